@@ -0,0 +1,689 @@
+package letters
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"io"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ARCChainValidation is the chain validation status of an Authenticated
+// Received Chain, as carried in the cv= tag of an ARC-Seal.
+type ARCChainValidation string
+
+// Chain validation statuses defined in RFC 8617 Section 4.4.
+const (
+	ARCChainValidationNone ARCChainValidation = "none"
+	ARCChainValidationPass ARCChainValidation = "pass"
+	ARCChainValidationFail ARCChainValidation = "fail"
+)
+
+const (
+	arcMaxInstance = 50
+
+	arcAuthenticationResultsHeader = "ARC-Authentication-Results"
+	arcMessageSignatureHeader      = "ARC-Message-Signature"
+	arcSealHeader                  = "ARC-Seal"
+)
+
+// ARCSet contains the three header fields that an ARC participant adds
+// to a message, as defined in RFC 8617 Section 4.1.
+type ARCSet struct {
+	Instance int
+
+	// AuthenticationResults is the ARC-Authentication-Results value
+	// without its leading "i=" tag, i.e. "authserv-id; results".
+	AuthenticationResults string
+
+	MessageSignature DomainKeySignature
+	Seal             DomainKeySignature
+}
+
+// ChainValidation returns the cv= tag of the ARC-Seal of the set.
+func (s ARCSet) ChainValidation() ARCChainValidation {
+	return ARCChainValidation(strings.ToLower(s.Seal.Tags["cv"]))
+}
+
+// ARCVerification contains the outcome of VerifyARC.
+type ARCVerification struct {
+	ChainValidation ARCChainValidation
+
+	// Sets contains the ARC sets of the message ordered by instance.
+	Sets []ARCSet
+
+	// OldestPass is the lowest instance whose ARC-Message-Signature still
+	// verifies, or 0 when the chain does not pass.
+	OldestPass int
+
+	// Reason describes why the chain failed.
+	Reason string
+}
+
+// ARCSealOptions configures SealARC.
+type ARCSealOptions struct {
+	Domain   string
+	Selector string
+	Signer   crypto.Signer
+
+	// AuthServID is the authserv-id of the ARC-Authentication-Results
+	// header field, usually the host name of the sealer.
+	AuthServID string
+
+	// AuthenticationResults are the results the sealer observed, in the
+	// resinfo syntax of RFC 8601, e.g.
+	// "spf=pass smtp.mailfrom=example.com; dkim=pass header.d=example.com".
+	AuthenticationResults string
+
+	// ChainValidation is the result of VerifyARC on the message as it
+	// was received.
+	ChainValidation ARCChainValidation
+
+	// SignedHeaders lists the header fields the ARC-Message-Signature
+	// covers. The default set is used when it is empty.
+	SignedHeaders []string
+
+	// Time is the signing time. The current time is used when it is zero.
+	Time time.Time
+}
+
+type rawARCSet struct {
+	instance              int
+	authenticationResults rawHeaderField
+	messageSignature      rawHeaderField
+	seal                  rawHeaderField
+	set                   ARCSet
+}
+
+// DefaultSignedHeaders returns the header fields that SealARC and SignDKIM
+// sign by default.
+func DefaultSignedHeaders() []string {
+	return []string{
+		"From",
+		"Reply-To",
+		"Subject",
+		"Date",
+		"To",
+		"Cc",
+		"Resent-Date",
+		"Resent-From",
+		"Resent-To",
+		"Resent-Cc",
+		"In-Reply-To",
+		"References",
+		"List-Id",
+		"List-Help",
+		"List-Unsubscribe",
+		"List-Subscribe",
+		"List-Post",
+		"List-Owner",
+		"List-Archive",
+		"Message-Id",
+		"MIME-Version",
+		"Content-Type",
+		"Content-Transfer-Encoding",
+	}
+}
+
+// ParseARCSets parses the ARC sets of an email from its ARC-Seal,
+// ARC-Message-Signature, and ARC-Authentication-Results headers and
+// returns them ordered by instance.
+//
+// ParseARCSets returns an error wrapping ErrInvalidARCChain when the
+// headers do not form complete sets numbered 1 to N.
+func ParseARCSets(headers Headers) ([]ARCSet, error) {
+	var fields []rawHeaderField
+
+	for _, name := range []string{
+		arcAuthenticationResultsHeader,
+		arcMessageSignatureHeader,
+		arcSealHeader,
+	} {
+		key := textproto.CanonicalMIMEHeaderKey(name)
+		for _, value := range headers.ExtraHeaders[key] {
+			fields = append(fields, rawHeaderField{
+				name: name,
+				raw:  name + ": " + value + "\r\n",
+			})
+		}
+	}
+
+	sets, err := groupARCSets(fields)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"letters.arc.ParseARCSets: cannot group ARC sets: %w",
+			err,
+		)
+	}
+
+	arcSets := make([]ARCSet, 0, len(sets))
+	for _, set := range sets {
+		arcSets = append(arcSets, set.set)
+	}
+
+	return arcSets, nil
+}
+
+func parseARCInstance(value string) (int, string, error) {
+	tag, rest, _ := strings.Cut(value, ";")
+
+	name, instance, ok := strings.Cut(tag, "=")
+	if !ok || strings.TrimSpace(name) != "i" {
+		return 0, "", fmt.Errorf(
+			"%w: missing i= tag in %q",
+			ErrInvalidARCChain,
+			strings.TrimSpace(value),
+		)
+	}
+
+	parsedInstance, err := strconv.Atoi(strings.TrimSpace(instance))
+	if err != nil || parsedInstance < 1 || parsedInstance > arcMaxInstance {
+		return 0, "", fmt.Errorf(
+			"%w: invalid instance %q",
+			ErrInvalidARCChain,
+			strings.TrimSpace(instance),
+		)
+	}
+
+	return parsedInstance, strings.TrimSpace(rest), nil
+}
+
+func groupARCSets(fields []rawHeaderField) ([]rawARCSet, error) {
+	setsByInstance := make(map[int]*rawARCSet)
+
+	for _, field := range fields {
+		isAAR := strings.EqualFold(field.name, arcAuthenticationResultsHeader)
+		isAMS := strings.EqualFold(field.name, arcMessageSignatureHeader)
+		isAS := strings.EqualFold(field.name, arcSealHeader)
+
+		if !isAAR && !isAMS && !isAS {
+			continue
+		}
+
+		value := field.value()
+
+		instance, rest, err := parseARCInstance(value)
+		if err != nil {
+			return nil, err
+		}
+
+		set, ok := setsByInstance[instance]
+		if !ok {
+			set = &rawARCSet{instance: instance}
+			set.set.Instance = instance
+			setsByInstance[instance] = set
+		}
+
+		var target *rawHeaderField
+
+		switch {
+		case isAAR:
+			target = &set.authenticationResults
+			set.set.AuthenticationResults = rest
+		case isAMS:
+			target = &set.messageSignature
+			set.set.MessageSignature, err = ParseDomainKeySignature(value)
+		default:
+			target = &set.seal
+			set.set.Seal, err = ParseDomainKeySignature(value)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf(
+				"%w: instance %d: %w",
+				ErrInvalidARCChain,
+				instance,
+				err,
+			)
+		}
+
+		if target.raw != "" {
+			return nil, fmt.Errorf(
+				"%w: duplicate %s for instance %d",
+				ErrInvalidARCChain,
+				field.name,
+				instance,
+			)
+		}
+
+		*target = field
+	}
+
+	sets := make([]rawARCSet, 0, len(setsByInstance))
+
+	for instance := 1; instance <= len(setsByInstance); instance++ {
+		set, ok := setsByInstance[instance]
+		if !ok {
+			return nil, fmt.Errorf(
+				"%w: missing instance %d",
+				ErrInvalidARCChain,
+				instance,
+			)
+		}
+
+		if set.authenticationResults.raw == "" ||
+			set.messageSignature.raw == "" ||
+			set.seal.raw == "" {
+			return nil, fmt.Errorf(
+				"%w: incomplete set for instance %d",
+				ErrInvalidARCChain,
+				instance,
+			)
+		}
+
+		sets = append(sets, *set)
+	}
+
+	return sets, nil
+}
+
+// VerifyARC validates the Authenticated Received Chain of a message read
+// from r, following RFC 8617 Section 5.2. Public keys are looked up with
+// resolver.
+//
+// A chain that fails validation is reported through ChainValidation and
+// Reason. An error is returned only when the message cannot be read or a
+// key lookup fails for reasons other than a missing key.
+func VerifyARC(
+	ctx context.Context,
+	resolver DomainKeyResolver,
+	r io.Reader,
+) (ARCVerification, error) {
+	verification := ARCVerification{
+		ChainValidation: ARCChainValidationNone,
+	}
+
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return verification, fmt.Errorf(
+			"letters.arc.VerifyARC: cannot read message: %w",
+			err,
+		)
+	}
+
+	fields, body, err := splitRawMessage(raw)
+	if err != nil {
+		return verification, fmt.Errorf(
+			"letters.arc.VerifyARC: cannot split message: %w",
+			err,
+		)
+	}
+
+	sets, err := groupARCSets(fields)
+	if err != nil {
+		return failARC(verification, err.Error()), nil
+	}
+
+	if len(sets) == 0 {
+		return verification, nil
+	}
+
+	for _, set := range sets {
+		verification.Sets = append(verification.Sets, set.set)
+	}
+
+	latest := sets[len(sets)-1]
+	if latest.set.ChainValidation() == ARCChainValidationFail {
+		return failARC(
+			verification,
+			fmt.Sprintf("instance %d sealed a failed chain", latest.instance),
+		), nil
+	}
+
+	for _, set := range sets {
+		expected := ARCChainValidationPass
+		if set.instance == 1 {
+			expected = ARCChainValidationNone
+		}
+
+		if set.set.ChainValidation() != expected {
+			return failARC(
+				verification,
+				fmt.Sprintf(
+					"instance %d has cv=%s, want cv=%s",
+					set.instance,
+					set.set.ChainValidation(),
+					expected,
+				),
+			), nil
+		}
+	}
+
+	verification.OldestPass = len(sets) + 1
+
+	for i := len(sets) - 1; i >= 0; i-- {
+		err := verifyMessageSignature(
+			ctx,
+			resolver,
+			fields,
+			body,
+			sets[i].messageSignature,
+			sets[i].set.MessageSignature,
+		)
+		if err != nil {
+			if isTransientKeyError(err) {
+				return failARC(verification, err.Error()), err
+			}
+
+			if i == len(sets)-1 {
+				return failARC(
+					verification,
+					fmt.Sprintf(
+						"ARC-Message-Signature of instance %d: %s",
+						sets[i].instance,
+						err,
+					),
+				), nil
+			}
+
+			break
+		}
+
+		verification.OldestPass = sets[i].instance
+	}
+
+	for i := len(sets) - 1; i >= 0; i-- {
+		err := verifyARCSeal(ctx, resolver, sets[:i+1])
+		if err != nil {
+			if isTransientKeyError(err) {
+				return failARC(verification, err.Error()), err
+			}
+
+			return failARC(
+				verification,
+				fmt.Sprintf(
+					"ARC-Seal of instance %d: %s",
+					sets[i].instance,
+					err,
+				),
+			), nil
+		}
+	}
+
+	verification.ChainValidation = ARCChainValidationPass
+
+	return verification, nil
+}
+
+func failARC(verification ARCVerification, reason string) ARCVerification {
+	verification.ChainValidation = ARCChainValidationFail
+	verification.OldestPass = 0
+	verification.Reason = reason
+
+	return verification
+}
+
+func isTransientKeyError(err error) bool {
+	return !isDNSNotFound(err) &&
+		!errorsIsAny(
+			err,
+			ErrNoDomainKey,
+			ErrInvalidDomainKey,
+			ErrSignatureMismatch,
+			ErrBodyHashMismatch,
+			ErrUnsupportedKeyType,
+			ErrUnsupportedSignatureAlgorithm,
+		)
+}
+
+// arcSealHash computes the hash an ARC-Seal signs: all ARC sets up to and
+// including the last one, in instance order, with the b= value of the last
+// ARC-Seal removed (RFC 8617 Section 5.1.1).
+func arcSealHash(sets []rawARCSet, hashAlgorithm crypto.Hash) []byte {
+	sealHasher := newHash(hashAlgorithm)
+
+	for i, set := range sets {
+		for _, field := range []rawHeaderField{
+			set.authenticationResults,
+			set.messageSignature,
+		} {
+			sealHasher.Write(
+				[]byte(canonicalizeHeader(field.raw, CanonicalizationRelaxed)),
+			)
+		}
+
+		if i < len(sets)-1 {
+			sealHasher.Write(
+				[]byte(canonicalizeHeader(set.seal.raw, CanonicalizationRelaxed)),
+			)
+
+			continue
+		}
+
+		sealHasher.Write([]byte(strings.TrimSuffix(
+			canonicalizeHeader(
+				removeSignatureValue(set.seal.raw),
+				CanonicalizationRelaxed,
+			),
+			"\r\n",
+		)))
+	}
+
+	return sealHasher.Sum(nil)
+}
+
+func verifyARCSeal(
+	ctx context.Context,
+	resolver DomainKeyResolver,
+	sets []rawARCSet,
+) error {
+	seal := sets[len(sets)-1].set.Seal
+
+	hashAlgorithm, err := hashForAlgorithm(seal.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	publicKey, err := resolver.LookupDomainKey(ctx, seal.Selector, seal.Domain)
+	if err != nil {
+		return fmt.Errorf(
+			"letters.arc.verifyARCSeal: "+
+				"cannot look up key %q for %q: %w",
+			seal.Selector,
+			seal.Domain,
+			err,
+		)
+	}
+
+	return verifyDigest(
+		publicKey,
+		seal.Algorithm,
+		hashAlgorithm,
+		arcSealHash(sets, hashAlgorithm),
+		seal.Signature,
+	)
+}
+
+// SealARC adds a new ARC set to a message read from r, as an ARC
+// intermediary does before forwarding a message (RFC 8617 Section 5.1).
+// It returns the message with the ARC-Seal, ARC-Message-Signature, and
+// ARC-Authentication-Results header fields prepended.
+//
+// Call VerifyARC on the message as received, before modifying it, and
+// pass its ChainValidation in options.
+func SealARC(r io.Reader, options ARCSealOptions) ([]byte, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"letters.arc.SealARC: cannot read message: %w",
+			err,
+		)
+	}
+
+	fields, body, err := splitRawMessage(raw)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"letters.arc.SealARC: cannot split message: %w",
+			err,
+		)
+	}
+
+	algorithm, err := algorithmForSigner(options.Signer)
+	if err != nil {
+		return nil, fmt.Errorf("letters.arc.SealARC: %w", err)
+	}
+
+	// A broken chain can still be sealed with cv=fail, so the new instance
+	// follows the highest instance present rather than the complete sets.
+	sets, err := groupARCSets(fields)
+	if err != nil && options.ChainValidation != ARCChainValidationFail {
+		return nil, fmt.Errorf(
+			"letters.arc.SealARC: cannot group existing ARC sets: %w",
+			err,
+		)
+	}
+
+	instance := highestARCInstance(fields) + 1
+	if instance > arcMaxInstance {
+		return nil, fmt.Errorf(
+			"letters.arc.SealARC: %w: chain already has %d sets",
+			ErrInvalidARCChain,
+			instance-1,
+		)
+	}
+
+	chainValidation := options.ChainValidation
+	if instance == 1 {
+		chainValidation = ARCChainValidationNone
+	} else if chainValidation == "" ||
+		chainValidation == ARCChainValidationNone {
+		return nil, fmt.Errorf(
+			"letters.arc.SealARC: %w: cv=%q for instance %d",
+			ErrInvalidARCChain,
+			chainValidation,
+			instance,
+		)
+	}
+
+	signingTime := options.Time
+	if signingTime.IsZero() {
+		signingTime = time.Now()
+	}
+
+	timestamp := strconv.FormatInt(signingTime.Unix(), 10)
+	instanceTag := strconv.Itoa(instance)
+
+	results := strings.TrimSpace(options.AuthenticationResults)
+	if results == "" {
+		results = "none"
+	}
+
+	newSet := rawARCSet{instance: instance}
+	newSet.authenticationResults = rawHeaderField{
+		name: arcAuthenticationResultsHeader,
+		raw: arcAuthenticationResultsHeader + ": i=" + instanceTag + "; " +
+			options.AuthServID + "; " + results + "\r\n",
+	}
+
+	signedHeaders := options.SignedHeaders
+	if len(signedHeaders) == 0 {
+		signedHeaders = presentHeaders(fields, DefaultSignedHeaders())
+	}
+
+	messageSignature, err := signMessage(fields, body, messageSigningParams{
+		headerName:             arcMessageSignatureHeader,
+		signer:                 options.Signer,
+		algorithm:              algorithm,
+		headerCanonicalization: CanonicalizationRelaxed,
+		bodyCanonicalization:   CanonicalizationRelaxed,
+		signedHeaders:          signedHeaders,
+		bodyLength:             -1,
+		tags: [][2]string{
+			{"i", instanceTag},
+			{"a", algorithm},
+			{"c", CanonicalizationRelaxed + "/" + CanonicalizationRelaxed},
+			{"d", options.Domain},
+			{"s", options.Selector},
+			{"t", timestamp},
+			{"h", strings.ToLower(strings.Join(signedHeaders, ":"))},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf(
+			"letters.arc.SealARC: cannot sign ARC-Message-Signature: %w",
+			err,
+		)
+	}
+
+	newSet.messageSignature = rawHeaderField{
+		name: arcMessageSignatureHeader,
+		raw:  messageSignature,
+	}
+
+	sealField := formatSignatureField(arcSealHeader, [][2]string{
+		{"i", instanceTag},
+		{"a", algorithm},
+		{"t", timestamp},
+		{"cv", string(chainValidation)},
+		{"d", options.Domain},
+		{"s", options.Selector},
+		{"b", ""},
+	})
+	newSet.seal = rawHeaderField{name: arcSealHeader, raw: sealField + "\r\n"}
+
+	// RFC 8617 Section 5.1.1: a sealer that found a failed chain signs
+	// only its own set.
+	sealedSets := slices.Clone(sets)
+	if chainValidation == ARCChainValidationFail {
+		sealedSets = nil
+	}
+
+	sealedSets = append(sealedSets, newSet)
+
+	sealSignature, err := signDigest(
+		options.Signer,
+		algorithm,
+		arcSealHash(sealedSets, crypto.SHA256),
+	)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"letters.arc.SealARC: cannot sign ARC-Seal: %w",
+			err,
+		)
+	}
+
+	return prependHeaderFields(
+		raw,
+		appendSignatureValue(sealField, sealSignature),
+		newSet.messageSignature.raw,
+		newSet.authenticationResults.raw,
+	), nil
+}
+
+func highestARCInstance(fields []rawHeaderField) int {
+	highest := 0
+
+	for _, field := range fields {
+		if !strings.EqualFold(field.name, arcSealHeader) {
+			continue
+		}
+
+		instance, _, err := parseARCInstance(field.value())
+		if err == nil && instance > highest {
+			highest = instance
+		}
+	}
+
+	return highest
+}
+
+// presentHeaders returns the names in names that occur in fields.
+func presentHeaders(fields []rawHeaderField, names []string) []string {
+	var present []string
+
+	for _, name := range names {
+		for _, field := range fields {
+			if strings.EqualFold(field.name, name) {
+				present = append(present, name)
+
+				break
+			}
+		}
+	}
+
+	return present
+}
@@ -0,0 +1,412 @@
+package letters_test
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mnako/letters"
+)
+
+const arcTestMessage = "From: Alice Sender <alice@example.com>\r\n" +
+	"To: list@lists.example.org\r\n" +
+	"Subject: Test ARC\r\n" +
+	"Date: Mon, 1 Apr 2019 07:55:00 +0100\r\n" +
+	"Message-ID: <Message-Id-1@example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"The quick brown fox jumps over the lazy dog.\r\n"
+
+type fakeDomainKeyResolver map[string]crypto.PublicKey
+
+func (r fakeDomainKeyResolver) LookupDomainKey(
+	_ context.Context,
+	selector string,
+	domain string,
+) (crypto.PublicKey, error) {
+	publicKey, ok := r[selector+"._domainkey."+domain]
+	if !ok {
+		return nil, letters.ErrNoDomainKey
+	}
+
+	return publicKey, nil
+}
+
+func newTestSigners(t *testing.T) (*rsa.PrivateKey, ed25519.PrivateKey) {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("cannot generate RSA key: %s", err)
+	}
+
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("cannot generate Ed25519 key: %s", err)
+	}
+
+	return rsaKey, ed25519Key
+}
+
+func sealTestMessage(
+	t *testing.T,
+	message []byte,
+	signer crypto.Signer,
+	domain string,
+	chainValidation letters.ARCChainValidation,
+) []byte {
+	t.Helper()
+
+	sealed, err := letters.SealARC(
+		bytes.NewReader(message),
+		letters.ARCSealOptions{
+			Domain:                domain,
+			Selector:              "arc",
+			Signer:                signer,
+			AuthServID:            domain,
+			AuthenticationResults: "spf=pass smtp.mailfrom=example.com",
+			ChainValidation:       chainValidation,
+			Time:                  time.Unix(1554101700, 0),
+		},
+	)
+	if err != nil {
+		t.Fatalf("cannot seal message: %s", err)
+	}
+
+	return sealed
+}
+
+func TestSealAndVerifyARC(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, ed25519Key := newTestSigners(t)
+	resolver := fakeDomainKeyResolver{
+		"arc._domainkey.lists.example.org": rsaKey.Public(),
+		"arc._domainkey.forwarder.example": ed25519Key.Public(),
+	}
+
+	firstHop := sealTestMessage(
+		t,
+		[]byte(arcTestMessage),
+		rsaKey,
+		"lists.example.org",
+		letters.ARCChainValidationNone,
+	)
+
+	verification, err := letters.VerifyARC(
+		context.Background(),
+		resolver,
+		bytes.NewReader(firstHop),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if verification.ChainValidation != letters.ARCChainValidationPass {
+		t.Fatalf("expected pass, got %#v", verification)
+	}
+
+	// The forwarder rewrites the subject, which breaks the first
+	// ARC-Message-Signature but not the chain of seals.
+	rewritten := bytes.Replace(
+		firstHop,
+		[]byte("Subject: Test ARC"),
+		[]byte("Subject: [list] Test ARC"),
+		1,
+	)
+	secondHop := sealTestMessage(
+		t,
+		rewritten,
+		ed25519Key,
+		"forwarder.example",
+		verification.ChainValidation,
+	)
+
+	verification, err = letters.VerifyARC(
+		context.Background(),
+		resolver,
+		bytes.NewReader(secondHop),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if verification.ChainValidation != letters.ARCChainValidationPass {
+		t.Fatalf("expected pass, got %#v", verification)
+	}
+
+	if verification.OldestPass != 2 {
+		t.Errorf("unexpected oldest pass: got %d", verification.OldestPass)
+	}
+
+	if len(verification.Sets) != 2 ||
+		verification.Sets[1].Seal.Domain != "forwarder.example" ||
+		verification.Sets[1].ChainValidation() !=
+			letters.ARCChainValidationPass {
+		t.Errorf("unexpected sets: %#v", verification.Sets)
+	}
+
+	tampered := bytes.Replace(
+		secondHop,
+		[]byte("lazy dog"),
+		[]byte("lazy cat"),
+		1,
+	)
+
+	verification, err = letters.VerifyARC(
+		context.Background(),
+		resolver,
+		bytes.NewReader(tampered),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if verification.ChainValidation != letters.ARCChainValidationFail {
+		t.Errorf("expected fail, got %#v", verification)
+	}
+}
+
+func TestVerifyARCTwoHops(t *testing.T) {
+	t.Parallel()
+
+	// The chain was sealed by an implementation of RFC 8617 written
+	// independently of letters, with RSA signatures made by OpenSSL.
+	data, err := os.ReadFile("tests/test_english_arc_two_hops.txt")
+	if err != nil {
+		t.Fatalf("cannot read test file: %s", err)
+	}
+
+	publicKey, err := letters.ParseDomainKeyRecord(
+		"v=DKIM1; k=rsa; p=" +
+			"MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAzKAGhxySiVrqtr7a" +
+			"u8W8/c7d1VdjomeAxizPiA2ZwSiCQqFzDCRA8xCWQl5MQwzFSykSGxYyGal5" +
+			"xCfzYf9rY5B9Wt4rfXN2VuMBLyLOZ+VUaXL1yyb1GeyzlTB9TTRyj8/Ju/BB" +
+			"Z74jpbYgFl3RfQtKdOcL5tnVZN5bfxxaMepR0e1ckTFZ+50aivfqI5pTlEye" +
+			"9p2TaZg06Op6/dmP8HRiVfxcKd7MqvoFrd6tJ5C+x/mjhev6max0KKhWCnRf" +
+			"yCf50vI9ItHPkkBnE4apIedfTMT8M65/ShGIH/EoYqSLbO9eJdQjdvVz0Gde" +
+			"eK13iixJgi+Dci47YGWYUZzIhwIDAQAB",
+	)
+	if err != nil {
+		t.Fatalf("cannot parse key: %s", err)
+	}
+
+	resolver := fakeDomainKeyResolver{
+		"arc._domainkey.lists.example.org": publicKey,
+		"arc._domainkey.mx.example.net":    publicKey,
+	}
+
+	testCases := []struct {
+		name               string
+		old                string
+		new                string
+		expected           letters.ARCChainValidation
+		expectedOldestPass int
+	}{
+		{
+			name:               "unchanged",
+			old:                "",
+			new:                "",
+			expected:           letters.ARCChainValidationPass,
+			expectedOldestPass: 1,
+		},
+		{
+			name:               "changed body",
+			old:                "lazy dog",
+			new:                "lazy cat",
+			expected:           letters.ARCChainValidationFail,
+			expectedOldestPass: 0,
+		},
+		{
+			name:               "changed authentication results",
+			old:                "spf=pass",
+			new:                "spf=none",
+			expected:           letters.ARCChainValidationFail,
+			expectedOldestPass: 0,
+		},
+		{
+			name:               "changed chain validation",
+			old:                "cv=pass",
+			new:                "cv=none",
+			expected:           letters.ARCChainValidationFail,
+			expectedOldestPass: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			message := bytes.Replace(
+				data,
+				[]byte(testCase.old),
+				[]byte(testCase.new),
+				1,
+			)
+
+			verification, err := letters.VerifyARC(
+				context.Background(),
+				resolver,
+				bytes.NewReader(message),
+			)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if verification.ChainValidation != testCase.expected ||
+				verification.OldestPass != testCase.expectedOldestPass {
+				t.Errorf("unexpected verification: %#v", verification)
+			}
+		})
+	}
+}
+
+func TestVerifyARCNoChain(t *testing.T) {
+	t.Parallel()
+
+	verification, err := letters.VerifyARC(
+		context.Background(),
+		fakeDomainKeyResolver{},
+		strings.NewReader(arcTestMessage),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if verification.ChainValidation != letters.ARCChainValidationNone {
+		t.Errorf("expected none, got %q", verification.ChainValidation)
+	}
+}
+
+func TestVerifyARCBrokenStructure(t *testing.T) {
+	t.Parallel()
+
+	message := "ARC-Seal: i=2; a=rsa-sha256; cv=pass; d=example.org; " +
+		"s=arc; b=AAAA\r\n" + arcTestMessage
+
+	verification, err := letters.VerifyARC(
+		context.Background(),
+		fakeDomainKeyResolver{},
+		strings.NewReader(message),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if verification.ChainValidation != letters.ARCChainValidationFail {
+		t.Errorf("expected fail, got %q", verification.ChainValidation)
+	}
+}
+
+func TestParseARCSets(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, _ := newTestSigners(t)
+
+	sealed := sealTestMessage(
+		t,
+		[]byte(arcTestMessage),
+		rsaKey,
+		"lists.example.org",
+		letters.ARCChainValidationNone,
+	)
+
+	email, err := letters.ParseEmail(bytes.NewReader(sealed))
+	if err != nil {
+		t.Fatalf("cannot parse email: %s", err)
+	}
+
+	sets, err := letters.ParseARCSets(email.Headers)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(sets) != 1 {
+		t.Fatalf("expected one set, got %d", len(sets))
+	}
+
+	set := sets[0]
+	if set.Instance != 1 ||
+		set.AuthenticationResults !=
+			"lists.example.org; spf=pass smtp.mailfrom=example.com" ||
+		set.MessageSignature.Domain != "lists.example.org" ||
+		set.MessageSignature.Algorithm != letters.SignatureAlgorithmRSASHA256 ||
+		set.ChainValidation() != letters.ARCChainValidationNone {
+		t.Errorf("unexpected set: %#v", set)
+	}
+}
+
+func TestTXTDomainKeyResolver(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, ed25519Key := newTestSigners(t)
+
+	rsaPublicKey, err := x509.MarshalPKIXPublicKey(rsaKey.Public())
+	if err != nil {
+		t.Fatalf("cannot marshal RSA key: %s", err)
+	}
+
+	resolver := letters.TXTDomainKeyResolver{
+		Resolver: fakeDNSResolver{
+			txt: map[string][]string{
+				"rsa._domainkey.example.com": {
+					"v=DKIM1; k=rsa; p=" +
+						base64.StdEncoding.EncodeToString(rsaPublicKey),
+				},
+				"ed._domainkey.example.com": {
+					"v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(
+						ed25519Key.Public().(ed25519.PublicKey),
+					),
+				},
+				"revoked._domainkey.example.com": {"v=DKIM1; p="},
+			},
+		},
+	}
+
+	publicKey, err := resolver.LookupDomainKey(
+		context.Background(),
+		"rsa",
+		"example.com",
+	)
+	if err != nil || !rsaKey.PublicKey.Equal(publicKey) {
+		t.Errorf("unexpected RSA key lookup: %v, %v", publicKey, err)
+	}
+
+	publicKey, err = resolver.LookupDomainKey(
+		context.Background(),
+		"ed",
+		"example.com",
+	)
+	if err != nil || !ed25519Key.Public().(ed25519.PublicKey).Equal(publicKey) {
+		t.Errorf("unexpected Ed25519 key lookup: %v, %v", publicKey, err)
+	}
+
+	_, err = resolver.LookupDomainKey(
+		context.Background(),
+		"revoked",
+		"example.com",
+	)
+	if err == nil {
+		t.Errorf("expected an error for a revoked key")
+	}
+
+	_, err = resolver.LookupDomainKey(
+		context.Background(),
+		"missing",
+		"example.com",
+	)
+	if err == nil {
+		t.Errorf("expected an error for a missing key")
+	}
+}
@@ -0,0 +1,468 @@
+package letters
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strings"
+)
+
+// Defaults of ArchiveInspectOptions.
+const (
+	DefaultArchiveMaxDepth          = 3
+	DefaultArchiveMaxEntries        = 1000
+	DefaultArchiveMaxExpansionRatio = 100
+	DefaultArchiveMaxSize           = 100 << 20
+)
+
+// archiveMinEntryLimit is the size up to which an entry is never reported
+// as exceeding the expansion ratio, because small files of repetitive text
+// compress very well without being a threat.
+const archiveMinEntryLimit = 1 << 20
+
+// zipFlagEncrypted is the general purpose bit flag of encrypted zip
+// entries.
+const zipFlagEncrypted = 0x1
+
+// ArchiveFormat is the format of an archive.
+type ArchiveFormat string
+
+// Formats supported by InspectArchive.
+const (
+	ArchiveFormatZip     ArchiveFormat = "zip"
+	ArchiveFormatTar     ArchiveFormat = "tar"
+	ArchiveFormatTarGzip ArchiveFormat = "tar.gz"
+	ArchiveFormatGzip    ArchiveFormat = "gzip"
+)
+
+// ArchiveLimit is a limit of ArchiveInspectOptions that an archive exceeded.
+type ArchiveLimit string
+
+// Limits reported by InspectArchive.
+const (
+	ArchiveLimitDepth          ArchiveLimit = "depth"
+	ArchiveLimitEntries        ArchiveLimit = "entries"
+	ArchiveLimitExpansionRatio ArchiveLimit = "expansion ratio"
+	ArchiveLimitSize           ArchiveLimit = "size"
+)
+
+// ArchiveInspectOptions configures InspectArchive. Zero values select the
+// defaults.
+type ArchiveInspectOptions struct {
+	// Extract reads the content of the entries into ArchiveEntry.File and
+	// inspects entries that are archives themselves.
+	Extract bool
+
+	// MaxDepth is the number of nested archives that are inspected below
+	// the outermost one. It defaults to DefaultArchiveMaxDepth.
+	MaxDepth int
+
+	// MaxEntries is the number of entries, including nested ones, after
+	// which the inspection stops. It defaults to DefaultArchiveMaxEntries.
+	MaxEntries int
+
+	// MaxExpansionRatio is the largest ratio of decompressed to compressed
+	// size of an entry, and of all decompressed data to the size of the
+	// outermost archive. It defaults to DefaultArchiveMaxExpansionRatio.
+	MaxExpansionRatio float64
+
+	// MaxSize is the number of bytes that may be decompressed in total. It
+	// defaults to DefaultArchiveMaxSize.
+	MaxSize int64
+}
+
+// ArchiveEntry is a file or directory in an archive.
+type ArchiveEntry struct {
+	// Path lists the names of the nested archives that contain the entry,
+	// from the outermost one, followed by Name.
+	Path []string
+
+	// Name is the name of the entry in its archive.
+	Name string
+
+	// Size is the decompressed size and CompressedSize the size in the
+	// archive, or 0 when the format does not record it. For zip archives
+	// both are the sizes the archive declares.
+	Size           int64
+	CompressedSize int64
+
+	// CompressionRatio is Size divided by CompressedSize, or 0 when the
+	// compressed size is unknown.
+	CompressionRatio float64
+
+	IsDir     bool
+	Encrypted bool
+
+	// File is the extracted entry, with its detected media type and its
+	// name as the filename parameter. It is nil unless
+	// ArchiveInspectOptions.Extract is set, and for directories,
+	// encrypted entries and entries that could not be read.
+	File *AttachedFile
+}
+
+// ArchiveInspection is the result of InspectArchive.
+type ArchiveInspection struct {
+	Format ArchiveFormat
+
+	// Entries lists the entries in archive order, each nested archive
+	// followed by its own entries.
+	Entries []ArchiveEntry
+
+	// LimitsExceeded lists the limits the archive exceeded. The inspection
+	// stops at the entries, expansion ratio and size limits; nested
+	// archives beyond the depth limit are listed but not inspected.
+	LimitsExceeded []ArchiveLimit
+}
+
+type archiveInspector struct {
+	options    ArchiveInspectOptions
+	inspection ArchiveInspection
+
+	// budget is the number of bytes that may still be decompressed.
+	budget  int64
+	stopped bool
+}
+
+// InspectArchive inspects the attached file with InspectArchive.
+func (f AttachedFile) InspectArchive(
+	options ArchiveInspectOptions,
+) (ArchiveInspection, error) {
+	return InspectArchive(f.Data, options)
+}
+
+// InspectArchive lists the entries of a zip, tar, tar.gz or gzip archive
+// with their sizes and compression ratios and flags encrypted entries.
+// With options.Extract, it also extracts the entries and inspects nested
+// archives recursively.
+//
+// Decompression is bounded by the depth, entry count, expansion ratio and
+// size limits of options, so that zip bombs are reported in
+// ArchiveInspection.LimitsExceeded instead of exhausting memory.
+//
+// It returns an error wrapping ErrUnsupportedArchive when data is not an
+// archive in one of the supported formats.
+func InspectArchive(
+	data []byte,
+	options ArchiveInspectOptions,
+) (ArchiveInspection, error) {
+	if options.MaxDepth <= 0 {
+		options.MaxDepth = DefaultArchiveMaxDepth
+	}
+
+	if options.MaxEntries <= 0 {
+		options.MaxEntries = DefaultArchiveMaxEntries
+	}
+
+	if options.MaxExpansionRatio <= 0 {
+		options.MaxExpansionRatio = DefaultArchiveMaxExpansionRatio
+	}
+
+	if options.MaxSize <= 0 {
+		options.MaxSize = DefaultArchiveMaxSize
+	}
+
+	inspector := archiveInspector{
+		options: options,
+		inspection: ArchiveInspection{
+			Format:         "",
+			Entries:        nil,
+			LimitsExceeded: nil,
+		},
+		budget: min(
+			options.MaxSize,
+			int64(float64(max(len(data), 1))*options.MaxExpansionRatio),
+		),
+		stopped: false,
+	}
+
+	format, err := inspector.inspect(data, nil)
+	if err != nil {
+		return inspector.inspection, fmt.Errorf(
+			"letters.archive.InspectArchive: %w",
+			err,
+		)
+	}
+
+	inspector.inspection.Format = format
+
+	return inspector.inspection, nil
+}
+
+func (a *archiveInspector) exceed(limit ArchiveLimit) {
+	for _, exceeded := range a.inspection.LimitsExceeded {
+		if exceeded == limit {
+			return
+		}
+	}
+
+	a.inspection.LimitsExceeded = append(a.inspection.LimitsExceeded, limit)
+}
+
+func (a *archiveInspector) stop(limit ArchiveLimit) {
+	a.exceed(limit)
+	a.stopped = true
+}
+
+// inspect adds the entries of an archive at a nesting path and returns its
+// format.
+func (a *archiveInspector) inspect(
+	data []byte,
+	archivePath []string,
+) (ArchiveFormat, error) {
+	mediaType := DetectContentType(data)
+
+	switch {
+	case mediaType == "application/zip" || isZipBasedContentType(mediaType):
+		return ArchiveFormatZip, a.inspectZip(data, archivePath)
+	case mediaType == "application/x-tar":
+		return ArchiveFormatTar, a.inspectTar(data, archivePath)
+	case mediaType == "application/gzip":
+		return a.inspectGzip(data, archivePath)
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedArchive, mediaType)
+	}
+}
+
+func (a *archiveInspector) inspectZip(
+	data []byte,
+	archivePath []string,
+) error {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return fmt.Errorf("cannot read zip archive: %w", err)
+	}
+
+	for _, file := range reader.File {
+		if a.stopped {
+			return nil
+		}
+
+		entry := newArchiveEntry(
+			archivePath,
+			file.Name,
+			int64(min(file.UncompressedSize64, math.MaxInt64)),
+			int64(min(file.CompressedSize64, math.MaxInt64)),
+		)
+		entry.IsDir = file.FileInfo().IsDir()
+		entry.Encrypted = file.Flags&zipFlagEncrypted != 0
+
+		if !a.options.Extract || entry.IsDir || entry.Encrypted {
+			a.addEntry(entry, nil)
+
+			continue
+		}
+
+		content, err := file.Open()
+		if err != nil {
+			a.addEntry(entry, nil)
+
+			continue
+		}
+
+		entryData, ok := a.read(content, entry.CompressedSize)
+		closeErr := content.Close()
+
+		if !ok || closeErr != nil {
+			a.addEntry(entry, nil)
+
+			continue
+		}
+
+		a.addEntry(entry, entryData)
+	}
+
+	return nil
+}
+
+func (a *archiveInspector) inspectTar(
+	data []byte,
+	archivePath []string,
+) error {
+	reader := tar.NewReader(bytes.NewReader(data))
+
+	for !a.stopped {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("cannot read tar archive: %w", err)
+		}
+
+		entry := newArchiveEntry(archivePath, header.Name, header.Size, 0)
+		entry.IsDir = header.Typeflag == tar.TypeDir
+
+		if !a.options.Extract || header.Typeflag != tar.TypeReg {
+			a.addEntry(entry, nil)
+
+			continue
+		}
+
+		// The tar archive is already decompressed, so reading its entries
+		// is not counted against the limits again.
+		entryData, err := io.ReadAll(reader)
+		if err != nil {
+			a.addEntry(entry, nil)
+
+			continue
+		}
+
+		a.addEntry(entry, entryData)
+	}
+
+	return nil
+}
+
+func (a *archiveInspector) inspectGzip(
+	data []byte,
+	archivePath []string,
+) (ArchiveFormat, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return ArchiveFormatGzip, fmt.Errorf(
+			"cannot read gzip archive: %w",
+			err,
+		)
+	}
+
+	name := reader.Name
+
+	decompressed, ok := a.read(reader, int64(len(data)))
+	if !ok {
+		return ArchiveFormatGzip, nil
+	}
+
+	if DetectContentType(decompressed) == "application/x-tar" {
+		return ArchiveFormatTarGzip, a.inspectTar(decompressed, archivePath)
+	}
+
+	if name == "" && len(archivePath) > 0 {
+		archiveName := archivePath[len(archivePath)-1]
+		name = strings.TrimSuffix(archiveName, path.Ext(archiveName))
+	}
+
+	entry := newArchiveEntry(
+		archivePath,
+		name,
+		int64(len(decompressed)),
+		int64(len(data)),
+	)
+
+	if !a.options.Extract {
+		decompressed = nil
+	}
+
+	a.addEntry(entry, decompressed)
+
+	return ArchiveFormatGzip, nil
+}
+
+// read decompresses an entry, stopping the inspection when it exceeds the
+// remaining size budget or the expansion ratio of its compressed size.
+func (a *archiveInspector) read(
+	r io.Reader,
+	compressedSize int64,
+) ([]byte, bool) {
+	ratioLimit := max(
+		int64(float64(compressedSize)*a.options.MaxExpansionRatio),
+		archiveMinEntryLimit,
+	)
+	limit := min(a.budget, ratioLimit)
+
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	a.budget -= int64(len(data))
+
+	if int64(len(data)) > limit {
+		if limit == ratioLimit {
+			a.stop(ArchiveLimitExpansionRatio)
+		} else {
+			a.stop(ArchiveLimitSize)
+		}
+
+		return nil, false
+	}
+
+	return data, err == nil
+}
+
+func newArchiveEntry(
+	archivePath []string,
+	name string,
+	size int64,
+	compressedSize int64,
+) ArchiveEntry {
+	entry := ArchiveEntry{
+		Path:             append(append([]string{}, archivePath...), name),
+		Name:             name,
+		Size:             size,
+		CompressedSize:   compressedSize,
+		CompressionRatio: 0,
+		IsDir:            false,
+		Encrypted:        false,
+		File:             nil,
+	}
+
+	if compressedSize > 0 {
+		entry.CompressionRatio = float64(size) / float64(compressedSize)
+	}
+
+	return entry
+}
+
+// addEntry adds an entry with its extracted data, if any, and inspects it
+// when it is a nested archive.
+func (a *archiveInspector) addEntry(entry ArchiveEntry, data []byte) {
+	if len(a.inspection.Entries) >= a.options.MaxEntries {
+		a.stop(ArchiveLimitEntries)
+
+		return
+	}
+
+	if data != nil {
+		entry.File = &AttachedFile{
+			ContentType: ContentTypeHeader{
+				ContentType: DetectContentType(data),
+				Params:      map[string]string{},
+			},
+			ContentDisposition: ContentDispositionHeader{
+				ContentDisposition: ContentDispositionAttachment,
+				Params: map[string]string{
+					"filename": path.Base(entry.Name),
+				},
+			},
+			Data: data,
+		}
+	}
+
+	a.inspection.Entries = append(a.inspection.Entries, entry)
+
+	if data == nil ||
+		!isArchiveContentType(entry.File.ContentType.ContentType) {
+		return
+	}
+
+	if len(entry.Path) > a.options.MaxDepth {
+		a.exceed(ArchiveLimitDepth)
+
+		return
+	}
+
+	// Nested archives that cannot be read are listed without entries.
+	_, _ = a.inspect(data, entry.Path)
+}
+
+func isArchiveContentType(mediaType string) bool {
+	switch mediaType {
+	case "application/zip", "application/x-tar", "application/gzip":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,334 @@
+package letters_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mnako/letters"
+)
+
+func tarTestData(t *testing.T, name string, content string) []byte {
+	t.Helper()
+
+	var b bytes.Buffer
+
+	writer := tar.NewWriter(&b)
+
+	err := writer.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0o644,
+		Size:     int64(len(content)),
+	})
+	if err != nil {
+		t.Fatalf("cannot write tar header: %s", err)
+	}
+
+	_, err = writer.Write([]byte(content))
+	if err != nil {
+		t.Fatalf("cannot write tar entry: %s", err)
+	}
+
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("cannot close tar: %s", err)
+	}
+
+	return b.Bytes()
+}
+
+func gzipTestData(t *testing.T, name string, data []byte) []byte {
+	t.Helper()
+
+	var b bytes.Buffer
+
+	writer := gzip.NewWriter(&b)
+	writer.Name = name
+
+	_, err := writer.Write(data)
+	if err != nil {
+		t.Fatalf("cannot write gzip: %s", err)
+	}
+
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("cannot close gzip: %s", err)
+	}
+
+	return b.Bytes()
+}
+
+func encryptedZipTestData(t *testing.T) []byte {
+	t.Helper()
+
+	var b bytes.Buffer
+
+	writer := zip.NewWriter(&b)
+
+	file, err := writer.CreateHeader(&zip.FileHeader{
+		Name:   "secret.exe",
+		Method: zip.Store,
+		Flags:  0x1,
+	})
+	if err != nil {
+		t.Fatalf("cannot create zip entry: %s", err)
+	}
+
+	_, err = file.Write([]byte("\x00\x01\x02\x03"))
+	if err != nil {
+		t.Fatalf("cannot write zip entry: %s", err)
+	}
+
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("cannot close zip: %s", err)
+	}
+
+	return b.Bytes()
+}
+
+func TestInspectArchive(t *testing.T) {
+	t.Parallel()
+
+	executable := "MZ\x90\x00" + strings.Repeat("\x00", 64)
+	innerZip := zipTestData(t, map[string]string{"payload.exe": executable})
+	bomb := zipTestData(t, map[string]string{
+		"zeros.bin": strings.Repeat("\x00", 16<<20),
+	})
+
+	testCases := []struct {
+		name           string
+		data           []byte
+		options        letters.ArchiveInspectOptions
+		expectedFormat letters.ArchiveFormat
+		expectedPaths  [][]string
+		expectedTypes  []string
+		expectedLimits []letters.ArchiveLimit
+	}{
+		{
+			name: "zip listing",
+			data: zipTestData(t, map[string]string{
+				"invoice.exe": executable,
+			}),
+			options:        letters.ArchiveInspectOptions{},
+			expectedFormat: letters.ArchiveFormatZip,
+			expectedPaths:  [][]string{{"invoice.exe"}},
+			expectedTypes:  []string{""},
+			expectedLimits: nil,
+		},
+		{
+			name: "nested zip",
+			data: zipTestData(t, map[string]string{
+				"documents.zip": string(innerZip),
+			}),
+			options:        letters.ArchiveInspectOptions{Extract: true},
+			expectedFormat: letters.ArchiveFormatZip,
+			expectedPaths: [][]string{
+				{"documents.zip"},
+				{"documents.zip", "payload.exe"},
+			},
+			expectedTypes: []string{
+				"application/zip",
+				"application/vnd.microsoft.portable-executable",
+			},
+			expectedLimits: nil,
+		},
+		{
+			name: "nested zip beyond the depth limit",
+			data: zipTestData(t, map[string]string{
+				"outer.zip": string(zipTestData(t, map[string]string{
+					"documents.zip": string(innerZip),
+				})),
+			}),
+			options: letters.ArchiveInspectOptions{
+				Extract:  true,
+				MaxDepth: 1,
+			},
+			expectedFormat: letters.ArchiveFormatZip,
+			expectedPaths: [][]string{
+				{"outer.zip"},
+				{"outer.zip", "documents.zip"},
+			},
+			expectedTypes:  []string{"application/zip", "application/zip"},
+			expectedLimits: []letters.ArchiveLimit{letters.ArchiveLimitDepth},
+		},
+		{
+			name:           "encrypted zip entry",
+			data:           encryptedZipTestData(t),
+			options:        letters.ArchiveInspectOptions{Extract: true},
+			expectedFormat: letters.ArchiveFormatZip,
+			expectedPaths:  [][]string{{"secret.exe"}},
+			expectedTypes:  []string{""},
+			expectedLimits: nil,
+		},
+		{
+			name: "tar.gz",
+			data: gzipTestData(
+				t,
+				"",
+				tarTestData(t, "bin/run.exe", executable),
+			),
+			options:        letters.ArchiveInspectOptions{Extract: true},
+			expectedFormat: letters.ArchiveFormatTarGzip,
+			expectedPaths:  [][]string{{"bin/run.exe"}},
+			expectedTypes: []string{
+				"application/vnd.microsoft.portable-executable",
+			},
+			expectedLimits: nil,
+		},
+		{
+			name: "gzip",
+			data: gzipTestData(t, "report.pdf", []byte("%PDF-1.7\n")),
+			options: letters.ArchiveInspectOptions{
+				Extract: true,
+			},
+			expectedFormat: letters.ArchiveFormatGzip,
+			expectedPaths:  [][]string{{"report.pdf"}},
+			expectedTypes:  []string{"application/pdf"},
+			expectedLimits: nil,
+		},
+		{
+			name:           "zip bomb",
+			data:           bomb,
+			options:        letters.ArchiveInspectOptions{Extract: true},
+			expectedFormat: letters.ArchiveFormatZip,
+			expectedPaths:  [][]string{{"zeros.bin"}},
+			expectedTypes:  []string{""},
+			expectedLimits: []letters.ArchiveLimit{
+				letters.ArchiveLimitExpansionRatio,
+			},
+		},
+		{
+			name: "entry limit",
+			data: zipTestData(t, map[string]string{
+				"a.txt": "a",
+				"b.txt": "b",
+				"c.txt": "c",
+			}),
+			options:        letters.ArchiveInspectOptions{MaxEntries: 2},
+			expectedFormat: letters.ArchiveFormatZip,
+			expectedPaths:  nil,
+			expectedTypes:  []string{"", ""},
+			expectedLimits: []letters.ArchiveLimit{letters.ArchiveLimitEntries},
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			inspection, err := letters.InspectArchive(
+				testCase.data,
+				testCase.options,
+			)
+			if err != nil {
+				t.Fatalf("cannot inspect archive: %s", err)
+			}
+
+			if inspection.Format != testCase.expectedFormat {
+				t.Errorf(
+					"unexpected format: got %q, expected %q",
+					inspection.Format,
+					testCase.expectedFormat,
+				)
+			}
+
+			if !reflect.DeepEqual(
+				inspection.LimitsExceeded,
+				testCase.expectedLimits,
+			) {
+				t.Errorf(
+					"unexpected limits: got %v, expected %v",
+					inspection.LimitsExceeded,
+					testCase.expectedLimits,
+				)
+			}
+
+			var types []string
+
+			for i, entry := range inspection.Entries {
+				if testCase.expectedPaths != nil &&
+					!reflect.DeepEqual(entry.Path, testCase.expectedPaths[i]) {
+					t.Errorf("unexpected path of entry %d: %q", i, entry.Path)
+				}
+
+				if entry.File == nil {
+					types = append(types, "")
+
+					continue
+				}
+
+				types = append(types, entry.File.ContentType.ContentType)
+			}
+
+			if !reflect.DeepEqual(types, testCase.expectedTypes) {
+				t.Errorf(
+					"unexpected entry types: got %q, expected %q",
+					types,
+					testCase.expectedTypes,
+				)
+			}
+		})
+	}
+}
+
+func TestInspectArchiveEntry(t *testing.T) {
+	t.Parallel()
+
+	inspection, err := letters.InspectArchive(
+		encryptedZipTestData(t),
+		letters.ArchiveInspectOptions{},
+	)
+	if err != nil {
+		t.Fatalf("cannot inspect archive: %s", err)
+	}
+
+	expected := []letters.ArchiveEntry{
+		{
+			Path:             []string{"secret.exe"},
+			Name:             "secret.exe",
+			Size:             4,
+			CompressedSize:   4,
+			CompressionRatio: 1,
+			IsDir:            false,
+			Encrypted:        true,
+			File:             nil,
+		},
+	}
+
+	if !reflect.DeepEqual(inspection.Entries, expected) {
+		t.Errorf(
+			"unexpected entries: got %#v, expected %#v",
+			inspection.Entries,
+			expected,
+		)
+	}
+}
+
+func TestInspectArchiveUnsupported(t *testing.T) {
+	t.Parallel()
+
+	file := letters.AttachedFile{
+		ContentType: letters.ContentTypeHeader{
+			ContentType: "application/pdf",
+			Params:      map[string]string{},
+		},
+		ContentDisposition: letters.ContentDispositionHeader{
+			ContentDisposition: letters.ContentDispositionAttachment,
+			Params:             map[string]string{"filename": "a.pdf"},
+		},
+		Data: []byte("%PDF-1.7\n"),
+	}
+
+	_, err := file.InspectArchive(letters.ArchiveInspectOptions{})
+	if !errors.Is(err, letters.ErrUnsupportedArchive) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
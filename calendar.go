@@ -0,0 +1,1091 @@
+package letters
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CalendarMethod is the iTIP method of a calendar, see RFC 5546.
+type CalendarMethod string
+
+// iTIP methods.
+const (
+	CalendarMethodPublish        CalendarMethod = "PUBLISH"
+	CalendarMethodRequest        CalendarMethod = "REQUEST"
+	CalendarMethodReply          CalendarMethod = "REPLY"
+	CalendarMethodAdd            CalendarMethod = "ADD"
+	CalendarMethodCancel         CalendarMethod = "CANCEL"
+	CalendarMethodRefresh        CalendarMethod = "REFRESH"
+	CalendarMethodCounter        CalendarMethod = "COUNTER"
+	CalendarMethodDeclineCounter CalendarMethod = "DECLINECOUNTER"
+)
+
+// ParticipationStatus is the participation status of an attendee of an
+// event.
+type ParticipationStatus string
+
+// Participation statuses of attendees of events.
+const (
+	ParticipationNeedsAction ParticipationStatus = "NEEDS-ACTION"
+	ParticipationAccepted    ParticipationStatus = "ACCEPTED"
+	ParticipationDeclined    ParticipationStatus = "DECLINED"
+	ParticipationTentative   ParticipationStatus = "TENTATIVE"
+	ParticipationDelegated   ParticipationStatus = "DELEGATED"
+)
+
+const (
+	calendarDateLayout        = "20060102"
+	calendarDateTimeLayout    = "20060102T150405"
+	calendarUTCDateTimeLayout = "20060102T150405Z"
+	calendarStatusCancelled   = "CANCELLED"
+	calendarMailtoPrefix      = "mailto:"
+	calendarMaxDepth          = 16
+	calendarOffsetHoursLength = 3
+	calendarOffsetLength      = 5
+	calendarOffsetSecLength   = 7
+	calendarByDayMinLength    = 2
+	daysPerWeek               = 7
+	hoursPerDay               = 24
+	secondsPerMinute          = 60
+	secondsPerHour            = 3600
+)
+
+// Calendar is an iCalendar object, see RFC 5545.
+type Calendar struct {
+	// Method is the iTIP method of a scheduling message, such as
+	// REQUEST for invitations, REPLY for answers to invitations and CANCEL
+	// for cancellations. It is empty for calendars that are not
+	// scheduling messages.
+	Method CalendarMethod
+
+	ProductID string
+	Events    []CalendarEvent
+}
+
+// CalendarEvent is a VEVENT component of a calendar.
+type CalendarEvent struct {
+	UID string
+
+	// Sequence is the revision of the event, which is incremented on
+	// significant changes and orders updates of the same event.
+	Sequence int
+
+	// Status is TENTATIVE, CONFIRMED or CANCELLED, or empty.
+	Status string
+
+	Summary     string
+	Description string
+	Location    string
+
+	Organizer *CalendarAttendee
+	Attendees []CalendarAttendee
+
+	// Start and End are in the time zone of the event: the IANA time zone
+	// named by its TZID parameter or, when the name is not an IANA name,
+	// a fixed zone with the offset that the VTIMEZONE component of the
+	// calendar defines for the time. UTC times are in UTC, and floating
+	// times and dates are in UTC as well. End is computed from the
+	// duration of events without an end.
+	Start time.Time
+	End   time.Time
+
+	// AllDay reports whether the event starts on a date rather than at a
+	// time.
+	AllDay bool
+
+	RecurrenceRules []RecurrenceRule
+
+	// RecurrenceID identifies the occurrence of a recurring event that the
+	// component overrides, replies to or cancels. It is zero for the
+	// recurring event itself.
+	RecurrenceID time.Time
+
+	// ExceptionDates are the occurrences excluded from the recurrence.
+	ExceptionDates []time.Time
+}
+
+// CalendarAttendee is the organizer or an attendee of an event.
+type CalendarAttendee struct {
+	Name    string
+	Address string
+
+	// Role is CHAIR, REQ-PARTICIPANT, OPT-PARTICIPANT or NON-PARTICIPANT.
+	Role string
+
+	ParticipationStatus ParticipationStatus
+
+	// RSVP reports whether the organizer expects a reply.
+	RSVP bool
+}
+
+// RecurrenceRule is a recurrence rule of an event.
+type RecurrenceRule struct {
+	// Frequency is SECONDLY, MINUTELY, HOURLY, DAILY, WEEKLY, MONTHLY or
+	// YEARLY.
+	Frequency string
+
+	Interval int
+	Count    int
+	Until    time.Time
+
+	// ByDay lists weekdays such as MO, optionally with an occurrence
+	// within the month or year, such as 1MO or -1FR.
+	ByDay      []string
+	ByMonthDay []int
+	ByMonth    []int
+	WeekStart  string
+
+	// Rule is the rule as written in the calendar.
+	Rule string
+}
+
+// CalendarReply is the participation status that an attendee sends in a
+// REPLY.
+type CalendarReply struct {
+	UID          string
+	RecurrenceID time.Time
+	Sequence     int
+	Attendee     CalendarAttendee
+}
+
+// IsCancellation reports whether the calendar cancels the events it lists.
+func (c Calendar) IsCancellation() bool {
+	return c.Method == CalendarMethodCancel
+}
+
+// Replies returns the participation statuses that attendees send in a
+// REPLY calendar, or nil for other methods.
+func (c Calendar) Replies() []CalendarReply {
+	if c.Method != CalendarMethodReply {
+		return nil
+	}
+
+	var replies []CalendarReply
+
+	for _, event := range c.Events {
+		for _, attendee := range event.Attendees {
+			replies = append(replies, CalendarReply{
+				UID:          event.UID,
+				RecurrenceID: event.RecurrenceID,
+				Sequence:     event.Sequence,
+				Attendee:     attendee,
+			})
+		}
+	}
+
+	return replies
+}
+
+// IsCancelled reports whether the event has been cancelled.
+func (e CalendarEvent) IsCancelled() bool {
+	return strings.EqualFold(e.Status, calendarStatusCancelled)
+}
+
+// WithCalendarParsing makes the parser parse the iCalendar files among the
+// attached and inline files into Email.Calendars. The files are kept, and
+// files that cannot be parsed are reported in Email.Warnings.
+func WithCalendarParsing() EmailParserOption {
+	return func(ep *EmailParser) {
+		ep.parseCalendars = true
+	}
+}
+
+// IsCalendar reports whether the attached file is an iCalendar file: a
+// text/calendar or application/ics file or a file with an .ics extension.
+func (f AttachedFile) IsCalendar() bool {
+	return isCalendarFile(f.ContentType, f.Filename())
+}
+
+// IsCalendar reports whether the inline file is an iCalendar file.
+func (f InlineFile) IsCalendar() bool {
+	return isCalendarFile(f.ContentType, f.Filename())
+}
+
+// ParseCalendar parses the attached file with ParseCalendar, decoding it
+// from the charset of its Content-Type and taking the method from its
+// method parameter when the calendar has none.
+func (f AttachedFile) ParseCalendar() (Calendar, error) {
+	return parseCalendarFile(f.ContentType, f.Data)
+}
+
+// ParseCalendar parses the inline file with ParseCalendar.
+func (f InlineFile) ParseCalendar() (Calendar, error) {
+	return parseCalendarFile(f.ContentType, f.Data)
+}
+
+func isCalendarFile(contentType ContentTypeHeader, filename Filename) bool {
+	switch strings.ToLower(contentType.ContentType) {
+	case "text/calendar", "application/ics":
+		return true
+	default:
+		return strings.EqualFold(path.Ext(filename.Sanitized), ".ics")
+	}
+}
+
+func parseCalendarFile(
+	contentType ContentTypeHeader,
+	data []byte,
+) (Calendar, error) {
+	calendar, err := ParseCalendar(
+		decodeCharsetBytes(data, contentType.Params["charset"]),
+	)
+	if err != nil {
+		return calendar, err
+	}
+
+	if calendar.Method == "" {
+		calendar.Method = CalendarMethod(
+			strings.ToUpper(contentType.Params["method"]),
+		)
+	}
+
+	return calendar, nil
+}
+
+func (ep *EmailParser) parseCalendarFiles(email *Email) {
+	add := func(calendar Calendar, err error) {
+		if err != nil {
+			email.Warnings = append(email.Warnings, err)
+
+			return
+		}
+
+		email.Calendars = append(email.Calendars, calendar)
+	}
+
+	for _, file := range email.InlineFiles {
+		if file.IsCalendar() {
+			add(file.ParseCalendar())
+		}
+	}
+
+	for _, file := range email.AttachedFiles {
+		if file.IsCalendar() {
+			add(file.ParseCalendar())
+		}
+	}
+}
+
+// calendarProperty is a content line of an iCalendar object.
+type calendarProperty struct {
+	name   string
+	params map[string][]string
+	value  string
+}
+
+func (p calendarProperty) param(name string) string {
+	values := p.params[name]
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+// calendarComponent is a component of an iCalendar object, such as
+// VCALENDAR, VEVENT or VTIMEZONE.
+type calendarComponent struct {
+	name       string
+	properties []calendarProperty
+	components []*calendarComponent
+}
+
+func (c *calendarComponent) property(name string) (calendarProperty, bool) {
+	for _, property := range c.properties {
+		if property.name == name {
+			return property, true
+		}
+	}
+
+	return calendarProperty{}, false
+}
+
+func (c *calendarComponent) text(name string) string {
+	property, _ := c.property(name)
+
+	return unescapeCalendarText(property.value)
+}
+
+// ParseCalendar parses an iCalendar object, as described in RFC 5545, with
+// the scheduling semantics of iTIP, described in RFC 5546. It returns an
+// error wrapping ErrInvalidCalendar when the text is not an iCalendar
+// object.
+func ParseCalendar(text string) (Calendar, error) {
+	root, err := parseCalendarComponents(text)
+	if err != nil {
+		return Calendar{}, fmt.Errorf(
+			"letters.calendar.ParseCalendar: %w",
+			err,
+		)
+	}
+
+	calendar := Calendar{
+		Method:    CalendarMethod(strings.ToUpper(root.text("METHOD"))),
+		ProductID: root.text("PRODID"),
+		Events:    nil,
+	}
+
+	zones := newCalendarTimeZones(root)
+
+	for _, component := range root.components {
+		if component.name != "VEVENT" {
+			continue
+		}
+
+		event, err := parseCalendarEvent(component, zones)
+		if err != nil {
+			return calendar, fmt.Errorf(
+				"letters.calendar.ParseCalendar: %w",
+				err,
+			)
+		}
+
+		calendar.Events = append(calendar.Events, event)
+	}
+
+	return calendar, nil
+}
+
+// parseCalendarComponents returns the VCALENDAR component of an iCalendar
+// object.
+func parseCalendarComponents(text string) (*calendarComponent, error) {
+	components, err := parseContentComponents(text, ErrInvalidCalendar)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(components) != 1 || components[0].name != "VCALENDAR" {
+		return nil, fmt.Errorf("%w: no complete VCALENDAR", ErrInvalidCalendar)
+	}
+
+	return components[0], nil
+}
+
+// parseContentComponents parses the content lines of iCalendar or vCard
+// data into its top-level components, such as VCALENDAR or VCARD. Errors
+// wrap errInvalid.
+func parseContentComponents(
+	text string,
+	errInvalid error,
+) ([]*calendarComponent, error) {
+	var components []*calendarComponent
+
+	var stack []*calendarComponent
+
+	for _, line := range unfoldContentLines(text) {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		property, ok := parseCalendarProperty(line)
+		if !ok {
+			return nil, fmt.Errorf(
+				"%w: invalid content line %q",
+				errInvalid,
+				line,
+			)
+		}
+
+		switch property.name {
+		case "BEGIN":
+			component := &calendarComponent{
+				name:       strings.ToUpper(property.value),
+				properties: nil,
+				components: nil,
+			}
+
+			switch {
+			case len(stack) >= calendarMaxDepth:
+				return nil, fmt.Errorf("%w: too deeply nested", errInvalid)
+			case len(stack) > 0:
+				parent := stack[len(stack)-1]
+				parent.components = append(parent.components, component)
+			default:
+				components = append(components, component)
+			}
+
+			stack = append(stack, component)
+		case "END":
+			if len(stack) == 0 ||
+				stack[len(stack)-1].name != strings.ToUpper(property.value) {
+				return nil, fmt.Errorf(
+					"%w: unexpected end of %s",
+					errInvalid,
+					property.value,
+				)
+			}
+
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf(
+					"%w: property %s outside of a component",
+					errInvalid,
+					property.name,
+				)
+			}
+
+			component := stack[len(stack)-1]
+			component.properties = append(component.properties, property)
+		}
+	}
+
+	if len(stack) > 0 {
+		return nil, fmt.Errorf(
+			"%w: unterminated %s component",
+			errInvalid,
+			stack[len(stack)-1].name,
+		)
+	}
+
+	return components, nil
+}
+
+// unfoldContentLines splits text into content lines, joining lines folded
+// with leading white space and, as in vCard 2.1, quoted-printable values
+// continued with soft line breaks.
+func unfoldContentLines(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\n ", "")
+	text = strings.ReplaceAll(text, "\n\t", "")
+
+	var lines []string
+
+	continued := false
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+
+		if continued {
+			lines[len(lines)-1] += line
+		} else {
+			lines = append(lines, line)
+		}
+
+		current := lines[len(lines)-1]
+		name, _, _ := strings.Cut(current, ":")
+		continued = strings.HasSuffix(current, "=") &&
+			strings.Contains(strings.ToUpper(name), "QUOTED-PRINTABLE")
+
+		if continued {
+			lines[len(lines)-1] = strings.TrimSuffix(current, "=")
+		}
+	}
+
+	return lines
+}
+
+// parseCalendarProperty parses a content line of iCalendar or vCard data:
+// a name, parameters with optionally quoted values and a value.
+func parseCalendarProperty(line string) (calendarProperty, bool) {
+	property := calendarProperty{
+		name:   "",
+		params: map[string][]string{},
+		value:  "",
+	}
+
+	end := strings.IndexAny(line, ";:")
+	if end <= 0 {
+		return property, false
+	}
+
+	property.name = strings.ToUpper(line[:end])
+	rest := line[end:]
+
+	for strings.HasPrefix(rest, ";") {
+		nameEnd := strings.IndexAny(rest[1:], "=;:") + 1
+		if nameEnd == 0 {
+			return property, false
+		}
+
+		// vCard 2.1 lists types without a parameter name, as in
+		// TEL;WORK;VOICE:...
+		if rest[nameEnd] != '=' {
+			property.params[vCardTypeParam] = append(
+				property.params[vCardTypeParam],
+				rest[1:nameEnd],
+			)
+			rest = rest[nameEnd:]
+
+			continue
+		}
+
+		name := strings.ToUpper(rest[1:nameEnd])
+		rest = rest[nameEnd+1:]
+
+		for {
+			var value string
+
+			if strings.HasPrefix(rest, "\"") {
+				closing := strings.IndexByte(rest[1:], '"')
+				if closing < 0 {
+					return property, false
+				}
+
+				value = rest[1 : closing+1]
+				rest = rest[closing+2:]
+			} else {
+				valueEnd := strings.IndexAny(rest, ",;:")
+				if valueEnd < 0 {
+					return property, false
+				}
+
+				value = rest[:valueEnd]
+				rest = rest[valueEnd:]
+			}
+
+			property.params[name] = append(property.params[name], value)
+
+			if !strings.HasPrefix(rest, ",") {
+				break
+			}
+
+			rest = rest[1:]
+		}
+	}
+
+	if !strings.HasPrefix(rest, ":") {
+		return property, false
+	}
+
+	property.value = rest[1:]
+
+	return property, true
+}
+
+// unescapeCalendarText unescapes a TEXT value.
+func unescapeCalendarText(value string) string {
+	if !strings.Contains(value, "\\") {
+		return value
+	}
+
+	var b strings.Builder
+
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c == '\\' && i+1 < len(value) {
+			i++
+			c = value[i]
+
+			if c == 'n' || c == 'N' {
+				c = '\n'
+			}
+		}
+
+		b.WriteByte(c)
+	}
+
+	return b.String()
+}
+
+func parseCalendarEvent(
+	component *calendarComponent,
+	zones calendarTimeZones,
+) (CalendarEvent, error) {
+	event := CalendarEvent{
+		UID:             component.text("UID"),
+		Sequence:        0,
+		Status:          strings.ToUpper(component.text("STATUS")),
+		Summary:         component.text("SUMMARY"),
+		Description:     component.text("DESCRIPTION"),
+		Location:        component.text("LOCATION"),
+		Organizer:       nil,
+		Attendees:       nil,
+		Start:           time.Time{},
+		End:             time.Time{},
+		AllDay:          false,
+		RecurrenceRules: nil,
+		RecurrenceID:    time.Time{},
+		ExceptionDates:  nil,
+	}
+
+	if sequence, err := strconv.Atoi(component.text("SEQUENCE")); err == nil {
+		event.Sequence = sequence
+	}
+
+	var err error
+
+	for _, property := range component.properties {
+		switch property.name {
+		case "ORGANIZER":
+			organizer := parseCalendarAttendee(property)
+			event.Organizer = &organizer
+		case "ATTENDEE":
+			event.Attendees = append(
+				event.Attendees,
+				parseCalendarAttendee(property),
+			)
+		case "DTSTART":
+			event.Start, event.AllDay, err = zones.parseTime(property)
+		case "DTEND":
+			event.End, _, err = zones.parseTime(property)
+		case "RECURRENCE-ID":
+			event.RecurrenceID, _, err = zones.parseTime(property)
+		case "RRULE":
+			var rule RecurrenceRule
+
+			rule, err = parseRecurrenceRule(property.value, zones)
+			event.RecurrenceRules = append(event.RecurrenceRules, rule)
+		case "EXDATE":
+			for _, value := range strings.Split(property.value, ",") {
+				var date time.Time
+
+				property.value = value
+				date, _, err = zones.parseTime(property)
+				event.ExceptionDates = append(event.ExceptionDates, date)
+			}
+		default:
+		}
+
+		if err != nil {
+			return event, fmt.Errorf(
+				"cannot parse %s of event %q: %w",
+				property.name,
+				event.UID,
+				err,
+			)
+		}
+	}
+
+	if duration, ok := component.property("DURATION"); ok &&
+		event.End.IsZero() {
+		d, err := parseCalendarDuration(duration.value)
+		if err != nil {
+			return event, fmt.Errorf(
+				"cannot parse DURATION of event %q: %w",
+				event.UID,
+				err,
+			)
+		}
+
+		event.End = event.Start.Add(d)
+	}
+
+	return event, nil
+}
+
+func parseCalendarAttendee(property calendarProperty) CalendarAttendee {
+	address := property.value
+	if strings.HasPrefix(strings.ToLower(address), calendarMailtoPrefix) {
+		address = address[len(calendarMailtoPrefix):]
+	}
+
+	status := ParticipationStatus(strings.ToUpper(property.param("PARTSTAT")))
+	if status == "" {
+		status = ParticipationNeedsAction
+	}
+
+	return CalendarAttendee{
+		Name:                property.param("CN"),
+		Address:             address,
+		Role:                strings.ToUpper(property.param("ROLE")),
+		ParticipationStatus: status,
+		RSVP:                strings.EqualFold(property.param("RSVP"), "TRUE"),
+	}
+}
+
+func parseRecurrenceRule(
+	value string,
+	zones calendarTimeZones,
+) (RecurrenceRule, error) {
+	rule := RecurrenceRule{
+		Frequency:  "",
+		Interval:   1,
+		Count:      0,
+		Until:      time.Time{},
+		ByDay:      nil,
+		ByMonthDay: nil,
+		ByMonth:    nil,
+		WeekStart:  "",
+		Rule:       value,
+	}
+
+	for _, part := range strings.Split(value, ";") {
+		name, partValue, _ := strings.Cut(part, "=")
+
+		var err error
+
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			rule.Frequency = strings.ToUpper(partValue)
+		case "INTERVAL":
+			rule.Interval, err = strconv.Atoi(partValue)
+		case "COUNT":
+			rule.Count, err = strconv.Atoi(partValue)
+		case "UNTIL":
+			rule.Until, _, err = zones.parseTime(calendarProperty{
+				name:   "UNTIL",
+				params: map[string][]string{},
+				value:  partValue,
+			})
+		case "BYDAY":
+			rule.ByDay = strings.Split(strings.ToUpper(partValue), ",")
+		case "BYMONTHDAY":
+			rule.ByMonthDay, err = parseCalendarIntegers(partValue)
+		case "BYMONTH":
+			rule.ByMonth, err = parseCalendarIntegers(partValue)
+		case "WKST":
+			rule.WeekStart = strings.ToUpper(partValue)
+		default:
+		}
+
+		if err != nil {
+			return rule, fmt.Errorf(
+				"%w: invalid recurrence rule %q",
+				ErrInvalidCalendar,
+				value,
+			)
+		}
+	}
+
+	if rule.Frequency == "" {
+		return rule, fmt.Errorf(
+			"%w: recurrence rule %q without frequency",
+			ErrInvalidCalendar,
+			value,
+		)
+	}
+
+	return rule, nil
+}
+
+func parseCalendarIntegers(value string) ([]int, error) {
+	var integers []int
+
+	for _, field := range strings.Split(value, ",") {
+		integer, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse integer: %w", err)
+		}
+
+		integers = append(integers, integer)
+	}
+
+	return integers, nil
+}
+
+// parseCalendarDuration parses a duration such as P1D, PT1H30M or -PT15M.
+func parseCalendarDuration(value string) (time.Duration, error) {
+	sign := time.Duration(1)
+
+	rest := value
+	switch {
+	case strings.HasPrefix(rest, "-"):
+		sign = -1
+		rest = rest[1:]
+	case strings.HasPrefix(rest, "+"):
+		rest = rest[1:]
+	default:
+	}
+
+	if !strings.HasPrefix(rest, "P") || len(rest) == 1 {
+		return 0, fmt.Errorf(
+			"%w: invalid duration %q",
+			ErrInvalidCalendar,
+			value,
+		)
+	}
+
+	units := map[byte]time.Duration{
+		'W': daysPerWeek * hoursPerDay * time.Hour,
+		'D': hoursPerDay * time.Hour,
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+	}
+
+	var duration time.Duration
+
+	number := ""
+
+	for _, c := range []byte(rest[1:]) {
+		switch {
+		case c == 'T':
+		case c >= '0' && c <= '9':
+			number += string(c)
+		default:
+			n, err := strconv.Atoi(number)
+			unit, ok := units[c]
+
+			if err != nil || !ok {
+				return 0, fmt.Errorf(
+					"%w: invalid duration %q",
+					ErrInvalidCalendar,
+					value,
+				)
+			}
+
+			duration += time.Duration(n) * unit
+			number = ""
+		}
+	}
+
+	if number != "" {
+		return 0, fmt.Errorf(
+			"%w: invalid duration %q",
+			ErrInvalidCalendar,
+			value,
+		)
+	}
+
+	return sign * duration, nil
+}
+
+// calendarTimeZones resolves the TZID parameters of a calendar.
+type calendarTimeZones map[string]*calendarComponent
+
+func newCalendarTimeZones(root *calendarComponent) calendarTimeZones {
+	zones := make(calendarTimeZones)
+
+	for _, component := range root.components {
+		if component.name == "VTIMEZONE" {
+			zones[component.text("TZID")] = component
+		}
+	}
+
+	return zones
+}
+
+// parseTime parses a DATE or DATE-TIME value of a property in the time
+// zone of its TZID parameter, and reports whether it is a date.
+func (z calendarTimeZones) parseTime(
+	property calendarProperty,
+) (time.Time, bool, error) {
+	value := strings.TrimSpace(property.value)
+
+	if len(value) == len(calendarDateLayout) {
+		date, err := time.Parse(calendarDateLayout, value)
+		if err != nil {
+			return date, true, fmt.Errorf(
+				"%w: invalid date %q",
+				ErrInvalidCalendar,
+				value,
+			)
+		}
+
+		return date, true, nil
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(calendarUTCDateTimeLayout, value)
+		if err != nil {
+			return t, false, fmt.Errorf(
+				"%w: invalid time %q",
+				ErrInvalidCalendar,
+				value,
+			)
+		}
+
+		return t, false, nil
+	}
+
+	local, err := time.Parse(calendarDateTimeLayout, value)
+	if err != nil {
+		return local, false, fmt.Errorf(
+			"%w: invalid time %q",
+			ErrInvalidCalendar,
+			value,
+		)
+	}
+
+	tzid := property.param("TZID")
+	if tzid == "" {
+		return local, false, nil
+	}
+
+	return z.localTime(tzid, local), false, nil
+}
+
+// localTime returns a wall clock time, given in UTC, in a time zone.
+func (z calendarTimeZones) localTime(tzid string, local time.Time) time.Time {
+	inZone := func(location *time.Location) time.Time {
+		return time.Date(
+			local.Year(),
+			local.Month(),
+			local.Day(),
+			local.Hour(),
+			local.Minute(),
+			local.Second(),
+			0,
+			location,
+		)
+	}
+
+	location, err := time.LoadLocation(strings.TrimPrefix(tzid, "/"))
+	if err == nil && !strings.EqualFold(tzid, "Local") {
+		return inZone(location)
+	}
+
+	component, ok := z[tzid]
+	if !ok {
+		return local
+	}
+
+	offset, ok := calendarTimeZoneOffset(component, local)
+	if !ok {
+		return local
+	}
+
+	return inZone(time.FixedZone(tzid, offset))
+}
+
+// calendarTimeZoneOffset returns the UTC offset, in seconds, that a
+// VTIMEZONE component defines for a wall clock time: the offset of the
+// STANDARD or DAYLIGHT observance with the latest onset before the time.
+// Observances recur on the dates of yearly rules with BYMONTH and BYDAY,
+// such as the last Sunday of March.
+func calendarTimeZoneOffset(
+	component *calendarComponent,
+	local time.Time,
+) (int, bool) {
+	var latest time.Time
+
+	offset, found := 0, false
+
+	for _, observance := range component.components {
+		if observance.name != "STANDARD" && observance.name != "DAYLIGHT" {
+			continue
+		}
+
+		start, err := time.Parse(
+			calendarDateTimeLayout,
+			observance.text("DTSTART"),
+		)
+		if err != nil {
+			continue
+		}
+
+		offsetTo, ok := parseCalendarUTCOffset(observance.text("TZOFFSETTO"))
+		if !ok {
+			continue
+		}
+
+		onset := start
+
+		if rule, ok := observance.property("RRULE"); ok {
+			onset = yearlyOnset(rule.value, start, local)
+		}
+
+		if onset.IsZero() || onset.After(local) {
+			continue
+		}
+
+		if !found || onset.After(latest) {
+			latest, offset, found = onset, offsetTo, true
+		}
+	}
+
+	return offset, found
+}
+
+// yearlyOnset returns the latest onset of a yearly observance rule, such as
+// FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU, before a wall clock time, or the zero
+// time when there is none or the rule is not supported.
+func yearlyOnset(value string, start time.Time, local time.Time) time.Time {
+	rule, err := parseRecurrenceRule(value, calendarTimeZones{})
+	if err != nil || rule.Frequency != "YEARLY" ||
+		len(rule.ByMonth) != 1 || len(rule.ByDay) != 1 {
+		return time.Time{}
+	}
+
+	for _, year := range []int{local.Year(), local.Year() - 1} {
+		month := time.Month(rule.ByMonth[0])
+
+		onset, ok := nthWeekday(year, month, rule.ByDay[0])
+		if !ok {
+			return time.Time{}
+		}
+
+		onset = onset.Add(
+			time.Duration(start.Hour())*time.Hour +
+				time.Duration(start.Minute())*time.Minute,
+		)
+
+		if onset.Before(start) ||
+			(!rule.Until.IsZero() && onset.After(rule.Until)) {
+			continue
+		}
+
+		if !onset.After(local) {
+			return onset
+		}
+	}
+
+	return time.Time{}
+}
+
+// nthWeekday returns the date of a BYDAY value such as 2SU or -1SU in a
+// month.
+func nthWeekday(year int, month time.Month, byDay string) (time.Time, bool) {
+	if len(byDay) <= calendarByDayMinLength {
+		return time.Time{}, false
+	}
+
+	weekdays := []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+	weekday := slices.Index(weekdays, byDay[len(byDay)-2:])
+	n, err := strconv.Atoi(byDay[:len(byDay)-2])
+
+	if weekday < 0 || err != nil || n == 0 {
+		return time.Time{}, false
+	}
+
+	if n > 0 {
+		first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+		days := (weekday - int(first.Weekday()) + daysPerWeek) % daysPerWeek
+
+		return first.AddDate(0, 0, days+(n-1)*daysPerWeek), true
+	}
+
+	last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC)
+	days := (int(last.Weekday()) - weekday + daysPerWeek) % daysPerWeek
+
+	return last.AddDate(0, 0, -days+(n+1)*daysPerWeek), true
+}
+
+// parseCalendarUTCOffset parses a UTC offset such as +0100 or -053000 into
+// seconds.
+func parseCalendarUTCOffset(value string) (int, bool) {
+	if len(value) != calendarOffsetLength &&
+		len(value) != calendarOffsetSecLength {
+		return 0, false
+	}
+
+	sign := 1
+
+	switch value[0] {
+	case '-':
+		sign = -1
+	case '+':
+	default:
+		return 0, false
+	}
+
+	hours, err := strconv.Atoi(value[1:calendarOffsetHoursLength])
+	if err != nil {
+		return 0, false
+	}
+
+	minutes, err := strconv.Atoi(
+		value[calendarOffsetHoursLength:calendarOffsetLength],
+	)
+	if err != nil {
+		return 0, false
+	}
+
+	seconds := 0
+
+	if len(value) == calendarOffsetSecLength {
+		seconds, err = strconv.Atoi(value[calendarOffsetLength:])
+		if err != nil {
+			return 0, false
+		}
+	}
+
+	return sign * (hours*secondsPerHour + minutes*secondsPerMinute + seconds),
+		true
+}
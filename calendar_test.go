@@ -0,0 +1,336 @@
+package letters_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mnako/letters"
+)
+
+const calendarTestRequest = "BEGIN:VCALENDAR\r\n" +
+	"PRODID:-//Example//Calendar//EN\r\n" +
+	"VERSION:2.0\r\n" +
+	"METHOD:REQUEST\r\n" +
+	"BEGIN:VTIMEZONE\r\n" +
+	"TZID:W. Europe Standard Time\r\n" +
+	"BEGIN:STANDARD\r\n" +
+	"DTSTART:16010101T030000\r\n" +
+	"TZOFFSETFROM:+0200\r\n" +
+	"TZOFFSETTO:+0100\r\n" +
+	"RRULE:FREQ=YEARLY;BYDAY=-1SU;BYMONTH=10\r\n" +
+	"END:STANDARD\r\n" +
+	"BEGIN:DAYLIGHT\r\n" +
+	"DTSTART:16010101T020000\r\n" +
+	"TZOFFSETFROM:+0100\r\n" +
+	"TZOFFSETTO:+0200\r\n" +
+	"RRULE:FREQ=YEARLY;BYDAY=-1SU;BYMONTH=3\r\n" +
+	"END:DAYLIGHT\r\n" +
+	"END:VTIMEZONE\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:weekly-sync@example.com\r\n" +
+	"SEQUENCE:2\r\n" +
+	"STATUS:CONFIRMED\r\n" +
+	"SUMMARY:Weekly sync\\, planning\r\n" +
+	"DESCRIPTION:Agenda:\\nRoadmap; budget and \r\n" +
+	" hiring\r\n" +
+	"LOCATION:Room 1\r\n" +
+	"ORGANIZER;CN=\"Alice, Lead\":mailto:alice@example.com\r\n" +
+	"ATTENDEE;CN=Bob;ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;\r\n" +
+	" RSVP=TRUE:mailto:bob@example.com\r\n" +
+	"ATTENDEE;CN=Carol;ROLE=OPT-PARTICIPANT:MAILTO:carol@example.com\r\n" +
+	"DTSTART;TZID=W. Europe Standard Time:20240715T100000\r\n" +
+	"DURATION:PT1H30M\r\n" +
+	"RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO;UNTIL=20250630T220000Z\r\n" +
+	"EXDATE;TZID=W. Europe Standard Time:20250113T100000\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParseCalendar(t *testing.T) {
+	t.Parallel()
+
+	calendar, err := letters.ParseCalendar(calendarTestRequest)
+	if err != nil {
+		t.Fatalf("cannot parse calendar: %s", err)
+	}
+
+	if calendar.Method != letters.CalendarMethodRequest ||
+		calendar.ProductID != "-//Example//Calendar//EN" ||
+		calendar.IsCancellation() ||
+		calendar.Replies() != nil ||
+		len(calendar.Events) != 1 {
+		t.Fatalf("unexpected calendar: %#v", calendar)
+	}
+
+	event := calendar.Events[0]
+
+	if event.UID != "weekly-sync@example.com" ||
+		event.Sequence != 2 ||
+		event.IsCancelled() ||
+		event.Summary != "Weekly sync, planning" ||
+		event.Description != "Agenda:\nRoadmap; budget and hiring" ||
+		event.Location != "Room 1" ||
+		event.AllDay {
+		t.Errorf("unexpected event: %#v", event)
+	}
+
+	expectedOrganizer := letters.CalendarAttendee{
+		Name:                "Alice, Lead",
+		Address:             "alice@example.com",
+		Role:                "",
+		ParticipationStatus: letters.ParticipationNeedsAction,
+		RSVP:                false,
+	}
+	if event.Organizer == nil || *event.Organizer != expectedOrganizer {
+		t.Errorf("unexpected organizer: %#v", event.Organizer)
+	}
+
+	expectedAttendees := []letters.CalendarAttendee{
+		{
+			Name:                "Bob",
+			Address:             "bob@example.com",
+			Role:                "REQ-PARTICIPANT",
+			ParticipationStatus: letters.ParticipationNeedsAction,
+			RSVP:                true,
+		},
+		{
+			Name:                "Carol",
+			Address:             "carol@example.com",
+			Role:                "OPT-PARTICIPANT",
+			ParticipationStatus: letters.ParticipationNeedsAction,
+			RSVP:                false,
+		},
+	}
+	if len(event.Attendees) != len(expectedAttendees) {
+		t.Fatalf("unexpected attendees: %#v", event.Attendees)
+	}
+
+	for i, attendee := range event.Attendees {
+		if attendee != expectedAttendees[i] {
+			t.Errorf("unexpected attendee %d: %#v", i, attendee)
+		}
+	}
+
+	start := time.Date(2024, time.July, 15, 8, 0, 0, 0, time.UTC)
+	if !event.Start.Equal(start) ||
+		!event.End.Equal(start.Add(90*time.Minute)) {
+		t.Errorf("unexpected times: %s - %s", event.Start, event.End)
+	}
+
+	if _, offset := event.Start.Zone(); offset != 2*60*60 {
+		t.Errorf("expected summer time offset, got %d", offset)
+	}
+
+	if len(event.RecurrenceRules) != 1 {
+		t.Fatalf("unexpected recurrence rules: %#v", event.RecurrenceRules)
+	}
+
+	until := time.Date(2025, time.June, 30, 22, 0, 0, 0, time.UTC)
+
+	rule := event.RecurrenceRules[0]
+	if rule.Frequency != "WEEKLY" ||
+		rule.Interval != 2 ||
+		len(rule.ByDay) != 1 || rule.ByDay[0] != "MO" ||
+		!rule.Until.Equal(until) {
+		t.Errorf("unexpected recurrence rule: %#v", rule)
+	}
+
+	exception := time.Date(2025, time.January, 13, 9, 0, 0, 0, time.UTC)
+	if len(event.ExceptionDates) != 1 ||
+		!event.ExceptionDates[0].Equal(exception) {
+		t.Errorf("unexpected exception dates: %v", event.ExceptionDates)
+	}
+}
+
+func TestParseCalendarMethods(t *testing.T) {
+	t.Parallel()
+
+	calendar := func(method string, event string) string {
+		return "BEGIN:VCALENDAR\r\n" +
+			"METHOD:" + method + "\r\n" +
+			"BEGIN:VEVENT\r\n" +
+			event +
+			"END:VEVENT\r\n" +
+			"END:VCALENDAR\r\n"
+	}
+
+	t.Run("cancel", func(t *testing.T) {
+		t.Parallel()
+
+		parsed, err := letters.ParseCalendar(calendar(
+			"CANCEL",
+			"UID:launch@example.com\r\n"+
+				"STATUS:CANCELLED\r\n"+
+				"DTSTART;VALUE=DATE:20241224\r\n"+
+				"DTEND;VALUE=DATE:20241225\r\n",
+		))
+		if err != nil {
+			t.Fatalf("cannot parse calendar: %s", err)
+		}
+
+		if !parsed.IsCancellation() ||
+			len(parsed.Events) != 1 ||
+			!parsed.Events[0].IsCancelled() ||
+			!parsed.Events[0].AllDay ||
+			!parsed.Events[0].Start.Equal(
+				time.Date(2024, time.December, 24, 0, 0, 0, 0, time.UTC),
+			) {
+			t.Errorf("unexpected calendar: %#v", parsed)
+		}
+	})
+
+	t.Run("reply", func(t *testing.T) {
+		t.Parallel()
+
+		parsed, err := letters.ParseCalendar(calendar(
+			"reply",
+			"UID:weekly-sync@example.com\r\n"+
+				"SEQUENCE:2\r\n"+
+				"RECURRENCE-ID:20240729T080000Z\r\n"+
+				"ATTENDEE;PARTSTAT=DECLINED;CN=Bob:mailto:bob@example.com\r\n",
+		))
+		if err != nil {
+			t.Fatalf("cannot parse calendar: %s", err)
+		}
+
+		replies := parsed.Replies()
+		if len(replies) != 1 {
+			t.Fatalf("unexpected replies: %#v", replies)
+		}
+
+		reply := replies[0]
+		if reply.UID != "weekly-sync@example.com" ||
+			reply.Sequence != 2 ||
+			!reply.RecurrenceID.Equal(
+				time.Date(2024, time.July, 29, 8, 0, 0, 0, time.UTC),
+			) ||
+			reply.Attendee.Address != "bob@example.com" ||
+			reply.Attendee.ParticipationStatus !=
+				letters.ParticipationDeclined {
+			t.Errorf("unexpected reply: %#v", reply)
+		}
+	})
+}
+
+func TestParseCalendarErrors(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		text string
+	}{
+		{
+			name: "empty",
+			text: "",
+		},
+		{
+			name: "not a calendar",
+			text: "BEGIN:VCARD\r\nFN:Alice\r\nEND:VCARD\r\n",
+		},
+		{
+			name: "unterminated",
+			text: "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nEND:VEVENT\r\n",
+		},
+		{
+			name: "mismatched end",
+			text: "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nEND:VCALENDAR\r\n",
+		},
+		{
+			name: "invalid content line",
+			text: "BEGIN:VCALENDAR\r\nSUMMARY\r\nEND:VCALENDAR\r\n",
+		},
+		{
+			name: "invalid start",
+			text: "BEGIN:VCALENDAR\r\n" +
+				"BEGIN:VEVENT\r\n" +
+				"DTSTART:tomorrow\r\n" +
+				"END:VEVENT\r\n" +
+				"END:VCALENDAR\r\n",
+		},
+		{
+			name: "invalid duration",
+			text: "BEGIN:VCALENDAR\r\n" +
+				"BEGIN:VEVENT\r\n" +
+				"DTSTART:20240715T080000Z\r\n" +
+				"DURATION:PT1X\r\n" +
+				"END:VEVENT\r\n" +
+				"END:VCALENDAR\r\n",
+		},
+		{
+			name: "recurrence rule without frequency",
+			text: "BEGIN:VCALENDAR\r\n" +
+				"BEGIN:VEVENT\r\n" +
+				"RRULE:COUNT=3\r\n" +
+				"END:VEVENT\r\n" +
+				"END:VCALENDAR\r\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := letters.ParseCalendar(testCase.text)
+			if !errors.Is(err, letters.ErrInvalidCalendar) {
+				t.Errorf("expected ErrInvalidCalendar, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseWithCalendarParsing(t *testing.T) {
+	t.Parallel()
+
+	message := "From: Alice <alice@example.com>\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"You are invited.\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/calendar; charset=utf-8\r\n" +
+		"Content-Disposition: attachment; filename=invite.ics\r\n" +
+		"\r\n" +
+		strings.Replace(calendarTestRequest, "METHOD:REQUEST\r\n", "", 1) +
+		"--b\r\n" +
+		"Content-Type: application/octet-stream\r\n" +
+		"Content-Disposition: attachment; filename=broken.ics\r\n" +
+		"\r\n" +
+		"BEGIN:VCALENDAR\r\n" +
+		"--b--\r\n"
+
+	email, err := letters.NewEmailParser(
+		letters.WithCalendarParsing(),
+	).Parse(strings.NewReader(message))
+	if err != nil {
+		t.Fatalf("cannot parse email: %s", err)
+	}
+
+	if len(email.Calendars) != 1 ||
+		len(email.Calendars[0].Events) != 1 ||
+		email.Calendars[0].Events[0].UID != "weekly-sync@example.com" {
+		t.Errorf("unexpected calendars: %#v", email.Calendars)
+	}
+
+	if len(email.AttachedFiles) != 2 {
+		t.Errorf("expected calendar files to be kept: %#v", email.AttachedFiles)
+	}
+
+	if len(email.Warnings) != 1 ||
+		!errors.Is(email.Warnings[0], letters.ErrInvalidCalendar) {
+		t.Errorf("unexpected warnings: %v", email.Warnings)
+	}
+
+	email, err = letters.ParseEmail(strings.NewReader(message))
+	if err != nil {
+		t.Fatalf("cannot parse email: %s", err)
+	}
+
+	if email.Calendars != nil {
+		t.Errorf("expected no calendars by default: %#v", email.Calendars)
+	}
+}
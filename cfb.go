@@ -0,0 +1,384 @@
+package letters
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// cfbSignature starts every compound file, see [MS-CFB] section 2.2.
+const cfbSignature = "\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1"
+
+const (
+	cfbHeaderSize          = 512
+	cfbHeaderDIFATEntries  = 109
+	cfbDirectoryEntrySize  = 128
+	cfbDirectoryNameLength = 64
+	cfbMaxRegularSector    = 0xfffffffa
+	cfbEndOfChain          = 0xfffffffe
+	cfbNoStream            = 0xffffffff
+	cfbMinSectorShift      = 7
+	cfbMaxSectorShift      = 16
+	cfbVersion3SectorSize  = 512
+)
+
+// Offsets of the fields of the compound file header.
+const (
+	cfbOffsetSectorShift      = 0x1e
+	cfbOffsetMiniSectorShift  = 0x20
+	cfbOffsetFirstDirSector   = 0x30
+	cfbOffsetMiniStreamCutoff = 0x38
+	cfbOffsetFirstMiniFAT     = 0x3c
+	cfbOffsetFirstDIFAT       = 0x44
+	cfbOffsetDIFAT            = 0x4c
+)
+
+// Offsets of the fields of a directory entry.
+const (
+	cfbEntryOffsetNameLength  = 0x40
+	cfbEntryOffsetType        = 0x42
+	cfbEntryOffsetLeft        = 0x44
+	cfbEntryOffsetRight       = 0x48
+	cfbEntryOffsetChild       = 0x4c
+	cfbEntryOffsetStartSector = 0x74
+	cfbEntryOffsetSize        = 0x78
+)
+
+// Types of directory entries.
+const (
+	cfbTypeStorage = 1
+	cfbTypeStream  = 2
+	cfbTypeRoot    = 5
+)
+
+type cfbEntry struct {
+	name        string
+	entryType   byte
+	left        uint32
+	right       uint32
+	child       uint32
+	startSector uint32
+	size        uint64
+}
+
+// cfbFile is a compound file binary, the container format of Outlook .msg
+// files and legacy Office documents, read from memory.
+type cfbFile struct {
+	data             []byte
+	sectorSize       int
+	miniSectorSize   int
+	miniStreamCutoff uint64
+	fat              []uint32
+	miniFAT          []uint32
+	miniStream       []byte
+	entries          []cfbEntry
+}
+
+// openCFB reads the allocation tables and the directory of a compound
+// file.
+func openCFB(data []byte) (*cfbFile, error) {
+	if len(data) < cfbHeaderSize || string(data[:8]) != cfbSignature {
+		return nil, fmt.Errorf("%w: no compound file signature", ErrInvalidMSG)
+	}
+
+	sectorShift := binary.LittleEndian.Uint16(data[cfbOffsetSectorShift:])
+	miniSectorShift := binary.LittleEndian.Uint16(
+		data[cfbOffsetMiniSectorShift:],
+	)
+
+	if sectorShift < cfbMinSectorShift || sectorShift > cfbMaxSectorShift ||
+		miniSectorShift >= sectorShift {
+		return nil, fmt.Errorf("%w: invalid sector size", ErrInvalidMSG)
+	}
+
+	file := &cfbFile{
+		data:           data,
+		sectorSize:     1 << sectorShift,
+		miniSectorSize: 1 << miniSectorShift,
+		miniStreamCutoff: uint64(binary.LittleEndian.Uint32(
+			data[cfbOffsetMiniStreamCutoff:],
+		)),
+		fat:        nil,
+		miniFAT:    nil,
+		miniStream: nil,
+		entries:    nil,
+	}
+
+	file.fat = file.readFAT()
+
+	directory, err := file.readChain(
+		binary.LittleEndian.Uint32(data[cfbOffsetFirstDirSector:]),
+		0,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read directory: %w", err)
+	}
+
+	for len(directory) >= cfbDirectoryEntrySize {
+		file.entries = append(file.entries, parseCFBEntry(directory))
+		directory = directory[cfbDirectoryEntrySize:]
+	}
+
+	// Version 3 files, with 512-byte sectors, may leave garbage in the most
+	// significant 32 bits of stream sizes.
+	if file.sectorSize == cfbVersion3SectorSize {
+		for i := range file.entries {
+			file.entries[i].size &= math.MaxUint32
+		}
+	}
+
+	if len(file.entries) == 0 || file.entries[0].entryType != cfbTypeRoot {
+		return nil, fmt.Errorf("%w: no root storage", ErrInvalidMSG)
+	}
+
+	miniFAT, err := file.readChain(
+		binary.LittleEndian.Uint32(data[cfbOffsetFirstMiniFAT:]),
+		0,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read mini FAT: %w", err)
+	}
+
+	file.miniFAT = littleEndianUint32s(miniFAT)
+
+	root := file.entries[0]
+
+	file.miniStream, err = file.readChain(root.startSector, root.size)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read mini stream: %w", err)
+	}
+
+	return file, nil
+}
+
+// readFAT collects the sectors of the FAT listed in the header and in the
+// DIFAT sector chain, and concatenates them. Repeated sectors are read
+// once, so that a crafted file cannot multiply the size of the FAT.
+func (c *cfbFile) readFAT() []uint32 {
+	fatSectors := littleEndianUint32s(
+		c.data[cfbOffsetDIFAT : cfbOffsetDIFAT+4*cfbHeaderDIFATEntries],
+	)
+
+	entriesPerSector := c.sectorSize / 4
+	difatSector := binary.LittleEndian.Uint32(c.data[cfbOffsetFirstDIFAT:])
+	visited := make(map[uint32]bool)
+
+	for range len(c.data) / c.sectorSize {
+		sector := c.sector(difatSector)
+		if sector == nil || visited[difatSector] {
+			break
+		}
+
+		visited[difatSector] = true
+
+		entries := littleEndianUint32s(sector)
+		fatSectors = append(fatSectors, entries[:entriesPerSector-1]...)
+		difatSector = entries[entriesPerSector-1]
+	}
+
+	var fat []uint32
+
+	clear(visited)
+
+	for _, fatSector := range fatSectors {
+		sector := c.sector(fatSector)
+		if sector == nil || visited[fatSector] {
+			continue
+		}
+
+		visited[fatSector] = true
+
+		fat = append(fat, littleEndianUint32s(sector)...)
+	}
+
+	return fat
+}
+
+// sector returns a regular sector, or nil when the number does not refer to
+// a sector in the file.
+func (c *cfbFile) sector(n uint32) []byte {
+	if n > cfbMaxRegularSector {
+		return nil
+	}
+
+	offset := (int64(n) + 1) * int64(c.sectorSize)
+	if offset+int64(c.sectorSize) > int64(len(c.data)) {
+		return nil
+	}
+
+	return c.data[offset : offset+int64(c.sectorSize)]
+}
+
+// readChain reads a chain of regular sectors, truncated to size when size
+// is not 0.
+func (c *cfbFile) readChain(start uint32, size uint64) ([]byte, error) {
+	return readSectorChain(
+		start,
+		size,
+		c.fat,
+		len(c.data)/c.sectorSize,
+		c.sector,
+	)
+}
+
+// readMiniChain reads a chain of sectors of the mini stream.
+func (c *cfbFile) readMiniChain(start uint32, size uint64) ([]byte, error) {
+	miniSector := func(n uint32) []byte {
+		offset := int64(n) * int64(c.miniSectorSize)
+		if n > cfbMaxRegularSector ||
+			offset+int64(c.miniSectorSize) > int64(len(c.miniStream)) {
+			return nil
+		}
+
+		return c.miniStream[offset : offset+int64(c.miniSectorSize)]
+	}
+
+	return readSectorChain(
+		start,
+		size,
+		c.miniFAT,
+		len(c.miniStream)/c.miniSectorSize,
+		miniSector,
+	)
+}
+
+// readSectorChain reads a chain of at most maxSectors sectors. It returns
+// an error wrapping ErrInvalidMSG when the chain visits a sector twice.
+func readSectorChain(
+	start uint32,
+	size uint64,
+	fat []uint32,
+	maxSectors int,
+	sector func(uint32) []byte,
+) ([]byte, error) {
+	var data []byte
+
+	visited := make(map[uint32]bool)
+
+	next := start
+	for next != cfbEndOfChain && next != cfbNoStream {
+		if visited[next] {
+			return nil, fmt.Errorf(
+				"%w: sector chain loops at %#x",
+				ErrInvalidMSG,
+				next,
+			)
+		}
+
+		visited[next] = true
+
+		content := sector(next)
+		if content == nil || int(next) >= len(fat) ||
+			len(visited) > maxSectors {
+			return nil, fmt.Errorf(
+				"%w: invalid sector %#x",
+				ErrInvalidMSG,
+				next,
+			)
+		}
+
+		data = append(data, content...)
+		next = fat[next]
+
+		if size > 0 && uint64(len(data)) >= size {
+			break
+		}
+	}
+
+	if size > 0 {
+		if uint64(len(data)) < size {
+			return nil, fmt.Errorf("%w: truncated stream", ErrInvalidMSG)
+		}
+
+		data = data[:size]
+	}
+
+	return data, nil
+}
+
+func parseCFBEntry(data []byte) cfbEntry {
+	nameLength := int(
+		binary.LittleEndian.Uint16(data[cfbEntryOffsetNameLength:]),
+	)
+
+	return cfbEntry{
+		name: decodeUTF16LE(
+			data[:min(max(nameLength, 0), cfbDirectoryNameLength)],
+		),
+		entryType: data[cfbEntryOffsetType],
+		left:      binary.LittleEndian.Uint32(data[cfbEntryOffsetLeft:]),
+		right:     binary.LittleEndian.Uint32(data[cfbEntryOffsetRight:]),
+		child:     binary.LittleEndian.Uint32(data[cfbEntryOffsetChild:]),
+		startSector: binary.LittleEndian.Uint32(
+			data[cfbEntryOffsetStartSector:],
+		),
+		size: binary.LittleEndian.Uint64(data[cfbEntryOffsetSize:]),
+	}
+}
+
+// children returns the entries of a storage by name.
+func (c *cfbFile) children(storage int) map[string]int {
+	children := make(map[string]int)
+
+	var visit func(id uint32, depth int)
+	visit = func(id uint32, depth int) {
+		// The siblings form a tree with at most one node per entry.
+		if int(id) >= len(c.entries) || depth > len(c.entries) {
+			return
+		}
+
+		entry := c.entries[id]
+		if _, found := children[entry.name]; found {
+			return
+		}
+
+		children[entry.name] = int(id)
+
+		visit(entry.left, depth+1)
+		visit(entry.right, depth+1)
+	}
+
+	visit(c.entries[storage].child, 0)
+
+	return children
+}
+
+// readStream reads the content of a stream entry.
+func (c *cfbFile) readStream(id int) ([]byte, error) {
+	entry := c.entries[id]
+	if entry.entryType != cfbTypeStream {
+		return nil, fmt.Errorf(
+			"%w: %q is not a stream",
+			ErrInvalidMSG,
+			entry.name,
+		)
+	}
+
+	if entry.size == 0 {
+		return []byte{}, nil
+	}
+
+	if entry.size > uint64(len(c.data)) {
+		return nil, fmt.Errorf(
+			"%w: stream %q is too large",
+			ErrInvalidMSG,
+			entry.name,
+		)
+	}
+
+	if entry.size < c.miniStreamCutoff {
+		return c.readMiniChain(entry.startSector, entry.size)
+	}
+
+	return c.readChain(entry.startSector, entry.size)
+}
+
+func littleEndianUint32s(data []byte) []uint32 {
+	values := make([]uint32, len(data)/4)
+
+	for i := range values {
+		values[i] = binary.LittleEndian.Uint32(data[4*i:])
+	}
+
+	return values
+}
@@ -0,0 +1,332 @@
+package letters
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const contentIDScheme = "cid:"
+
+type (
+	// ContentIDRewriter returns the URL that replaces a cid: URL that
+	// refers to the inline file.
+	ContentIDRewriter func(file InlineFile) string
+)
+
+// ContentIDReference links a cid: URL in an HTML body to the inline file it
+// refers to.
+type ContentIDReference struct {
+	// URL is the cid: URL as written in the HTML body.
+	URL string
+
+	// ContentID is the Content-ID the URL refers to.
+	ContentID string
+
+	// File is the inline file with the Content-ID, or nil when the email
+	// does not contain one.
+	File *InlineFile
+}
+
+// ContentIDResolution describes how the cid: URLs of an HTML body relate to
+// the inline files of an email.
+type ContentIDResolution struct {
+	// References contains every distinct cid: URL in document order.
+	References []ContentIDReference
+
+	// Missing lists the Content-IDs that are referenced but that no inline
+	// file has.
+	Missing []string
+
+	// Orphaned lists the inline files that are not referenced.
+	Orphaned []InlineFile
+}
+
+// InlineFileDataURI returns the contents of the inline file as a base64
+// data: URI. It can be passed to RewriteContentIDs.
+func InlineFileDataURI(file InlineFile) string {
+	mediaType := file.ContentType.ContentType
+	if mediaType == "" {
+		mediaType = "application/octet-stream"
+	}
+
+	return "data:" + mediaType + ";base64," +
+		base64.StdEncoding.EncodeToString(file.Data)
+}
+
+// ResolveContentIDs links the cid: URLs in the HTML body of the email to its
+// inline files.
+func (e Email) ResolveContentIDs() (ContentIDResolution, error) {
+	return ResolveContentIDs(e.HTML, e.InlineFiles)
+}
+
+// RewriteContentIDs returns the HTML body of the email with the cid: URLs
+// that refer to its inline files replaced by the URLs that rewrite returns.
+func (e Email) RewriteContentIDs(rewrite ContentIDRewriter) (string, error) {
+	return RewriteContentIDs(e.HTML, e.InlineFiles, rewrite)
+}
+
+// ResolveContentIDs links the cid: URLs (RFC 2392) in an HTML body to the
+// inline files with the matching Content-ID.
+//
+// URLs are read from element attributes such as src, href and background,
+// and from url() values in style attributes and style elements.
+func ResolveContentIDs(
+	htmlBody string,
+	files []InlineFile,
+) (ContentIDResolution, error) {
+	var resolution ContentIDResolution
+
+	document, err := html.Parse(strings.NewReader(htmlBody))
+	if err != nil {
+		return resolution, fmt.Errorf(
+			"letters.contentid.ResolveContentIDs: cannot parse HTML: %w",
+			err,
+		)
+	}
+
+	seenURLs := make(map[string]bool)
+	referenced := make(map[int]bool)
+	missing := make(map[string]bool)
+
+	forEachContentIDURL(document, func(cidURL string) string {
+		if seenURLs[cidURL] {
+			return cidURL
+		}
+
+		seenURLs[cidURL] = true
+
+		contentID := parseContentIDURL(cidURL)
+		reference := ContentIDReference{
+			URL:       cidURL,
+			ContentID: contentID,
+			File:      nil,
+		}
+
+		index := findInlineFile(files, contentID)
+		if index >= 0 {
+			reference.File = &files[index]
+			referenced[index] = true
+		} else if !missing[contentID] {
+			missing[contentID] = true
+			resolution.Missing = append(resolution.Missing, contentID)
+		}
+
+		resolution.References = append(resolution.References, reference)
+
+		return cidURL
+	})
+
+	for i, file := range files {
+		if !referenced[i] {
+			resolution.Orphaned = append(resolution.Orphaned, file)
+		}
+	}
+
+	return resolution, nil
+}
+
+// RewriteContentIDs replaces the cid: URLs in an HTML body that refer to
+// one of the inline files with the URLs that rewrite returns, for example
+// InlineFileDataURI or a function that returns URLs where the caller serves
+// the files. URLs that do not refer to an inline file are left unchanged.
+//
+// The result is rendered from the parsed document, so it is a complete HTML
+// document even when htmlBody is a fragment.
+func RewriteContentIDs(
+	htmlBody string,
+	files []InlineFile,
+	rewrite ContentIDRewriter,
+) (string, error) {
+	document, err := html.Parse(strings.NewReader(htmlBody))
+	if err != nil {
+		return "", fmt.Errorf(
+			"letters.contentid.RewriteContentIDs: cannot parse HTML: %w",
+			err,
+		)
+	}
+
+	forEachContentIDURL(document, func(cidURL string) string {
+		index := findInlineFile(files, parseContentIDURL(cidURL))
+		if index < 0 {
+			return cidURL
+		}
+
+		return rewrite(files[index])
+	})
+
+	var b strings.Builder
+
+	err = html.Render(&b, document)
+	if err != nil {
+		return "", fmt.Errorf(
+			"letters.contentid.RewriteContentIDs: cannot render HTML: %w",
+			err,
+		)
+	}
+
+	return b.String(), nil
+}
+
+// parseContentIDURL returns the Content-ID that a cid: URL refers to.
+func parseContentIDURL(cidURL string) string {
+	contentID := strings.TrimSpace(cidURL)[len(contentIDScheme):]
+
+	unescaped, err := url.PathUnescape(contentID)
+	if err == nil {
+		contentID = unescaped
+	}
+
+	return strings.Trim(contentID, "<>")
+}
+
+func isContentIDURL(s string) bool {
+	s = strings.TrimSpace(s)
+
+	return len(s) > len(contentIDScheme) &&
+		strings.EqualFold(s[:len(contentIDScheme)], contentIDScheme)
+}
+
+// findInlineFile returns the index of the inline file with the Content-ID,
+// preferring an exact match to a case-insensitive one, or -1.
+func findInlineFile(files []InlineFile, contentID string) int {
+	fallback := -1
+
+	for i, file := range files {
+		if file.ContentID == contentID {
+			return i
+		}
+
+		if fallback < 0 && strings.EqualFold(file.ContentID, contentID) {
+			fallback = i
+		}
+	}
+
+	return fallback
+}
+
+// forEachContentIDURL calls replace for every cid: URL in the document and
+// replaces the URL with the result.
+func forEachContentIDURL(node *html.Node, replace func(string) string) {
+	if node.Type == html.ElementNode {
+		for i, attribute := range node.Attr {
+			switch {
+			case attribute.Key == "style":
+				node.Attr[i].Val = replaceCSSContentIDURLs(
+					attribute.Val,
+					replace,
+				)
+			case isContentIDURL(attribute.Val):
+				node.Attr[i].Val = replace(strings.TrimSpace(attribute.Val))
+			}
+		}
+
+		if node.DataAtom == atom.Style {
+			child := node.FirstChild
+			for ; child != nil; child = child.NextSibling {
+				if child.Type == html.TextNode {
+					child.Data = replaceCSSContentIDURLs(child.Data, replace)
+				}
+			}
+		}
+	}
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		forEachContentIDURL(child, replace)
+	}
+}
+
+// replaceCSSContentIDURLs calls replace for every url(cid:...) value in a
+// style sheet and replaces the URL with the result.
+func replaceCSSContentIDURLs(css string, replace func(string) string) string {
+	return replaceCSSURLs(css, func(cssURL string) string {
+		if !isContentIDURL(cssURL) {
+			return cssURL
+		}
+
+		return replace(cssURL)
+	})
+}
+
+// replaceCSSURLs calls replace for every url() value in a style sheet and
+// replaces the URL with the result.
+func replaceCSSURLs(css string, replace func(string) string) string {
+	css, _ = scanCSSURLs(css, replace)
+
+	return css
+}
+
+// scanCSSURLs works like replaceCSSURLs and also reports whether every url()
+// value is terminated. An unterminated value is copied unchanged without
+// calling replace.
+func scanCSSURLs(css string, replace func(string) string) (string, bool) {
+	var b strings.Builder
+
+	for {
+		start := indexFold(css, "url(")
+		if start < 0 {
+			b.WriteString(css)
+
+			return b.String(), true
+		}
+
+		start += len("url(")
+		b.WriteString(css[:start])
+		css = css[start:]
+
+		value := strings.TrimLeft(css, " \t\r\n")
+		b.WriteString(css[:len(css)-len(value)])
+		css = value
+
+		quote := ""
+		if strings.HasPrefix(css, `"`) || strings.HasPrefix(css, "'") {
+			quote = css[:1]
+			css = css[1:]
+		}
+
+		end := strings.IndexByte(css, ')')
+		if quote != "" {
+			end = strings.Index(css, quote)
+		}
+
+		if end < 0 {
+			b.WriteString(quote)
+			b.WriteString(css)
+
+			return b.String(), false
+		}
+
+		cssURL := css[:end]
+
+		replaced := replace(strings.TrimSpace(cssURL))
+		if replaced != strings.TrimSpace(cssURL) {
+			cssURL = replaced
+
+			switch {
+			case quote != "":
+				cssURL = escapeCSSString(cssURL, quote)
+			case strings.ContainsAny(cssURL, "()'\"\\ \t\r\n"):
+				cssURL = `"` + escapeCSSString(cssURL, `"`) + `"`
+			}
+		}
+
+		b.WriteString(quote)
+		b.WriteString(cssURL)
+
+		css = css[end:]
+	}
+}
+
+// escapeCSSString escapes a value for a CSS string delimited by quote.
+func escapeCSSString(value string, quote string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		quote, `\`+quote,
+		"\n", `\a `,
+		"\r", `\d `,
+	).Replace(value)
+}
@@ -0,0 +1,216 @@
+package letters_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mnako/letters"
+)
+
+func contentIDTestFiles() []letters.InlineFile {
+	return []letters.InlineFile{
+		{
+			ContentID: "logo@example.com",
+			ContentType: letters.ContentTypeHeader{
+				ContentType: "image/png",
+				Params:      map[string]string{},
+			},
+			ContentDisposition: letters.ContentDispositionHeader{
+				ContentDisposition: letters.ContentDispositionInline,
+				Params:             map[string]string{},
+			},
+			Data: []byte("png"),
+		},
+		{
+			ContentID: "Background@Example.com",
+			ContentType: letters.ContentTypeHeader{
+				ContentType: "image/gif",
+				Params:      map[string]string{},
+			},
+			ContentDisposition: letters.ContentDispositionHeader{
+				ContentDisposition: letters.ContentDispositionInline,
+				Params:             map[string]string{},
+			},
+			Data: []byte("gif"),
+		},
+		{
+			ContentID: "unused@example.com",
+			ContentType: letters.ContentTypeHeader{
+				ContentType: "image/jpeg",
+				Params:      map[string]string{},
+			},
+			ContentDisposition: letters.ContentDispositionHeader{
+				ContentDisposition: letters.ContentDispositionInline,
+				Params:             map[string]string{},
+			},
+			Data: []byte("jpg"),
+		},
+	}
+}
+
+const contentIDTestHTML = "<style>" +
+	".a { background: url( 'cid:logo@example.com' ) }</style>" +
+	"<div style=\"background-image:url(cid:background@example.com)\">" +
+	"<img src=\"cid:logo%40example.com\">" +
+	"<img src=\"CID:logo@example.com\">" +
+	"<img src=\"cid:missing@example.com\">" +
+	"</div>"
+
+func TestResolveContentIDs(t *testing.T) {
+	t.Parallel()
+
+	files := contentIDTestFiles()
+
+	resolution, err := letters.ResolveContentIDs(contentIDTestHTML, files)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var urls, contentIDs []string
+
+	for _, reference := range resolution.References {
+		urls = append(urls, reference.URL)
+		contentIDs = append(contentIDs, reference.ContentID)
+
+		if (reference.File == nil) !=
+			(reference.ContentID == "missing@example.com") {
+			t.Errorf("unexpected file for %q", reference.URL)
+		}
+	}
+
+	expectedURLs := []string{
+		"cid:logo@example.com",
+		"cid:background@example.com",
+		"cid:logo%40example.com",
+		"CID:logo@example.com",
+		"cid:missing@example.com",
+	}
+	if !reflect.DeepEqual(urls, expectedURLs) {
+		t.Errorf("unexpected URLs: %q", urls)
+	}
+
+	expectedContentIDs := []string{
+		"logo@example.com",
+		"background@example.com",
+		"logo@example.com",
+		"logo@example.com",
+		"missing@example.com",
+	}
+	if !reflect.DeepEqual(contentIDs, expectedContentIDs) {
+		t.Errorf("unexpected Content-IDs: %q", contentIDs)
+	}
+
+	if !reflect.DeepEqual(resolution.Missing, []string{"missing@example.com"}) {
+		t.Errorf("unexpected missing references: %q", resolution.Missing)
+	}
+
+	if len(resolution.Orphaned) != 1 ||
+		resolution.Orphaned[0].ContentID != "unused@example.com" {
+		t.Errorf("unexpected orphaned files: %#v", resolution.Orphaned)
+	}
+}
+
+func TestContentIDsNonASCIIStyles(t *testing.T) {
+	t.Parallel()
+
+	// Lowercasing changes the length of Ⱥ and İ in bytes.
+	for _, prefix := range []string{
+		"color:ȺȺȺȺȺȺȺȺȺȺȺȺ ",
+		"font-family:İİİİ;",
+	} {
+		html := "<div style=\"" + prefix +
+			"background:URL(cid:background@example.com)\">x</div>"
+
+		resolution, err := letters.ResolveContentIDs(
+			html,
+			contentIDTestFiles(),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if len(resolution.References) != 1 ||
+			resolution.References[0].ContentID != "background@example.com" {
+			t.Errorf("unexpected references: %#v", resolution.References)
+		}
+
+		rewritten, err := letters.RewriteContentIDs(
+			html,
+			contentIDTestFiles(),
+			letters.InlineFileDataURI,
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		expected := prefix + "background:URL(data:image/gif;base64,Z2lm)"
+		if !strings.Contains(rewritten, expected) {
+			t.Errorf("expected %q in %q", expected, rewritten)
+		}
+	}
+}
+
+func TestRewriteContentIDs(t *testing.T) {
+	t.Parallel()
+
+	files := contentIDTestFiles()
+
+	rewritten, err := letters.RewriteContentIDs(
+		contentIDTestHTML,
+		files,
+		letters.InlineFileDataURI,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, expected := range []string{
+		"url( 'data:image/png;base64,cG5n' )",
+		"background-image:url(data:image/gif;base64,Z2lm)",
+		`<img src="data:image/png;base64,cG5n"/>` +
+			`<img src="data:image/png;base64,cG5n"/>`,
+		`<img src="cid:missing@example.com"/>`,
+	} {
+		if !strings.Contains(rewritten, expected) {
+			t.Errorf("expected %q in %q", expected, rewritten)
+		}
+	}
+
+	rewritten, err = letters.RewriteContentIDs(
+		contentIDTestHTML,
+		files,
+		func(file letters.InlineFile) string {
+			return "/files/" + file.ContentID + "?a=(1)"
+		},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, expected := range []string{
+		"url( '/files/logo@example.com?a=(1)' )",
+		"url(&#34;/files/Background@Example.com?a=(1)&#34;)",
+		`<img src="/files/logo@example.com?a=(1)"/>`,
+	} {
+		if !strings.Contains(rewritten, expected) {
+			t.Errorf("expected %q in %q", expected, rewritten)
+		}
+	}
+
+	rewritten, err = letters.RewriteContentIDs(
+		contentIDTestHTML,
+		files,
+		func(file letters.InlineFile) string {
+			return "/files/" + file.ContentID + `?a='1'&b=\`
+		},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := `url( '/files/logo@example.com?a=\'1\'&b=\\' )`
+	if !strings.Contains(rewritten, expected) {
+		t.Errorf("expected %q in %q", expected, rewritten)
+	}
+}
@@ -2,13 +2,11 @@ package letters
 
 import (
 	"bytes"
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
 	"mime"
 	"mime/multipart"
-	"mime/quotedprintable"
 	"strings"
 
 	"golang.org/x/net/html/charset"
@@ -53,10 +51,8 @@ func decodeHeader(headerValue string) (string, error) {
 func decodeContent(
 	content io.Reader,
 	textEncoding encoding.Encoding,
-	cte ContentTransferEncoding,
+	decodeTransfer ContentTransferDecoder,
 ) (io.Reader, error) {
-	var contentReader io.Reader
-
 	contentBytes, err := io.ReadAll(content)
 	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
 		return nil, fmt.Errorf(
@@ -66,54 +62,17 @@ func decodeContent(
 		)
 	}
 
-	switch cte {
-	case cteBase64:
-		decoded := base64.NewDecoder(
-			base64.StdEncoding,
-			bytes.NewReader(contentBytes),
+	decodedBytes, err := decodeTransfer(contentBytes)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"letters.decoders.decodeContent: "+
+				"cannot decode content transfer encoding: %w",
+			err,
 		)
-
-		decodedBytes, err := io.ReadAll(decoded)
-		if errors.Is(err, io.ErrUnexpectedEOF) {
-			decoded = base64.NewDecoder(
-				base64.RawStdEncoding,
-				bytes.NewReader(contentBytes),
-			)
-
-			decodedBytes, err = io.ReadAll(decoded)
-			if err != nil {
-				return nil, fmt.Errorf(
-					"letters.decoders.decodeContent: "+
-						"cannot decode raw-std-base64-encoded content: %w",
-					err,
-				)
-			}
-		} else if err != nil {
-			return nil, fmt.Errorf(
-				"letters.decoders.decodeContent: "+
-					"cannot decode std-base64-encoded content: %w",
-				err,
-			)
-		}
-
-		contentReader = bytes.NewReader(decodedBytes)
-	case cteQuotedPrintable:
-		decoded := quotedprintable.NewReader(bytes.NewReader(contentBytes))
-
-		decodedBytes, err := io.ReadAll(decoded)
-		if err != nil {
-			return nil, fmt.Errorf(
-				"letters.decoders.decodeContent: "+
-					"cannot decode quoted-printable-encoded content: %w",
-				err,
-			)
-		}
-
-		contentReader = bytes.NewReader(decodedBytes)
-	case cte7bit, cte8bit, cteBinary:
-		contentReader = bytes.NewReader(contentBytes)
 	}
 
+	var contentReader io.Reader = bytes.NewReader(decodedBytes)
+
 	if textEncoding != nil {
 		contentReader = transform.NewReader(
 			contentReader,
@@ -126,7 +85,7 @@ func decodeContent(
 
 func decodeInlineFile(
 	part *multipart.Part,
-	cte ContentTransferEncoding,
+	decodeTransfer ContentTransferDecoder,
 ) (InlineFile, error) {
 	var ifl InlineFile
 
@@ -139,7 +98,7 @@ func decodeInlineFile(
 		)
 	}
 
-	decoded, err := decodeContent(part, nil, cte)
+	decoded, err := decodeContent(part, nil, decodeTransfer)
 	if err != nil {
 		return ifl, fmt.Errorf(
 			"letters.decoders.decodeInlineFile: "+
@@ -187,11 +146,11 @@ func decodeInlineFile(
 func decodeAttachmentFileFromBody(
 	body io.Reader,
 	headers Headers,
-	cte ContentTransferEncoding,
+	decodeTransfer ContentTransferDecoder,
 ) (AttachedFile, error) {
 	var afl AttachedFile
 
-	decoded, err := decodeContent(body, nil, cte)
+	decoded, err := decodeContent(body, nil, decodeTransfer)
 	if err != nil {
 		return afl, fmt.Errorf(
 			"letters.decoders.decodeAttachmentFileFromBody: "+
@@ -217,11 +176,11 @@ func decodeAttachmentFileFromBody(
 
 func decodeAttachedFileFromPart(
 	part *multipart.Part,
-	cte ContentTransferEncoding,
+	decodeTransfer ContentTransferDecoder,
 ) (AttachedFile, error) {
 	var afl AttachedFile
 
-	decoded, err := decodeContent(part, nil, cte)
+	decoded, err := decodeContent(part, nil, decodeTransfer)
 	if err != nil {
 		return afl, fmt.Errorf(
 			"letters.decoders.decodeAttachedFileFromPart: "+
@@ -0,0 +1,416 @@
+package letters
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const dkimSignatureHeader = "DKIM-Signature"
+
+// DKIMBodyLengthFull makes SignDKIM add an l= tag that covers the whole
+// canonicalized body.
+const DKIMBodyLengthFull int64 = -1
+
+// DKIMResult is the result of verifying a DKIM signature, as reported in
+// Authentication-Results (RFC 8601).
+type DKIMResult string
+
+// DKIM results defined in RFC 8601 Section 2.7.1.
+const (
+	DKIMResultPass      DKIMResult = "pass"
+	DKIMResultFail      DKIMResult = "fail"
+	DKIMResultTempError DKIMResult = "temperror"
+	DKIMResultPermError DKIMResult = "permerror"
+)
+
+// DKIMSignOptions configures SignDKIM.
+type DKIMSignOptions struct {
+	Domain   string
+	Selector string
+
+	// Signer is an *rsa.PrivateKey, an ed25519.PrivateKey, or another
+	// crypto.Signer backed by an RSA or Ed25519 key.
+	Signer crypto.Signer
+
+	// HeaderCanonicalization and BodyCanonicalization are
+	// CanonicalizationSimple or CanonicalizationRelaxed. Both default to
+	// CanonicalizationRelaxed.
+	HeaderCanonicalization string
+	BodyCanonicalization   string
+
+	// SignedHeaders lists the header fields the signature covers. Names
+	// may be repeated to sign several instances of a field or to prevent
+	// fields from being added later. The default set, limited to the
+	// fields present in the message, is used when it is empty.
+	SignedHeaders []string
+
+	// BodyLength adds an l= tag. Zero omits the tag and signs the whole
+	// body; a positive value signs at most that many bytes of the
+	// canonicalized body; DKIMBodyLengthFull signs the whole body and
+	// records its length.
+	BodyLength int64
+
+	// Identity is the optional Agent or User Identifier (i= tag).
+	Identity string
+
+	// Time is the signing time. The current time is used when it is zero.
+	Time time.Time
+
+	// Expiration adds an x= tag this long after Time when it is positive.
+	Expiration time.Duration
+}
+
+// DKIMVerification contains the outcome of verifying one DKIM-Signature.
+type DKIMVerification struct {
+	Result    DKIMResult
+	Signature DomainKeySignature
+
+	// Err describes why the signature did not pass.
+	Err error
+}
+
+// SignDKIM signs a message read from r as described in RFC 6376 Section 5
+// and returns it with a DKIM-Signature header field prepended.
+//
+// The message can be raw bytes as received, or an Email that the caller
+// serialized to RFC 5322 format.
+func SignDKIM(r io.Reader, options DKIMSignOptions) ([]byte, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"letters.dkim.SignDKIM: cannot read message: %w",
+			err,
+		)
+	}
+
+	fields, body, err := splitRawMessage(raw)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"letters.dkim.SignDKIM: cannot split message: %w",
+			err,
+		)
+	}
+
+	if options.Domain == "" || options.Selector == "" {
+		return nil, fmt.Errorf(
+			"letters.dkim.SignDKIM: %w: domain and selector are required",
+			ErrInvalidSignOptions,
+		)
+	}
+
+	algorithm, err := algorithmForSigner(options.Signer)
+	if err != nil {
+		return nil, fmt.Errorf("letters.dkim.SignDKIM: %w", err)
+	}
+
+	headerCanonicalization, err := dkimCanonicalization(
+		options.HeaderCanonicalization,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("letters.dkim.SignDKIM: %w", err)
+	}
+
+	bodyCanonicalization, err := dkimCanonicalization(
+		options.BodyCanonicalization,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("letters.dkim.SignDKIM: %w", err)
+	}
+
+	signedHeaders := options.SignedHeaders
+	if len(signedHeaders) == 0 {
+		signedHeaders = presentHeaders(fields, DefaultSignedHeaders())
+	}
+
+	if !slices.ContainsFunc(signedHeaders, func(name string) bool {
+		return strings.EqualFold(name, "From")
+	}) {
+		return nil, fmt.Errorf(
+			"letters.dkim.SignDKIM: %w: the From field must be signed",
+			ErrInvalidSignOptions,
+		)
+	}
+
+	if options.Identity != "" &&
+		!identityInDomain(options.Identity, options.Domain) {
+		return nil, fmt.Errorf(
+			"letters.dkim.SignDKIM: %w: identity %q is outside domain %q",
+			ErrInvalidSignOptions,
+			options.Identity,
+			options.Domain,
+		)
+	}
+
+	signingTime := options.Time
+	if signingTime.IsZero() {
+		signingTime = time.Now()
+	}
+
+	tags := [][2]string{
+		{"v", "1"},
+		{"a", algorithm},
+		{"c", headerCanonicalization + "/" + bodyCanonicalization},
+		{"d", options.Domain},
+		{"s", options.Selector},
+	}
+
+	if options.Identity != "" {
+		tags = append(tags, [2]string{"i", options.Identity})
+	}
+
+	tags = append(
+		tags,
+		[2]string{"t", strconv.FormatInt(signingTime.Unix(), 10)},
+	)
+
+	if options.Expiration > 0 {
+		tags = append(tags, [2]string{
+			"x",
+			strconv.FormatInt(signingTime.Add(options.Expiration).Unix(), 10),
+		})
+	}
+
+	bodyLength := int64(-1)
+	if options.BodyLength != 0 {
+		canonicalBodyLength := int64(
+			len(canonicalizeBody(body, bodyCanonicalization)),
+		)
+
+		bodyLength = canonicalBodyLength
+		if options.BodyLength > 0 && options.BodyLength < canonicalBodyLength {
+			bodyLength = options.BodyLength
+		}
+
+		tags = append(
+			tags,
+			[2]string{"l", strconv.FormatInt(bodyLength, 10)},
+		)
+	}
+
+	tags = append(
+		tags,
+		[2]string{"h", strings.ToLower(strings.Join(signedHeaders, ":"))},
+	)
+
+	signature, err := signMessage(fields, body, messageSigningParams{
+		headerName:             dkimSignatureHeader,
+		signer:                 options.Signer,
+		algorithm:              algorithm,
+		headerCanonicalization: headerCanonicalization,
+		bodyCanonicalization:   bodyCanonicalization,
+		signedHeaders:          signedHeaders,
+		bodyLength:             bodyLength,
+		tags:                   tags,
+	})
+	if err != nil {
+		return nil, fmt.Errorf(
+			"letters.dkim.SignDKIM: cannot sign message: %w",
+			err,
+		)
+	}
+
+	return prependHeaderFields(raw, signature), nil
+}
+
+func dkimCanonicalization(canonicalization string) (string, error) {
+	switch strings.ToLower(canonicalization) {
+	case "", CanonicalizationRelaxed:
+		return CanonicalizationRelaxed, nil
+	case CanonicalizationSimple:
+		return CanonicalizationSimple, nil
+	default:
+		return "", fmt.Errorf(
+			"%w: unknown canonicalization %q",
+			ErrInvalidSignOptions,
+			canonicalization,
+		)
+	}
+}
+
+// VerifyDKIM verifies every DKIM-Signature header field of a message read
+// from r, as described in RFC 6376 Section 6, and returns one result per
+// signature in header order.
+//
+// An error is returned only when the message cannot be read. The domains
+// of passing signatures are the DKIMDomains input of CheckDMARC.
+func VerifyDKIM(
+	ctx context.Context,
+	resolver DomainKeyResolver,
+	r io.Reader,
+) ([]DKIMVerification, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"letters.dkim.VerifyDKIM: cannot read message: %w",
+			err,
+		)
+	}
+
+	fields, body, err := splitRawMessage(raw)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"letters.dkim.VerifyDKIM: cannot split message: %w",
+			err,
+		)
+	}
+
+	var verifications []DKIMVerification
+
+	for _, field := range fields {
+		if !strings.EqualFold(field.name, dkimSignatureHeader) {
+			continue
+		}
+
+		verifications = append(
+			verifications,
+			verifyDKIMSignature(ctx, resolver, fields, body, field),
+		)
+	}
+
+	return verifications, nil
+}
+
+func verifyDKIMSignature(
+	ctx context.Context,
+	resolver DomainKeyResolver,
+	fields []rawHeaderField,
+	body []byte,
+	field rawHeaderField,
+) DKIMVerification {
+	signature, err := ParseDomainKeySignature(field.value())
+	if err != nil {
+		return DKIMVerification{
+			Result:    DKIMResultPermError,
+			Signature: signature,
+			Err:       err,
+		}
+	}
+
+	err = validateDKIMSignature(signature)
+	if err != nil {
+		return DKIMVerification{
+			Result:    DKIMResultPermError,
+			Signature: signature,
+			Err:       err,
+		}
+	}
+
+	err = verifyMessageSignature(ctx, resolver, fields, body, field, signature)
+	if err != nil {
+		result := DKIMResultFail
+		if isTransientKeyError(err) {
+			result = DKIMResultTempError
+		} else if errorsIsAny(
+			err,
+			ErrNoDomainKey,
+			ErrInvalidDomainKey,
+			ErrUnsupportedSignatureAlgorithm,
+		) {
+			result = DKIMResultPermError
+		}
+
+		return DKIMVerification{
+			Result:    result,
+			Signature: signature,
+			Err: fmt.Errorf(
+				"letters.dkim.VerifyDKIM: cannot verify signature "+
+					"of %q: %w",
+				signature.Domain,
+				err,
+			),
+		}
+	}
+
+	return DKIMVerification{Result: DKIMResultPass, Signature: signature}
+}
+
+func validateDKIMSignature(signature DomainKeySignature) error {
+	var problems []error
+
+	if signature.Tags["v"] != "1" {
+		problems = append(problems, fmt.Errorf(
+			"%w: unsupported version %q",
+			ErrInvalidSignature,
+			signature.Tags["v"],
+		))
+	}
+
+	for _, name := range []string{"a", "b", "bh", "d", "h", "s"} {
+		if signature.Tags[name] == "" {
+			problems = append(problems, fmt.Errorf(
+				"%w: missing %s= tag",
+				ErrInvalidSignature,
+				name,
+			))
+		}
+	}
+
+	for _, canonicalization := range []string{
+		signature.HeaderCanonicalization,
+		signature.BodyCanonicalization,
+	} {
+		if canonicalization != CanonicalizationSimple &&
+			canonicalization != CanonicalizationRelaxed {
+			problems = append(problems, fmt.Errorf(
+				"%w: unknown canonicalization %q",
+				ErrInvalidSignature,
+				signature.Tags["c"],
+			))
+
+			break
+		}
+	}
+
+	if identity, ok := signature.Tags["i"]; ok &&
+		!identityInDomain(identity, signature.Domain) {
+		problems = append(problems, fmt.Errorf(
+			"%w: identity %q is outside domain %q",
+			ErrInvalidSignature,
+			identity,
+			signature.Domain,
+		))
+	}
+
+	if !slices.Contains(signature.SignedHeaders, "from") {
+		problems = append(problems, fmt.Errorf(
+			"%w: From is not signed",
+			ErrInvalidSignature,
+		))
+	}
+
+	if expiration, ok := signature.Tags["x"]; ok {
+		seconds, err := strconv.ParseInt(expiration, 10, 64)
+		if err != nil || time.Unix(seconds, 0).Before(time.Now()) {
+			problems = append(problems, fmt.Errorf(
+				"%w: signature expired at %q",
+				ErrInvalidSignature,
+				expiration,
+			))
+		}
+	}
+
+	return errors.Join(problems...)
+}
+
+// identityInDomain reports whether the domain of an Agent or User Identifier
+// is domain or one of its subdomains, as RFC 6376 Section 3.5 requires of
+// the i= tag.
+func identityInDomain(identity string, domain string) bool {
+	at := strings.LastIndexByte(identity, '@')
+	if at < 0 || domain == "" {
+		return false
+	}
+
+	identityDomain := strings.ToLower(identity[at+1:])
+	domain = strings.ToLower(domain)
+
+	return identityDomain == domain ||
+		strings.HasSuffix(identityDomain, "."+domain)
+}
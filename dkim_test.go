@@ -0,0 +1,407 @@
+package letters_test
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mnako/letters"
+)
+
+func TestSignAndVerifyDKIM(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, ed25519Key := newTestSigners(t)
+	resolver := fakeDomainKeyResolver{
+		"rsa._domainkey.example.com": rsaKey.Public(),
+		"ed._domainkey.example.com":  ed25519Key.Public(),
+	}
+
+	testCases := []struct {
+		name    string
+		signer  crypto.Signer
+		options letters.DKIMSignOptions
+	}{
+		{
+			name:   "rsa relaxed/relaxed",
+			signer: rsaKey,
+			options: letters.DKIMSignOptions{
+				Selector: "rsa",
+			},
+		},
+		{
+			name:   "rsa simple/simple",
+			signer: rsaKey,
+			options: letters.DKIMSignOptions{
+				Selector:               "rsa",
+				HeaderCanonicalization: letters.CanonicalizationSimple,
+				BodyCanonicalization:   letters.CanonicalizationSimple,
+			},
+		},
+		{
+			name:   "ed25519 with custom headers",
+			signer: ed25519Key,
+			options: letters.DKIMSignOptions{
+				Selector:      "ed",
+				SignedHeaders: []string{"From", "Subject", "Subject"},
+				Identity:      "user@Mail.Example.com",
+				Expiration:    time.Hour,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			options := testCase.options
+			options.Domain = "example.com"
+			options.Signer = testCase.signer
+
+			signed, err := letters.SignDKIM(
+				strings.NewReader(arcTestMessage),
+				options,
+			)
+			if err != nil {
+				t.Fatalf("cannot sign message: %s", err)
+			}
+
+			if !bytes.HasPrefix(signed, []byte("DKIM-Signature: v=1;")) {
+				t.Fatalf("unexpected signed message: %q", signed)
+			}
+
+			verifications, err := letters.VerifyDKIM(
+				context.Background(),
+				resolver,
+				bytes.NewReader(signed),
+			)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if len(verifications) != 1 ||
+				verifications[0].Result != letters.DKIMResultPass {
+				t.Fatalf("expected one passing signature, got %#v", verifications)
+			}
+
+			tampered := bytes.Replace(
+				signed,
+				[]byte("Subject: Test ARC"),
+				[]byte("Subject: Test DKIM"),
+				1,
+			)
+
+			verifications, err = letters.VerifyDKIM(
+				context.Background(),
+				resolver,
+				bytes.NewReader(tampered),
+			)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if verifications[0].Result != letters.DKIMResultFail ||
+				!errors.Is(verifications[0].Err, letters.ErrSignatureMismatch) {
+				t.Errorf("expected a failing signature, got %#v", verifications)
+			}
+		})
+	}
+}
+
+// rfc8463TestMessage is the signed message of RFC 8463 Appendix A.3.
+const rfc8463TestMessage = "DKIM-Signature: v=1; a=ed25519-sha256; " +
+	"c=relaxed/relaxed;\r\n" +
+	" d=football.example.com; i=@football.example.com;\r\n" +
+	" q=dns/txt; s=brisbane; t=1528637909; h=from : to :\r\n" +
+	" subject : date : message-id : from : subject : date;\r\n" +
+	" bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;\r\n" +
+	" b=/gCrinpcQOoIfuHNQIbq4pgh9kyIK3AQUdt9OdqQehSwhEIug4D11Bus\r\n" +
+	" Fa3bT3FY5OsU7ZbnKELq+eXdp1Q1Dw==\r\n" +
+	"DKIM-Signature: v=1; a=rsa-sha256; c=relaxed/relaxed;\r\n" +
+	" d=football.example.com; i=@football.example.com;\r\n" +
+	" q=dns/txt; s=test; t=1528637909; h=from : to : subject :\r\n" +
+	" date : message-id : from : subject : date;\r\n" +
+	" bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;\r\n" +
+	" b=F45dVWDfMbQDGHJFlXUNB2HKfbCeLRyhDXgFpEL8GwpsRe0IeIixNTe3\r\n" +
+	" DhCVlUrSjV4BwcVcOF6+FF3Zo9Rpo1tFOeS9mPYQTnGdaSGsgeefOsk2Jz\r\n" +
+	" dA+L10TeYt9BgDfQNZtKdN1WO//KgIqXP7OdEFE4LjFYNcUxZQ4FADY+8=\r\n" +
+	"From: Joe SixPack <joe@football.example.com>\r\n" +
+	"To: Suzie Q <suzie@shopping.example.net>\r\n" +
+	"Subject: Is dinner ready?\r\n" +
+	"Date: Fri, 11 Jul 2003 21:00:37 -0700 (PDT)\r\n" +
+	"Message-ID: <20030712040037.46341.5F8J@football.example.com>\r\n" +
+	"\r\n" +
+	"Hi.\r\n" +
+	"\r\n" +
+	"We lost the game.  Are you hungry yet?\r\n" +
+	"\r\n" +
+	"Joe.\r\n"
+
+func TestVerifyDKIMRFC8463(t *testing.T) {
+	t.Parallel()
+
+	// The public keys of RFC 8463 Appendix A.2.
+	ed25519Key, err := letters.ParseDomainKeyRecord(
+		"v=DKIM1; k=ed25519; p=11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo=",
+	)
+	if err != nil {
+		t.Fatalf("cannot parse Ed25519 key: %s", err)
+	}
+
+	rsaKey, err := letters.ParseDomainKeyRecord(
+		"v=DKIM1; k=rsa; p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQDkHlOQoBTzWR" +
+			"iGs5V6NpP3idY6Wk08a5qhdR6wy5bdOKb2jLQiY/J16JYi0Qvx/byYzCNb3W91" +
+			"y3FutACDfzwQ/BC/e/8uBsCR+yz1Lxj+PL6lHvqMKrM3rG4hstT5QjvHO9Pzox" +
+			"ZyVYLzBfO2EeC3Ip3G+2kryOTIKT+l/K4w3QIDAQAB",
+	)
+	if err != nil {
+		t.Fatalf("cannot parse RSA key: %s", err)
+	}
+
+	resolver := fakeDomainKeyResolver{
+		"brisbane._domainkey.football.example.com": ed25519Key,
+		"test._domainkey.football.example.com":     rsaKey,
+	}
+
+	verifications, err := letters.VerifyDKIM(
+		context.Background(),
+		resolver,
+		strings.NewReader(rfc8463TestMessage),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(verifications) != 2 {
+		t.Fatalf("expected two signatures, got %#v", verifications)
+	}
+
+	for i, selector := range []string{"brisbane", "test"} {
+		if verifications[i].Result != letters.DKIMResultPass ||
+			verifications[i].Signature.Selector != selector {
+			t.Errorf("unexpected verification %d: %#v", i, verifications[i])
+		}
+	}
+
+	verifications, err = letters.VerifyDKIM(
+		context.Background(),
+		resolver,
+		strings.NewReader(
+			strings.Replace(rfc8463TestMessage, "hungry", "thirsty", 1),
+		),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for i, verification := range verifications {
+		if verification.Result != letters.DKIMResultFail {
+			t.Errorf("expected failing signature %d: %#v", i, verification)
+		}
+	}
+}
+
+func TestSignDKIMBodyLength(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, _ := newTestSigners(t)
+	resolver := fakeDomainKeyResolver{
+		"rsa._domainkey.example.com": rsaKey.Public(),
+	}
+
+	signed, err := letters.SignDKIM(
+		strings.NewReader(arcTestMessage),
+		letters.DKIMSignOptions{
+			Domain:     "example.com",
+			Selector:   "rsa",
+			Signer:     rsaKey,
+			BodyLength: letters.DKIMBodyLengthFull,
+		},
+	)
+	if err != nil {
+		t.Fatalf("cannot sign message: %s", err)
+	}
+
+	if !bytes.Contains(signed, []byte("l=46;")) {
+		t.Errorf("expected l=46 tag in %q", signed)
+	}
+
+	// A mailing list footer appended after signing is not covered by l=.
+	withFooter := append(
+		bytes.Clone(signed),
+		[]byte("--\r\nTo unsubscribe, reply STOP.\r\n")...,
+	)
+
+	verifications, err := letters.VerifyDKIM(
+		context.Background(),
+		resolver,
+		bytes.NewReader(withFooter),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if verifications[0].Result != letters.DKIMResultPass {
+		t.Errorf("expected pass, got %#v", verifications[0])
+	}
+}
+
+func TestSignDKIMLineEndings(t *testing.T) {
+	t.Parallel()
+
+	_, ed25519Key := newTestSigners(t)
+	resolver := fakeDomainKeyResolver{
+		"ed._domainkey.example.com": ed25519Key.Public(),
+	}
+
+	lfMessage := strings.ReplaceAll(arcTestMessage, "\r\n", "\n")
+
+	signed, err := letters.SignDKIM(
+		strings.NewReader(lfMessage),
+		letters.DKIMSignOptions{
+			Domain:   "example.com",
+			Selector: "ed",
+			Signer:   ed25519Key,
+		},
+	)
+	if err != nil {
+		t.Fatalf("cannot sign message: %s", err)
+	}
+
+	if bytes.Contains(signed, []byte("\r\n")) {
+		t.Errorf("expected LF line endings to be kept")
+	}
+
+	verifications, err := letters.VerifyDKIM(
+		context.Background(),
+		resolver,
+		bytes.NewReader(signed),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if verifications[0].Result != letters.DKIMResultPass {
+		t.Errorf("expected pass, got %#v", verifications[0])
+	}
+}
+
+func TestSignDKIMInvalidOptions(t *testing.T) {
+	t.Parallel()
+
+	_, ed25519Key := newTestSigners(t)
+
+	testCases := []struct {
+		name    string
+		options letters.DKIMSignOptions
+	}{
+		{
+			name: "unsigned From",
+			options: letters.DKIMSignOptions{
+				SignedHeaders: []string{"Subject"},
+			},
+		},
+		{
+			name: "identity outside domain",
+			options: letters.DKIMSignOptions{
+				Identity: "user@example.net",
+			},
+		},
+		{
+			name: "identity in a lookalike domain",
+			options: letters.DKIMSignOptions{
+				Identity: "@badexample.com",
+			},
+		},
+		{
+			name: "identity without a domain",
+			options: letters.DKIMSignOptions{
+				Identity: "user",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			options := testCase.options
+			options.Domain = "example.com"
+			options.Selector = "ed"
+			options.Signer = ed25519Key
+
+			_, err := letters.SignDKIM(
+				strings.NewReader(arcTestMessage),
+				options,
+			)
+			if !errors.Is(err, letters.ErrInvalidSignOptions) {
+				t.Errorf("expected ErrInvalidSignOptions, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyDKIMInvalidSignature(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		tags string
+	}{
+		{
+			name: "unknown canonicalization",
+			tags: "c=foo/bar; d=example.com",
+		},
+		{
+			name: "unknown body canonicalization",
+			tags: "c=relaxed/foo; d=example.com",
+		},
+		{
+			name: "identity outside domain",
+			tags: "d=example.com; i=user@example.net",
+		},
+		{
+			name: "identity in a lookalike domain",
+			tags: "d=example.com; i=@badexample.com",
+		},
+		{
+			name: "identity in a parent domain",
+			tags: "d=mail.example.com; i=@example.com",
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			message := "DKIM-Signature: v=1; a=ed25519-sha256; " +
+				testCase.tags + "; s=ed; h=from; bh=AAAA; b=AAAA\r\n" +
+				arcTestMessage
+
+			verifications, err := letters.VerifyDKIM(
+				context.Background(),
+				fakeDomainKeyResolver{},
+				strings.NewReader(message),
+			)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if len(verifications) != 1 ||
+				verifications[0].Result != letters.DKIMResultPermError ||
+				!errors.Is(verifications[0].Err, letters.ErrInvalidSignature) {
+				t.Errorf("expected a permerror, got %#v", verifications)
+			}
+		})
+	}
+}
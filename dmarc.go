@@ -0,0 +1,429 @@
+package letters
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// DMARCPolicy is a policy requested by a DMARC record.
+type DMARCPolicy string
+
+// DMARC policies defined in RFC 7489 Section 6.3.
+const (
+	DMARCPolicyNone       DMARCPolicy = "none"
+	DMARCPolicyQuarantine DMARCPolicy = "quarantine"
+	DMARCPolicyReject     DMARCPolicy = "reject"
+)
+
+// DMARCAlignment is an identifier alignment mode.
+type DMARCAlignment string
+
+// DMARC alignment modes defined in RFC 7489 Section 3.1.
+const (
+	DMARCAlignmentRelaxed DMARCAlignment = "r"
+	DMARCAlignmentStrict  DMARCAlignment = "s"
+)
+
+// DMARCResult is the result of a DMARC evaluation.
+type DMARCResult string
+
+// DMARC results as reported in Authentication-Results (RFC 8601).
+const (
+	DMARCResultNone      DMARCResult = "none"
+	DMARCResultPass      DMARCResult = "pass"
+	DMARCResultFail      DMARCResult = "fail"
+	DMARCResultTempError DMARCResult = "temperror"
+	DMARCResultPermError DMARCResult = "permerror"
+)
+
+const dmarcDefaultPercent = 100
+
+// DMARCRecord contains a parsed DMARC policy record.
+type DMARCRecord struct {
+	Policy          DMARCPolicy
+	SubdomainPolicy DMARCPolicy
+	DKIMAlignment   DMARCAlignment
+	SPFAlignment    DMARCAlignment
+	Percent         int
+	ReportAggregate []string
+	ReportFailure   []string
+	FailureOptions  string
+	ReportInterval  int
+}
+
+// DMARCAuthResults contains the authentication results that a DMARC
+// evaluation aligns against the RFC5322.From domain.
+type DMARCAuthResults struct {
+	// SPF is the result of CheckSPF for the message.
+	SPF SPFCheckResult
+
+	// DKIMDomains are the d= domains of all DKIM signatures that verified.
+	DKIMDomains []string
+}
+
+// DMARCCheckResult contains the outcome of a DMARC evaluation.
+type DMARCCheckResult struct {
+	Result DMARCResult
+
+	// FromDomain is the domain of the RFC5322.From address.
+	FromDomain string
+
+	// PolicyDomain is the domain the DMARC record was found for. It is
+	// the organizational domain when FromDomain publishes no record.
+	PolicyDomain string
+
+	Record      DMARCRecord
+	SPFAligned  bool
+	DKIMAligned bool
+
+	// Policy is the policy the receiver should apply to a failing message.
+	// It is DMARCPolicyNone for passing messages. Applying the Percent
+	// sampling rate of the record is left to the caller.
+	Policy DMARCPolicy
+}
+
+// ParseDMARCRecord parses a DMARC record as defined in RFC 7489 Section 6.4.
+func ParseDMARCRecord(s string) (DMARCRecord, error) {
+	record := DMARCRecord{
+		DKIMAlignment:  DMARCAlignmentRelaxed,
+		SPFAlignment:   DMARCAlignmentRelaxed,
+		Percent:        dmarcDefaultPercent,
+		FailureOptions: "0",
+		ReportInterval: 86400, //nolint:mnd // One day, RFC 7489 Section 6.3.
+	}
+
+	tags := strings.Split(s, ";")
+
+	version, value, _ := strings.Cut(tags[0], "=")
+	if strings.TrimSpace(version) != "v" ||
+		strings.TrimSpace(value) != "DMARC1" {
+		return record, fmt.Errorf(
+			"%w: missing v=DMARC1 in %q",
+			ErrInvalidDMARCRecord,
+			s,
+		)
+	}
+
+	hasPolicy := false
+
+	for _, tag := range tags[1:] {
+		name, value, ok := strings.Cut(tag, "=")
+		if !ok {
+			if strings.TrimSpace(tag) == "" {
+				continue
+			}
+
+			return record, fmt.Errorf(
+				"%w: invalid tag %q",
+				ErrInvalidDMARCRecord,
+				tag,
+			)
+		}
+
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+
+		var err error
+
+		switch name {
+		case "p":
+			hasPolicy = true
+			record.Policy, err = parseDMARCPolicy(value)
+		case "sp":
+			record.SubdomainPolicy, err = parseDMARCPolicy(value)
+		case "adkim":
+			record.DKIMAlignment, err = parseDMARCAlignment(value)
+		case "aspf":
+			record.SPFAlignment, err = parseDMARCAlignment(value)
+		case "pct":
+			record.Percent, err = parseDMARCInt(value, dmarcDefaultPercent)
+		case "ri":
+			record.ReportInterval, err = parseDMARCInt(value, -1)
+		case "rua":
+			record.ReportAggregate = parseDMARCURIs(value)
+		case "ruf":
+			record.ReportFailure = parseDMARCURIs(value)
+		case "fo":
+			record.FailureOptions = value
+		}
+
+		if err != nil {
+			return record, err
+		}
+	}
+
+	if !hasPolicy {
+		// RFC 7489 Section 6.6.3: a record without a valid p= tag but with
+		// a rua= tag is treated as p=none.
+		if len(record.ReportAggregate) == 0 {
+			return record, fmt.Errorf(
+				"%w: missing p= tag in %q",
+				ErrInvalidDMARCRecord,
+				s,
+			)
+		}
+
+		record.Policy = DMARCPolicyNone
+	}
+
+	if record.SubdomainPolicy == "" {
+		record.SubdomainPolicy = record.Policy
+	}
+
+	return record, nil
+}
+
+func parseDMARCPolicy(s string) (DMARCPolicy, error) {
+	policy := DMARCPolicy(strings.ToLower(s))
+
+	switch policy {
+	case DMARCPolicyNone, DMARCPolicyQuarantine, DMARCPolicyReject:
+		return policy, nil
+	default:
+		return policy, fmt.Errorf(
+			"%w: unknown policy %q",
+			ErrInvalidDMARCRecord,
+			s,
+		)
+	}
+}
+
+func parseDMARCAlignment(s string) (DMARCAlignment, error) {
+	alignment := DMARCAlignment(strings.ToLower(s))
+
+	switch alignment {
+	case DMARCAlignmentRelaxed, DMARCAlignmentStrict:
+		return alignment, nil
+	default:
+		return alignment, fmt.Errorf(
+			"%w: unknown alignment mode %q",
+			ErrInvalidDMARCRecord,
+			s,
+		)
+	}
+}
+
+func parseDMARCInt(s string, maxValue int) (int, error) {
+	value, err := strconv.Atoi(s)
+	if err != nil || value < 0 || (maxValue >= 0 && value > maxValue) {
+		return 0, fmt.Errorf(
+			"%w: invalid number %q",
+			ErrInvalidDMARCRecord,
+			s,
+		)
+	}
+
+	return value, nil
+}
+
+func parseDMARCURIs(s string) []string {
+	var uris []string
+
+	for uri := range strings.SplitSeq(s, ",") {
+		uri = strings.TrimSpace(uri)
+		if uri != "" {
+			uris = append(uris, uri)
+		}
+	}
+
+	return uris
+}
+
+// OrganizationalDomain returns the organizational domain of domain as
+// defined in RFC 7489 Section 3.2, using the public suffix list.
+func OrganizationalDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+
+	organizationalDomain, err := publicsuffix.EffectiveTLDPlusOne(domain)
+	if err != nil {
+		return domain
+	}
+
+	return organizationalDomain
+}
+
+func isDMARCAligned(
+	domain string,
+	fromDomain string,
+	alignment DMARCAlignment,
+) bool {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	if domain == "" {
+		return false
+	}
+
+	if alignment == DMARCAlignmentStrict {
+		return domain == fromDomain
+	}
+
+	return OrganizationalDomain(domain) == OrganizationalDomain(fromDomain)
+}
+
+// CheckDMARC evaluates the DMARC policy of the RFC5322.From domain in
+// headers against the SPF and DKIM results in authResults, as described
+// in RFC 7489 Section 6.6.
+//
+// A temperror or permerror result is returned together with an error that
+// describes the cause.
+func CheckDMARC(
+	ctx context.Context,
+	resolver TXTResolver,
+	headers Headers,
+	authResults DMARCAuthResults,
+) (DMARCCheckResult, error) {
+	var result DMARCCheckResult
+
+	fromDomain, err := dmarcFromDomain(headers)
+	if err != nil {
+		result.Result = DMARCResultPermError
+
+		return result, fmt.Errorf(
+			"letters.dmarc.CheckDMARC: cannot determine From domain: %w",
+			err,
+		)
+	}
+
+	result.FromDomain = fromDomain
+
+	record, policyDomain, err := lookupDMARCRecord(ctx, resolver, fromDomain)
+	if err != nil {
+		result.Result = DMARCResultTempError
+
+		return result, fmt.Errorf(
+			"letters.dmarc.CheckDMARC: cannot look up DMARC record: %w",
+			err,
+		)
+	}
+
+	if policyDomain == "" {
+		result.Result = DMARCResultNone
+		result.Policy = DMARCPolicyNone
+
+		return result, nil
+	}
+
+	result.PolicyDomain = policyDomain
+	result.Record = record
+
+	result.SPFAligned = authResults.SPF.Result == SPFResultPass &&
+		isDMARCAligned(authResults.SPF.Domain, fromDomain, record.SPFAlignment)
+
+	for _, dkimDomain := range authResults.DKIMDomains {
+		if isDMARCAligned(dkimDomain, fromDomain, record.DKIMAlignment) {
+			result.DKIMAligned = true
+
+			break
+		}
+	}
+
+	if result.SPFAligned || result.DKIMAligned {
+		result.Result = DMARCResultPass
+		result.Policy = DMARCPolicyNone
+
+		return result, nil
+	}
+
+	result.Result = DMARCResultFail
+
+	result.Policy = record.Policy
+	if policyDomain != fromDomain {
+		result.Policy = record.SubdomainPolicy
+	}
+
+	return result, nil
+}
+
+func dmarcFromDomain(headers Headers) (string, error) {
+	if len(headers.From) == 0 {
+		return "", fmt.Errorf(
+			"letters.dmarc.dmarcFromDomain: %w",
+			ErrNoFromDomain,
+		)
+	}
+
+	var fromDomain string
+
+	for _, from := range headers.From {
+		_, domain, ok := strings.Cut(from.Address, "@")
+		if !ok || domain == "" {
+			return "", fmt.Errorf(
+				"letters.dmarc.dmarcFromDomain: %w in %q",
+				ErrNoFromDomain,
+				from.Address,
+			)
+		}
+
+		domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+
+		// RFC 7489 Section 6.6.1: messages with multiple From domains
+		// cannot be evaluated against a single policy.
+		if fromDomain != "" && domain != fromDomain {
+			return "", fmt.Errorf(
+				"letters.dmarc.dmarcFromDomain: %w: %q and %q",
+				ErrMultipleFromDomains,
+				fromDomain,
+				domain,
+			)
+		}
+
+		fromDomain = domain
+	}
+
+	return fromDomain, nil
+}
+
+func lookupDMARCRecord(
+	ctx context.Context,
+	resolver TXTResolver,
+	fromDomain string,
+) (DMARCRecord, string, error) {
+	domains := []string{fromDomain}
+
+	organizationalDomain := OrganizationalDomain(fromDomain)
+	if organizationalDomain != fromDomain {
+		domains = append(domains, organizationalDomain)
+	}
+
+	for _, domain := range domains {
+		txts, err := resolver.LookupTXT(ctx, "_dmarc."+domain)
+		if err != nil && !isDNSNotFound(err) {
+			return DMARCRecord{}, "", fmt.Errorf(
+				"letters.dmarc.lookupDMARCRecord: "+
+					"cannot look up TXT records of %q: %w",
+				"_dmarc."+domain,
+				err,
+			)
+		}
+
+		var records []DMARCRecord
+
+		for _, txt := range txts {
+			if !strings.HasPrefix(strings.TrimSpace(txt), "v=DMARC1") {
+				continue
+			}
+
+			record, err := ParseDMARCRecord(txt)
+			if err != nil {
+				continue
+			}
+
+			records = append(records, record)
+		}
+
+		// RFC 7489 Section 6.6.3: more than one record means no record,
+		// without falling back to the Organizational Domain.
+		switch len(records) {
+		case 0:
+		case 1:
+			return records[0], domain, nil
+		default:
+			return DMARCRecord{}, "", nil
+		}
+	}
+
+	return DMARCRecord{}, "", nil
+}
@@ -0,0 +1,214 @@
+package letters_test
+
+import (
+	"context"
+	"errors"
+	"net/mail"
+	"testing"
+
+	"github.com/mnako/letters"
+)
+
+func TestParseDMARCRecord(t *testing.T) {
+	t.Parallel()
+
+	record, err := letters.ParseDMARCRecord(
+		"v=DMARC1; p=reject; sp=quarantine; adkim=s; pct=50; " +
+			"rua=mailto:dmarc@example.com,mailto:dmarc@example.net",
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if record.Policy != letters.DMARCPolicyReject ||
+		record.SubdomainPolicy != letters.DMARCPolicyQuarantine ||
+		record.DKIMAlignment != letters.DMARCAlignmentStrict ||
+		record.SPFAlignment != letters.DMARCAlignmentRelaxed ||
+		record.Percent != 50 ||
+		len(record.ReportAggregate) != 2 {
+		t.Errorf("unexpected record: %#v", record)
+	}
+
+	for _, invalid := range []string{
+		"v=DMARC2; p=none",
+		"v=DMARC1; p=maybe",
+		"v=DMARC1; p=none; pct=101",
+		"v=DMARC1; adkim=x",
+	} {
+		_, err := letters.ParseDMARCRecord(invalid)
+		if !errors.Is(err, letters.ErrInvalidDMARCRecord) {
+			t.Errorf("%q: expected ErrInvalidDMARCRecord, got %v", invalid, err)
+		}
+	}
+}
+
+func TestCheckDMARC(t *testing.T) {
+	t.Parallel()
+
+	resolver := fakeDNSResolver{
+		txt: map[string][]string{
+			"_dmarc.example.com": {"v=DMARC1; p=reject; sp=quarantine"},
+			"_dmarc.example.org": {"v=DMARC1; p=quarantine; aspf=s"},
+			"_dmarc.news.example.org": {
+				"v=DMARC1; p=none",
+				"v=DMARC1; p=reject",
+			},
+		},
+		fail: map[string]bool{
+			"_dmarc.example.net": true,
+		},
+	}
+
+	testCases := []struct {
+		name                 string
+		from                 string
+		authResults          letters.DMARCAuthResults
+		expectedResult       letters.DMARCResult
+		expectedPolicy       letters.DMARCPolicy
+		expectedPolicyDomain string
+	}{
+		{
+			name: "aligned SPF pass",
+			from: "alice@example.com",
+			authResults: letters.DMARCAuthResults{
+				SPF: letters.SPFCheckResult{
+					Result: letters.SPFResultPass,
+					Domain: "bounces.example.com",
+				},
+			},
+			expectedResult:       letters.DMARCResultPass,
+			expectedPolicy:       letters.DMARCPolicyNone,
+			expectedPolicyDomain: "example.com",
+		},
+		{
+			name: "aligned DKIM pass",
+			from: "alice@example.com",
+			authResults: letters.DMARCAuthResults{
+				SPF: letters.SPFCheckResult{
+					Result: letters.SPFResultPass,
+					Domain: "esp.example.net",
+				},
+				DKIMDomains: []string{"esp.example.net", "example.com"},
+			},
+			expectedResult:       letters.DMARCResultPass,
+			expectedPolicy:       letters.DMARCPolicyNone,
+			expectedPolicyDomain: "example.com",
+		},
+		{
+			name: "unaligned fail",
+			from: "alice@example.com",
+			authResults: letters.DMARCAuthResults{
+				SPF: letters.SPFCheckResult{
+					Result: letters.SPFResultPass,
+					Domain: "esp.example.net",
+				},
+			},
+			expectedResult:       letters.DMARCResultFail,
+			expectedPolicy:       letters.DMARCPolicyReject,
+			expectedPolicyDomain: "example.com",
+		},
+		{
+			name: "subdomain policy from organizational domain",
+			from: "alice@news.example.com",
+			authResults: letters.DMARCAuthResults{
+				SPF: letters.SPFCheckResult{
+					Result: letters.SPFResultFail,
+					Domain: "news.example.com",
+				},
+			},
+			expectedResult:       letters.DMARCResultFail,
+			expectedPolicy:       letters.DMARCPolicyQuarantine,
+			expectedPolicyDomain: "example.com",
+		},
+		{
+			name: "strict SPF alignment",
+			from: "alice@example.org",
+			authResults: letters.DMARCAuthResults{
+				SPF: letters.SPFCheckResult{
+					Result: letters.SPFResultPass,
+					Domain: "bounces.example.org",
+				},
+			},
+			expectedResult:       letters.DMARCResultFail,
+			expectedPolicy:       letters.DMARCPolicyQuarantine,
+			expectedPolicyDomain: "example.org",
+		},
+		{
+			name: "multiple records without organizational domain fallback",
+			from: "alice@news.example.org",
+			authResults: letters.DMARCAuthResults{
+				SPF: letters.SPFCheckResult{
+					Result: letters.SPFResultFail,
+					Domain: "news.example.org",
+				},
+			},
+			expectedResult: letters.DMARCResultNone,
+			expectedPolicy: letters.DMARCPolicyNone,
+		},
+		{
+			name:           "no record",
+			from:           "alice@example.edu",
+			expectedResult: letters.DMARCResultNone,
+			expectedPolicy: letters.DMARCPolicyNone,
+		},
+		{
+			name:           "dns failure",
+			from:           "alice@example.net",
+			expectedResult: letters.DMARCResultTempError,
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			headers := letters.Headers{
+				From: []*mail.Address{{Address: testCase.from}},
+			}
+
+			result, err := letters.CheckDMARC(
+				context.Background(),
+				resolver,
+				headers,
+				testCase.authResults,
+			)
+			if err != nil &&
+				testCase.expectedResult != letters.DMARCResultTempError {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if result.Result != testCase.expectedResult ||
+				result.Policy != testCase.expectedPolicy ||
+				result.PolicyDomain != testCase.expectedPolicyDomain {
+				t.Errorf("unexpected result: %#v", result)
+			}
+		})
+	}
+}
+
+func TestCheckDMARCMultipleFromDomains(t *testing.T) {
+	t.Parallel()
+
+	headers := letters.Headers{
+		From: []*mail.Address{
+			{Address: "alice@example.com"},
+			{Address: "bob@example.net"},
+		},
+	}
+
+	result, err := letters.CheckDMARC(
+		context.Background(),
+		fakeDNSResolver{},
+		headers,
+		letters.DMARCAuthResults{},
+	)
+	if !errors.Is(err, letters.ErrMultipleFromDomains) {
+		t.Fatalf("expected ErrMultipleFromDomains, got %v", err)
+	}
+
+	if result.Result != letters.DMARCResultPermError {
+		t.Errorf("unexpected result: got %q", result.Result)
+	}
+}
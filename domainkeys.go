@@ -0,0 +1,870 @@
+package letters
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1" //nolint:gosec // rsa-sha1 is still needed to verify old signatures.
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signature algorithms defined in RFC 6376 Section 3.3 and RFC 8463.
+const (
+	SignatureAlgorithmRSASHA1       = "rsa-sha1"
+	SignatureAlgorithmRSASHA256     = "rsa-sha256"
+	SignatureAlgorithmEd25519SHA256 = "ed25519-sha256"
+)
+
+// Canonicalization algorithms defined in RFC 6376 Section 3.4.
+const (
+	CanonicalizationSimple  = "simple"
+	CanonicalizationRelaxed = "relaxed"
+)
+
+const (
+	domainKeyFoldWidth  = 76
+	domainKeyChunkWidth = 72
+)
+
+// DomainKeySignature contains the tags of a DKIM-Signature or an
+// ARC-Message-Signature or ARC-Seal header field, which share the tag-list
+// syntax of RFC 6376 Section 3.2.
+type DomainKeySignature struct {
+	Algorithm              string
+	HeaderCanonicalization string
+	BodyCanonicalization   string
+	Domain                 string
+	Selector               string
+	SignedHeaders          []string
+	BodyHash               []byte
+	Signature              []byte
+
+	// BodyLength is the value of the l= tag, or -1 when the whole body is
+	// signed.
+	BodyLength int64
+
+	Timestamp time.Time
+
+	// Tags contains all tags as they appear in the header field, including
+	// the ones that have dedicated fields.
+	Tags map[string]string
+}
+
+// DomainKeyResolver looks up the public key published for a selector and
+// a signing domain.
+type DomainKeyResolver interface {
+	LookupDomainKey(
+		ctx context.Context,
+		selector string,
+		domain string,
+	) (crypto.PublicKey, error)
+}
+
+// TXTDomainKeyResolver is a DomainKeyResolver that reads key records from
+// "<selector>._domainkey.<domain>" TXT records.
+type TXTDomainKeyResolver struct {
+	Resolver TXTResolver
+}
+
+// LookupDomainKey looks up and parses the key record for selector and domain.
+func (r TXTDomainKeyResolver) LookupDomainKey(
+	ctx context.Context,
+	selector string,
+	domain string,
+) (crypto.PublicKey, error) {
+	name := selector + "._domainkey." + domain
+
+	txts, err := r.Resolver.LookupTXT(ctx, name)
+	if err != nil {
+		if isDNSNotFound(err) {
+			return nil, fmt.Errorf(
+				"letters.domainkeys.LookupDomainKey: %w for %q",
+				ErrNoDomainKey,
+				name,
+			)
+		}
+
+		return nil, fmt.Errorf(
+			"letters.domainkeys.LookupDomainKey: "+
+				"cannot look up TXT records of %q: %w",
+			name,
+			err,
+		)
+	}
+
+	if len(txts) == 0 {
+		return nil, fmt.Errorf(
+			"letters.domainkeys.LookupDomainKey: %w for %q",
+			ErrNoDomainKey,
+			name,
+		)
+	}
+
+	return ParseDomainKeyRecord(txts[0])
+}
+
+// ParseDomainKeyRecord parses the public key from a DKIM key record as
+// defined in RFC 6376 Section 3.6.1.
+func ParseDomainKeyRecord(s string) (crypto.PublicKey, error) {
+	tags, err := parseTagList(s)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"letters.domainkeys.ParseDomainKeyRecord: %w: %w",
+			ErrInvalidDomainKey,
+			err,
+		)
+	}
+
+	if version, ok := tags["v"]; ok && version != "DKIM1" {
+		return nil, fmt.Errorf(
+			"letters.domainkeys.ParseDomainKeyRecord: "+
+				"%w: unknown version %q",
+			ErrInvalidDomainKey,
+			version,
+		)
+	}
+
+	encodedKey := stripWhitespace(tags["p"])
+	if encodedKey == "" {
+		return nil, fmt.Errorf(
+			"letters.domainkeys.ParseDomainKeyRecord: %w: key revoked",
+			ErrInvalidDomainKey,
+		)
+	}
+
+	keyBytes, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"letters.domainkeys.ParseDomainKeyRecord: %w: %w",
+			ErrInvalidDomainKey,
+			err,
+		)
+	}
+
+	switch keyType := tags["k"]; keyType {
+	case "", "rsa":
+		publicKey, err := x509.ParsePKIXPublicKey(keyBytes)
+		if err != nil {
+			rsaPublicKey, pkcs1Err := x509.ParsePKCS1PublicKey(keyBytes)
+			if pkcs1Err != nil {
+				return nil, fmt.Errorf(
+					"letters.domainkeys.ParseDomainKeyRecord: %w: %w",
+					ErrInvalidDomainKey,
+					err,
+				)
+			}
+
+			return rsaPublicKey, nil
+		}
+
+		rsaPublicKey, ok := publicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf(
+				"letters.domainkeys.ParseDomainKeyRecord: "+
+					"%w: not an RSA key",
+				ErrInvalidDomainKey,
+			)
+		}
+
+		return rsaPublicKey, nil
+	case "ed25519":
+		if len(keyBytes) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf(
+				"letters.domainkeys.ParseDomainKeyRecord: "+
+					"%w: invalid Ed25519 key size %d",
+				ErrInvalidDomainKey,
+				len(keyBytes),
+			)
+		}
+
+		return ed25519.PublicKey(keyBytes), nil
+	default:
+		return nil, fmt.Errorf(
+			"letters.domainkeys.ParseDomainKeyRecord: "+
+				"%w: unknown key type %q",
+			ErrInvalidDomainKey,
+			keyType,
+		)
+	}
+}
+
+// ParseDomainKeySignature parses the value of a DKIM-Signature,
+// ARC-Message-Signature, or ARC-Seal header field.
+func ParseDomainKeySignature(s string) (DomainKeySignature, error) {
+	signature := DomainKeySignature{
+		HeaderCanonicalization: CanonicalizationSimple,
+		BodyCanonicalization:   CanonicalizationSimple,
+		BodyLength:             -1,
+	}
+
+	tags, err := parseTagList(s)
+	if err != nil {
+		return signature, fmt.Errorf(
+			"letters.domainkeys.ParseDomainKeySignature: %w: %w",
+			ErrInvalidSignature,
+			err,
+		)
+	}
+
+	signature.Tags = tags
+	signature.Algorithm = strings.ToLower(tags["a"])
+	signature.Domain = strings.ToLower(tags["d"])
+	signature.Selector = tags["s"]
+
+	if canonicalization, ok := tags["c"]; ok {
+		headerCanonicalization, bodyCanonicalization, hasBody := strings.Cut(
+			strings.ToLower(canonicalization),
+			"/",
+		)
+
+		signature.HeaderCanonicalization = headerCanonicalization
+		if hasBody {
+			signature.BodyCanonicalization = bodyCanonicalization
+		}
+	}
+
+	for name := range strings.SplitSeq(tags["h"], ":") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" {
+			signature.SignedHeaders = append(signature.SignedHeaders, name)
+		}
+	}
+
+	signature.BodyHash, err = decodeTagBase64(tags, "bh")
+	if err != nil {
+		return signature, err
+	}
+
+	signature.Signature, err = decodeTagBase64(tags, "b")
+	if err != nil {
+		return signature, err
+	}
+
+	if bodyLength, ok := tags["l"]; ok {
+		signature.BodyLength, err = strconv.ParseInt(bodyLength, 10, 64)
+		if err != nil || signature.BodyLength < 0 {
+			return signature, fmt.Errorf(
+				"letters.domainkeys.ParseDomainKeySignature: "+
+					"%w: invalid body length %q",
+				ErrInvalidSignature,
+				bodyLength,
+			)
+		}
+	}
+
+	if timestamp, ok := tags["t"]; ok {
+		seconds, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return signature, fmt.Errorf(
+				"letters.domainkeys.ParseDomainKeySignature: "+
+					"%w: invalid timestamp %q",
+				ErrInvalidSignature,
+				timestamp,
+			)
+		}
+
+		signature.Timestamp = time.Unix(seconds, 0)
+	}
+
+	return signature, nil
+}
+
+func decodeTagBase64(tags map[string]string, name string) ([]byte, error) {
+	value, ok := tags[name]
+	if !ok {
+		return nil, nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(stripWhitespace(value))
+	if err != nil {
+		return nil, fmt.Errorf(
+			"letters.domainkeys.decodeTagBase64: "+
+				"%w: cannot decode %s= tag: %w",
+			ErrInvalidSignature,
+			name,
+			err,
+		)
+	}
+
+	return decoded, nil
+}
+
+func parseTagList(s string) (map[string]string, error) {
+	tags := make(map[string]string)
+
+	for tag := range strings.SplitSeq(s, ";") {
+		if strings.TrimSpace(tag) == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(tag, "=")
+		if !ok {
+			return nil, fmt.Errorf(
+				"letters.domainkeys.parseTagList: "+
+					"%w: invalid tag %q",
+				ErrInvalidTagList,
+				strings.TrimSpace(tag),
+			)
+		}
+
+		name = strings.TrimSpace(name)
+		if _, exists := tags[name]; exists {
+			return nil, fmt.Errorf(
+				"letters.domainkeys.parseTagList: "+
+					"%w: duplicate tag %q",
+				ErrInvalidTagList,
+				name,
+			)
+		}
+
+		tags[name] = strings.TrimSpace(
+			strings.NewReplacer("\r\n", "", "\n", "").Replace(value),
+		)
+	}
+
+	return tags, nil
+}
+
+func errorsIsAny(err error, targets ...error) bool {
+	for _, target := range targets {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func stripWhitespace(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\r', '\n':
+			return -1
+		default:
+			return r
+		}
+	}, s)
+}
+
+// rawHeaderField is a header field exactly as it appears in a message,
+// including folding whitespace and the terminating CRLF.
+type rawHeaderField struct {
+	name string
+	raw  string
+}
+
+func (f rawHeaderField) value() string {
+	_, value, _ := strings.Cut(f.raw, ":")
+
+	return value
+}
+
+// splitRawMessage splits a message into its header fields and its body,
+// normalizing all line endings to CRLF as RFC 6376 canonicalization
+// expects.
+func splitRawMessage(raw []byte) ([]rawHeaderField, []byte, error) {
+	normalized := bytes.ReplaceAll(raw, []byte("\r\n"), []byte("\n"))
+	normalized = bytes.ReplaceAll(normalized, []byte("\n"), []byte("\r\n"))
+
+	if bytes.HasPrefix(normalized, []byte("\r\n")) {
+		return nil, normalized[2:], nil
+	}
+
+	headerSection, body, found := bytes.Cut(normalized, []byte("\r\n\r\n"))
+	if !found {
+		headerSection = bytes.TrimSuffix(normalized, []byte("\r\n"))
+	}
+
+	var fields []rawHeaderField
+
+	for line := range strings.SplitSeq(string(headerSection), "\r\n") {
+		if line != "" && (line[0] == ' ' || line[0] == '\t') {
+			if len(fields) == 0 {
+				return nil, nil, fmt.Errorf(
+					"letters.domainkeys.splitRawMessage: "+
+						"%w: continuation line before first field",
+					ErrMalformedHeader,
+				)
+			}
+
+			fields[len(fields)-1].raw += line + "\r\n"
+
+			continue
+		}
+
+		name, _, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, nil, fmt.Errorf(
+				"letters.domainkeys.splitRawMessage: %w: %q",
+				ErrMalformedHeader,
+				line,
+			)
+		}
+
+		fields = append(fields, rawHeaderField{
+			name: strings.TrimRight(name, " \t"),
+			raw:  line + "\r\n",
+		})
+	}
+
+	return fields, body, nil
+}
+
+func canonicalizeHeader(field string, canonicalization string) string {
+	if canonicalization != CanonicalizationRelaxed {
+		return field
+	}
+
+	name, value, _ := strings.Cut(field, ":")
+	value = strings.NewReplacer("\r\n", "", "\n", "").Replace(value)
+
+	return strings.ToLower(strings.TrimRight(name, " \t")) + ":" +
+		strings.Join(strings.FieldsFunc(value, isWSP), " ") + "\r\n"
+}
+
+func isWSP(r rune) bool {
+	return r == ' ' || r == '\t'
+}
+
+func canonicalizeBody(body []byte, canonicalization string) []byte {
+	lines := strings.Split(string(body), "\r\n")
+
+	if canonicalization == CanonicalizationRelaxed {
+		for i, line := range lines {
+			lines[i] = relaxBodyLine(line)
+		}
+	}
+
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	if len(lines) == 0 {
+		if canonicalization == CanonicalizationRelaxed {
+			return nil
+		}
+
+		return []byte("\r\n")
+	}
+
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+// relaxBodyLine reduces each run of whitespace within a line to a single
+// space and removes whitespace at the end of the line.
+func relaxBodyLine(line string) string {
+	var relaxed strings.Builder
+
+	inWSP := false
+
+	for _, r := range line {
+		if isWSP(r) {
+			inWSP = true
+
+			continue
+		}
+
+		if inWSP {
+			relaxed.WriteByte(' ')
+
+			inWSP = false
+		}
+
+		relaxed.WriteRune(r)
+	}
+
+	return relaxed.String()
+}
+
+// selectSignedHeaders returns the header fields listed in names, choosing
+// instances from the bottom of the header up as described in RFC 6376
+// Section 5.4.2. Names without a remaining instance are skipped.
+func selectSignedHeaders(
+	fields []rawHeaderField,
+	names []string,
+) []rawHeaderField {
+	used := make(map[int]bool)
+	selected := make([]rawHeaderField, 0, len(names))
+
+	for _, name := range names {
+		for i := len(fields) - 1; i >= 0; i-- {
+			if used[i] || !strings.EqualFold(fields[i].name, name) {
+				continue
+			}
+
+			used[i] = true
+
+			selected = append(selected, fields[i])
+
+			break
+		}
+	}
+
+	return selected
+}
+
+// removeSignatureValue empties the value of the b= tag of a signature
+// header field, keeping everything else byte for byte.
+func removeSignatureValue(field string) string {
+	name, value, _ := strings.Cut(field, ":")
+
+	offset := 0
+	for tag := range strings.SplitSeq(value, ";") {
+		tagName, _, ok := strings.Cut(tag, "=")
+		if ok && strings.TrimSpace(tagName) == "b" {
+			equals := offset + strings.IndexByte(tag, '=') + 1
+			end := offset + len(tag)
+
+			trailer := ""
+			if strings.HasSuffix(value[:end], "\r\n") {
+				trailer = "\r\n"
+			}
+
+			return name + ":" + value[:equals] + trailer + value[end:]
+		}
+
+		offset += len(tag) + 1
+	}
+
+	return field
+}
+
+func hashForAlgorithm(algorithm string) (crypto.Hash, error) {
+	switch algorithm {
+	case SignatureAlgorithmRSASHA256, SignatureAlgorithmEd25519SHA256:
+		return crypto.SHA256, nil
+	case SignatureAlgorithmRSASHA1:
+		return crypto.SHA1, nil
+	default:
+		return 0, fmt.Errorf(
+			"letters.domainkeys.hashForAlgorithm: %w %q",
+			ErrUnsupportedSignatureAlgorithm,
+			algorithm,
+		)
+	}
+}
+
+func newHash(hashAlgorithm crypto.Hash) hash.Hash {
+	if hashAlgorithm == crypto.SHA1 {
+		return sha1.New() //nolint:gosec // Needed for rsa-sha1 signatures.
+	}
+
+	return sha256.New()
+}
+
+func algorithmForSigner(signer crypto.Signer) (string, error) {
+	switch signer.Public().(type) {
+	case *rsa.PublicKey:
+		return SignatureAlgorithmRSASHA256, nil
+	case ed25519.PublicKey:
+		return SignatureAlgorithmEd25519SHA256, nil
+	default:
+		return "", fmt.Errorf(
+			"letters.domainkeys.algorithmForSigner: %w %T",
+			ErrUnsupportedKeyType,
+			signer.Public(),
+		)
+	}
+}
+
+func signDigest(
+	signer crypto.Signer,
+	algorithm string,
+	digest []byte,
+) ([]byte, error) {
+	var opts crypto.SignerOpts = crypto.SHA256
+	if algorithm == SignatureAlgorithmEd25519SHA256 {
+		// RFC 8463 Section 3: Ed25519 signs the SHA-256 digest itself.
+		opts = crypto.Hash(0)
+	}
+
+	signature, err := signer.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"letters.domainkeys.signDigest: cannot sign digest: %w",
+			err,
+		)
+	}
+
+	return signature, nil
+}
+
+func verifyDigest(
+	publicKey crypto.PublicKey,
+	algorithm string,
+	hashAlgorithm crypto.Hash,
+	digest []byte,
+	signature []byte,
+) error {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		if algorithm == SignatureAlgorithmEd25519SHA256 {
+			break
+		}
+
+		err := rsa.VerifyPKCS1v15(key, hashAlgorithm, digest, signature)
+		if err != nil {
+			return fmt.Errorf(
+				"letters.domainkeys.verifyDigest: %w: %w",
+				ErrSignatureMismatch,
+				err,
+			)
+		}
+
+		return nil
+	case ed25519.PublicKey:
+		if algorithm != SignatureAlgorithmEd25519SHA256 {
+			break
+		}
+
+		if !ed25519.Verify(key, digest, signature) {
+			return fmt.Errorf(
+				"letters.domainkeys.verifyDigest: %w",
+				ErrSignatureMismatch,
+			)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf(
+		"letters.domainkeys.verifyDigest: %w: key %T cannot verify %q",
+		ErrUnsupportedKeyType,
+		publicKey,
+		algorithm,
+	)
+}
+
+func computeBodyHash(
+	body []byte,
+	canonicalization string,
+	bodyLength int64,
+	hashAlgorithm crypto.Hash,
+) []byte {
+	canonicalBody := canonicalizeBody(body, canonicalization)
+	if bodyLength >= 0 && bodyLength < int64(len(canonicalBody)) {
+		canonicalBody = canonicalBody[:bodyLength]
+	}
+
+	bodyHasher := newHash(hashAlgorithm)
+	bodyHasher.Write(canonicalBody)
+
+	return bodyHasher.Sum(nil)
+}
+
+func computeHeaderHash(
+	fields []rawHeaderField,
+	signatureField string,
+	canonicalization string,
+	hashAlgorithm crypto.Hash,
+) []byte {
+	headerHasher := newHash(hashAlgorithm)
+
+	for _, field := range fields {
+		headerHasher.Write(
+			[]byte(canonicalizeHeader(field.raw, canonicalization)),
+		)
+	}
+
+	headerHasher.Write([]byte(strings.TrimSuffix(
+		canonicalizeHeader(
+			removeSignatureValue(signatureField),
+			canonicalization,
+		),
+		"\r\n",
+	)))
+
+	return headerHasher.Sum(nil)
+}
+
+// verifyMessageSignature verifies a DKIM-Signature or ARC-Message-Signature
+// header field over the header fields and body of a message.
+func verifyMessageSignature(
+	ctx context.Context,
+	resolver DomainKeyResolver,
+	fields []rawHeaderField,
+	body []byte,
+	signatureField rawHeaderField,
+	signature DomainKeySignature,
+) error {
+	hashAlgorithm, err := hashForAlgorithm(signature.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	bodyHash := computeBodyHash(
+		body,
+		signature.BodyCanonicalization,
+		signature.BodyLength,
+		hashAlgorithm,
+	)
+	if !bytes.Equal(bodyHash, signature.BodyHash) {
+		return fmt.Errorf(
+			"letters.domainkeys.verifyMessageSignature: %w",
+			ErrBodyHashMismatch,
+		)
+	}
+
+	publicKey, err := resolver.LookupDomainKey(
+		ctx,
+		signature.Selector,
+		signature.Domain,
+	)
+	if err != nil {
+		return fmt.Errorf(
+			"letters.domainkeys.verifyMessageSignature: "+
+				"cannot look up key %q for %q: %w",
+			signature.Selector,
+			signature.Domain,
+			err,
+		)
+	}
+
+	headerHash := computeHeaderHash(
+		selectSignedHeaders(fields, signature.SignedHeaders),
+		signatureField.raw,
+		signature.HeaderCanonicalization,
+		hashAlgorithm,
+	)
+
+	return verifyDigest(
+		publicKey,
+		signature.Algorithm,
+		hashAlgorithm,
+		headerHash,
+		signature.Signature,
+	)
+}
+
+type messageSigningParams struct {
+	headerName             string
+	signer                 crypto.Signer
+	algorithm              string
+	headerCanonicalization string
+	bodyCanonicalization   string
+	signedHeaders          []string
+	bodyLength             int64
+
+	// tags are written before the bh= and b= tags, which signMessage adds.
+	tags [][2]string
+}
+
+// signMessage computes a DKIM-Signature or ARC-Message-Signature header
+// field over the header fields and body of a message.
+func signMessage(
+	fields []rawHeaderField,
+	body []byte,
+	params messageSigningParams,
+) (string, error) {
+	hashAlgorithm, err := hashForAlgorithm(params.algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	bodyHash := computeBodyHash(
+		body,
+		params.bodyCanonicalization,
+		params.bodyLength,
+		hashAlgorithm,
+	)
+
+	tags := slices.Clone(params.tags)
+	tags = append(
+		tags,
+		[2]string{"bh", base64.StdEncoding.EncodeToString(bodyHash)},
+		[2]string{"b", ""},
+	)
+
+	signatureField := formatSignatureField(params.headerName, tags)
+
+	headerHash := computeHeaderHash(
+		selectSignedHeaders(fields, params.signedHeaders),
+		signatureField,
+		params.headerCanonicalization,
+		hashAlgorithm,
+	)
+
+	signature, err := signDigest(params.signer, params.algorithm, headerHash)
+	if err != nil {
+		return "", err
+	}
+
+	return appendSignatureValue(signatureField, signature), nil
+}
+
+// formatSignatureField formats a signature header field from tags. The
+// last tag must be "b" with an empty value; the signature is appended with
+// appendSignatureValue once the field has been hashed.
+func formatSignatureField(name string, tags [][2]string) string {
+	var field strings.Builder
+
+	field.WriteString(name + ":")
+
+	lineLength := field.Len()
+
+	for i, tag := range tags {
+		part := tag[0] + "=" + tag[1]
+		if i < len(tags)-1 {
+			part += ";"
+		}
+
+		if lineLength+len(part)+1 > domainKeyFoldWidth {
+			field.WriteString("\r\n\t")
+
+			lineLength = 1
+		} else {
+			field.WriteString(" ")
+
+			lineLength++
+		}
+
+		field.WriteString(part)
+
+		lineLength += len(part)
+	}
+
+	return field.String()
+}
+
+func appendSignatureValue(field string, signature []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(signature)
+
+	var folded strings.Builder
+
+	folded.WriteString(field)
+
+	for len(encoded) > domainKeyChunkWidth {
+		folded.WriteString("\r\n\t" + encoded[:domainKeyChunkWidth])
+		encoded = encoded[domainKeyChunkWidth:]
+	}
+
+	folded.WriteString("\r\n\t" + encoded + "\r\n")
+
+	return folded.String()
+}
+
+// prependHeaderFields adds header fields, formatted with CRLF line endings,
+// to the top of a message, using the line endings of the message.
+func prependHeaderFields(raw []byte, fields ...string) []byte {
+	prefix := strings.Join(fields, "")
+
+	usesBareLF := !bytes.Contains(raw, []byte("\r\n")) &&
+		bytes.Contains(raw, []byte("\n"))
+	if usesBareLF {
+		prefix = strings.ReplaceAll(prefix, "\r\n", "\n")
+	}
+
+	return append([]byte(prefix), raw...)
+}
@@ -0,0 +1,432 @@
+package letters
+
+import (
+	"html"
+	"strconv"
+	"strings"
+)
+
+const (
+	enrichedMaxCommandLength = 60
+	enrichedMaxParamLength   = 64
+)
+
+type enrichedNode struct {
+	// command is the lower-cased command name, or empty for text.
+	command  string
+	param    string
+	text     string
+	children []*enrichedNode
+}
+
+// EnrichedToHTML converts text/enriched content (RFC 1896) to HTML.
+//
+// Only the formatting commands defined in RFC 1896 produce markup. Text is
+// escaped, color, fontfamily and lang parameters are validated before they
+// are used, and unknown commands are ignored while their content is kept, so
+// the result is safe to embed in an HTML document.
+func EnrichedToHTML(s string) string {
+	var b strings.Builder
+
+	for _, node := range parseEnriched(s).children {
+		node.renderHTML(&b, false)
+	}
+
+	return b.String()
+}
+
+// EnrichedToText converts text/enriched content (RFC 1896) to plain text.
+//
+// Formatting commands and their parameters are removed, line breaks are
+// interpreted as described in RFC 1896 Section 2, and excerpts are quoted
+// with "> ".
+func EnrichedToText(s string) string {
+	var b strings.Builder
+
+	for _, node := range parseEnriched(s).children {
+		node.renderText(&b, false)
+	}
+
+	return b.String()
+}
+
+func parseEnriched(s string) *enrichedNode {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+
+	root := &enrichedNode{command: "", param: "", text: "", children: nil}
+	stack := []*enrichedNode{root}
+
+	var (
+		text    strings.Builder
+		inParam bool
+		param   strings.Builder
+	)
+
+	flushText := func() {
+		if text.Len() == 0 {
+			return
+		}
+
+		if inParam {
+			param.WriteString(text.String())
+		} else {
+			top := stack[len(stack)-1]
+			top.children = append(top.children, &enrichedNode{
+				command:  "",
+				param:    "",
+				text:     text.String(),
+				children: nil,
+			})
+		}
+
+		text.Reset()
+	}
+
+	for len(s) > 0 {
+		if strings.HasPrefix(s, "<<") {
+			text.WriteByte('<')
+
+			s = s[2:]
+
+			continue
+		}
+
+		command, closing, length := parseEnrichedCommand(s)
+		if length == 0 {
+			text.WriteByte(s[0])
+
+			s = s[1:]
+
+			continue
+		}
+
+		s = s[length:]
+
+		flushText()
+
+		switch {
+		case command == "param" && !closing:
+			inParam = true
+
+			param.Reset()
+		case command == "param" && closing:
+			if inParam {
+				top := stack[len(stack)-1]
+				top.param = param.String()
+				inParam = false
+			}
+		case !closing:
+			node := &enrichedNode{
+				command:  command,
+				param:    "",
+				text:     "",
+				children: nil,
+			}
+
+			top := stack[len(stack)-1]
+			top.children = append(top.children, node)
+			stack = append(stack, node)
+		default:
+			// Close the matching command along with any commands that
+			// were improperly left open inside it.
+			for i := len(stack) - 1; i > 0; i-- {
+				if stack[i].command == command {
+					stack = stack[:i]
+
+					break
+				}
+			}
+		}
+	}
+
+	flushText()
+
+	return root
+}
+
+// parseEnrichedCommand returns the command at the start of s and the length
+// of its markup, or a zero length when s does not start with a command.
+func parseEnrichedCommand(s string) (string, bool, int) {
+	if !strings.HasPrefix(s, "<") {
+		return "", false, 0
+	}
+
+	end := strings.IndexByte(s, '>')
+	if end < 0 {
+		return "", false, 0
+	}
+
+	name := s[1:end]
+	closing := strings.HasPrefix(name, "/")
+	name = strings.TrimPrefix(name, "/")
+
+	if name == "" || len(name) > enrichedMaxCommandLength {
+		return "", false, 0
+	}
+
+	for _, r := range []byte(name) {
+		if !isASCIILetter(r) && !isASCIIDigit(r) && r != '-' {
+			return "", false, 0
+		}
+	}
+
+	return strings.ToLower(name), closing, end + 1
+}
+
+// fillEnrichedText applies the RFC 1896 line break rules outside nofill: a
+// single newline is a space and a run of n newlines is n-1 line breaks.
+func fillEnrichedText(s string, lineBreak string) string {
+	var b strings.Builder
+
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '\n')
+		if i < 0 {
+			b.WriteString(s)
+
+			break
+		}
+
+		b.WriteString(s[:i])
+
+		s = s[i:]
+		newlines := len(s) - len(strings.TrimLeft(s, "\n"))
+		s = s[newlines:]
+
+		if newlines == 1 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteString(strings.Repeat(lineBreak, newlines-1))
+		}
+	}
+
+	return b.String()
+}
+
+func (n *enrichedNode) renderText(b *strings.Builder, nofill bool) {
+	if n.command == "" {
+		if nofill {
+			b.WriteString(n.text)
+
+			return
+		}
+
+		text := fillEnrichedText(n.text, "\n")
+		if strings.HasSuffix(b.String(), "\n") {
+			// A newline after a block such as an excerpt does not start
+			// the next line with a space.
+			text = strings.TrimPrefix(text, " ")
+		}
+
+		b.WriteString(text)
+
+		return
+	}
+
+	if n.command == "nofill" {
+		nofill = true
+	}
+
+	if n.command != "excerpt" {
+		for _, child := range n.children {
+			child.renderText(b, nofill)
+		}
+
+		return
+	}
+
+	var excerpt strings.Builder
+
+	for _, child := range n.children {
+		child.renderText(&excerpt, nofill)
+	}
+
+	if b.Len() > 0 && !strings.HasSuffix(b.String(), "\n") {
+		b.WriteByte('\n')
+	}
+
+	lines := strings.Split(strings.TrimSuffix(excerpt.String(), "\n"), "\n")
+	for i, line := range lines {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+
+		b.WriteString(strings.TrimRight("> "+line, " "))
+	}
+
+	b.WriteByte('\n')
+}
+
+func (n *enrichedNode) renderHTML(b *strings.Builder, nofill bool) {
+	if n.command == "" {
+		text := html.EscapeString(n.text)
+		if !nofill {
+			text = fillEnrichedText(text, "<br>\n")
+		}
+
+		b.WriteString(text)
+
+		return
+	}
+
+	if n.command == "nofill" {
+		nofill = true
+	}
+
+	openTag, closeTag := enrichedHTMLTags(n.command, n.param)
+
+	b.WriteString(openTag)
+
+	for _, child := range n.children {
+		child.renderHTML(b, nofill)
+	}
+
+	b.WriteString(closeTag)
+}
+
+func enrichedHTMLTags(command string, param string) (string, string) {
+	param = strings.TrimSpace(param)
+
+	switch command {
+	case "bold":
+		return "<b>", "</b>"
+	case "italic":
+		return "<i>", "</i>"
+	case "underline":
+		return "<u>", "</u>"
+	case "fixed":
+		return "<code>", "</code>"
+	case "smaller":
+		return "<small>", "</small>"
+	case "bigger":
+		return `<span style="font-size:larger">`, "</span>"
+	case "center":
+		return `<div style="text-align:center">`, "</div>"
+	case "flushleft":
+		return `<div style="text-align:left">`, "</div>"
+	case "flushright":
+		return `<div style="text-align:right">`, "</div>"
+	case "flushboth":
+		return `<div style="text-align:justify">`, "</div>"
+	case "paraindent":
+		return `<div style="` + enrichedIndentStyle(param) + `">`, "</div>"
+	case "nofill":
+		return "<pre>", "</pre>"
+	case "excerpt":
+		return "<blockquote>", "</blockquote>"
+	case "color":
+		color := enrichedColor(param)
+		if color == "" {
+			return "", ""
+		}
+
+		return `<span style="color:` + color + `">`, "</span>"
+	case "fontfamily":
+		if !isEnrichedFontFamily(param) {
+			return "", ""
+		}
+
+		return `<span style="font-family:` + param + `">`, "</span>"
+	case "lang":
+		if !isEnrichedLang(param) {
+			return "", ""
+		}
+
+		return `<span lang="` + param + `">`, "</span>"
+	default:
+		return "", ""
+	}
+}
+
+func enrichedIndentStyle(param string) string {
+	var styles []string
+
+	for _, value := range strings.Split(strings.ToLower(param), ",") {
+		switch strings.TrimSpace(value) {
+		case "left":
+			styles = append(styles, "margin-left:2em")
+		case "right":
+			styles = append(styles, "margin-right:2em")
+		case "in":
+			styles = append(styles, "text-indent:2em")
+		case "out":
+			styles = append(styles, "text-indent:-2em")
+		}
+	}
+
+	return strings.Join(styles, ";")
+}
+
+// enrichedColor returns a CSS color for a color name or an RFC 1896
+// "rrrr,gggg,bbbb" value, or an empty string when param is neither.
+func enrichedColor(param string) string {
+	if isEnrichedColorName(param) {
+		return strings.ToLower(param)
+	}
+
+	components := strings.Split(param, ",")
+	if len(components) != 3 {
+		return ""
+	}
+
+	color := "#"
+
+	for _, component := range components {
+		value, err := strconv.ParseUint(strings.TrimSpace(component), 16, 16)
+		if err != nil {
+			return ""
+		}
+
+		color += strconv.FormatUint(value>>8|0x100, 16)[1:]
+	}
+
+	return color
+}
+
+func isEnrichedColorName(s string) bool {
+	if s == "" || len(s) > enrichedMaxParamLength {
+		return false
+	}
+
+	for _, r := range []byte(s) {
+		if !isASCIILetter(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isEnrichedFontFamily(s string) bool {
+	if s == "" || len(s) > enrichedMaxParamLength || s[0] == ' ' ||
+		s[0] == '-' {
+		return false
+	}
+
+	for _, r := range []byte(s) {
+		if !isASCIILetter(r) && !isASCIIDigit(r) && r != ' ' && r != '-' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isEnrichedLang(s string) bool {
+	if len(s) > enrichedMaxParamLength {
+		return false
+	}
+
+	for i, subtag := range strings.Split(s, "-") {
+		if subtag == "" {
+			return false
+		}
+
+		for _, r := range []byte(subtag) {
+			if !isASCIILetter(r) && (i == 0 || !isASCIIDigit(r)) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
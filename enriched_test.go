@@ -0,0 +1,131 @@
+package letters_test
+
+import (
+	"testing"
+
+	"github.com/mnako/letters"
+)
+
+func TestEnrichedToHTML(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		enriched string
+		expected string
+	}{
+		{
+			name:     "nested formatting",
+			enriched: "<bold>Now <italic>is</italic></bold> the <<time>",
+			expected: "<b>Now <i>is</i></b> the &lt;time&gt;",
+		},
+		{
+			name:     "line breaks",
+			enriched: "one\r\ntwo\r\n\r\nthree\r\n\r\n\r\nfour",
+			expected: "one two<br>\nthree<br>\n<br>\nfour",
+		},
+		{
+			name:     "nofill",
+			enriched: "<nofill>a  b\n<<c></nofill>",
+			expected: "<pre>a  b\n&lt;c&gt;</pre>",
+		},
+		{
+			name: "params",
+			enriched: "<color><param>red</param>red</color> " +
+				"<color><param>ffff,8000,0000</param>orange</color> " +
+				"<fontfamily><param>Times New Roman</param>" +
+				"serif</fontfamily> " +
+				"<lang><param>de-CH</param>Grüezi</lang>",
+			expected: "<span style=\"color:red\">red</span> " +
+				"<span style=\"color:#ff8000\">orange</span> " +
+				"<span style=\"font-family:Times New Roman\">serif</span> " +
+				"<span lang=\"de-CH\">Grüezi</span>",
+		},
+		{
+			name: "unsafe params",
+			enriched: "<color><param>red;background:url(x)</param>a</color>" +
+				"<fontfamily><param>x\"onclick=\"y</param>b</fontfamily>",
+			expected: "ab",
+		},
+		{
+			name: "excerpt and alignment",
+			enriched: "<excerpt>quoted</excerpt>" +
+				"<center>middle</center>" +
+				"<paraindent><param>left,in</param>indented</paraindent>",
+			expected: "<blockquote>quoted</blockquote>" +
+				"<div style=\"text-align:center\">middle</div>" +
+				"<div style=\"margin-left:2em;text-indent:2em\">" +
+				"indented</div>",
+		},
+		{
+			name: "unknown commands",
+			enriched: "<blink><param>fast</param>kept</blink> " +
+				"<script>x</script>",
+			expected: "kept x",
+		},
+		{
+			name:     "improper nesting",
+			enriched: "<bold><italic>text</bold> after",
+			expected: "<b><i>text</i></b> after",
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			html := letters.EnrichedToHTML(testCase.enriched)
+			if html != testCase.expected {
+				t.Errorf(
+					"unexpected HTML:\ngot:      %q\nexpected: %q",
+					html,
+					testCase.expected,
+				)
+			}
+		})
+	}
+}
+
+func TestEnrichedToText(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		enriched string
+		expected string
+	}{
+		{
+			name: "formatting and line breaks",
+			enriched: "<bold>Now</bold> is\r\nthe <<time>\r\n\r\n" +
+				"<color><param>red</param>for all</color>",
+			expected: "Now is the <time>\nfor all",
+		},
+		{
+			name:     "nofill",
+			enriched: "<nofill>a  b\nc</nofill>",
+			expected: "a  b\nc",
+		},
+		{
+			name:     "excerpt",
+			enriched: "He said:<excerpt>one\n\ntwo</excerpt>\nOK",
+			expected: "He said:\n> one\n> two\nOK",
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			text := letters.EnrichedToText(testCase.enriched)
+			if text != testCase.expected {
+				t.Errorf(
+					"unexpected text:\ngot:      %q\nexpected: %q",
+					text,
+					testCase.expected,
+				)
+			}
+		})
+	}
+}
@@ -17,4 +17,140 @@ var (
 	ErrUnknownContentTransferEncoding = errors.New(
 		"letters.parsers.parseContentTransferEncoding: unknown Content-Transfer-Encoding",
 	)
+
+	// ErrInvalidSPFQuery indicates that an SPF query lacks a required identity.
+	ErrInvalidSPFQuery = errors.New(
+		"letters.spf.CheckSPF: invalid SPF query",
+	)
+
+	// ErrSPFTempError indicates a transient DNS error during SPF evaluation.
+	ErrSPFTempError = errors.New("letters.spf.checkHost: temperror")
+
+	// ErrSPFPermError indicates an SPF record that cannot be interpreted.
+	ErrSPFPermError = errors.New("letters.spf.checkHost: permerror")
+
+	// ErrNoReceivedHeader indicates that an email has no Received header.
+	ErrNoReceivedHeader = errors.New("letters.spf: no Received header")
+
+	// ErrNoConnectingIP indicates that a Received header has no client IP.
+	ErrNoConnectingIP = errors.New(
+		"letters.spf: no connecting IP address in Received header",
+	)
+
+	// ErrInvalidDMARCRecord indicates a DMARC record that cannot be parsed.
+	ErrInvalidDMARCRecord = errors.New(
+		"letters.dmarc.ParseDMARCRecord: invalid DMARC record",
+	)
+
+	// ErrNoFromDomain indicates that an email has no usable From domain.
+	ErrNoFromDomain = errors.New("letters.dmarc: no From domain")
+
+	// ErrMultipleFromDomains indicates a From header with several domains.
+	ErrMultipleFromDomains = errors.New("letters.dmarc: multiple From domains")
+
+	// ErrMalformedHeader indicates a raw header section that cannot be split
+	// into header fields.
+	ErrMalformedHeader = errors.New(
+		"letters.domainkeys.splitRawMessage: malformed header",
+	)
+
+	// ErrInvalidTagList indicates a tag list that cannot be parsed.
+	ErrInvalidTagList = errors.New(
+		"letters.domainkeys.parseTagList: invalid tag list",
+	)
+
+	// ErrInvalidSignature indicates a signature header that cannot be parsed.
+	ErrInvalidSignature = errors.New(
+		"letters.domainkeys.ParseDomainKeySignature: invalid signature",
+	)
+
+	// ErrNoDomainKey indicates that no key record exists for a selector.
+	ErrNoDomainKey = errors.New(
+		"letters.domainkeys.LookupDomainKey: no key record",
+	)
+
+	// ErrInvalidDomainKey indicates a key record that cannot be parsed.
+	ErrInvalidDomainKey = errors.New(
+		"letters.domainkeys.ParseDomainKeyRecord: invalid key record",
+	)
+
+	// ErrUnsupportedSignatureAlgorithm indicates an unknown a= algorithm.
+	ErrUnsupportedSignatureAlgorithm = errors.New(
+		"letters.domainkeys.hashForAlgorithm: unsupported signature algorithm",
+	)
+
+	// ErrUnsupportedKeyType indicates a key that cannot sign or verify with
+	// the requested algorithm.
+	ErrUnsupportedKeyType = errors.New(
+		"letters.domainkeys: unsupported key type",
+	)
+
+	// ErrBodyHashMismatch indicates that a body hash does not match the body.
+	ErrBodyHashMismatch = errors.New(
+		"letters.domainkeys.verifyMessageSignature: body hash mismatch",
+	)
+
+	// ErrSignatureMismatch indicates that a signature does not verify.
+	ErrSignatureMismatch = errors.New(
+		"letters.domainkeys.verifyDigest: signature mismatch",
+	)
+
+	// ErrInvalidARCChain indicates ARC header fields that do not form a
+	// valid chain of ARC sets.
+	ErrInvalidARCChain = errors.New("letters.arc: invalid ARC chain")
+
+	// ErrInvalidSignOptions indicates signing options that cannot produce a
+	// valid signature.
+	ErrInvalidSignOptions = errors.New(
+		"letters.dkim.SignDKIM: invalid signing options",
+	)
+
+	// ErrInvalidExportOptions indicates attachment export options that
+	// cannot be used.
+	ErrInvalidExportOptions = errors.New(
+		"letters.export: invalid export options",
+	)
+
+	// ErrDuplicateFilename indicates an exported file for which every
+	// " (n)" variant of its file name is already taken.
+	ErrDuplicateFilename = errors.New(
+		"letters.export: too many files with the same name",
+	)
+
+	// ErrUnsupportedArchive indicates data that is not a zip, tar, tar.gz
+	// or gzip archive.
+	ErrUnsupportedArchive = errors.New(
+		"letters.archive: unsupported archive format",
+	)
+
+	// ErrInvalidTNEF indicates data that is not a valid TNEF stream.
+	ErrInvalidTNEF = errors.New("letters.tnef: invalid TNEF stream")
+
+	// ErrInvalidMSG indicates data that is not a valid Outlook .msg file.
+	ErrInvalidMSG = errors.New("letters.msg: invalid Outlook message")
+
+	// ErrInvalidLegacyEncoding indicates content that is not valid
+	// uuencoded, yEnc or BinHex data.
+	ErrInvalidLegacyEncoding = errors.New(
+		"letters.legacy: invalid uuencoded, yEnc or BinHex data",
+	)
+
+	// ErrInvalidCalendar indicates data that is not a valid iCalendar
+	// object.
+	ErrInvalidCalendar = errors.New("letters.calendar: invalid iCalendar data")
+
+	// ErrInvalidVCard indicates data that is not a valid list of vCards.
+	ErrInvalidVCard = errors.New("letters.vcard: invalid vCard data")
+
+	// ErrInvalidPartial indicates message/partial fragments that are
+	// invalid, inconsistent or incomplete.
+	ErrInvalidPartial = errors.New(
+		"letters.partial: invalid message/partial fragments",
+	)
+
+	// ErrPartialTooLarge indicates a message/partial message that exceeds
+	// the limits of a MemoryPartialStore.
+	ErrPartialTooLarge = errors.New(
+		"letters.partial: message/partial message exceeds store limits",
+	)
 )
@@ -0,0 +1,462 @@
+package letters
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultManifestName is the file name of the manifest that
+// AttachmentExporter.WriteManifest writes when
+// AttachmentExportOptions.ManifestName is empty.
+const DefaultManifestName = "manifest.json"
+
+const (
+	exportDirMode  = 0o750
+	exportFileMode = 0o600
+
+	// exportMaxDuplicates limits the " (n)" suffixes tried for a file name.
+	exportMaxDuplicates = 10000
+)
+
+// AttachmentLayout selects how AttachmentExporter names the files it
+// writes.
+type AttachmentLayout int
+
+// Layouts supported by AttachmentExporter.
+const (
+	// AttachmentLayoutFilenames writes every file under its sanitized file
+	// name, adding " (2)", " (3)" and so on before the extension when the
+	// name is already taken, compared case-insensitively.
+	AttachmentLayoutFilenames AttachmentLayout = iota
+
+	// AttachmentLayoutContentAddressed writes every distinct content once,
+	// at "sha256/<first two hex digits>/<SHA-256 in hex>".
+	AttachmentLayoutContentAddressed
+)
+
+// ExportedFileKind tells attached and inline files apart in a manifest.
+type ExportedFileKind string
+
+// Kinds of exported files.
+const (
+	ExportedFileAttached ExportedFileKind = "attached"
+	ExportedFileInline   ExportedFileKind = "inline"
+)
+
+// AttachmentExportOptions configures an AttachmentExporter.
+type AttachmentExportOptions struct {
+	// Dir is the target directory. It is created when it does not exist.
+	Dir string
+
+	Layout AttachmentLayout
+
+	// ManifestName is the file name of the manifest in Dir. It defaults to
+	// DefaultManifestName.
+	ManifestName string
+}
+
+// ExportedFile describes a file written by an AttachmentExporter.
+type ExportedFile struct {
+	Kind ExportedFileKind `json:"kind"`
+
+	// Filename is the decoded file name from the email. See
+	// AttachedFile.Filename.
+	Filename string `json:"filename"`
+
+	// Path is the slash-separated path of the written file relative to
+	// the target directory.
+	Path string `json:"path"`
+
+	// SHA256 is the SHA-256 hash of the content in lower-case hex.
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+
+	// ContentType is the declared media type.
+	ContentType string `json:"contentType"`
+
+	// ContentID is the Content-ID of inline files.
+	ContentID string `json:"contentId,omitempty"`
+}
+
+// AttachmentManifest lists the files written by an AttachmentExporter.
+type AttachmentManifest struct {
+	MessageID string         `json:"messageId,omitempty"`
+	Files     []ExportedFile `json:"files"`
+}
+
+// AttachmentExporter writes the files of emails into a directory and keeps
+// a manifest of them. Files can be added one at a time, for example while
+// reading the parts of a message, with Export, ExportAttachedFile and
+// ExportInlineFile. An AttachmentExporter is not safe for concurrent use.
+type AttachmentExporter struct {
+	options  AttachmentExportOptions
+	manifest AttachmentManifest
+
+	// names contains the lower-case names taken in the filenames layout.
+	names map[string]bool
+}
+
+// ExportFiles writes the inline and attached files of the email into a
+// directory with an AttachmentExporter, followed by the manifest, and
+// returns the manifest.
+func (e Email) ExportFiles(
+	options AttachmentExportOptions,
+) (AttachmentManifest, error) {
+	exporter, err := NewAttachmentExporter(options)
+	if err != nil {
+		return AttachmentManifest{}, fmt.Errorf(
+			"letters.export.ExportFiles: cannot create exporter: %w",
+			err,
+		)
+	}
+
+	exporter.SetMessageID(string(e.Headers.MessageID))
+
+	for _, file := range e.InlineFiles {
+		_, err = exporter.ExportInlineFile(file)
+		if err != nil {
+			return exporter.Manifest(), fmt.Errorf(
+				"letters.export.ExportFiles: cannot export inline file: %w",
+				err,
+			)
+		}
+	}
+
+	for _, file := range e.AttachedFiles {
+		_, err = exporter.ExportAttachedFile(file)
+		if err != nil {
+			return exporter.Manifest(), fmt.Errorf(
+				"letters.export.ExportFiles: cannot export attached file: %w",
+				err,
+			)
+		}
+	}
+
+	err = exporter.WriteManifest()
+	if err != nil {
+		return exporter.Manifest(), fmt.Errorf(
+			"letters.export.ExportFiles: cannot write manifest: %w",
+			err,
+		)
+	}
+
+	return exporter.Manifest(), nil
+}
+
+// NewAttachmentExporter returns an AttachmentExporter that writes into
+// options.Dir, creating the directory when it does not exist.
+func NewAttachmentExporter(
+	options AttachmentExportOptions,
+) (*AttachmentExporter, error) {
+	if options.Dir == "" {
+		return nil, fmt.Errorf(
+			"%w: no target directory",
+			ErrInvalidExportOptions,
+		)
+	}
+
+	switch options.Layout {
+	case AttachmentLayoutFilenames, AttachmentLayoutContentAddressed:
+	default:
+		return nil, fmt.Errorf(
+			"%w: unknown layout %d",
+			ErrInvalidExportOptions,
+			options.Layout,
+		)
+	}
+
+	if options.ManifestName == "" {
+		options.ManifestName = DefaultManifestName
+	}
+
+	if options.ManifestName != SanitizeFilename(options.ManifestName) {
+		return nil, fmt.Errorf(
+			"%w: invalid manifest name %q",
+			ErrInvalidExportOptions,
+			options.ManifestName,
+		)
+	}
+
+	err := os.MkdirAll(options.Dir, exportDirMode)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"letters.export.NewAttachmentExporter: "+
+				"cannot create target directory: %w",
+			err,
+		)
+	}
+
+	return &AttachmentExporter{
+		options: options,
+		manifest: AttachmentManifest{
+			MessageID: "",
+			Files:     []ExportedFile{},
+		},
+		names: map[string]bool{
+			strings.ToLower(options.ManifestName): true,
+		},
+	}, nil
+}
+
+// SetMessageID sets the Message-ID recorded in the manifest.
+func (x *AttachmentExporter) SetMessageID(messageID string) {
+	x.manifest.MessageID = messageID
+}
+
+// Manifest returns the manifest of the files exported so far.
+func (x *AttachmentExporter) Manifest() AttachmentManifest {
+	manifest := x.manifest
+	manifest.Files = append([]ExportedFile{}, x.manifest.Files...)
+
+	return manifest
+}
+
+// ExportAttachedFile writes an attached file.
+func (x *AttachmentExporter) ExportAttachedFile(
+	file AttachedFile,
+) (ExportedFile, error) {
+	return x.Export(
+		ExportedFileAttached,
+		file.ContentType,
+		file.ContentDisposition,
+		"",
+		bytes.NewReader(file.Data),
+	)
+}
+
+// ExportInlineFile writes an inline file.
+func (x *AttachmentExporter) ExportInlineFile(
+	file InlineFile,
+) (ExportedFile, error) {
+	return x.Export(
+		ExportedFileInline,
+		file.ContentType,
+		file.ContentDisposition,
+		file.ContentID,
+		bytes.NewReader(file.Data),
+	)
+}
+
+// Export writes a file read from r, with the file name taken from its
+// headers as in AttachedFile.Filename, and adds it to the manifest.
+func (x *AttachmentExporter) Export(
+	kind ExportedFileKind,
+	contentType ContentTypeHeader,
+	contentDisposition ContentDispositionHeader,
+	contentID string,
+	r io.Reader,
+) (ExportedFile, error) {
+	filename := fileFilename(contentType, contentDisposition)
+
+	exported := ExportedFile{
+		Kind:        kind,
+		Filename:    filename.Name,
+		Path:        "",
+		SHA256:      "",
+		Size:        0,
+		ContentType: contentType.ContentType,
+		ContentID:   contentID,
+	}
+
+	var err error
+
+	switch x.options.Layout {
+	case AttachmentLayoutContentAddressed:
+		err = x.exportContentAddressed(&exported, r)
+	default:
+		err = x.exportFilename(&exported, filename.Sanitized, r)
+	}
+
+	if err != nil {
+		return exported, fmt.Errorf(
+			"letters.export.Export: cannot write %q: %w",
+			filename.Sanitized,
+			err,
+		)
+	}
+
+	x.manifest.Files = append(x.manifest.Files, exported)
+
+	return exported, nil
+}
+
+// exportFilename writes a file under a free variant of its sanitized name.
+// Files are created exclusively, so existing files and symbolic links in
+// the target directory are never followed or overwritten.
+func (x *AttachmentExporter) exportFilename(
+	exported *ExportedFile,
+	sanitized string,
+	r io.Reader,
+) error {
+	extension := path.Ext(sanitized)
+	stem := strings.TrimSuffix(sanitized, extension)
+
+	// Like SanitizeFilename, treat a long extension as part of the stem.
+	if len(extension) > maxFilenameLength/2 {
+		extension = ""
+		stem = sanitized
+	}
+
+	for i := 1; i <= exportMaxDuplicates; i++ {
+		name := sanitized
+		if i > 1 {
+			// Shorten the stem first so that the suffix survives the
+			// length limit of SanitizeFilename.
+			suffix := " (" + strconv.Itoa(i) + ")"
+			name = SanitizeFilename(
+				strings.TrimRight(
+					truncateFilename(
+						stem,
+						maxFilenameLength-len(suffix)-len(extension),
+					),
+					". ",
+				) + suffix + extension,
+			)
+		}
+
+		if x.names[strings.ToLower(name)] {
+			continue
+		}
+
+		file, err := os.OpenFile(
+			filepath.Join(x.options.Dir, name),
+			os.O_WRONLY|os.O_CREATE|os.O_EXCL,
+			exportFileMode,
+		)
+		if errors.Is(err, os.ErrExist) {
+			x.names[strings.ToLower(name)] = true
+
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("cannot create file: %w", err)
+		}
+
+		x.names[strings.ToLower(name)] = true
+		exported.Path = name
+
+		return writeExportedFile(exported, file, r)
+	}
+
+	return fmt.Errorf("%w: %q", ErrDuplicateFilename, sanitized)
+}
+
+// exportContentAddressed writes a file to a temporary file, then moves it
+// to the path derived from its hash unless that content is already
+// stored.
+func (x *AttachmentExporter) exportContentAddressed(
+	exported *ExportedFile,
+	r io.Reader,
+) error {
+	file, err := os.CreateTemp(x.options.Dir, ".letters-*")
+	if err != nil {
+		return fmt.Errorf("cannot create temporary file: %w", err)
+	}
+
+	temporaryName := file.Name()
+
+	err = writeExportedFile(exported, file, r)
+	if err != nil {
+		_ = os.Remove(temporaryName)
+
+		return err
+	}
+
+	exported.Path = path.Join("sha256", exported.SHA256[:2], exported.SHA256)
+	target := filepath.Join(x.options.Dir, filepath.FromSlash(exported.Path))
+
+	err = os.MkdirAll(filepath.Dir(target), exportDirMode)
+	if err == nil {
+		err = os.Rename(temporaryName, target)
+	}
+
+	if err != nil {
+		_ = os.Remove(temporaryName)
+
+		return fmt.Errorf("cannot store file: %w", err)
+	}
+
+	return nil
+}
+
+// writeExportedFile copies r into file, recording the size and hash, and
+// closes file.
+func writeExportedFile(
+	exported *ExportedFile,
+	file *os.File,
+	r io.Reader,
+) error {
+	digest := sha256.New()
+
+	size, err := io.Copy(io.MultiWriter(file, digest), r)
+
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return fmt.Errorf("cannot write file: %w", err)
+	}
+
+	exported.Size = size
+	exported.SHA256 = hex.EncodeToString(digest.Sum(nil))
+
+	return nil
+}
+
+// WriteManifest writes the manifest as indented JSON to the manifest file
+// in the target directory, replacing an earlier version.
+func (x *AttachmentExporter) WriteManifest() error {
+	data, err := json.MarshalIndent(x.manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf(
+			"letters.export.WriteManifest: cannot encode manifest: %w",
+			err,
+		)
+	}
+
+	file, err := os.CreateTemp(x.options.Dir, ".letters-*")
+	if err != nil {
+		return fmt.Errorf(
+			"letters.export.WriteManifest: cannot create manifest: %w",
+			err,
+		)
+	}
+
+	_, err = file.Write(append(data, '\n'))
+
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(
+			file.Name(),
+			filepath.Join(x.options.Dir, x.options.ManifestName),
+		)
+	}
+
+	if err != nil {
+		_ = os.Remove(file.Name())
+
+		return fmt.Errorf(
+			"letters.export.WriteManifest: cannot write manifest: %w",
+			err,
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,278 @@
+package letters_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mnako/letters"
+)
+
+func exportTestEmail() letters.Email {
+	attachment := func(filename string, data string) letters.AttachedFile {
+		return letters.AttachedFile{
+			ContentType: letters.ContentTypeHeader{
+				ContentType: "text/plain",
+				Params:      map[string]string{},
+			},
+			ContentDisposition: letters.ContentDispositionHeader{
+				ContentDisposition: letters.ContentDispositionAttachment,
+				Params:             map[string]string{"filename": filename},
+			},
+			Data: []byte(data),
+		}
+	}
+
+	return letters.Email{
+		Headers: letters.Headers{
+			MessageID: "1234@example.com",
+		},
+		InlineFiles: []letters.InlineFile{
+			{
+				ContentID: "logo@example.com",
+				ContentType: letters.ContentTypeHeader{
+					ContentType: "image/png",
+					Params:      map[string]string{"name": "logo.png"},
+				},
+				ContentDisposition: letters.ContentDispositionHeader{
+					ContentDisposition: letters.ContentDispositionInline,
+					Params:             map[string]string{},
+				},
+				Data: []byte("png"),
+			},
+		},
+		AttachedFiles: []letters.AttachedFile{
+			attachment("notes.txt", "first"),
+			attachment("NOTES.txt", "second"),
+			attachment("../../notes.txt", "first"),
+			attachment("", "unnamed"),
+		},
+	}
+}
+
+func readExportManifest(t *testing.T, dir string) letters.AttachmentManifest {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join(dir, letters.DefaultManifestName))
+	if err != nil {
+		t.Fatalf("cannot read manifest: %s", err)
+	}
+
+	var manifest letters.AttachmentManifest
+
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		t.Fatalf("cannot decode manifest: %s", err)
+	}
+
+	return manifest
+}
+
+func TestExportFilesFilenames(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	// An existing file and a symbolic link must not be overwritten or
+	// followed.
+	err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("keep"), 0o600)
+	if err != nil {
+		t.Fatalf("cannot create file: %s", err)
+	}
+
+	outside := filepath.Join(t.TempDir(), "outside.txt")
+
+	err = os.Symlink(outside, filepath.Join(dir, "notes (2).txt"))
+	if err != nil {
+		t.Fatalf("cannot create symbolic link: %s", err)
+	}
+
+	manifest, err := exportTestEmail().ExportFiles(
+		letters.AttachmentExportOptions{Dir: dir},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var paths []string
+	for _, file := range manifest.Files {
+		paths = append(paths, file.Path)
+	}
+
+	expectedPaths := []string{
+		"logo.png",
+		"notes (3).txt",
+		"NOTES (4).txt",
+		"notes (5).txt",
+		letters.DefaultFilename,
+	}
+	if !reflect.DeepEqual(paths, expectedPaths) {
+		t.Errorf("unexpected paths: %q", paths)
+	}
+
+	for i, expected := range []string{"png", "first", "second", "first"} {
+		data, err := os.ReadFile(filepath.Join(dir, expectedPaths[i]))
+		if err != nil || string(data) != expected {
+			t.Errorf("unexpected content of %q: %q", expectedPaths[i], data)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "notes.txt"))
+	if err != nil || string(data) != "keep" {
+		t.Errorf("existing file was changed: %q", data)
+	}
+
+	_, err = os.Stat(outside)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("symbolic link was followed: %v", err)
+	}
+
+	if !reflect.DeepEqual(readExportManifest(t, dir), manifest) {
+		t.Errorf("unexpected manifest: %#v", readExportManifest(t, dir))
+	}
+
+	expectedInline := letters.ExportedFile{
+		Kind:     letters.ExportedFileInline,
+		Filename: "logo.png",
+		Path:     "logo.png",
+		SHA256: "8f8cbb7dcf46e0bc7d53265749a6c17d" +
+			"116093a6ba95e442764060c76fd4a86c",
+		Size:        3,
+		ContentType: "image/png",
+		ContentID:   "logo@example.com",
+	}
+
+	if manifest.MessageID != "1234@example.com" ||
+		manifest.Files[0] != expectedInline ||
+		manifest.Files[3].Filename != "../../notes.txt" {
+		t.Errorf("unexpected manifest: %#v", manifest)
+	}
+}
+
+func TestExportFilesLongDuplicateNames(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		filename      string
+		expectedPaths []string
+	}{
+		{
+			name:     "long stem",
+			filename: strings.Repeat("a", 300) + ".pdf",
+			expectedPaths: []string{
+				strings.Repeat("a", 251) + ".pdf",
+				strings.Repeat("a", 247) + " (2).pdf",
+			},
+		},
+		{
+			name:     "long extension",
+			filename: "a." + strings.Repeat("x", 300),
+			expectedPaths: []string{
+				"a." + strings.Repeat("x", 253),
+				"a." + strings.Repeat("x", 249) + " (2)",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			attachment := letters.AttachedFile{
+				ContentType: letters.ContentTypeHeader{
+					ContentType: "application/pdf",
+					Params:      map[string]string{},
+				},
+				ContentDisposition: letters.ContentDispositionHeader{
+					ContentDisposition: letters.ContentDispositionAttachment,
+					Params: map[string]string{
+						"filename": testCase.filename,
+					},
+				},
+				Data: []byte("pdf"),
+			}
+
+			email := letters.Email{
+				AttachedFiles: []letters.AttachedFile{attachment, attachment},
+			}
+
+			manifest, err := email.ExportFiles(
+				letters.AttachmentExportOptions{Dir: t.TempDir()},
+			)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			var paths []string
+			for _, file := range manifest.Files {
+				paths = append(paths, file.Path)
+			}
+
+			if !reflect.DeepEqual(paths, testCase.expectedPaths) {
+				t.Errorf("unexpected paths: %q", paths)
+			}
+		})
+	}
+}
+
+func TestExportFilesContentAddressed(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	manifest, err := exportTestEmail().ExportFiles(
+		letters.AttachmentExportOptions{
+			Dir:    dir,
+			Layout: letters.AttachmentLayoutContentAddressed,
+		},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	const firstHash = "a7937b64b8caa58f03721bb6bacf5c78" +
+		"cb235febe0e70b1b84cd99541461a08e"
+
+	first := manifest.Files[1]
+	if first.SHA256 != firstHash ||
+		first.Size != int64(len("first")) ||
+		first.Path != "sha256/a7/"+firstHash ||
+		manifest.Files[3].Path != first.Path {
+		t.Errorf("unexpected manifest: %#v", manifest)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(first.Path)))
+	if err != nil || string(data) != "first" {
+		t.Errorf("unexpected content: %q", data)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, "sha256"))
+	if err != nil || len(entries) != 4 {
+		t.Errorf("unexpected store: %v, %v", entries, err)
+	}
+
+	if !reflect.DeepEqual(readExportManifest(t, dir), manifest) {
+		t.Errorf("unexpected manifest: %#v", readExportManifest(t, dir))
+	}
+}
+
+func TestNewAttachmentExporterInvalidOptions(t *testing.T) {
+	t.Parallel()
+
+	for _, options := range []letters.AttachmentExportOptions{
+		{Dir: ""},
+		{Dir: t.TempDir(), Layout: letters.AttachmentLayout(7)},
+		{Dir: t.TempDir(), ManifestName: "../manifest.json"},
+	} {
+		_, err := letters.NewAttachmentExporter(options)
+		if !errors.Is(err, letters.ErrInvalidExportOptions) {
+			t.Errorf("%#v: unexpected error: %v", options, err)
+		}
+	}
+}
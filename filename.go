@@ -0,0 +1,392 @@
+package letters
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// FilenameFallbackCharset is the charset that Filename assumes for file
+// names sent as raw 8-bit bytes that are not valid UTF-8.
+const FilenameFallbackCharset = "windows-1252"
+
+// DefaultFilename is the sanitized file name of files that have no usable
+// name.
+const DefaultFilename = "attachment"
+
+// maxFilenameLength is the maximum length in bytes of a sanitized file
+// name, which most file systems support.
+const maxFilenameLength = 255
+
+// Filename is the file name of an attached or inline file.
+type Filename struct {
+	// Name is the decoded file name as the sender wrote it. It is empty
+	// when the file has no name.
+	Name string
+
+	// Sanitized is Name reduced to a single path element that is safe to
+	// create on Windows, macOS and Unix file systems. It is DefaultFilename
+	// when nothing usable is left.
+	Sanitized string
+}
+
+// Filename returns the file name of the inline file. See
+// AttachedFile.Filename.
+func (f InlineFile) Filename() Filename {
+	return fileFilename(f.ContentType, f.ContentDisposition)
+}
+
+// Filename returns the file name of the attached file from the filename
+// parameter of its Content-Disposition header or, when that is missing, the
+// name parameter of its Content-Type header.
+//
+// RFC 2231 continuations and charsets are decoded when the headers are
+// parsed. Filename also decodes RFC 2047 encoded-words inside the
+// parameter, which RFC 2047 does not allow but many clients send, and
+// decodes raw 8-bit names that are not valid UTF-8 as
+// FilenameFallbackCharset.
+func (f AttachedFile) Filename() Filename {
+	return fileFilename(f.ContentType, f.ContentDisposition)
+}
+
+func fileFilename(
+	contentType ContentTypeHeader,
+	contentDisposition ContentDispositionHeader,
+) Filename {
+	name := DecodeFilename(
+		contentDisposition.Params["filename"],
+		FilenameFallbackCharset,
+	)
+	if name == "" {
+		name = DecodeFilename(
+			contentType.Params["name"],
+			FilenameFallbackCharset,
+		)
+	}
+
+	return Filename{
+		Name:      name,
+		Sanitized: SanitizeFilename(name),
+	}
+}
+
+// DecodeFilename decodes a file name parameter that may contain RFC 2047
+// encoded-words or raw 8-bit bytes in fallbackCharset.
+func DecodeFilename(value string, fallbackCharset string) string {
+	if !utf8.ValidString(value) {
+		value = decodeCharsetBytes([]byte(value), fallbackCharset)
+	}
+
+	if strings.Contains(value, "=?") {
+		decoded, err := decodeHeader(value)
+		if err == nil {
+			value = decoded
+		}
+	}
+
+	return strings.TrimSpace(value)
+}
+
+// SanitizeFilename makes a file name safe to create on disk. It keeps only
+// the last path element, replaces characters that Windows does not allow,
+// removes control and invisible formatting characters such as
+// right-to-left overrides, trims leading and trailing dots and spaces,
+// prefixes reserved Windows device names such as CON and LPT1 with an
+// underscore and shortens names to 255 bytes, keeping the extension.
+func SanitizeFilename(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = name[strings.LastIndexByte(name, '/')+1:]
+
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r == utf8.RuneError,
+			unicode.IsControl(r),
+			unicode.Is(unicode.Cf, r):
+			return -1
+		case strings.ContainsRune(`<>:"|?*`, r):
+			return '_'
+		default:
+			return r
+		}
+	}, name)
+
+	name = strings.Trim(name, ". ")
+	if name == "" {
+		return DefaultFilename
+	}
+
+	if isReservedFilename(name) {
+		name = "_" + name
+	}
+
+	if len(name) > maxFilenameLength {
+		extension := path.Ext(name)
+		if len(extension) > maxFilenameLength/2 {
+			extension = ""
+		}
+
+		stem := truncateFilename(name, maxFilenameLength-len(extension))
+		name = strings.TrimRight(stem, ". ") + extension
+	}
+
+	return name
+}
+
+// truncateFilename shortens a file name to at most length bytes without
+// splitting a UTF-8 sequence.
+func truncateFilename(name string, length int) string {
+	if len(name) <= length {
+		return name
+	}
+
+	name = name[:length]
+	for !utf8.ValidString(name) {
+		name = name[:len(name)-1]
+	}
+
+	return name
+}
+
+// isReservedFilename reports whether a file name is a Windows device name,
+// which Windows reserves with any extension.
+func isReservedFilename(name string) bool {
+	base, _, _ := strings.Cut(name, ".")
+	base = strings.ToUpper(strings.TrimRight(base, " "))
+
+	switch base {
+	case "CON", "PRN", "AUX", "NUL", "CONIN$", "CONOUT$":
+		return true
+	default:
+	}
+
+	const devicePrefixLength = 3
+
+	if len(base) == devicePrefixLength+1 &&
+		(strings.HasPrefix(base, "COM") || strings.HasPrefix(base, "LPT")) {
+		return base[devicePrefixLength] >= '0' &&
+			base[devicePrefixLength] <= '9'
+	}
+
+	return false
+}
+
+// fileContentDisposition returns a Content-Disposition header with the last
+// element of a file name, which encoders and Outlook may record as a path.
+func fileContentDisposition(
+	disposition ContentDisposition,
+	filename string,
+) ContentDispositionHeader {
+	header := ContentDispositionHeader{
+		ContentDisposition: disposition,
+		Params:             map[string]string{},
+	}
+
+	if filename != "" {
+		header.Params["filename"] = path.Base(
+			strings.ReplaceAll(filename, "\\", "/"),
+		)
+	}
+
+	return header
+}
+
+// decodeCharsetBytes decodes bytes in the charset, keeping them unchanged
+// when the charset is unknown.
+func decodeCharsetBytes(data []byte, label string) string {
+	switch strings.ToLower(label) {
+	case "", "us-ascii", "utf-8", "utf8":
+		return string(data)
+	default:
+	}
+
+	reader, err := charsetReader(label, bytes.NewReader(data))
+	if err != nil {
+		return string(data)
+	}
+
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return string(data)
+	}
+
+	return string(decoded)
+}
+
+type mediaTypeParam struct {
+	attribute string
+	value     string
+}
+
+// scanMediaTypeParams returns the parameters of a Content-Type or
+// Content-Disposition value in order, with quoted values unquoted. Unlike
+// mime.ParseMediaType, it accepts raw 8-bit bytes and other invalid
+// characters in values.
+func scanMediaTypeParams(value string) []mediaTypeParam {
+	var params []mediaTypeParam
+
+	_, rest, _ := strings.Cut(value, ";")
+
+	for {
+		rest = strings.TrimLeft(rest, " \t\r\n;")
+
+		end := strings.IndexAny(rest, "=;")
+		if end < 0 {
+			return params
+		}
+
+		if rest[end] == ';' {
+			rest = rest[end:]
+
+			continue
+		}
+
+		attribute := strings.ToLower(strings.TrimSpace(rest[:end]))
+		rest = strings.TrimLeft(rest[end+1:], " \t\r\n")
+
+		var paramValue string
+
+		if strings.HasPrefix(rest, `"`) {
+			var b strings.Builder
+
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+
+				b.WriteByte(rest[i])
+			}
+
+			paramValue = b.String()
+			rest = rest[min(i+1, len(rest)):]
+
+			if index := strings.IndexByte(rest, ';'); index >= 0 {
+				rest = rest[index:]
+			} else {
+				rest = ""
+			}
+		} else {
+			paramValue, rest, _ = strings.Cut(rest, ";")
+			paramValue = strings.TrimSpace(paramValue)
+		}
+
+		if attribute != "" {
+			params = append(params, mediaTypeParam{
+				attribute: attribute,
+				value:     paramValue,
+			})
+		}
+	}
+}
+
+type extendedParamSection struct {
+	index   int
+	encoded bool
+	value   string
+}
+
+// decodeMediaTypeParams decodes the parameters of a Content-Type or
+// Content-Disposition value, including RFC 2231 continuations and
+// extended values in any charset that the email parser supports.
+// Extended values replace plain values of the same parameter.
+func decodeMediaTypeParams(value string) map[string]string {
+	params := make(map[string]string)
+	sections := make(map[string][]extendedParamSection)
+
+	for _, param := range scanMediaTypeParams(value) {
+		attribute, section, found := strings.Cut(param.attribute, "*")
+		if !found {
+			if _, ok := params[attribute]; !ok {
+				params[attribute] = param.value
+			}
+
+			continue
+		}
+
+		encoded := strings.HasSuffix(section, "*") || section == ""
+		section = strings.TrimSuffix(section, "*")
+
+		index := 0
+		if section != "" {
+			var err error
+
+			index, err = strconv.Atoi(section)
+			if err != nil {
+				continue
+			}
+		}
+
+		sections[attribute] = append(
+			sections[attribute],
+			extendedParamSection{
+				index:   index,
+				encoded: encoded,
+				value:   param.value,
+			},
+		)
+	}
+
+	for attribute, parts := range sections {
+		decoded, ok := decodeExtendedParam(parts)
+		if ok {
+			params[attribute] = decoded
+		}
+	}
+
+	return params
+}
+
+// decodeExtendedParam joins the sections of an RFC 2231 parameter and
+// decodes them from their charset.
+func decodeExtendedParam(sections []extendedParamSection) (string, bool) {
+	slices.SortStableFunc(sections, func(a, b extendedParamSection) int {
+		return a.index - b.index
+	})
+
+	var (
+		data    []byte
+		charset string
+	)
+
+	for i, section := range sections {
+		if section.index != i {
+			return "", false
+		}
+
+		value := section.value
+
+		if section.encoded {
+			if i == 0 {
+				// The first section starts with "charset'language'".
+				var found bool
+
+				charset, value, found = strings.Cut(value, "'")
+				if !found {
+					return "", false
+				}
+
+				_, value, found = strings.Cut(value, "'")
+				if !found {
+					return "", false
+				}
+			}
+
+			unescaped, err := url.PathUnescape(value)
+			if err != nil {
+				return "", false
+			}
+
+			value = unescaped
+		}
+
+		data = append(data, value...)
+	}
+
+	return decodeCharsetBytes(data, charset), true
+}
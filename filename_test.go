@@ -0,0 +1,182 @@
+package letters_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mnako/letters"
+)
+
+func TestAttachedFileFilename(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name              string
+		contentType       string
+		disposition       string
+		expectedName      string
+		expectedSanitized string
+	}{
+		{
+			name:              "plain",
+			contentType:       "application/pdf",
+			disposition:       "attachment; filename=\"invoice.pdf\"",
+			expectedName:      "invoice.pdf",
+			expectedSanitized: "invoice.pdf",
+		},
+		{
+			name:              "Content-Type name",
+			contentType:       "application/pdf; name=\"invoice.pdf\"",
+			disposition:       "attachment",
+			expectedName:      "invoice.pdf",
+			expectedSanitized: "invoice.pdf",
+		},
+		{
+			name:        "RFC 2231 continuations",
+			contentType: "application/pdf",
+			disposition: "attachment;\r\n" +
+				" filename*0*=UTF-8''r%C3%A9sum;\r\n" +
+				" filename*1*=%C3%A9;\r\n" +
+				" filename*2=\".pdf\"",
+			expectedName:      "résumé.pdf",
+			expectedSanitized: "résumé.pdf",
+		},
+		{
+			name:        "RFC 2231 in ISO-8859-1 before a plain filename",
+			contentType: "text/plain",
+			disposition: "attachment; filename=\"cafe.txt\";\r\n" +
+				" filename*=iso-8859-1'fr'caf%E9.txt",
+			expectedName:      "café.txt",
+			expectedSanitized: "café.txt",
+		},
+		{
+			name: "RFC 2047 inside a quoted parameter",
+			contentType: "application/pdf;\r\n" +
+				" name=\"=?UTF-8?B?csOpc3Vtw6kucGRm?=\"",
+			disposition: "attachment;\r\n" +
+				" filename=\"=?ISO-8859-1?Q?r=E9sum=E9?= final.pdf\"",
+			expectedName:      "résumé final.pdf",
+			expectedSanitized: "résumé final.pdf",
+		},
+		{
+			name:              "raw 8-bit quoted",
+			contentType:       "text/plain",
+			disposition:       "attachment; filename=\"caf\xe9.txt\"",
+			expectedName:      "café.txt",
+			expectedSanitized: "café.txt",
+		},
+		{
+			name:              "raw 8-bit token",
+			contentType:       "text/plain",
+			disposition:       "attachment; filename=caf\xe9.txt",
+			expectedName:      "café.txt",
+			expectedSanitized: "café.txt",
+		},
+		{
+			name:              "path traversal",
+			contentType:       "text/plain",
+			disposition:       "attachment; filename=\"..\\\\..\\\\evil.bat\"",
+			expectedName:      "..\\..\\evil.bat",
+			expectedSanitized: "evil.bat",
+		},
+		{
+			name:              "no name",
+			contentType:       "application/octet-stream",
+			disposition:       "attachment",
+			expectedName:      "",
+			expectedSanitized: letters.DefaultFilename,
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			email, err := letters.ParseEmail(strings.NewReader(
+				"From: Alice <alice@example.com>\r\n" +
+					"MIME-Version: 1.0\r\n" +
+					"Content-Type: multipart/mixed; boundary=b\r\n" +
+					"\r\n" +
+					"--b\r\n" +
+					"Content-Type: text/plain\r\n" +
+					"\r\n" +
+					"See attached.\r\n" +
+					"--b\r\n" +
+					"Content-Type: " + testCase.contentType + "\r\n" +
+					"Content-Disposition: " + testCase.disposition + "\r\n" +
+					"\r\n" +
+					"data\r\n" +
+					"--b--\r\n",
+			))
+			if err != nil {
+				t.Fatalf("cannot parse email: %s", err)
+			}
+
+			if len(email.AttachedFiles) != 1 {
+				t.Fatalf("unexpected attached files: %#v", email.AttachedFiles)
+			}
+
+			filename := email.AttachedFiles[0].Filename()
+
+			if filename.Name != testCase.expectedName {
+				t.Errorf(
+					"unexpected name: got %q, expected %q",
+					filename.Name,
+					testCase.expectedName,
+				)
+			}
+
+			if filename.Sanitized != testCase.expectedSanitized {
+				t.Errorf(
+					"unexpected sanitized name: got %q, expected %q",
+					filename.Sanitized,
+					testCase.expectedSanitized,
+				)
+			}
+		})
+	}
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		expected string
+	}{
+		{"report.pdf", "report.pdf"},
+		{"../../etc/passwd", "passwd"},
+		{"C:\\Windows\\System32\\drivers", "drivers"},
+		{"..", letters.DefaultFilename},
+		{"  .hidden. ", "hidden"},
+		{"what? <why>: \"this\"|that*.txt", "what_ _why__ _this__that_.txt"},
+		{"invoice\u202efdp.exe", "invoicefdp.exe"},
+		{"tab\tand\x00null.txt", "tabandnull.txt"},
+		{"CON", "_CON"},
+		{"nul.txt", "_nul.txt"},
+		{"Lpt1.log", "_Lpt1.log"},
+		{"COM10.txt", "COM10.txt"},
+		{"console.txt", "console.txt"},
+		{
+			strings.Repeat("é", 200) + ".pdf",
+			strings.Repeat("é", 125) + ".pdf",
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			sanitized := letters.SanitizeFilename(testCase.name)
+			if sanitized != testCase.expected {
+				t.Errorf(
+					"unexpected sanitized name: got %q, expected %q",
+					sanitized,
+					testCase.expected,
+				)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package letters
+
+import (
+	"strings"
+)
+
+const (
+	flowedSignatureSeparator = "-- "
+	flowedQuoteMarker        = '>'
+
+	// DefaultFlowedWidth is the line width recommended by RFC 3676
+	// Section 4.2 for generating format=flowed text.
+	DefaultFlowedWidth = 66
+)
+
+// FlowedParagraph is a logical line of format=flowed text: one or more
+// physical lines joined at their soft line breaks.
+type FlowedParagraph struct {
+	// QuoteDepth is the number of quote markers (">") the paragraph had.
+	QuoteDepth int
+
+	// Text is the paragraph with quote markers and space-stuffing removed.
+	Text string
+}
+
+// ParseFlowedText splits text/plain; format=flowed content into logical
+// paragraphs as described in RFC 3676 Section 4. delSp corresponds to the
+// delsp=yes Content-Type parameter, with which the space that marks a soft
+// line break is deleted when lines are joined.
+func ParseFlowedText(s string, delSp bool) []FlowedParagraph {
+	var (
+		paragraphs []FlowedParagraph
+		flowing    bool
+	)
+
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+
+		quoteDepth := 0
+		for quoteDepth < len(line) && line[quoteDepth] == flowedQuoteMarker {
+			quoteDepth++
+		}
+
+		line = strings.TrimPrefix(line[quoteDepth:], " ")
+
+		flowed := line != flowedSignatureSeparator &&
+			strings.HasSuffix(line, " ")
+		if flowed && delSp {
+			line = strings.TrimSuffix(line, " ")
+		}
+
+		last := len(paragraphs) - 1
+		if flowing && paragraphs[last].QuoteDepth == quoteDepth &&
+			line != flowedSignatureSeparator {
+			paragraphs[last].Text += line
+		} else {
+			paragraphs = append(paragraphs, FlowedParagraph{
+				QuoteDepth: quoteDepth,
+				Text:       line,
+			})
+		}
+
+		flowing = flowed
+	}
+
+	return paragraphs
+}
+
+// DecodeFlowedText decodes text/plain; format=flowed content into text with
+// one logical paragraph per line. Quoted paragraphs keep their quote depth
+// and are prefixed with one ">" per level followed by a space.
+func DecodeFlowedText(s string, delSp bool) string {
+	paragraphs := ParseFlowedText(s, delSp)
+	lines := make([]string, 0, len(paragraphs))
+
+	for _, paragraph := range paragraphs {
+		text := paragraph.Text
+		if text != flowedSignatureSeparator {
+			text = strings.TrimRight(text, " ")
+		}
+
+		if paragraph.QuoteDepth > 0 {
+			text = strings.TrimRight(
+				strings.Repeat(string(flowedQuoteMarker), paragraph.QuoteDepth)+
+					" "+text,
+				" ",
+			)
+		}
+
+		lines = append(lines, text)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// EncodeFlowedText encodes text as format=flowed (RFC 3676 Section 4.2) with
+// lines at most width characters long where the words allow it; a width of
+// zero or less means DefaultFlowedWidth.
+//
+// Every line of s is a paragraph. Lines starting with ">" are quoted, with
+// one level per marker; spaces between the markers are ignored. The result
+// must be sent as text/plain; format=flowed without the delsp parameter.
+func EncodeFlowedText(s string, width int) string {
+	if width <= 0 {
+		width = DefaultFlowedWidth
+	}
+
+	var lines []string
+
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+
+		quoteDepth := 0
+		rest := line
+
+		for {
+			trimmed := strings.TrimLeft(rest, " ")
+			if trimmed == "" || trimmed[0] != flowedQuoteMarker ||
+				(quoteDepth == 0 && trimmed != rest) {
+				break
+			}
+
+			quoteDepth++
+			rest = trimmed[1:]
+		}
+
+		if quoteDepth > 0 {
+			rest = strings.TrimPrefix(rest, " ")
+		}
+
+		lines = append(lines, encodeFlowedParagraph(rest, quoteDepth, width)...)
+	}
+
+	return strings.Join(lines, "\r\n")
+}
+
+func encodeFlowedParagraph(text string, quoteDepth int, width int) []string {
+	prefix := strings.Repeat(string(flowedQuoteMarker), quoteDepth)
+	if quoteDepth > 0 {
+		prefix += " "
+	}
+
+	if text == flowedSignatureSeparator && quoteDepth == 0 {
+		return []string{text}
+	}
+
+	// Trailing spaces would turn the hard line break into a soft one.
+	text = strings.TrimRight(text, " ")
+
+	var lines []string
+
+	for {
+		// Deep quotes may leave no room for text; break after every word
+		// then.
+		available := max(width-len(prefix), 1)
+
+		cut := len(text)
+		if cut > available {
+			// Break after the last space that fits, or after the first
+			// space when a single word is longer than the line.
+			cut = strings.LastIndexByte(text[:available], ' ')
+			if cut <= 0 {
+				cut = strings.IndexByte(text, ' ')
+			}
+
+			if cut <= 0 {
+				cut = len(text)
+			} else {
+				// Keep the space at the end of the line to mark the soft
+				// break.
+				for cut < len(text) && text[cut] == ' ' {
+					cut++
+				}
+			}
+		}
+
+		chunk := text[:cut]
+		text = text[cut:]
+
+		if quoteDepth == 0 && (strings.HasPrefix(chunk, " ") ||
+			strings.HasPrefix(chunk, string(flowedQuoteMarker)) ||
+			strings.HasPrefix(chunk, "From ")) {
+			chunk = " " + chunk
+		}
+
+		if chunk == "" {
+			lines = append(lines, strings.TrimRight(prefix, " "))
+		} else {
+			lines = append(lines, prefix+chunk)
+		}
+
+		if text == "" {
+			return lines
+		}
+	}
+}
+
+func decodeTextFormat(text string, contentType ContentTypeHeader) string {
+	if contentType.Params["format"] != "flowed" {
+		return text
+	}
+
+	return DecodeFlowedText(text, contentType.Params["delsp"] == "yes")
+}
@@ -0,0 +1,190 @@
+package letters_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mnako/letters"
+)
+
+func TestDecodeFlowedText(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		flowed   string
+		delSp    bool
+		expected string
+	}{
+		{
+			name: "soft line breaks",
+			flowed: "The quick brown fox \r\n" +
+				"jumps over the lazy \r\n" +
+				"dog.\r\n" +
+				"\r\n" +
+				"Fixed line\r\n" +
+				"Another fixed line",
+			expected: "The quick brown fox jumps over the lazy dog.\n" +
+				"\n" +
+				"Fixed line\n" +
+				"Another fixed line",
+		},
+		{
+			name:     "delsp",
+			flowed:   "Donau \nDampf \nSchiff",
+			delSp:    true,
+			expected: "DonauDampfSchiff",
+		},
+		{
+			name:     "space-stuffing",
+			flowed:   " From the start\n  indented\n >not quoted",
+			expected: "From the start\n indented\n>not quoted",
+		},
+		{
+			name: "quote depth",
+			flowed: ">> Deeply quoted \n" +
+				">> text\n" +
+				"> Quoted\n" +
+				">\n" +
+				"Reply",
+			expected: ">> Deeply quoted text\n" +
+				"> Quoted\n" +
+				">\n" +
+				"Reply",
+		},
+		{
+			name: "quote depth change ends paragraph",
+			flowed: "> Quoted \n" +
+				"Unquoted",
+			expected: "> Quoted\n" +
+				"Unquoted",
+		},
+		{
+			name:     "signature separator",
+			flowed:   "Bye \n-- \nAlice",
+			expected: "Bye\n-- \nAlice",
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			decoded := letters.DecodeFlowedText(testCase.flowed, testCase.delSp)
+			if decoded != testCase.expected {
+				t.Errorf(
+					"unexpected text:\ngot:      %q\nexpected: %q",
+					decoded,
+					testCase.expected,
+				)
+			}
+		})
+	}
+}
+
+func TestParseFlowedText(t *testing.T) {
+	t.Parallel()
+
+	paragraphs := letters.ParseFlowedText(
+		">> Deeply \n>> quoted\n> Quoted\nReply",
+		false,
+	)
+
+	expected := []letters.FlowedParagraph{
+		{QuoteDepth: 2, Text: "Deeply quoted"},
+		{QuoteDepth: 1, Text: "Quoted"},
+		{QuoteDepth: 0, Text: "Reply"},
+	}
+	if !reflect.DeepEqual(paragraphs, expected) {
+		t.Errorf("unexpected paragraphs: %#v", paragraphs)
+	}
+}
+
+func TestEncodeFlowedText(t *testing.T) {
+	t.Parallel()
+
+	text := "The quick brown fox jumps over the lazy dog.   \n" +
+		"From here on\n" +
+		"> > A quoted paragraph that is long enough to wrap.\n" +
+		">\n" +
+		"-- \n" +
+		"Alice"
+
+	encoded := letters.EncodeFlowedText(text, 20)
+
+	expected := "The quick brown fox \r\n" +
+		"jumps over the lazy \r\n" +
+		"dog.\r\n" +
+		" From here on\r\n" +
+		">> A quoted \r\n" +
+		">> paragraph that \r\n" +
+		">> is long enough \r\n" +
+		">> to wrap.\r\n" +
+		">\r\n" +
+		"-- \r\n" +
+		"Alice"
+	if encoded != expected {
+		t.Errorf(
+			"unexpected encoding:\ngot:      %q\nexpected: %q",
+			encoded,
+			expected,
+		)
+	}
+
+	decoded := letters.DecodeFlowedText(encoded, false)
+
+	expectedDecoded := "The quick brown fox jumps over the lazy dog.\n" +
+		"From here on\n" +
+		">> A quoted paragraph that is long enough to wrap.\n" +
+		">\n" +
+		"-- \n" +
+		"Alice"
+	if decoded != expectedDecoded {
+		t.Errorf("unexpected round trip: %q", decoded)
+	}
+}
+
+func TestEncodeFlowedTextNarrowWidth(t *testing.T) {
+	t.Parallel()
+
+	encoded := letters.EncodeFlowedText(">>> hello world foo", 2)
+
+	expected := ">>> hello \r\n>>> world \r\n>>> foo"
+	if encoded != expected {
+		t.Errorf(
+			"unexpected encoding:\ngot:      %q\nexpected: %q",
+			encoded,
+			expected,
+		)
+	}
+}
+
+func TestParseFlowedEmail(t *testing.T) {
+	t.Parallel()
+
+	message := "From: Alice <alice@example.com>\r\n" +
+		"Subject: Flowed\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/alternative; boundary=b\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain; charset=utf-8; format=Flowed; delsp=no\r\n" +
+		"\r\n" +
+		"Hello \r\n" +
+		"world\r\n" +
+		"> Quoted \r\n" +
+		"> text\r\n" +
+		"--b--\r\n"
+
+	email, err := letters.ParseEmail(strings.NewReader(message))
+	if err != nil {
+		t.Fatalf("cannot parse email: %s", err)
+	}
+
+	expected := "Hello world\n> Quoted text"
+	if email.Text != expected {
+		t.Errorf("unexpected text: got %q, expected %q", email.Text, expected)
+	}
+}
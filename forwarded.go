@@ -0,0 +1,342 @@
+package letters
+
+import (
+	"fmt"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+const forwardedMinHeaderLines = 2
+
+// ForwardedMessage is a message that was forwarded inline, by pasting its
+// headers and body into the body of the forwarding message.
+type ForwardedMessage struct {
+	// Headers contains the From, Reply-To, To, Cc, Date and Subject lines
+	// of the forwarded message, parsed like the headers of an email.
+	// Other lines of the header block are in Headers.ExtraHeaders.
+	Headers Headers
+
+	// RawHeaders contains the header block as written, keyed by canonical
+	// header name, also when an address or a date could not be parsed.
+	RawHeaders map[string]string
+
+	// Text is the body of the forwarded message up to the next forwarded
+	// message, if any.
+	Text string
+
+	// Forwarded is the message that this message forwarded in turn.
+	Forwarded *ForwardedMessage
+}
+
+// Original returns the innermost forwarded message, whose headers describe
+// the original sender.
+func (fm ForwardedMessage) Original() ForwardedMessage {
+	original := fm
+	for original.Forwarded != nil {
+		original = *original.Forwarded
+	}
+
+	return original
+}
+
+// ForwardedMessage extracts the inline-forwarded message from the plain-text
+// body of the email, or from a plain-text rendering of the HTML body when
+// the email has no plain-text body. The boolean is false when the email does
+// not contain a forwarded message.
+func (e Email) ForwardedMessage() (ForwardedMessage, bool, error) {
+	if e.Text != "" {
+		forwarded, ok := ExtractForwardedText(e.Text)
+
+		return forwarded, ok, nil
+	}
+
+	forwarded, ok, err := ExtractForwardedHTML(e.HTML)
+	if err != nil {
+		return ForwardedMessage{}, false, fmt.Errorf(
+			"letters.forwarded.ForwardedMessage: "+
+				"cannot extract from html body: %w",
+			err,
+		)
+	}
+
+	return forwarded, ok, nil
+}
+
+// ExtractForwardedHTML extracts an inline-forwarded message from an HTML
+// body. The HTML is rendered with HTMLToText and the text is passed to
+// ExtractForwardedText.
+func ExtractForwardedHTML(s string) (ForwardedMessage, bool, error) {
+	text, err := HTMLToText(s, HTMLLinkOmit)
+	if err != nil {
+		return ForwardedMessage{}, false, fmt.Errorf(
+			"letters.forwarded.ExtractForwardedHTML: "+
+				"cannot render HTML: %w",
+			err,
+		)
+	}
+
+	forwarded, ok := ExtractForwardedText(text)
+
+	return forwarded, ok, nil
+}
+
+// ExtractForwardedText extracts an inline-forwarded message from a
+// plain-text body.
+//
+// A forwarded message starts with a separator such as Gmail's
+// "---------- Forwarded message ---------", Outlook's underscore line or
+// "-----Original Message-----", or Apple Mail's "Begin forwarded message:",
+// followed by a block of From, Date or Sent, Subject, To and Cc lines. The
+// separators and header names of several languages are recognized. A
+// forwarded message that itself contains a forwarded message is returned
+// with the inner message in Forwarded.
+func ExtractForwardedText(s string) (ForwardedMessage, bool) {
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+
+	_, start, headerEnd, ok := findForwardedBlock(lines)
+	if !ok {
+		return ForwardedMessage{}, false
+	}
+
+	forwarded := parseForwardedHeaders(lines[start:headerEnd])
+
+	body := lines[headerEnd:]
+
+	bodyEnd := len(body)
+	if separator, _, _, found := findForwardedBlock(body); found {
+		bodyEnd = separator
+	}
+
+	forwarded.Text = joinReplyLines(body[:bodyEnd])
+
+	nested, ok := ExtractForwardedText(strings.Join(body, "\n"))
+	if ok {
+		forwarded.Forwarded = &nested
+	}
+
+	return forwarded, true
+}
+
+// findForwardedBlock returns the indexes of the separator line and the
+// first header line of the first forwarded message in lines, and the index
+// of the line after its header block.
+func findForwardedBlock(lines []string) (int, int, int, bool) {
+	for i, line := range lines {
+		if !isForwardSeparator(strings.TrimSpace(line)) {
+			continue
+		}
+
+		start := i + 1
+		for start < len(lines) && strings.TrimSpace(lines[start]) == "" {
+			start++
+		}
+
+		end, headerLines := scanForwardedHeaders(lines[start:])
+		if headerLines >= forwardedMinHeaderLines {
+			return i, start, start + end, true
+		}
+	}
+
+	return 0, 0, 0, false
+}
+
+func isForwardSeparator(line string) bool {
+	if isOutlookSeparator(line) {
+		return true
+	}
+
+	lower := strings.ToLower(line)
+
+	if strings.HasPrefix(lower, "---") {
+		switch strings.Trim(lower, "- ") {
+		case "forwarded message",
+			"original message",
+			"weitergeleitete nachricht",
+			"ursprüngliche nachricht",
+			"message transféré",
+			"message d'origine",
+			"mensaje reenviado",
+			"mensaje original",
+			"messaggio inoltrato",
+			"messaggio originale",
+			"doorgestuurd bericht",
+			"oorspronkelijk bericht",
+			"mensagem encaminhada",
+			"mensagem original":
+			return true
+		}
+	}
+
+	switch strings.TrimRight(lower, " :") {
+	case "begin forwarded message",
+		"anfang der weitergeleiteten nachricht",
+		"début du message réexpédié",
+		"inicio del mensaje reenviado",
+		"inizio messaggio inoltrato",
+		"begin doorgestuurd bericht",
+		"início da mensagem reencaminhada":
+		return true
+	default:
+		return false
+	}
+}
+
+// scanForwardedHeaders returns the number of lines in the header block at
+// the start of lines and the number of header fields in it.
+func scanForwardedHeaders(lines []string) (int, int) {
+	fields := 0
+
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			return i, fields
+		}
+
+		if fields > 0 && (line[0] == ' ' || line[0] == '\t') {
+			continue
+		}
+
+		name, _, found := strings.Cut(line, ":")
+		if !found || forwardedHeaderName(name) == "" {
+			return i, fields
+		}
+
+		fields++
+	}
+
+	return len(lines), fields
+}
+
+// forwardedHeaderName returns the canonical name of a header line in the
+// header block of a forwarded message, or an empty string for names that
+// are not recognized.
+func forwardedHeaderName(name string) string {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "from", "von", "de", "da", "van", "från", "fra":
+		return "From"
+	case "reply-to", "antwort an", "répondre à", "responder a":
+		return "Reply-To"
+	case "to", "an", "à", "a", "para", "aan", "till", "til":
+		return "To"
+	case "cc", "kopie", "copie", "cópia", "copia":
+		return "Cc"
+	case "date", "sent", "datum", "gesendet", "envoyé", "fecha",
+		"enviado", "data", "inviato", "verzonden", "skickat", "sendt":
+		return "Date"
+	case "subject", "betreff", "objet", "asunto", "assunto", "oggetto",
+		"onderwerp", "ämne", "emne":
+		return "Subject"
+	case "message-id", "in-reply-to", "references":
+		return textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(name))
+	default:
+		return ""
+	}
+}
+
+func parseForwardedHeaders(lines []string) ForwardedMessage {
+	var forwarded ForwardedMessage
+
+	forwarded.RawHeaders = make(map[string]string)
+	forwarded.Headers.ExtraHeaders = make(map[string][]string)
+
+	var name string
+
+	for _, line := range lines {
+		if name != "" && (line[0] == ' ' || line[0] == '\t') {
+			forwarded.RawHeaders[name] += " " + strings.TrimSpace(line)
+
+			continue
+		}
+
+		key, value, _ := strings.Cut(line, ":")
+		name = forwardedHeaderName(key)
+		forwarded.RawHeaders[name] = strings.TrimSpace(value)
+	}
+
+	for name, value := range forwarded.RawHeaders {
+		switch name {
+		case "From":
+			forwarded.Headers.From = parseForwardedAddressList(value)
+		case "Reply-To":
+			forwarded.Headers.ReplyTo = parseForwardedAddressList(value)
+		case "To":
+			forwarded.Headers.To = parseForwardedAddressList(value)
+		case "Cc":
+			forwarded.Headers.Cc = parseForwardedAddressList(value)
+		case "Date":
+			forwarded.Headers.Date = parseForwardedDate(value)
+		case "Subject":
+			forwarded.Headers.Subject = ParseStringHeader(value)
+		default:
+			forwarded.Headers.ExtraHeaders[name] = []string{
+				ParseStringHeader(value),
+			}
+		}
+	}
+
+	return forwarded
+}
+
+// parseForwardedAddressList parses an address list with
+// ParseAddressListHeader. Outlook separates addresses with semicolons.
+// Addresses that cannot be parsed are left out.
+func parseForwardedAddressList(value string) []*mail.Address {
+	value = strings.ReplaceAll(value, ";", ",")
+
+	addresses, err := ParseAddressListHeader(
+		mail.Header{"From": []string{value}},
+		"From",
+	)
+	if err == nil {
+		return addresses
+	}
+
+	addresses = nil
+
+	for _, item := range strings.Split(value, ",") {
+		address, err := mail.ParseAddress(strings.TrimSpace(item))
+		if err == nil {
+			addresses = append(addresses, address)
+		}
+	}
+
+	return addresses
+}
+
+// parseForwardedDate parses a date with ParseDateHeader, falling back to
+// the layouts that mail clients use when they forward a message.
+func parseForwardedDate(value string) time.Time {
+	date := ParseDateHeader(value)
+	if !date.IsZero() {
+		return date
+	}
+
+	// Mail clients use a narrow no-break space before AM and PM.
+	value = strings.Join(strings.Fields(
+		strings.ReplaceAll(value, "\u202f", " "),
+	), " ")
+
+	for _, layout := range []string{
+		"Mon, Jan 2, 2006 at 3:04 PM",
+		"Mon, Jan 2, 2006 at 15:04",
+		"Mon, 2 Jan 2006 at 15:04",
+		"Monday, January 2, 2006 3:04 PM",
+		"Monday, January 2, 2006 at 3:04 PM",
+		"Monday, 2 January 2006 15:04",
+		"Monday, 2 January 2006 at 15:04",
+		"January 2, 2006 at 3:04:05 PM MST",
+		"January 2, 2006 at 3:04 PM",
+		"2 January 2006 at 15:04:05 MST",
+		"2 January 2006 at 15:04",
+		"2006-01-02 15:04",
+		"2006-01-02 15:04:05",
+	} {
+		date, err := time.Parse(layout, value)
+		if err == nil {
+			return date
+		}
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,162 @@
+package letters_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mnako/letters"
+)
+
+func TestExtractForwardedText(t *testing.T) {
+	t.Parallel()
+
+	text := "Looks like phishing, see below.\n" +
+		"\n" +
+		"---------- Forwarded message ---------\n" +
+		"From: IT Support <support@examp1e.com>\n" +
+		"Date: Mon, Apr 1, 2019 at 7:55 AM\n" +
+		"Subject: Your password expires\n" +
+		"To: Bob <bob@example.com>, Carol <carol@example.com>\n" +
+		"\n" +
+		"\n" +
+		"Click here to keep your password.\n" +
+		"\n" +
+		"-----Original Message-----\n" +
+		"From: Mallory <mallory@example.net>\n" +
+		"Sent: Sunday, March 31, 2019 11:00 PM\n" +
+		"To: IT Support; Eve <eve@example.net>\n" +
+		"Subject: template\n" +
+		"\n" +
+		"Original text\n"
+
+	forwarded, ok := letters.ExtractForwardedText(text)
+	if !ok {
+		t.Fatalf("expected a forwarded message")
+	}
+
+	if len(forwarded.Headers.From) != 1 ||
+		forwarded.Headers.From[0].Address != "support@examp1e.com" ||
+		forwarded.Headers.From[0].Name != "IT Support" {
+		t.Errorf("unexpected From: %v", forwarded.Headers.From)
+	}
+
+	expectedDate := time.Date(2019, time.April, 1, 7, 55, 0, 0, time.UTC)
+	if !forwarded.Headers.Date.Equal(expectedDate) {
+		t.Errorf("unexpected Date: %s", forwarded.Headers.Date)
+	}
+
+	if forwarded.Headers.Subject != "Your password expires" ||
+		len(forwarded.Headers.To) != 2 {
+		t.Errorf("unexpected headers: %#v", forwarded.Headers)
+	}
+
+	if forwarded.Text != "Click here to keep your password." {
+		t.Errorf("unexpected text: %q", forwarded.Text)
+	}
+
+	if forwarded.Forwarded == nil {
+		t.Fatalf("expected a nested forwarded message")
+	}
+
+	original := forwarded.Original()
+	if len(original.Headers.From) != 1 ||
+		original.Headers.From[0].Address != "mallory@example.net" {
+		t.Errorf("unexpected original From: %v", original.Headers.From)
+	}
+
+	expectedDate = time.Date(2019, time.March, 31, 23, 0, 0, 0, time.UTC)
+	if !original.Headers.Date.Equal(expectedDate) {
+		t.Errorf("unexpected original Date: %s", original.Headers.Date)
+	}
+
+	if len(original.Headers.To) != 1 ||
+		original.Headers.To[0].Address != "eve@example.net" ||
+		original.RawHeaders["To"] != "IT Support; Eve <eve@example.net>" {
+		t.Errorf(
+			"unexpected original To: %v, %q",
+			original.Headers.To,
+			original.RawHeaders["To"],
+		)
+	}
+
+	if original.Text != "Original text" || original.Forwarded != nil {
+		t.Errorf("unexpected original: %#v", original)
+	}
+}
+
+func TestExtractForwardedTextLocalized(t *testing.T) {
+	t.Parallel()
+
+	text := "Anfang der weitergeleiteten Nachricht:\n" +
+		"\n" +
+		"Von: Alice <alice@example.de>\n" +
+		"Betreff: Rechnung\n" +
+		"Datum: 1. April 2019 um 07:55:00 MESZ\n" +
+		"An: Bob <bob@example.de>\n" +
+		"\n" +
+		"Hallo"
+
+	forwarded, ok := letters.ExtractForwardedText(text)
+	if !ok {
+		t.Fatalf("expected a forwarded message")
+	}
+
+	if len(forwarded.Headers.From) != 1 ||
+		forwarded.Headers.From[0].Address != "alice@example.de" ||
+		forwarded.Headers.Subject != "Rechnung" ||
+		forwarded.RawHeaders["Date"] != "1. April 2019 um 07:55:00 MESZ" ||
+		forwarded.Text != "Hallo" {
+		t.Errorf("unexpected forwarded message: %#v", forwarded)
+	}
+}
+
+func TestExtractForwardedTextNone(t *testing.T) {
+	t.Parallel()
+
+	for _, text := range []string{
+		"Just a message.",
+		"---------- Forwarded message ---------\nnot headers",
+	} {
+		_, ok := letters.ExtractForwardedText(text)
+		if ok {
+			t.Errorf("%q: unexpected forwarded message", text)
+		}
+	}
+}
+
+func TestEmailForwardedMessageFromHTML(t *testing.T) {
+	t.Parallel()
+
+	message := "From: Bob <bob@example.com>\r\n" +
+		"Subject: Fwd: Hello\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/html; charset=utf-8\r\n" +
+		"\r\n" +
+		"<div dir=\"ltr\">FYI<br><div class=\"gmail_quote\">" +
+		"<div dir=\"ltr\" class=\"gmail_attr\">" +
+		"---------- Forwarded message ---------<br>" +
+		"From: <strong class=\"gmail_sendername\">Alice</strong> " +
+		"<span dir=\"auto\">&lt;<a href=\"mailto:alice@example.com\">" +
+		"alice@example.com</a>&gt;</span><br>" +
+		"Date: Mon, 1 Apr 2019 07:55:00 +0100<br>" +
+		"Subject: Hello<br>To: &lt;bob@example.com&gt;<br></div><br><br>" +
+		"<div dir=\"ltr\">Hi Bob</div></div></div>\r\n"
+
+	email, err := letters.ParseEmail(strings.NewReader(message))
+	if err != nil {
+		t.Fatalf("cannot parse email: %s", err)
+	}
+
+	forwarded, ok, err := email.ForwardedMessage()
+	if err != nil || !ok {
+		t.Fatalf("expected a forwarded message: %v", err)
+	}
+
+	if len(forwarded.Headers.From) != 1 ||
+		forwarded.Headers.From[0].Address != "alice@example.com" ||
+		forwarded.Headers.Date.Unix() != 1554101700 ||
+		forwarded.Text != "Hi Bob" {
+		t.Errorf("unexpected forwarded message: %#v", forwarded)
+	}
+}
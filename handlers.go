@@ -0,0 +1,129 @@
+package letters
+
+import (
+	"fmt"
+	"io"
+	"net/textproto"
+	"strings"
+)
+
+// wildcardSubtype matches every subtype of a media type in a content type
+// handler pattern.
+const wildcardSubtype = "*"
+
+// ContentTypeHandler handles the parts of the media types it is registered
+// for with WithContentTypeHandler. Its result is added to
+// Email.HandledParts and an error fails the parse.
+type ContentTypeHandler func(part HandledPart) (any, error)
+
+// HandledPart is a part passed to a ContentTypeHandler.
+type HandledPart struct {
+	// Header is the header of the part, or the header of the message for
+	// single-part messages.
+	Header textproto.MIMEHeader
+
+	ContentType        ContentTypeHeader
+	ContentDisposition ContentDispositionHeader
+
+	// ParentContentType is the content type of the multipart entity that
+	// contains the part. It is empty for single-part messages.
+	ParentContentType ContentTypeHeader
+
+	// Data is the content of the part, decoded from its
+	// Content-Transfer-Encoding but not from its charset.
+	Data []byte
+}
+
+// Text returns the content of the part decoded from its charset or, when
+// it has none, the charset of its parent.
+func (p HandledPart) Text() string {
+	charsetLabel := p.ContentType.Params["charset"]
+	if charsetLabel == "" {
+		charsetLabel = p.ParentContentType.Params["charset"]
+	}
+
+	return decodeCharsetBytes(p.Data, charsetLabel)
+}
+
+// WithContentTypeHandler registers a handler for the parts of a media type,
+// such as text/calendar, or of the media types matching a pattern, such as
+// message/* or */*. The parser passes matching parts to the handler instead
+// of adding them to the bodies or files of the email, and adds the result
+// to Email.HandledParts under the pattern. Exact media types take
+// precedence over type/* patterns, which take precedence over */*.
+// Multipart entities are always walked by the parser.
+func WithContentTypeHandler(
+	pattern string,
+	handler ContentTypeHandler,
+) EmailParserOption {
+	return func(ep *EmailParser) {
+		ep.contentTypeHandlers[strings.ToLower(pattern)] = handler
+	}
+}
+
+// contentTypeHandler returns the most specific handler registered for a
+// media type and its pattern.
+func (ep *EmailParser) contentTypeHandler(
+	contentType string,
+) (string, ContentTypeHandler, bool) {
+	if len(ep.contentTypeHandlers) == 0 ||
+		strings.HasPrefix(contentType, contentTypeMultipartPrefix) {
+		return "", nil, false
+	}
+
+	mediaType, _, _ := strings.Cut(contentType, "/")
+
+	for _, pattern := range []string{
+		contentType,
+		mediaType + "/" + wildcardSubtype,
+		wildcardSubtype + "/" + wildcardSubtype,
+	} {
+		if handler, ok := ep.contentTypeHandlers[pattern]; ok {
+			return pattern, handler, true
+		}
+	}
+
+	return "", nil, false
+}
+
+// handlePart passes a part to the handler registered for its content type
+// and adds the result to the handled parts. It reports whether a handler
+// was registered.
+func (ep *EmailParser) handlePart(
+	body io.Reader,
+	part HandledPart,
+	decodeTransfer ContentTransferDecoder,
+	handledParts *map[string][]any,
+) (bool, error) {
+	pattern, handler, ok := ep.contentTypeHandler(part.ContentType.ContentType)
+	if !ok {
+		return false, nil
+	}
+
+	decoded, err := decodeContent(body, nil, decodeTransfer)
+	if err != nil {
+		return true, fmt.Errorf("cannot decode part: %w", err)
+	}
+
+	part.Data, err = io.ReadAll(decoded)
+	if err != nil {
+		return true, fmt.Errorf("cannot read part: %w", err)
+	}
+
+	result, err := handler(part)
+	if err != nil {
+		return true, fmt.Errorf(
+			"cannot handle %s part: %w",
+			part.ContentType.ContentType,
+			err,
+		)
+	}
+
+	if *handledParts == nil {
+		*handledParts = make(map[string][]any)
+	}
+
+	(*handledParts)[pattern] = append((*handledParts)[pattern], result)
+
+	return true, nil
+}
@@ -0,0 +1,160 @@
+package letters_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mnako/letters"
+)
+
+const handlersTestEmail = "From: Alice <alice@example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=b\r\n" +
+	"\r\n" +
+	"--b\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"Meeting invitation\r\n" +
+	"--b\r\n" +
+	"Content-Type: text/calendar; charset=iso-8859-1; method=REQUEST\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"BEGIN:VCALENDAR\r\n" +
+	"SUMMARY:Caf=E9\r\n" +
+	"END:VCALENDAR\r\n" +
+	"--b\r\n" +
+	"Content-Type: message/rfc822\r\n" +
+	"Content-Disposition: attachment; filename=earlier.eml\r\n" +
+	"\r\n" +
+	"Subject: Earlier\r\n" +
+	"\r\n" +
+	"Earlier text\r\n" +
+	"--b--\r\n"
+
+func TestParseWithContentTypeHandler(t *testing.T) {
+	t.Parallel()
+
+	email, err := letters.NewEmailParser(
+		letters.WithContentTypeHandler(
+			"Text/Calendar",
+			func(part letters.HandledPart) (any, error) {
+				method := part.ContentType.Params["method"]
+
+				return method + " " + part.Text(), nil
+			},
+		),
+		letters.WithContentTypeHandler(
+			"message/*",
+			func(part letters.HandledPart) (any, error) {
+				return part.ContentDisposition.Params["filename"], nil
+			},
+		),
+	).Parse(strings.NewReader(handlersTestEmail))
+	if err != nil {
+		t.Fatalf("cannot parse email: %s", err)
+	}
+
+	expectedCalendar := "REQUEST BEGIN:VCALENDAR\r\n" +
+		"SUMMARY:Café\r\n" +
+		"END:VCALENDAR"
+
+	calendars := email.HandledParts["text/calendar"]
+	if len(calendars) != 1 || calendars[0] != expectedCalendar {
+		t.Errorf("unexpected calendars: %q", calendars)
+	}
+
+	messages := email.HandledParts["message/*"]
+	if len(messages) != 1 || messages[0] != "earlier.eml" {
+		t.Errorf("unexpected messages: %q", messages)
+	}
+
+	if email.Text != "Meeting invitation" ||
+		len(email.AttachedFiles) != 0 ||
+		len(email.InlineFiles) != 0 {
+		t.Errorf("expected handled parts to be left out: %#v", email)
+	}
+}
+
+func TestParseWithContentTypeHandlerPrecedence(t *testing.T) {
+	t.Parallel()
+
+	handler := func(name string) letters.ContentTypeHandler {
+		return func(part letters.HandledPart) (any, error) {
+			return name + " " + part.ContentType.ContentType, nil
+		}
+	}
+
+	email, err := letters.NewEmailParser(
+		letters.WithContentTypeHandler("*/*", handler("any")),
+		letters.WithContentTypeHandler("text/*", handler("text")),
+		letters.WithContentTypeHandler("text/calendar", handler("calendar")),
+	).Parse(strings.NewReader(handlersTestEmail))
+	if err != nil {
+		t.Fatalf("cannot parse email: %s", err)
+	}
+
+	expected := map[string][]any{
+		"text/*":        {"text text/plain"},
+		"text/calendar": {"calendar text/calendar"},
+		"*/*":           {"any message/rfc822"},
+	}
+
+	for pattern, results := range expected {
+		handled := email.HandledParts[pattern]
+		if len(handled) != len(results) || handled[0] != results[0] {
+			t.Errorf("unexpected %s results: %q", pattern, handled)
+		}
+	}
+
+	if email.Text != "" {
+		t.Errorf("expected no text, got %q", email.Text)
+	}
+}
+
+func TestParseWithContentTypeHandlerSinglePart(t *testing.T) {
+	t.Parallel()
+
+	message := "From: Alice <alice@example.com>\r\n" +
+		"Content-Type: application/x-vendor\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"dmVuZG9yIGRhdGE=\r\n"
+
+	email, err := letters.NewEmailParser(
+		letters.WithContentTypeHandler(
+			"application/x-vendor",
+			func(part letters.HandledPart) (any, error) {
+				return part.Header.Get("From") + ": " + string(part.Data), nil
+			},
+		),
+	).Parse(strings.NewReader(message))
+	if err != nil {
+		t.Fatalf("cannot parse email: %s", err)
+	}
+
+	handled := email.HandledParts["application/x-vendor"]
+	if len(handled) != 1 ||
+		handled[0] != "Alice <alice@example.com>: vendor data" ||
+		len(email.AttachedFiles) != 0 {
+		t.Errorf("unexpected email: %#v", email)
+	}
+}
+
+func TestParseWithContentTypeHandlerError(t *testing.T) {
+	t.Parallel()
+
+	errInvalid := errors.New("invalid calendar")
+
+	_, err := letters.NewEmailParser(
+		letters.WithContentTypeHandler(
+			"text/calendar",
+			func(_ letters.HandledPart) (any, error) {
+				return nil, errInvalid
+			},
+		),
+	).Parse(strings.NewReader(handlersTestEmail))
+	if !errors.Is(err, errInvalid) {
+		t.Errorf("expected handler error, got %v", err)
+	}
+}
@@ -0,0 +1,502 @@
+package letters
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// HTMLLinkStyle controls how HTMLToText renders link targets.
+type HTMLLinkStyle int
+
+const (
+	// HTMLLinkFootnotes renders links as numbered references, for example
+	// "Letters[1]", and lists their targets at the end of the text.
+	HTMLLinkFootnotes HTMLLinkStyle = iota
+
+	// HTMLLinkInline renders link targets after the link text, for example
+	// "Letters <https://example.com/>".
+	HTMLLinkInline
+
+	// HTMLLinkOmit renders only the link text.
+	HTMLLinkOmit
+)
+
+const htmlTableCellSeparator = " | "
+
+// WithHTMLToText makes the parser fill Email.Text with a plain-text rendering
+// of Email.HTML when the message has an HTML body but no plain-text body.
+func WithHTMLToText(linkStyle HTMLLinkStyle) EmailParserOption {
+	return func(ep *EmailParser) {
+		ep.htmlLinkStyle = linkStyle
+		ep.htmlToText = true
+	}
+}
+
+// HTMLText returns a plain-text rendering of the HTML body of the email.
+func (e Email) HTMLText(linkStyle HTMLLinkStyle) (string, error) {
+	return HTMLToText(e.HTML, linkStyle)
+}
+
+// HTMLToText renders an HTML document as readable plain text.
+//
+// Paragraphs, headings and other block elements are separated by blank lines.
+// Line breaks are kept, list items are prefixed with "*" or their number,
+// table rows are rendered as lines with cells separated by "|", and
+// blockquotes are prefixed with ">". Scripts, styles and elements hidden with
+// the hidden attribute or with display:none or visibility:hidden inline
+// styles are dropped.
+func HTMLToText(s string, linkStyle HTMLLinkStyle) (string, error) {
+	document, err := html.Parse(strings.NewReader(s))
+	if err != nil {
+		return "", fmt.Errorf(
+			"letters.htmltext.HTMLToText: cannot parse HTML: %w",
+			err,
+		)
+	}
+
+	renderer := htmlTextRenderer{
+		out:          strings.Builder{},
+		linkStyle:    linkStyle,
+		links:        nil,
+		prefixes:     nil,
+		lists:        nil,
+		marker:       "",
+		newlines:     0,
+		breakPrefix:  "",
+		space:        false,
+		preformatted: 0,
+		cellIndex:    0,
+	}
+	renderer.renderChildren(document)
+
+	return renderer.String(), nil
+}
+
+type htmlTextList struct {
+	ordered bool
+	index   int
+}
+
+type htmlTextRenderer struct {
+	out       strings.Builder
+	linkStyle HTMLLinkStyle
+	links     []string
+
+	// prefixes are written at the start of every line, for example "> "
+	// inside blockquotes and indentation inside list items.
+	prefixes []string
+	lists    []htmlTextList
+
+	// marker replaces the innermost prefix on the first line of a list
+	// item.
+	marker string
+
+	// newlines is the number of line breaks waiting to be written before
+	// the next text; breakPrefix is written on the blank lines among them.
+	newlines    int
+	breakPrefix string
+	space       bool
+
+	preformatted int
+	cellIndex    int
+}
+
+func (r *htmlTextRenderer) renderChildren(node *html.Node) {
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		r.render(child)
+	}
+}
+
+func (r *htmlTextRenderer) render(node *html.Node) {
+	switch node.Type {
+	case html.TextNode:
+		r.writeText(node.Data)
+
+		return
+	case html.ElementNode:
+	case html.DocumentNode:
+		r.renderChildren(node)
+
+		return
+	case html.ErrorNode,
+		html.CommentNode,
+		html.DoctypeNode,
+		html.RawNode:
+		return
+	}
+
+	if isHiddenHTMLElement(node) {
+		return
+	}
+
+	switch node.DataAtom {
+	case atom.Br:
+		r.lineBreak()
+	case atom.Hr:
+		r.blockBreak(2)
+		r.writeRaw("---")
+		r.blockBreak(2)
+	case atom.Img:
+		r.writeText(htmlAttribute(node, "alt"))
+	case atom.A:
+		r.renderLink(node)
+	case atom.P,
+		atom.H1,
+		atom.H2,
+		atom.H3,
+		atom.H4,
+		atom.H5,
+		atom.H6,
+		atom.Table,
+		atom.Dl:
+		r.blockBreak(2)
+		r.renderChildren(node)
+		r.blockBreak(2)
+	case atom.Pre:
+		r.blockBreak(2)
+		r.preformatted++
+		r.renderChildren(node)
+		r.preformatted--
+		r.blockBreak(2)
+	case atom.Blockquote:
+		r.blockBreak(2)
+		r.prefixes = append(r.prefixes, "> ")
+		r.renderChildren(node)
+		r.prefixes = r.prefixes[:len(r.prefixes)-1]
+		r.blockBreak(2)
+	case atom.Ul, atom.Ol:
+		r.renderList(node)
+	case atom.Li:
+		r.renderListItem(node)
+	case atom.Tr:
+		r.blockBreak(1)
+		r.cellIndex = 0
+		r.renderChildren(node)
+		r.blockBreak(1)
+	case atom.Td, atom.Th:
+		if r.cellIndex > 0 {
+			r.writeRaw(htmlTableCellSeparator)
+		}
+
+		r.cellIndex++
+		r.renderChildren(node)
+	case atom.Div,
+		atom.Address,
+		atom.Article,
+		atom.Aside,
+		atom.Caption,
+		atom.Center,
+		atom.Dd,
+		atom.Dt,
+		atom.Fieldset,
+		atom.Figcaption,
+		atom.Figure,
+		atom.Footer,
+		atom.Form,
+		atom.Header,
+		atom.Main,
+		atom.Nav,
+		atom.Section:
+		r.blockBreak(1)
+		r.renderChildren(node)
+		r.blockBreak(1)
+	default:
+		r.renderChildren(node)
+	}
+}
+
+func (r *htmlTextRenderer) renderList(node *html.Node) {
+	if len(r.lists) == 0 {
+		r.blockBreak(2)
+	} else {
+		r.blockBreak(1)
+	}
+
+	start := 1
+	if node.DataAtom == atom.Ol {
+		value, err := strconv.Atoi(htmlAttribute(node, "start"))
+		if err == nil {
+			start = value
+		}
+	}
+
+	r.lists = append(r.lists, htmlTextList{
+		ordered: node.DataAtom == atom.Ol,
+		index:   start,
+	})
+	r.renderChildren(node)
+	r.lists = r.lists[:len(r.lists)-1]
+
+	if len(r.lists) == 0 {
+		r.blockBreak(2)
+	} else {
+		r.blockBreak(1)
+	}
+}
+
+func (r *htmlTextRenderer) renderListItem(node *html.Node) {
+	r.blockBreak(1)
+
+	marker := "* "
+
+	if len(r.lists) > 0 {
+		list := &r.lists[len(r.lists)-1]
+		if list.ordered {
+			marker = strconv.Itoa(list.index) + ". "
+		}
+
+		list.index++
+	}
+
+	r.marker = marker
+	r.prefixes = append(r.prefixes, strings.Repeat(" ", len(marker)))
+	r.renderChildren(node)
+	r.prefixes = r.prefixes[:len(r.prefixes)-1]
+	r.marker = ""
+	r.blockBreak(1)
+}
+
+func (r *htmlTextRenderer) renderLink(node *html.Node) {
+	start := r.out.Len()
+
+	r.renderChildren(node)
+
+	href := strings.TrimSpace(htmlAttribute(node, "href"))
+	if r.linkStyle == HTMLLinkOmit || !isRenderableLink(href) {
+		return
+	}
+
+	text := strings.TrimSpace(r.out.String()[start:])
+	if text == href || "mailto:"+text == href {
+		return
+	}
+
+	switch r.linkStyle {
+	case HTMLLinkInline:
+		r.writeRaw(" <" + href + ">")
+	case HTMLLinkFootnotes:
+		index := len(r.links) + 1
+		for i, link := range r.links {
+			if link == href {
+				index = i + 1
+
+				break
+			}
+		}
+
+		if index > len(r.links) {
+			r.links = append(r.links, href)
+		}
+
+		r.writeRaw("[" + strconv.Itoa(index) + "]")
+	case HTMLLinkOmit:
+	}
+}
+
+// blockBreak requests n line breaks before the next text.
+func (r *htmlTextRenderer) blockBreak(n int) {
+	r.space = false
+
+	if r.out.Len() == 0 {
+		return
+	}
+
+	prefix := strings.Join(r.prefixes, "")
+	if r.newlines == 0 || len(prefix) < len(r.breakPrefix) {
+		r.breakPrefix = prefix
+	}
+
+	r.newlines = max(r.newlines, n)
+}
+
+func (r *htmlTextRenderer) lineBreak() {
+	r.space = false
+
+	if r.newlines > 0 {
+		r.newlines++
+
+		return
+	}
+
+	r.breakPrefix = strings.Join(r.prefixes, "")
+	r.newlines = 1
+}
+
+func (r *htmlTextRenderer) writeText(s string) {
+	if r.preformatted > 0 {
+		lines := strings.Split(s, "\n")
+		for i, line := range lines {
+			if i > 0 {
+				r.lineBreak()
+			}
+
+			if line != "" {
+				r.writeRaw(line)
+			}
+		}
+
+		return
+	}
+
+	if strings.IndexFunc(s, isHTMLSpace) == 0 {
+		r.space = true
+	}
+
+	words := strings.FieldsFunc(s, isHTMLSpace)
+	for i, word := range words {
+		if (i > 0 || r.space) && r.newlines == 0 && !r.atLineStart() {
+			r.writeRaw(" ")
+		}
+
+		r.writeRaw(word)
+		r.space = false
+	}
+
+	if last, _ := utf8.DecodeLastRuneInString(s); isHTMLSpace(last) {
+		r.space = true
+	}
+}
+
+// writeRaw writes s after any pending line breaks and line prefix.
+func (r *htmlTextRenderer) writeRaw(s string) {
+	if r.newlines > 0 {
+		r.out.WriteString("\n")
+
+		blank := strings.TrimRight(r.breakPrefix, " ")
+		for range r.newlines - 1 {
+			r.out.WriteString(blank + "\n")
+		}
+
+		r.newlines = 0
+	}
+
+	if r.atLineStart() {
+		prefixes := r.prefixes
+		if r.marker != "" && len(prefixes) > 0 {
+			prefixes = prefixes[:len(prefixes)-1]
+		}
+
+		r.out.WriteString(strings.Join(prefixes, ""))
+
+		if r.marker != "" {
+			r.out.WriteString(r.marker)
+			r.marker = ""
+		}
+	}
+
+	r.out.WriteString(s)
+}
+
+func (r *htmlTextRenderer) atLineStart() bool {
+	s := r.out.String()
+
+	return s == "" || s[len(s)-1] == '\n'
+}
+
+func (r *htmlTextRenderer) String() string {
+	lines := strings.Split(r.out.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+
+	text := strings.Trim(strings.Join(lines, "\n"), "\n")
+
+	if len(r.links) > 0 {
+		var footnotes strings.Builder
+
+		for i, link := range r.links {
+			footnotes.WriteString(
+				"\n[" + strconv.Itoa(i+1) + "] " + link,
+			)
+		}
+
+		text += "\n" + footnotes.String()
+	}
+
+	return text
+}
+
+func htmlAttribute(node *html.Node, key string) string {
+	for _, attribute := range node.Attr {
+		if attribute.Namespace == "" && attribute.Key == key {
+			return attribute.Val
+		}
+	}
+
+	return ""
+}
+
+func isHiddenHTMLElement(node *html.Node) bool {
+	switch node.DataAtom {
+	case atom.Head,
+		atom.Script,
+		atom.Style,
+		atom.Template,
+		atom.Noscript,
+		atom.Iframe,
+		atom.Object,
+		atom.Embed,
+		atom.Svg,
+		atom.Canvas:
+		return true
+	default:
+	}
+
+	for _, attribute := range node.Attr {
+		if attribute.Namespace != "" {
+			continue
+		}
+
+		switch attribute.Key {
+		case "hidden":
+			return true
+		case "style":
+			style := strings.Map(func(r rune) rune {
+				if isHTMLSpace(r) {
+					return -1
+				}
+
+				return r
+			}, strings.ToLower(attribute.Val))
+
+			if strings.Contains(style, "display:none") ||
+				strings.Contains(style, "visibility:hidden") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func isRenderableLink(href string) bool {
+	if href == "" || strings.HasPrefix(href, "#") {
+		return false
+	}
+
+	scheme, _, found := strings.Cut(href, ":")
+	if !found {
+		return true
+	}
+
+	switch strings.ToLower(scheme) {
+	case "javascript", "cid", "data", "vbscript":
+		return false
+	default:
+		return true
+	}
+}
+
+func isHTMLSpace(r rune) bool {
+	switch r {
+	case ' ', '\t', '\n', '\r', '\f', '\u00a0':
+		return true
+	default:
+		return false
+	}
+}
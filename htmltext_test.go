@@ -0,0 +1,173 @@
+package letters_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mnako/letters"
+)
+
+func TestHTMLToText(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name      string
+		html      string
+		linkStyle letters.HTMLLinkStyle
+		expected  string
+	}{
+		{
+			name: "paragraphs and line breaks",
+			html: "<html><head><title>Title</title>" +
+				"<style>p { color: red; }</style></head><body>" +
+				"<h1>Hello,   <b>World</b>!</h1>" +
+				"<p>First line<br>second line</p>" +
+				"<div>Block</div><p>Last</p>" +
+				"<script>alert(1)</script></body></html>",
+			linkStyle: letters.HTMLLinkFootnotes,
+			expected: "Hello, World!\n\n" +
+				"First line\nsecond line\n\n" +
+				"Block\n\n" +
+				"Last",
+		},
+		{
+			name: "non-ASCII text before inline elements",
+			html: "<p>Voilà<b>!</b> Привет Р<i>x</i> " +
+				"a&nbsp;<b>b</b></p>",
+			linkStyle: letters.HTMLLinkFootnotes,
+			expected:  "Voilà! Привет Рx a b",
+		},
+		{
+			name: "hidden elements",
+			html: "<div style=\"display: none\">preheader</div>" +
+				"<p>Visible<span hidden>secret</span>" +
+				"<span style=\"visibility:hidden\">secret</span></p>",
+			linkStyle: letters.HTMLLinkFootnotes,
+			expected:  "Visible",
+		},
+		{
+			name: "lists",
+			html: "<p>Items:</p><ul><li>One</li>" +
+				"<li>Two<ol start=\"3\"><li>Three</li><li>Four</li></ol></li>" +
+				"</ul><p>Done</p>",
+			linkStyle: letters.HTMLLinkFootnotes,
+			expected: "Items:\n\n" +
+				"* One\n" +
+				"* Two\n" +
+				"  3. Three\n" +
+				"  4. Four\n\n" +
+				"Done",
+		},
+		{
+			name: "tables",
+			html: "<table><tr><th>Name</th><th>Qty</th></tr>" +
+				"<tr><td>Apples</td><td>3</td></tr></table>",
+			linkStyle: letters.HTMLLinkFootnotes,
+			expected:  "Name | Qty\nApples | 3",
+		},
+		{
+			name: "blockquotes",
+			html: "<p>Reply</p><blockquote><p>Quoted</p>" +
+				"<p>Second</p></blockquote>",
+			linkStyle: letters.HTMLLinkFootnotes,
+			expected:  "Reply\n\n> Quoted\n>\n> Second",
+		},
+		{
+			name:      "preformatted text",
+			html:      "<pre>a  b\n  c</pre>",
+			linkStyle: letters.HTMLLinkFootnotes,
+			expected:  "a  b\n  c",
+		},
+		{
+			name: "footnote links",
+			html: "<p>Read <a href=\"https://example.com/a\">the docs</a>, " +
+				"<a href=\"https://example.com/b\">the blog</a> and " +
+				"<a href=\"https://example.com/a\">the docs again</a>. " +
+				"<a href=\"https://example.com/\">https://example.com/</a> " +
+				"<a href=\"#top\">Top</a></p>",
+			linkStyle: letters.HTMLLinkFootnotes,
+			expected: "Read the docs[1], the blog[2] and the docs again[1]. " +
+				"https://example.com/ Top\n\n" +
+				"[1] https://example.com/a\n" +
+				"[2] https://example.com/b",
+		},
+		{
+			name: "inline links",
+			html: "<p>Read " +
+				"<a href=\"https://example.com/a\">the docs</a>.</p>",
+			linkStyle: letters.HTMLLinkInline,
+			expected:  "Read the docs <https://example.com/a>.",
+		},
+		{
+			name: "omitted links",
+			html: "<p>Read " +
+				"<a href=\"https://example.com/a\">the docs</a>.</p>",
+			linkStyle: letters.HTMLLinkOmit,
+			expected:  "Read the docs.",
+		},
+		{
+			name: "images and entities",
+			html: "<p><img src=\"cid:logo\" alt=\"Logo\"> " +
+				"Fish &amp; Chips</p>",
+			linkStyle: letters.HTMLLinkFootnotes,
+			expected:  "Logo Fish & Chips",
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			text, err := letters.HTMLToText(testCase.html, testCase.linkStyle)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if text != testCase.expected {
+				t.Errorf(
+					"unexpected text:\ngot:\n%s\nexpected:\n%s",
+					text,
+					testCase.expected,
+				)
+			}
+		})
+	}
+}
+
+func TestParseWithHTMLToText(t *testing.T) {
+	t.Parallel()
+
+	message := "From: Alice <alice@example.com>\r\n" +
+		"Subject: HTML only\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/html; charset=utf-8\r\n" +
+		"\r\n" +
+		"<p>Hello <a href=\"https://example.com/\">there</a></p>\r\n"
+
+	email, err := letters.NewEmailParser().Parse(strings.NewReader(message))
+	if err != nil {
+		t.Fatalf("cannot parse email: %s", err)
+	}
+
+	if email.Text != "" {
+		t.Errorf("expected no text without the option, got %q", email.Text)
+	}
+
+	text, err := email.HTMLText(letters.HTMLLinkInline)
+	if err != nil || text != "Hello there <https://example.com/>" {
+		t.Errorf("unexpected HTMLText: %q, %v", text, err)
+	}
+
+	email, err = letters.NewEmailParser(
+		letters.WithHTMLToText(letters.HTMLLinkFootnotes),
+	).Parse(strings.NewReader(message))
+	if err != nil {
+		t.Fatalf("cannot parse email: %s", err)
+	}
+
+	expected := "Hello there[1]\n\n[1] https://example.com/"
+	if email.Text != expected {
+		t.Errorf("unexpected text: got %q, expected %q", email.Text, expected)
+	}
+}
@@ -0,0 +1,533 @@
+package letters
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+)
+
+const (
+	uuBeginPrefix       = "begin "
+	uuBase64BeginPrefix = "begin-base64 "
+	uuEnd               = "end"
+	uuBase64End         = "===="
+	uuCharOffset        = ' '
+	uuMaxChar           = '`'
+	uuGroupLength       = 4
+	uuGroupBytes        = 3
+	uuMinModeLength     = 3
+	uuMaxModeLength     = 4
+
+	yEncBeginPrefix = "=ybegin "
+	yEncPartPrefix  = "=ypart "
+	yEncEndPrefix   = "=yend"
+	yEncOffset      = 42
+	yEncEscape      = '='
+	yEncEscapeShift = 64
+
+	binHexPrefix    = "(This file must be converted with BinHex"
+	binHexDelimiter = ':'
+	binHexAlphabet  = "!\"#$%&'()*+,-012345689@ABCDEFGHIJKLMNPQRSTUVXYZ[`" +
+		"abcdefhijklmpqr"
+	binHexRunMarker = 0x90
+	binHexCRCPoly   = 0x1021
+	binHexCRCTopBit = 0x8000
+	binHexCharset   = "macintosh"
+
+	// Sizes of the fields of a BinHex header after the file name: version,
+	// type, creator, flags, data fork length, resource fork length and
+	// header CRC.
+	binHexHeaderFieldsSize = 1 + 4 + 4 + 2 + 4 + 4 + 2
+	binHexCRCSize          = 2
+	binHexForkLengthSize   = 4
+	bitsPerByte            = 8
+	sixBitMask             = 0x3f
+)
+
+// legacyFile is a file decoded from a uuencoded, yEnc or BinHex block.
+type legacyFile struct {
+	name string
+	data []byte
+}
+
+func (f legacyFile) attachedFile() AttachedFile {
+	return AttachedFile{
+		ContentType: ContentTypeHeader{
+			ContentType: fileContentType(f.name, f.data),
+			Params:      map[string]string{},
+		},
+		ContentDisposition: fileContentDisposition(
+			ContentDispositionAttachment,
+			f.name,
+		),
+		Data: f.data,
+	}
+}
+
+// legacyBlockDecoder decodes a block that starts at the first of the lines
+// and returns the file and the number of lines of the block.
+type legacyBlockDecoder func(lines []string) (legacyFile, int, bool)
+
+// WithLegacyFileDecoding makes the parser decode uuencoded, yEnc and BinHex
+// 4.0 blocks in the plain-text body, as ExtractLegacyFiles does, and append
+// the decoded files to Email.AttachedFiles. Blocks of files that the file
+// filter rejects are removed from the text all the same.
+func WithLegacyFileDecoding() EmailParserOption {
+	return func(ep *EmailParser) {
+		ep.decodeLegacy = true
+	}
+}
+
+func (ep *EmailParser) extractLegacyFiles(email *Email) {
+	text, files := ExtractLegacyFiles(email.Text)
+
+	email.Text = text
+
+	for _, file := range files {
+		if ep.fileFilter(file.ContentType, file.ContentDisposition) {
+			email.AttachedFiles = append(email.AttachedFiles, file)
+		}
+	}
+}
+
+// ExtractLegacyFiles finds the files that older clients and Usenet gateways
+// embed in plain text: uuencoded "begin 644 name" blocks, including the
+// begin-base64 variant, yEnc blocks and BinHex 4.0 blocks. It returns the
+// text without the blocks that it could decode and the decoded files, with
+// their names and detected media types. yEnc blocks must match the size and
+// CRC-32 of their trailer and BinHex blocks their CRCs; BinHex files keep
+// only their data fork.
+func ExtractLegacyFiles(text string) (string, []AttachedFile) {
+	var b strings.Builder
+
+	var files []AttachedFile
+
+	lines := strings.SplitAfter(text, "\n")
+	decoders := []legacyBlockDecoder{
+		decodeUUEncodedBlock,
+		decodeYEncBlock,
+		decodeBinHexBlock,
+	}
+
+	for i := 0; i < len(lines); {
+		found := false
+
+		for _, decode := range decoders {
+			file, n, ok := decode(lines[i:])
+			if ok {
+				files = append(files, file.attachedFile())
+				i += n
+				found = true
+
+				break
+			}
+		}
+
+		if !found {
+			b.WriteString(lines[i])
+			i++
+		}
+	}
+
+	return b.String(), files
+}
+
+// decodeLegacyContent decodes a body with a legacy content-transfer
+// encoding. uuencoded bodies may omit the begin and end lines.
+func decodeLegacyContent(
+	data []byte,
+	cte ContentTransferEncoding,
+) ([]byte, error) {
+	var decode legacyBlockDecoder
+
+	switch cte {
+	case cteXYEnc:
+		decode = decodeYEncBlock
+	case cteXBinHex:
+		decode = decodeBinHexBlock
+	default:
+		decode = decodeUUEncodedBlock
+	}
+
+	lines := strings.SplitAfter(string(data), "\n")
+
+	for i := range lines {
+		file, _, ok := decode(lines[i:])
+		if ok {
+			return file.data, nil
+		}
+	}
+
+	if cte == cteXYEnc || cte == cteXBinHex {
+		return nil, fmt.Errorf("%w: no %s block", ErrInvalidLegacyEncoding, cte)
+	}
+
+	var decoded []byte
+
+	for _, line := range lines {
+		line = trimLineEnding(line)
+		if line == "" || line == uuEnd ||
+			strings.HasPrefix(line, uuBeginPrefix) {
+			continue
+		}
+
+		decodedLine, ok := decodeUULine(line)
+		if !ok {
+			return nil, fmt.Errorf(
+				"%w: invalid uuencoded line %q",
+				ErrInvalidLegacyEncoding,
+				line,
+			)
+		}
+
+		decoded = append(decoded, decodedLine...)
+	}
+
+	return decoded, nil
+}
+
+func trimLineEnding(line string) string {
+	return strings.TrimRight(line, "\r\n")
+}
+
+// decodeUUEncodedBlock decodes a block that starts with a "begin mode name"
+// or "begin-base64 mode name" line and ends with an "end" or "====" line.
+func decodeUUEncodedBlock(lines []string) (legacyFile, int, bool) {
+	begin := trimLineEnding(lines[0])
+
+	isBase64 := strings.HasPrefix(begin, uuBase64BeginPrefix)
+	if !isBase64 && !strings.HasPrefix(begin, uuBeginPrefix) {
+		return legacyFile{}, 0, false
+	}
+
+	mode, name, found := strings.Cut(
+		strings.TrimLeft(begin[strings.IndexByte(begin, ' '):], " "),
+		" ",
+	)
+	if !found || !isUUMode(mode) || strings.TrimSpace(name) == "" {
+		return legacyFile{}, 0, false
+	}
+
+	file := legacyFile{name: strings.TrimSpace(name), data: nil}
+
+	var encoded strings.Builder
+
+	for i := 1; i < len(lines); i++ {
+		line := trimLineEnding(lines[i])
+
+		switch {
+		case isBase64 && line == uuBase64End:
+			data, err := base64.StdEncoding.DecodeString(encoded.String())
+			if err != nil {
+				return legacyFile{}, 0, false
+			}
+
+			file.data = data
+
+			return file, i + 1, true
+		case isBase64:
+			encoded.WriteString(strings.TrimSpace(line))
+		case line == uuEnd:
+			return file, i + 1, true
+		default:
+			data, ok := decodeUULine(line)
+			if !ok {
+				return legacyFile{}, 0, false
+			}
+
+			file.data = append(file.data, data...)
+		}
+	}
+
+	return legacyFile{}, 0, false
+}
+
+func isUUMode(mode string) bool {
+	if len(mode) < uuMinModeLength || len(mode) > uuMaxModeLength {
+		return false
+	}
+
+	_, err := strconv.ParseUint(mode, 8, 32)
+
+	return err == nil
+}
+
+// decodeUULine decodes a uuencoded line: a character encoding the number of
+// bytes, followed by groups of four characters encoding three bytes each.
+// Encoders may trim trailing spaces, which encode zero bits.
+func decodeUULine(line string) ([]byte, bool) {
+	if line == "" {
+		return nil, true
+	}
+
+	for _, c := range []byte(line) {
+		if c < uuCharOffset || c > uuMaxChar {
+			return nil, false
+		}
+	}
+
+	n := int((line[0] - uuCharOffset) & sixBitMask)
+	groups := []byte(line[1:])
+
+	length := (n + uuGroupBytes - 1) / uuGroupBytes * uuGroupLength
+	for len(groups) < length {
+		groups = append(groups, uuCharOffset)
+	}
+
+	data := make([]byte, 0, length/uuGroupLength*uuGroupBytes)
+
+	for i := 0; i+uuGroupLength <= length; i += uuGroupLength {
+		var group uint32
+
+		for _, c := range groups[i : i+uuGroupLength] {
+			group = group<<6 | uint32((c-uuCharOffset)&sixBitMask)
+		}
+
+		data = append(data, byte(group>>16), byte(group>>8), byte(group))
+	}
+
+	return data[:n], true
+}
+
+// decodeYEncBlock decodes a yEnc block, from its "=ybegin" line to its
+// "=yend" line, checking the size and CRC-32 of the trailer.
+func decodeYEncBlock(lines []string) (legacyFile, int, bool) {
+	begin := trimLineEnding(lines[0])
+	if !strings.HasPrefix(begin, yEncBeginPrefix) {
+		return legacyFile{}, 0, false
+	}
+
+	params := yEncParams(begin)
+	file := legacyFile{name: strings.TrimSpace(params["name"]), data: nil}
+	isPart := params["part"] != ""
+
+	start := 1
+	if isPart && len(lines) > 1 &&
+		strings.HasPrefix(lines[1], yEncPartPrefix) {
+		start = 2
+	}
+
+	for i := start; i < len(lines); i++ {
+		line := trimLineEnding(lines[i])
+
+		if strings.HasPrefix(line, yEncBeginPrefix) {
+			return legacyFile{}, 0, false
+		}
+
+		if !strings.HasPrefix(line, yEncEndPrefix) {
+			file.data = appendYEncLine(file.data, line)
+
+			continue
+		}
+
+		trailer := yEncParams(line)
+
+		size, err := strconv.Atoi(trailer["size"])
+		if err != nil || size != len(file.data) {
+			return legacyFile{}, 0, false
+		}
+
+		checksum := trailer["crc32"]
+		if isPart {
+			checksum = trailer["pcrc32"]
+		}
+
+		if checksum != "" {
+			crc, err := strconv.ParseUint(checksum, 16, 32)
+			if err != nil || uint32(crc) != crc32.ChecksumIEEE(file.data) {
+				return legacyFile{}, 0, false
+			}
+		}
+
+		return file, i + 1, true
+	}
+
+	return legacyFile{}, 0, false
+}
+
+// yEncParams parses the key=value parameters of a yEnc control line. The
+// name parameter comes last and extends to the end of the line.
+func yEncParams(line string) map[string]string {
+	params := make(map[string]string)
+
+	if i := strings.Index(line, " name="); i >= 0 {
+		params["name"] = line[i+len(" name="):]
+		line = line[:i]
+	}
+
+	for _, field := range strings.Fields(line)[1:] {
+		key, value, found := strings.Cut(field, "=")
+		if found {
+			params[key] = value
+		}
+	}
+
+	return params
+}
+
+func appendYEncLine(data []byte, line string) []byte {
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if c == yEncEscape && i+1 < len(line) {
+			i++
+			c = line[i] - yEncEscapeShift
+		}
+
+		data = append(data, c-yEncOffset)
+	}
+
+	return data
+}
+
+// decodeBinHexBlock decodes a BinHex 4.0 block, from its "(This file must
+// be converted with BinHex 4.0)" line to the colon that ends its data.
+func decodeBinHexBlock(lines []string) (legacyFile, int, bool) {
+	if !strings.HasPrefix(strings.TrimSpace(lines[0]), binHexPrefix) {
+		return legacyFile{}, 0, false
+	}
+
+	var encoded []byte
+
+	started := false
+
+	for i := 1; i < len(lines); i++ {
+		for _, c := range []byte(lines[i]) {
+			switch {
+			case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			case !started && c == binHexDelimiter:
+				started = true
+			case !started:
+				return legacyFile{}, 0, false
+			case c == binHexDelimiter:
+				file, ok := decodeBinHex(encoded)
+
+				return file, i + 1, ok
+			default:
+				encoded = append(encoded, c)
+			}
+		}
+	}
+
+	return legacyFile{}, 0, false
+}
+
+// decodeBinHex decodes the characters between the colons of a BinHex 4.0
+// block and returns the data fork of the file.
+func decodeBinHex(encoded []byte) (legacyFile, bool) {
+	var packed []byte
+
+	var bits uint32
+
+	var bitCount int
+
+	for _, c := range encoded {
+		value := strings.IndexByte(binHexAlphabet, c)
+		if value < 0 {
+			return legacyFile{}, false
+		}
+
+		bits = bits<<6 | uint32(value)
+		bitCount += 6
+
+		if bitCount >= bitsPerByte {
+			bitCount -= bitsPerByte
+			packed = append(packed, byte(bits>>bitCount))
+		}
+	}
+
+	data, ok := expandBinHexRuns(packed)
+	if !ok || len(data) == 0 {
+		return legacyFile{}, false
+	}
+
+	nameLength := int(data[0])
+	headerLength := 1 + nameLength + binHexHeaderFieldsSize
+
+	if len(data) < headerLength {
+		return legacyFile{}, false
+	}
+
+	header := data[:headerLength-binHexCRCSize]
+	if binHexCRC(header) !=
+		binary.BigEndian.Uint16(data[headerLength-binHexCRCSize:]) {
+		return legacyFile{}, false
+	}
+
+	dataLength := uint64(binary.BigEndian.Uint32(
+		header[len(header)-2*binHexForkLengthSize:],
+	))
+
+	fork := data[headerLength:]
+	if uint64(len(fork)) < dataLength+binHexCRCSize {
+		return legacyFile{}, false
+	}
+
+	if binHexCRC(fork[:dataLength]) !=
+		binary.BigEndian.Uint16(fork[dataLength:]) {
+		return legacyFile{}, false
+	}
+
+	return legacyFile{
+		name: decodeCharsetBytes(data[1:1+nameLength], binHexCharset),
+		data: fork[:dataLength],
+	}, true
+}
+
+// expandBinHexRuns expands the run-length encoding of BinHex 4.0, in which
+// the marker byte followed by a count repeats the previous byte and the
+// marker followed by zero is the marker byte itself.
+func expandBinHexRuns(packed []byte) ([]byte, bool) {
+	data := make([]byte, 0, len(packed))
+
+	for i := 0; i < len(packed); i++ {
+		c := packed[i]
+		if c != binHexRunMarker {
+			data = append(data, c)
+
+			continue
+		}
+
+		i++
+		if i >= len(packed) {
+			break
+		}
+
+		count := int(packed[i])
+
+		switch {
+		case count == 0:
+			data = append(data, binHexRunMarker)
+		case len(data) == 0:
+			return nil, false
+		default:
+			previous := data[len(data)-1]
+			for range count - 1 {
+				data = append(data, previous)
+			}
+		}
+	}
+
+	return data, true
+}
+
+// binHexCRC returns the CRC-16/XMODEM checksum of data that BinHex 4.0 uses.
+func binHexCRC(data []byte) uint16 {
+	var crc uint16
+
+	for _, c := range data {
+		crc ^= uint16(c) << bitsPerByte
+
+		for range bitsPerByte {
+			if crc&binHexCRCTopBit != 0 {
+				crc = crc<<1 ^ binHexCRCPoly
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
@@ -0,0 +1,256 @@
+package letters_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mnako/letters"
+)
+
+const (
+	uuencodedTestData = "M2&5L;&\\L(&QE9V%C>2!W;W)L9\"$*" +
+		"2&5L;&\\L(&QE9V%C>2!W;W)L9\"$*2&5L\n" +
+		"2;&\\L(&QE9V%C>2!W;W)L9\"$*\n"
+	legacyTestText = "Hello, legacy world!\n" +
+		"Hello, legacy world!\n" +
+		"Hello, legacy world!\n"
+)
+
+func TestExtractLegacyFiles(t *testing.T) {
+	t.Parallel()
+
+	yEncData := "\x00\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a\x0b\x0c\x0d" +
+		"\x0e\x0f\x10\x11\x12\x13\x14\x15\x16\x17\x18\x19\x1a\x1b\x1c\x1d" +
+		"\x1e\x1f\x20\x21\x22\x23\x24\x25\x26\x27\x00\x0a\x0d\x3d\x13"
+
+	testCases := []struct {
+		name          string
+		text          string
+		expectedText  string
+		expectedName  string
+		expectedType  string
+		expectedData  string
+		expectedFiles int
+	}{
+		{
+			name: "uuencode",
+			text: "Here it is:\n" +
+				"begin 644 hello.txt\n" +
+				uuencodedTestData +
+				"`\n" +
+				"end\n" +
+				"Bye\n",
+			expectedText:  "Here it is:\nBye\n",
+			expectedName:  "hello.txt",
+			expectedType:  "text/plain",
+			expectedData:  legacyTestText,
+			expectedFiles: 1,
+		},
+		{
+			name: "uuencode base64",
+			text: "begin-base64 600 dir/hello.txt\r\n" +
+				"SGVsbG8sIGxl\r\n" +
+				"Z2FjeSB3b3JsZCEK\r\n" +
+				"====\r\n",
+			expectedText:  "",
+			expectedName:  "hello.txt",
+			expectedType:  "text/plain",
+			expectedData:  "Hello, legacy world!\n",
+			expectedFiles: 1,
+		},
+		{
+			name: "yEnc",
+			text: "Posted:\n" +
+				"=ybegin line=128 size=45 name=data file.bin\n" +
+				"*+,-./0123456789:;<=}>?@ABCDEFGHIJKLMNOPQ*47g=}\n" +
+				"=yend size=45 crc32=03765f5f\n",
+			expectedText:  "Posted:\n",
+			expectedName:  "data file.bin",
+			expectedType:  "application/octet-stream",
+			expectedData:  yEncData,
+			expectedFiles: 1,
+		},
+		{
+			name: "BinHex",
+			text: "(This file must be converted with BinHex 4.0)\n" +
+				":#P+1Fh9YMLjdH(3!9%9B9(4dH(3!N!8F!*!%929#D@j)" +
+				"CAJJC'&dB5\"QEh*V#J#\n" +
+				"3#T!!k5F!!!:\n" +
+				"Regards\n",
+			expectedText: "Regards\n",
+			expectedName: "Résumé.txt",
+			expectedType: "text/plain",
+			expectedData: "BinHex data fork\n" +
+				strings.Repeat("\x00", 10) + "\x90",
+			expectedFiles: 1,
+		},
+		{
+			name: "yEnc with a wrong checksum",
+			text: "=ybegin line=128 size=45 name=data.bin\n" +
+				"*+,-./0123456789:;<=}>?@ABCDEFGHIJKLMNOPQ*47g=}\n" +
+				"=yend size=45 crc32=00000000\n",
+			expectedText: "=ybegin line=128 size=45 name=data.bin\n" +
+				"*+,-./0123456789:;<=}>?@ABCDEFGHIJKLMNOPQ*47g=}\n" +
+				"=yend size=45 crc32=00000000\n",
+			expectedFiles: 0,
+		},
+		{
+			name: "uuencode without end",
+			text: "begin 644 hello.txt\n" +
+				uuencodedTestData,
+			expectedText: "begin 644 hello.txt\n" +
+				uuencodedTestData,
+			expectedFiles: 0,
+		},
+		{
+			name:          "prose",
+			text:          "Let us begin 644 tasks.\nThe end\n",
+			expectedText:  "Let us begin 644 tasks.\nThe end\n",
+			expectedFiles: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			text, files := letters.ExtractLegacyFiles(testCase.text)
+			if text != testCase.expectedText {
+				t.Errorf(
+					"expected text %q, got %q",
+					testCase.expectedText,
+					text,
+				)
+			}
+
+			if len(files) != testCase.expectedFiles {
+				t.Fatalf("unexpected files: %#v", files)
+			}
+
+			if testCase.expectedFiles == 0 {
+				return
+			}
+
+			file := files[0]
+			if file.Filename().Name != testCase.expectedName ||
+				file.ContentType.ContentType != testCase.expectedType ||
+				string(file.Data) != testCase.expectedData {
+				t.Errorf(
+					"unexpected file %q, %q: %q",
+					file.Filename().Name,
+					file.ContentType.ContentType,
+					file.Data,
+				)
+			}
+		})
+	}
+}
+
+func TestParseWithLegacyFileDecoding(t *testing.T) {
+	t.Parallel()
+
+	message := "From: Alice <alice@example.com>\r\n" +
+		"Subject: Hello\r\n" +
+		"Content-Type: text/plain; charset=us-ascii\r\n" +
+		"\r\n" +
+		"See the file.\r\n" +
+		"begin 644 hello.txt\r\n" +
+		strings.ReplaceAll(uuencodedTestData, "\n", "\r\n") +
+		"`\r\n" +
+		"end\r\n"
+
+	email, err := letters.ParseEmail(strings.NewReader(message))
+	if err != nil {
+		t.Fatalf("cannot parse email: %s", err)
+	}
+
+	if !strings.Contains(email.Text, "begin 644 hello.txt") ||
+		len(email.AttachedFiles) != 0 {
+		t.Errorf("expected uuencoded text without the option: %#v", email)
+	}
+
+	email, err = letters.NewEmailParser(
+		letters.WithLegacyFileDecoding(),
+	).Parse(strings.NewReader(message))
+	if err != nil {
+		t.Fatalf("cannot parse email: %s", err)
+	}
+
+	if email.Text != "See the file." ||
+		len(email.AttachedFiles) != 1 ||
+		email.AttachedFiles[0].Filename().Name != "hello.txt" ||
+		string(email.AttachedFiles[0].Data) != legacyTestText {
+		t.Errorf("unexpected email: %#v", email)
+	}
+}
+
+func TestParseLegacyContentTransferEncoding(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		encoding string
+		body     string
+	}{
+		{
+			name:     "x-uuencode",
+			encoding: "x-uuencode",
+			body: "begin 644 hello.txt\r\n" +
+				strings.ReplaceAll(uuencodedTestData, "\n", "\r\n") +
+				"`\r\n" +
+				"end\r\n",
+		},
+		{
+			name:     "x-uue without begin line",
+			encoding: "X-UUE",
+			body:     strings.ReplaceAll(uuencodedTestData, "\n", "\r\n"),
+		},
+		{
+			name:     "x-yenc",
+			encoding: "x-yenc",
+			body: "=ybegin line=128 size=21 name=hello.txt\r\n" +
+				"r\x8f\x96\x96\x99VJ\x96\x8f\x91\x8b\x8d\xa3J" +
+				"\xa1\x99\x9c\x96\x8eK4\r\n" +
+				"=yend size=21\r\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			message := "From: Alice <alice@example.com>\r\n" +
+				"MIME-Version: 1.0\r\n" +
+				"Content-Type: multipart/mixed; boundary=b\r\n" +
+				"\r\n" +
+				"--b\r\n" +
+				"Content-Type: text/plain\r\n" +
+				"\r\n" +
+				"See the file.\r\n" +
+				"--b\r\n" +
+				"Content-Type: application/octet-stream\r\n" +
+				"Content-Disposition: attachment; filename=hello.txt\r\n" +
+				"Content-Transfer-Encoding: " + testCase.encoding + "\r\n" +
+				"\r\n" +
+				testCase.body +
+				"--b--\r\n"
+
+			email, err := letters.ParseEmail(strings.NewReader(message))
+			if err != nil {
+				t.Fatalf("cannot parse email: %s", err)
+			}
+
+			expected := legacyTestText
+			if testCase.encoding == "x-yenc" {
+				expected = "Hello, legacy world!\n"
+			}
+
+			if len(email.AttachedFiles) != 1 ||
+				string(email.AttachedFiles[0].Data) != expected {
+				t.Errorf("unexpected attached files: %#v", email.AttachedFiles)
+			}
+		})
+	}
+}
@@ -1,9 +1,12 @@
 package letters
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"net/mail"
+	"net/textproto"
 	"strings"
 )
 
@@ -35,6 +38,20 @@ type EmailParser struct {
 	bodyFilter     EmailBodyFilter
 	fileFilter     EmailFileFilter
 	headersParsers HeadersParsers
+	htmlToText     bool
+	htmlLinkStyle  HTMLLinkStyle
+	decodeTNEF     bool
+	decodeLegacy   bool
+	parseCalendars bool
+	parseVCards    bool
+
+	extractSignatureContacts bool
+
+	partialStore PartialStore
+
+	transferDecoders      ContentTransferDecoders
+	unknownEncodingPolicy UnknownEncodingPolicy
+	contentTypeHandlers   map[string]ContentTypeHandler
 }
 
 // EmailParserOption configures an EmailParser.
@@ -75,6 +92,20 @@ func NewEmailParser(options ...EmailParserOption) *EmailParser {
 		bodyFilter:     AllBodies,
 		fileFilter:     AllFiles,
 		headersParsers: DefaultHeadersParsers(),
+		htmlToText:     false,
+		htmlLinkStyle:  HTMLLinkFootnotes,
+		decodeTNEF:     false,
+		decodeLegacy:   false,
+		parseCalendars: false,
+		parseVCards:    false,
+
+		extractSignatureContacts: false,
+
+		partialStore: nil,
+
+		transferDecoders:      DefaultContentTransferDecoders(),
+		unknownEncodingPolicy: UnknownEncodingError,
+		contentTypeHandlers:   map[string]ContentTypeHandler{},
 	}
 
 	for _, option := range options {
@@ -84,11 +115,36 @@ func NewEmailParser(options ...EmailParserOption) *EmailParser {
 	return ep
 }
 
-// Parse reads and parses an email message.
+// Parse reads and parses an email message. It reads Outlook .msg files with
+// ParseMSG.
 func (ep *EmailParser) Parse(r io.Reader) (Email, error) {
 	var email Email
 
-	msg, err := mail.ReadMessage(r)
+	br := bufio.NewReader(r)
+
+	signature, _ := br.Peek(len(cfbSignature))
+	if string(signature) == cfbSignature {
+		return ep.ParseMSG(br)
+	}
+
+	// Fragments are kept whole for reassembly.
+	var data []byte
+
+	if ep.partialStore != nil {
+		var err error
+
+		data, err = io.ReadAll(br)
+		if err != nil {
+			return email, fmt.Errorf(
+				"letters.EmailParser.Parse: cannot read message: %w",
+				err,
+			)
+		}
+
+		br = bufio.NewReader(bytes.NewReader(data))
+	}
+
+	msg, err := mail.ReadMessage(br)
 	if err != nil {
 		return email, fmt.Errorf(
 			"letters.EmailParser.Parse: cannot read message: %w",
@@ -106,8 +162,19 @@ func (ep *EmailParser) Parse(r io.Reader) (Email, error) {
 
 	email.Headers = headers
 
-	cte, err := ParseContentTransferEncoding(
+	if ep.partialStore != nil &&
+		email.Headers.ContentType.ContentType == contentTypeMessagePartial {
+		email, err = ep.parsePartial(email, data)
+		if err != nil {
+			return email, fmt.Errorf("letters.EmailParser.Parse: %w", err)
+		}
+
+		return email, nil
+	}
+
+	decodeTransfer, err := ep.contentTransferDecoder(
 		msg.Header.Get("Content-Transfer-Encoding"),
+		&email.Warnings,
 	)
 	if err != nil {
 		return email, fmt.Errorf(
@@ -117,15 +184,32 @@ func (ep *EmailParser) Parse(r io.Reader) (Email, error) {
 		)
 	}
 
+	handled, err := ep.handlePart(
+		msg.Body,
+		HandledPart{
+			Header:             textproto.MIMEHeader(msg.Header),
+			ContentType:        email.Headers.ContentType,
+			ContentDisposition: email.Headers.ContentDisposition,
+			ParentContentType:  ContentTypeHeader{},
+			Data:               nil,
+		},
+		decodeTransfer,
+		&email.HandledParts,
+	)
+	if err != nil {
+		return email, fmt.Errorf("letters.EmailParser.Parse: %w", err)
+	}
+
 	contentType := email.Headers.ContentType.ContentType
 
 	switch {
+	case handled:
 	case contentType == contentTypeTextPlain:
 		if ep.bodyFilter(email.Headers.ContentType) {
 			email.Text, err = parseText(
 				msg.Body,
 				email.Headers.ContentType.Params["charset"],
-				cte,
+				decodeTransfer,
 			)
 			if err != nil {
 				return email, fmt.Errorf(
@@ -134,13 +218,15 @@ func (ep *EmailParser) Parse(r io.Reader) (Email, error) {
 					err,
 				)
 			}
+
+			email.Text = decodeTextFormat(email.Text, email.Headers.ContentType)
 		}
 	case contentType == contentTypeTextEnriched:
 		if ep.bodyFilter(email.Headers.ContentType) {
 			email.EnrichedText, err = parseText(
 				msg.Body,
 				email.Headers.ContentType.Params["charset"],
-				cte,
+				decodeTransfer,
 			)
 			if err != nil {
 				return email,
@@ -156,7 +242,7 @@ func (ep *EmailParser) Parse(r io.Reader) (Email, error) {
 			email.HTML, err = parseText(
 				msg.Body,
 				email.Headers.ContentType.Params["charset"],
-				cte,
+				decodeTransfer,
 			)
 			if err != nil {
 				return email,
@@ -190,6 +276,8 @@ func (ep *EmailParser) Parse(r io.Reader) (Email, error) {
 		email.HTML = emailBodies.html
 		email.InlineFiles = emailBodies.InlineFiles
 		email.AttachedFiles = emailBodies.AttachedFiles
+		email.Warnings = append(email.Warnings, emailBodies.warnings...)
+		email.HandledParts = emailBodies.handledParts
 	default:
 		if !ep.fileFilter(
 			email.Headers.ContentType,
@@ -198,7 +286,11 @@ func (ep *EmailParser) Parse(r io.Reader) (Email, error) {
 			break
 		}
 
-		afl, err := decodeAttachmentFileFromBody(msg.Body, email.Headers, cte)
+		afl, err := decodeAttachmentFileFromBody(
+			msg.Body,
+			email.Headers,
+			decodeTransfer,
+		)
 		if err != nil {
 			return email, fmt.Errorf(
 				"letters.EmailParser.Parse: "+
@@ -210,9 +302,40 @@ func (ep *EmailParser) Parse(r io.Reader) (Email, error) {
 		email.AttachedFiles = append(email.AttachedFiles, afl)
 	}
 
+	if ep.decodeTNEF {
+		decodeTNEFFiles(&email)
+	}
+
+	if ep.decodeLegacy {
+		ep.extractLegacyFiles(&email)
+	}
+
+	if ep.parseCalendars {
+		ep.parseCalendarFiles(&email)
+	}
+
+	if ep.parseVCards {
+		ep.parseVCardFiles(&email)
+	}
+
+	if ep.htmlToText && email.Text == "" && email.HTML != "" {
+		email.Text, err = HTMLToText(email.HTML, ep.htmlLinkStyle)
+		if err != nil {
+			return email, fmt.Errorf(
+				"letters.EmailParser.Parse: "+
+					"cannot render html text: %w",
+				err,
+			)
+		}
+	}
+
 	email.Text = normalizeMultilineString(email.Text)
 	email.EnrichedText = normalizeMultilineString(email.EnrichedText)
 	email.HTML = normalizeMultilineString(email.HTML)
 
+	if ep.extractSignatureContacts {
+		ep.extractSignatureContact(&email)
+	}
+
 	return email, nil
 }
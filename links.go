@@ -0,0 +1,635 @@
+package letters
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+// linkMaxUnwrapDepth limits how many nested wrappers UnwrapURL removes.
+const linkMaxUnwrapDepth = 10
+
+// LinkSource is the body a link was found in.
+type LinkSource string
+
+// Bodies links are extracted from.
+const (
+	LinkSourceText LinkSource = "text"
+	LinkSourceHTML LinkSource = "html"
+)
+
+// URLWrapper is a security gateway or redirector that wraps the URL of a
+// link.
+type URLWrapper string
+
+// Wrappers removed by UnwrapURL.
+const (
+	URLWrapperSafeLinks    URLWrapper = "Microsoft SafeLinks"
+	URLWrapperProofpointV1 URLWrapper = "Proofpoint URL Defense v1"
+	URLWrapperProofpointV2 URLWrapper = "Proofpoint URL Defense v2"
+	URLWrapperProofpointV3 URLWrapper = "Proofpoint URL Defense v3"
+	URLWrapperMimecast     URLWrapper = "Mimecast"
+	URLWrapperGoogle       URLWrapper = "Google redirect"
+)
+
+// UnwrappedURL is a URL with the security gateway and redirect wrappers
+// removed.
+type UnwrappedURL struct {
+	// URL is the innermost URL that could be decoded.
+	URL string
+
+	// Domain is the lower-case ASCII domain of the destination. Mimecast
+	// links do not contain the destination URL, so for them URL stays the
+	// Mimecast URL and Domain is the domain that Mimecast reports.
+	Domain string
+
+	// Wrappers lists the removed wrappers, outermost first.
+	Wrappers []URLWrapper
+}
+
+// LinkLocation is where a link was found.
+type LinkLocation struct {
+	Source LinkSource
+
+	// Line and Column are the 1-based line and byte column of the URL in
+	// the plain-text body, or of the start tag in the HTML body.
+	Line   int
+	Column int
+
+	// Element and Attribute are the HTML element and attribute that
+	// contain the URL. They are empty for plain-text links.
+	Element   string
+	Attribute string
+}
+
+// Link is a link in the body of an email.
+type Link struct {
+	// URL is the URL as written in the body.
+	URL string
+
+	// Destination is URL with its wrappers removed. See UnwrappedURL.
+	Destination UnwrappedURL
+
+	// Text is the anchor text of an HTML link, or the alt text of its
+	// images when it has none. It is empty for plain-text links.
+	Text string
+
+	// TextDomain is the domain that Text displays, for example
+	// "www.example.com" for the text "https://www.example.com/login", or
+	// an empty string when Text does not look like a URL or domain.
+	TextDomain string
+
+	// Mismatch reports whether TextDomain and the destination domain
+	// belong to different organizational domains, which is typical of
+	// phishing.
+	Mismatch bool
+
+	Location LinkLocation
+}
+
+// Links extracts the links from the plain-text and HTML bodies of the email
+// with ExtractTextLinks and ExtractHTMLLinks.
+func (e Email) Links() ([]Link, error) {
+	htmlLinks, err := ExtractHTMLLinks(e.HTML)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"letters.links.Links: cannot extract links from html body: %w",
+			err,
+		)
+	}
+
+	return append(ExtractTextLinks(e.Text), htmlLinks...), nil
+}
+
+// ExtractTextLinks returns the http, https and www. URLs in a plain-text
+// body in order of appearance. Punctuation that ends a sentence and
+// unbalanced closing brackets are not considered part of a URL.
+func ExtractTextLinks(s string) []Link {
+	var links []Link
+
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	for lineIndex, line := range lines {
+		offset := 0
+
+		for {
+			start, end := findTextLink(line[offset:])
+			if start < 0 {
+				break
+			}
+
+			rawURL := line[offset+start : offset+end]
+
+			destination := rawURL
+			if strings.EqualFold(rawURL[:len("www.")], "www.") {
+				destination = "http://" + rawURL
+			}
+
+			links = append(links, Link{
+				URL:         rawURL,
+				Destination: UnwrapURL(destination),
+				Text:        "",
+				TextDomain:  "",
+				Mismatch:    false,
+				Location: LinkLocation{
+					Source:    LinkSourceText,
+					Line:      lineIndex + 1,
+					Column:    offset + start + 1,
+					Element:   "",
+					Attribute: "",
+				},
+			})
+
+			offset += end
+		}
+	}
+
+	return links
+}
+
+// findTextLink returns the start and end of the first URL in a line, or -1
+// and -1.
+func findTextLink(line string) (int, int) {
+	for from := 0; from < len(line); {
+		start := -1
+		prefix := ""
+
+		for _, candidate := range []string{"http://", "https://", "www."} {
+			index := indexFold(line[from:], candidate)
+			if index >= 0 && (start < 0 || from+index < start) {
+				start = from + index
+				prefix = candidate
+			}
+		}
+
+		if start < 0 {
+			return -1, -1
+		}
+
+		if start > 0 && !isTextLinkBoundary(line[start-1]) {
+			from = start + len(prefix)
+
+			continue
+		}
+
+		end := start
+		for end < len(line) && !isTextLinkTerminator(line[end]) {
+			end++
+		}
+
+		end = trimTextLinkEnd(line, start, end)
+		if end > start+len(prefix) {
+			return start, end
+		}
+
+		from = start + len(prefix)
+	}
+
+	return -1, -1
+}
+
+func isTextLinkBoundary(c byte) bool {
+	return !isASCIILetter(c) && !isASCIIDigit(c) &&
+		c != '.' && c != '/' && c != '@' && c != '-' && c != '_'
+}
+
+func isTextLinkTerminator(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '\f', '<', '>', '"', '`':
+		return true
+	default:
+		return c < ' ' || c == 0x7f
+	}
+}
+
+// trimTextLinkEnd removes trailing punctuation and unbalanced closing
+// brackets from the URL at line[start:end].
+func trimTextLinkEnd(line string, start int, end int) int {
+	for end > start {
+		switch line[end-1] {
+		case '.', ',', ';', ':', '!', '?', '\'', '*':
+			end--
+
+			continue
+		case ')':
+			if isTextLinkUnbalanced(line[start:end], '(', ')') {
+				end--
+
+				continue
+			}
+		case ']':
+			if isTextLinkUnbalanced(line[start:end], '[', ']') {
+				end--
+
+				continue
+			}
+		default:
+		}
+
+		return end
+	}
+
+	return end
+}
+
+func isTextLinkUnbalanced(s string, open byte, closing byte) bool {
+	return strings.Count(s, string(closing)) > strings.Count(s, string(open))
+}
+
+// ExtractHTMLLinks returns the links of the a and area elements in an HTML
+// body in document order. Empty and fragment-only hrefs are ignored.
+func ExtractHTMLLinks(s string) ([]Link, error) {
+	var (
+		links   []Link
+		current *Link
+		text    strings.Builder
+		alt     strings.Builder
+	)
+
+	tokenizer := html.NewTokenizer(strings.NewReader(s))
+	line, column := 1, 1
+
+	finish := func() {
+		if current == nil {
+			return
+		}
+
+		current.Text = strings.Join(strings.FieldsFunc(
+			text.String(),
+			isHTMLSpace,
+		), " ")
+		if current.Text == "" {
+			current.Text = strings.TrimSpace(alt.String())
+		}
+
+		setLinkTextDomain(current)
+		links = append(links, *current)
+		current = nil
+	}
+
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			break
+		}
+
+		raw := tokenizer.Raw()
+		token := tokenizer.Token()
+
+		switch {
+		case tokenType == html.TextToken && current != nil:
+			text.WriteString(token.Data)
+		case tokenType == html.EndTagToken && token.DataAtom == atom.A:
+			finish()
+		case tokenType == html.StartTagToken ||
+			tokenType == html.SelfClosingTagToken:
+			switch token.DataAtom {
+			case atom.A, atom.Area:
+				finish()
+
+				href := strings.TrimSpace(htmlTokenAttribute(token, "href"))
+				if href == "" || strings.HasPrefix(href, "#") {
+					break
+				}
+
+				current = &Link{
+					URL:         href,
+					Destination: UnwrapURL(href),
+					Text:        "",
+					TextDomain:  "",
+					Mismatch:    false,
+					Location: LinkLocation{
+						Source:    LinkSourceHTML,
+						Line:      line,
+						Column:    column,
+						Element:   token.Data,
+						Attribute: "href",
+					},
+				}
+
+				text.Reset()
+				alt.Reset()
+
+				if token.DataAtom == atom.Area {
+					alt.WriteString(htmlTokenAttribute(token, "alt"))
+					finish()
+				}
+			case atom.Img:
+				if current != nil {
+					if alt.Len() > 0 {
+						alt.WriteByte(' ')
+					}
+
+					alt.WriteString(htmlTokenAttribute(token, "alt"))
+				}
+			default:
+			}
+		default:
+		}
+
+		if newlines := strings.Count(string(raw), "\n"); newlines > 0 {
+			line += newlines
+			column = len(raw) - strings.LastIndexByte(string(raw), '\n')
+		} else {
+			column += len(raw)
+		}
+	}
+
+	if err := tokenizer.Err(); !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf(
+			"letters.links.ExtractHTMLLinks: cannot tokenize HTML: %w",
+			err,
+		)
+	}
+
+	finish()
+
+	return links, nil
+}
+
+func htmlTokenAttribute(token html.Token, key string) string {
+	for _, attribute := range token.Attr {
+		if attribute.Namespace == "" && attribute.Key == key {
+			return attribute.Val
+		}
+	}
+
+	return ""
+}
+
+// setLinkTextDomain sets the TextDomain and Mismatch fields of an HTML link
+// from its anchor text.
+func setLinkTextDomain(link *Link) {
+	for field := range strings.FieldsSeq(link.Text) {
+		domain := linkTextDomain(field)
+		if domain == "" {
+			continue
+		}
+
+		link.TextDomain = domain
+		link.Mismatch = link.Destination.Domain != "" &&
+			OrganizationalDomain(domain) !=
+				OrganizationalDomain(link.Destination.Domain)
+
+		return
+	}
+}
+
+// linkTextDomain returns the domain that a word of anchor text displays, or
+// an empty string when the word is not a URL or domain.
+func linkTextDomain(word string) string {
+	word = strings.Trim(word, "()<>[]{}\"'.,;:!?")
+
+	if strings.Contains(word, "://") {
+		parsed, err := url.Parse(word)
+		if err != nil {
+			return ""
+		}
+
+		return normalizeLinkDomain(parsed.Hostname())
+	}
+
+	if strings.Contains(word, "@") {
+		return ""
+	}
+
+	host, _, _ := strings.Cut(word, "/")
+	host, _, _ = strings.Cut(host, "?")
+
+	domain := normalizeLinkDomain(host)
+	if !isLinkTextDomain(domain) {
+		return ""
+	}
+
+	return domain
+}
+
+// isLinkTextDomain reports whether a word written as plain text is a domain
+// name under a public suffix.
+func isLinkTextDomain(domain string) bool {
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return false
+	}
+
+	for _, label := range labels {
+		if label == "" ||
+			strings.HasPrefix(label, "-") ||
+			strings.HasSuffix(label, "-") {
+			return false
+		}
+
+		for _, c := range []byte(label) {
+			if !isASCIILetter(c) && !isASCIIDigit(c) && c != '-' {
+				return false
+			}
+		}
+	}
+
+	suffix, icann := publicsuffix.PublicSuffix(domain)
+
+	return icann && suffix != domain
+}
+
+// normalizeLinkDomain returns the lower-case ASCII form of a domain, with
+// internationalized labels encoded as punycode.
+func normalizeLinkDomain(domain string) string {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+
+	for _, r := range domain {
+		if r > unicode.MaxASCII {
+			ascii, err := idna.Lookup.ToASCII(domain)
+			if err != nil {
+				return domain
+			}
+
+			return ascii
+		}
+	}
+
+	return domain
+}
+
+// UnwrapURL removes Microsoft SafeLinks, Proofpoint URL Defense (v1, v2
+// and v3), Mimecast and Google redirect wrappers from a URL, including
+// nested ones, and returns the destination.
+func UnwrapURL(rawURL string) UnwrappedURL {
+	unwrapped := UnwrappedURL{
+		URL:      rawURL,
+		Domain:   "",
+		Wrappers: nil,
+	}
+
+	for range linkMaxUnwrapDepth {
+		parsed, err := url.Parse(strings.TrimSpace(unwrapped.URL))
+		if err != nil {
+			return unwrapped
+		}
+
+		unwrapped.Domain = normalizeLinkDomain(parsed.Hostname())
+
+		inner, wrapper, domain := unwrapURL(unwrapped.URL, parsed)
+		if wrapper == "" {
+			return unwrapped
+		}
+
+		unwrapped.Wrappers = append(unwrapped.Wrappers, wrapper)
+		if inner == "" {
+			unwrapped.Domain = normalizeLinkDomain(domain)
+
+			return unwrapped
+		}
+
+		unwrapped.URL = inner
+	}
+
+	return unwrapped
+}
+
+// unwrapURL removes one wrapper from a URL. It returns the wrapped URL, or
+// an empty string and the destination domain for Mimecast links, and the
+// wrapper; the wrapper is empty when the URL is not wrapped.
+func unwrapURL(
+	rawURL string,
+	parsed *url.URL,
+) (string, URLWrapper, string) {
+	host := strings.ToLower(parsed.Hostname())
+	query := parsed.Query()
+
+	switch {
+	case strings.HasSuffix(host, ".safelinks.protection.outlook.com") ||
+		strings.HasSuffix(host, ".safelinks.protection.office365.us"):
+		if inner := query.Get("url"); inner != "" {
+			return inner, URLWrapperSafeLinks, ""
+		}
+	case host == "urldefense.proofpoint.com" &&
+		parsed.Path == "/v1/url":
+		if inner := query.Get("u"); inner != "" {
+			return inner, URLWrapperProofpointV1, ""
+		}
+	case host == "urldefense.proofpoint.com" &&
+		parsed.Path == "/v2/url":
+		if inner := decodeProofpointV2(query.Get("u")); inner != "" {
+			return inner, URLWrapperProofpointV2, ""
+		}
+	case (host == "urldefense.com" || host == "urldefense.proofpoint.com") &&
+		strings.HasPrefix(parsed.EscapedPath(), "/v3/__"):
+		if inner := decodeProofpointV3(rawURL); inner != "" {
+			return inner, URLWrapperProofpointV3, ""
+		}
+	case host == "mimecast.com" ||
+		strings.HasSuffix(host, ".mimecast.com") ||
+		host == "mimecastprotect.com" ||
+		strings.HasSuffix(host, ".mimecastprotect.com"):
+		if inner := query.Get("url"); inner != "" {
+			return inner, URLWrapperMimecast, ""
+		}
+
+		if domain := query.Get("domain"); domain != "" {
+			return "", URLWrapperMimecast, domain
+		}
+	case strings.HasPrefix(OrganizationalDomain(host), "google.") &&
+		parsed.Path == "/url":
+		for _, key := range []string{"q", "url"} {
+			inner := query.Get(key)
+			if isAbsoluteWebURL(inner) {
+				return inner, URLWrapperGoogle, ""
+			}
+		}
+	}
+
+	return "", "", ""
+}
+
+func isAbsoluteWebURL(s string) bool {
+	lower := strings.ToLower(s)
+
+	return strings.HasPrefix(lower, "http://") ||
+		strings.HasPrefix(lower, "https://")
+}
+
+// decodeProofpointV2 decodes the u parameter of a Proofpoint v2 URL, which
+// is percent-encoded with "-" in place of "%" and "_" in place of "/".
+func decodeProofpointV2(u string) string {
+	u = strings.NewReplacer("-", "%", "_", "/").Replace(u)
+
+	decoded, err := url.PathUnescape(u)
+	if err != nil {
+		return ""
+	}
+
+	return decoded
+}
+
+// decodeProofpointV3 decodes a Proofpoint v3 URL of the form
+// "https://urldefense.com/v3/__<url>__;<characters>!!<signature>".
+//
+// Characters of the wrapped URL that Proofpoint replaced with "*" are
+// stored, base64url-encoded, after "__;". A run of n characters is written
+// as "**" followed by a letter, digit, "-" or "_" that encodes n-2.
+func decodeProofpointV3(rawURL string) string {
+	_, rest, _ := strings.Cut(rawURL, "/v3/__")
+
+	encodedURL, rest, found := strings.Cut(rest, "__;")
+	if !found {
+		return ""
+	}
+
+	encodedCharacters, _, _ := strings.Cut(rest, "!")
+
+	decodedURL, err := url.PathUnescape(encodedURL)
+	if err != nil {
+		return ""
+	}
+
+	decodedCharacters, err := base64.RawURLEncoding.DecodeString(
+		strings.TrimRight(encodedCharacters, "="),
+	)
+	if err != nil {
+		return ""
+	}
+
+	characters := []rune(string(decodedCharacters))
+
+	const runLengths = "ABCDEFGHIJKLMNOPQRSTUVWXYZ" +
+		"abcdefghijklmnopqrstuvwxyz0123456789-_"
+
+	var b strings.Builder
+
+	for i := 0; i < len(decodedURL); i++ {
+		if decodedURL[i] != '*' {
+			b.WriteByte(decodedURL[i])
+
+			continue
+		}
+
+		length := 1
+
+		if i+2 < len(decodedURL) && decodedURL[i+1] == '*' {
+			index := strings.IndexByte(runLengths, decodedURL[i+2])
+			if index < 0 {
+				return ""
+			}
+
+			length = index + len("**")
+			i += 2
+		}
+
+		if length > len(characters) {
+			return ""
+		}
+
+		b.WriteString(string(characters[:length]))
+		characters = characters[length:]
+	}
+
+	return b.String()
+}
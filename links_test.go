@@ -0,0 +1,289 @@
+package letters_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mnako/letters"
+)
+
+func TestUnwrapURL(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name             string
+		url              string
+		expectedURL      string
+		expectedDomain   string
+		expectedWrappers []letters.URLWrapper
+	}{
+		{
+			name:             "not wrapped",
+			url:              "https://www.example.com/a?b=c",
+			expectedURL:      "https://www.example.com/a?b=c",
+			expectedDomain:   "www.example.com",
+			expectedWrappers: nil,
+		},
+		{
+			name: "SafeLinks",
+			url: "https://nam02.safelinks.protection.outlook.com/?url=" +
+				"https%3A%2F%2Fwww.example.com%2Flogin%3Fa%3D1&data=05" +
+				"&sdata=abc&reserved=0",
+			expectedURL:    "https://www.example.com/login?a=1",
+			expectedDomain: "www.example.com",
+			expectedWrappers: []letters.URLWrapper{
+				letters.URLWrapperSafeLinks,
+			},
+		},
+		{
+			name: "Proofpoint v1",
+			url: "https://urldefense.proofpoint.com/v1/url?u=" +
+				"http%3A%2F%2Fwww.example.com%2F&k=abc&r=def",
+			expectedURL:    "http://www.example.com/",
+			expectedDomain: "www.example.com",
+			expectedWrappers: []letters.URLWrapper{
+				letters.URLWrapperProofpointV1,
+			},
+		},
+		{
+			name: "Proofpoint v2",
+			url: "https://urldefense.proofpoint.com/v2/url?u=" +
+				"https-3A__www.example.com_path-3Fa-3Db-26c-3Dd" +
+				"&d=DwMFaQ&c=abc&r=def&m=ghi&s=jkl&e=",
+			expectedURL:    "https://www.example.com/path?a=b&c=d",
+			expectedDomain: "www.example.com",
+			expectedWrappers: []letters.URLWrapper{
+				letters.URLWrapperProofpointV2,
+			},
+		},
+		{
+			name: "Proofpoint v3",
+			url: "https://urldefense.com/v3/__https://www.example.com" +
+				"/a*b?c=d*e**A__;K34lJQ!!AbCdEf!GhIjKl$",
+			expectedURL:    "https://www.example.com/a+b?c=d~e%%",
+			expectedDomain: "www.example.com",
+			expectedWrappers: []letters.URLWrapper{
+				letters.URLWrapperProofpointV3,
+			},
+		},
+		{
+			name: "Proofpoint v3 without replaced characters",
+			url: "https://urldefense.com/v3/__https://www.example.com/" +
+				"__;!!AbCdEf!GhIjKl$",
+			expectedURL:    "https://www.example.com/",
+			expectedDomain: "www.example.com",
+			expectedWrappers: []letters.URLWrapper{
+				letters.URLWrapperProofpointV3,
+			},
+		},
+		{
+			name: "Mimecast",
+			url: "https://protect-eu.mimecast.com/s/AbCdEfGh" +
+				"?domain=Example.COM",
+			expectedURL: "https://protect-eu.mimecast.com/s/AbCdEfGh" +
+				"?domain=Example.COM",
+			expectedDomain: "example.com",
+			expectedWrappers: []letters.URLWrapper{
+				letters.URLWrapperMimecast,
+			},
+		},
+		{
+			name: "Google redirect",
+			url: "https://www.google.co.uk/url?sa=t&q=" +
+				"https://www.example.com/&source=gmail",
+			expectedURL:    "https://www.example.com/",
+			expectedDomain: "www.example.com",
+			expectedWrappers: []letters.URLWrapper{
+				letters.URLWrapperGoogle,
+			},
+		},
+		{
+			name: "nested wrappers",
+			url: "https://eur01.safelinks.protection.outlook.com/?url=" +
+				"https%3A%2F%2Furldefense.proofpoint.com%2Fv2%2Furl%3Fu%3D" +
+				"https-3A__xn-2D-2Dpypal-2D4ve.com_%26d%3DDwMFaQ&data=05",
+			expectedURL:    "https://xn--pypal-4ve.com/",
+			expectedDomain: "xn--pypal-4ve.com",
+			expectedWrappers: []letters.URLWrapper{
+				letters.URLWrapperSafeLinks,
+				letters.URLWrapperProofpointV2,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			unwrapped := letters.UnwrapURL(testCase.url)
+
+			if unwrapped.URL != testCase.expectedURL {
+				t.Errorf(
+					"unexpected URL:\ngot:      %q\nexpected: %q",
+					unwrapped.URL,
+					testCase.expectedURL,
+				)
+			}
+
+			if unwrapped.Domain != testCase.expectedDomain {
+				t.Errorf("unexpected domain: %q", unwrapped.Domain)
+			}
+
+			if !reflect.DeepEqual(
+				unwrapped.Wrappers,
+				testCase.expectedWrappers,
+			) {
+				t.Errorf("unexpected wrappers: %q", unwrapped.Wrappers)
+			}
+		})
+	}
+}
+
+func TestExtractTextLinks(t *testing.T) {
+	t.Parallel()
+
+	text := "See https://example.com/a_(b) and www.example.org.\r\n" +
+		"(Mirror: http://example.net/x?y=1), <https://example.com/z>\n" +
+		"Not a link: foo.www.example.com or https://"
+
+	links := letters.ExtractTextLinks(text)
+
+	expected := []struct {
+		url         string
+		destination string
+		line        int
+		column      int
+	}{
+		{"https://example.com/a_(b)", "https://example.com/a_(b)", 1, 5},
+		{"www.example.org", "http://www.example.org", 1, 35},
+		{"http://example.net/x?y=1", "http://example.net/x?y=1", 2, 10},
+		{"https://example.com/z", "https://example.com/z", 2, 38},
+	}
+
+	if len(links) != len(expected) {
+		t.Fatalf("unexpected links: %#v", links)
+	}
+
+	for i, link := range links {
+		if link.URL != expected[i].url ||
+			link.Destination.URL != expected[i].destination ||
+			link.Location.Source != letters.LinkSourceText ||
+			link.Location.Line != expected[i].line ||
+			link.Location.Column != expected[i].column {
+			t.Errorf("unexpected link %d: %#v", i, link)
+		}
+	}
+}
+
+func TestExtractTextLinksNonASCII(t *testing.T) {
+	t.Parallel()
+
+	// Lowercasing changes the length of Ⱥ and İ in bytes.
+	testCases := []struct {
+		name     string
+		text     string
+		expected []string
+	}{
+		{
+			name:     "link after non-ASCII text",
+			text:     "ȺȺ see HTTPS://example.com/x now",
+			expected: []string{"HTTPS://example.com/x"},
+		},
+		{
+			name:     "prefix without URL after non-ASCII text",
+			text:     strings.Repeat("Ⱥ", 12) + " www.",
+			expected: nil,
+		},
+		{
+			name:     "link after shrinking text",
+			text:     "İİİİ www.example.org",
+			expected: []string{"www.example.org"},
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var urls []string
+			for _, link := range letters.ExtractTextLinks(testCase.text) {
+				urls = append(urls, link.URL)
+			}
+
+			if !reflect.DeepEqual(urls, testCase.expected) {
+				t.Errorf("unexpected links: %q", urls)
+			}
+		})
+	}
+}
+
+func TestExtractHTMLLinks(t *testing.T) {
+	t.Parallel()
+
+	body := "<p>Hello,</p>\n" +
+		"<p>Please <a href=\"https://www.paypal.com.evil.example/\">" +
+		"https://www.<b>paypal</b>.com/signin</a> today.</p>\n" +
+		"<a href=\"https://nam02.safelinks.protection.outlook.com/?url=" +
+		"https%3A%2F%2Fwww.paypal.com%2F&amp;data=05\">PayPal.com</a>" +
+		"<a href=\"#top\">Top</a>" +
+		"<a href=\"https://example.com/\">" +
+		"<img src=\"x.png\" alt=\"Logo\"></a>" +
+		"<map><area href=\"https://example.org/\" alt=\"Area\"></map>"
+
+	links, err := letters.ExtractHTMLLinks(body)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []struct {
+		destination string
+		text        string
+		textDomain  string
+		mismatch    bool
+		element     string
+		line        int
+		column      int
+	}{
+		{
+			"https://www.paypal.com.evil.example/",
+			"https://www.paypal.com/signin",
+			"www.paypal.com",
+			true,
+			"a",
+			2,
+			11,
+		},
+		{
+			"https://www.paypal.com/",
+			"PayPal.com",
+			"paypal.com",
+			false,
+			"a",
+			3,
+			1,
+		},
+		{"https://example.com/", "Logo", "", false, "a", 3, 143},
+		{"https://example.org/", "Area", "", false, "area", 3, 211},
+	}
+
+	if len(links) != len(expected) {
+		t.Fatalf("unexpected links: %#v", links)
+	}
+
+	for i, link := range links {
+		if link.Destination.URL != expected[i].destination ||
+			link.Text != expected[i].text ||
+			link.TextDomain != expected[i].textDomain ||
+			link.Mismatch != expected[i].mismatch ||
+			link.Location.Source != letters.LinkSourceHTML ||
+			link.Location.Element != expected[i].element ||
+			link.Location.Attribute != "href" ||
+			link.Location.Line != expected[i].line ||
+			link.Location.Column != expected[i].column {
+			t.Errorf("unexpected link %d: %#v", i, link)
+		}
+	}
+}
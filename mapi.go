@@ -0,0 +1,554 @@
+package letters
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// MAPI property types. A type with mapiMultipleValues set holds a list of
+// values of the base type.
+const (
+	mapiTypeNull       = 0x0001
+	mapiTypeShort      = 0x0002
+	mapiTypeLong       = 0x0003
+	mapiTypeFloat      = 0x0004
+	mapiTypeDouble     = 0x0005
+	mapiTypeCurrency   = 0x0006
+	mapiTypeAppTime    = 0x0007
+	mapiTypeError      = 0x000a
+	mapiTypeBoolean    = 0x000b
+	mapiTypeObject     = 0x000d
+	mapiTypeLongLong   = 0x0014
+	mapiTypeString8    = 0x001e
+	mapiTypeUnicode    = 0x001f
+	mapiTypeSystemTime = 0x0040
+	mapiTypeCLSID      = 0x0048
+	mapiTypeBinary     = 0x0102
+	mapiMultipleValues = 0x1000
+
+	// mapiNamedPropertyID is the lowest ID of named properties.
+	mapiNamedPropertyID = 0x8000
+)
+
+// MAPI property IDs.
+const (
+	mapiMessageClass          = 0x001a
+	mapiSubject               = 0x0037
+	mapiClientSubmitTime      = 0x0039
+	mapiSentRepresentingName  = 0x0042
+	mapiSentRepresentingEmail = 0x0065
+	mapiSenderName            = 0x0c1a
+	mapiSenderEmailAddress    = 0x0c1f
+	mapiMessageDeliveryTime   = 0x0e06
+	mapiBody                  = 0x1000
+	mapiRTFCompressed         = 0x1009
+	mapiBodyHTML              = 0x1013
+	mapiInternetMessageID     = 0x1035
+	mapiDisplayName           = 0x3001
+	mapiAttachDataBinary      = 0x3701
+	mapiAttachFilename        = 0x3704
+	mapiAttachLongFilename    = 0x3707
+	mapiAttachMIMETag         = 0x370e
+	mapiInternetCodePage      = 0x3fde
+	mapiMessageCodePage       = 0x3ffd
+	mapiSenderSMTPAddress     = 0x5d01
+	mapiSentRepresentingSMTP  = 0x5d02
+)
+
+const (
+	// mapiDefaultCharset is the charset of 8-bit strings of messages that
+	// do not record their code page.
+	mapiDefaultCharset = "windows-1252"
+
+	mapiGUIDLength              = 16
+	mapiNamedPropertyKindString = 1
+	mapiValueAlignment          = 4
+	mapiMaxValues               = 1 << 16
+
+	// Windows FILETIME values count 100-nanosecond intervals since 1601.
+	filetimeUnitsPerSecond  = 10000000
+	filetimeUnixEpochOffset = 11644473600
+
+	codePageWindowsFirst = 1250
+	codePageWindowsLast  = 1258
+)
+
+// MAPIPropertyName identifies a named MAPI property, whose ID is assigned
+// per message. Either ID or Name is set.
+type MAPIPropertyName struct {
+	GUID [16]byte
+	ID   uint32
+	Name string
+}
+
+// MAPIProperty is a property of a TNEF or Outlook message or of one of its
+// attachments.
+type MAPIProperty struct {
+	ID   uint16
+	Type uint16
+
+	// Name identifies named properties, whose IDs are 0x8000 and above. It
+	// is nil for other properties.
+	Name *MAPIPropertyName
+
+	// Values are the raw little-endian values. There is a single value
+	// unless Type is a multi-valued type.
+	Values [][]byte
+
+	// charset is the charset of 8-bit string values.
+	charset string
+}
+
+// Text returns the first value of a string property decoded to UTF-8, or
+// an empty string for properties of other types.
+func (p MAPIProperty) Text() string {
+	if len(p.Values) == 0 {
+		return ""
+	}
+
+	value := p.Values[0]
+
+	switch p.Type &^ mapiMultipleValues {
+	case mapiTypeUnicode:
+		return decodeUTF16LE(value)
+	case mapiTypeString8:
+		charset := p.charset
+		if charset == "" {
+			charset = mapiDefaultCharset
+		}
+
+		return decodeCharsetBytes(bytes.TrimRight(value, "\x00"), charset)
+	default:
+		return ""
+	}
+}
+
+// Time returns the first value of a time property, or the zero time for
+// properties of other types.
+func (p MAPIProperty) Time() time.Time {
+	if len(p.Values) == 0 ||
+		p.Type&^mapiMultipleValues != mapiTypeSystemTime ||
+		len(p.Values[0]) < 8 {
+		return time.Time{}
+	}
+
+	return filetimeToTime(binary.LittleEndian.Uint64(p.Values[0]))
+}
+
+// Int returns the first value of an integer or boolean property, or 0 for
+// properties of other types.
+func (p MAPIProperty) Int() int64 {
+	if len(p.Values) == 0 {
+		return 0
+	}
+
+	value := p.Values[0]
+
+	switch p.Type &^ mapiMultipleValues {
+	case mapiTypeShort, mapiTypeBoolean:
+		if len(value) >= 2 {
+			return int64(int16(binary.LittleEndian.Uint16(value)))
+		}
+	case mapiTypeLong, mapiTypeError:
+		if len(value) >= 4 {
+			return int64(int32(binary.LittleEndian.Uint32(value)))
+		}
+	case mapiTypeLongLong, mapiTypeCurrency:
+		if len(value) >= 8 {
+			return int64(binary.LittleEndian.Uint64(value))
+		}
+	default:
+	}
+
+	return 0
+}
+
+// Bytes returns the first value of the property, without the interface ID
+// of object values.
+func (p MAPIProperty) Bytes() []byte {
+	if len(p.Values) == 0 {
+		return nil
+	}
+
+	if p.Type == mapiTypeObject && len(p.Values[0]) >= mapiGUIDLength {
+		return p.Values[0][mapiGUIDLength:]
+	}
+
+	return p.Values[0]
+}
+
+// mapiProperties looks up unnamed properties by ID.
+type mapiProperties []MAPIProperty
+
+func (properties mapiProperties) find(id uint16) (MAPIProperty, bool) {
+	for _, property := range properties {
+		if property.ID == id && property.Name == nil {
+			return property, true
+		}
+	}
+
+	return MAPIProperty{}, false
+}
+
+func (properties mapiProperties) text(id uint16) string {
+	property, _ := properties.find(id)
+
+	return property.Text()
+}
+
+func (properties mapiProperties) time(id uint16) time.Time {
+	property, _ := properties.find(id)
+
+	return property.Time()
+}
+
+func (properties mapiProperties) integer(id uint16) int64 {
+	property, _ := properties.find(id)
+
+	return property.Int()
+}
+
+func setMAPICharset(properties mapiProperties, charset string) {
+	for i := range properties {
+		properties[i].charset = charset
+	}
+}
+
+// attachmentFilename returns the long file name, file name or display name
+// of an attachment, or fallback when it has none.
+func (properties mapiProperties) attachmentFilename(fallback string) string {
+	for _, id := range []uint16{
+		mapiAttachLongFilename,
+		mapiAttachFilename,
+		mapiDisplayName,
+	} {
+		if filename := properties.text(id); filename != "" {
+			return filename
+		}
+	}
+
+	return fallback
+}
+
+// attachmentContentType returns the MIME tag of an attachment or, when it
+// has none, the media type detected from its content or file name.
+func (properties mapiProperties) attachmentContentType(
+	filename string,
+	data []byte,
+) string {
+	contentType := strings.ToLower(properties.text(mapiAttachMIMETag))
+	if contentType != "" {
+		return contentType
+	}
+
+	return fileContentType(filename, data)
+}
+
+// codePageCharset returns the charset label of a Windows code page, or an
+// empty string when it is unknown.
+func codePageCharset(codePage int64) string {
+	if codePage >= codePageWindowsFirst && codePage <= codePageWindowsLast {
+		return "windows-" + strconv.FormatInt(codePage, 10)
+	}
+
+	return codePageCharsets()[codePage]
+}
+
+// codePageCharsets maps other Windows code pages to charset labels.
+func codePageCharsets() map[int64]string {
+	return map[int64]string{
+		874:   "windows-874",
+		932:   "shift_jis",
+		936:   "gbk",
+		949:   "euc-kr",
+		950:   "big5",
+		1200:  "utf-16le",
+		20127: "us-ascii",
+		20866: "koi8-r",
+		28591: "iso-8859-1",
+		28592: "iso-8859-2",
+		28605: "iso-8859-15",
+		50220: "iso-2022-jp",
+		51932: "euc-jp",
+		54936: "gb18030",
+		65001: "utf-8",
+	}
+}
+
+func decodeUTF16LE(data []byte) string {
+	units := make([]uint16, 0, len(data)/2)
+
+	for i := 0; i+1 < len(data); i += 2 {
+		units = append(units, binary.LittleEndian.Uint16(data[i:]))
+	}
+
+	return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+}
+
+// filetimeToTime converts a Windows FILETIME, the number of 100-nanosecond
+// intervals since 1601, to a UTC time. The zero FILETIME is the zero time.
+func filetimeToTime(filetime uint64) time.Time {
+	if filetime == 0 {
+		return time.Time{}
+	}
+
+	seconds := int64(filetime/filetimeUnitsPerSecond) -
+		filetimeUnixEpochOffset
+	nanoseconds := int64(filetime%filetimeUnitsPerSecond) * 100
+
+	return time.Unix(seconds, nanoseconds).UTC()
+}
+
+// mapiFixedValueSize returns the size of a value of a fixed-size property
+// type in a TNEF property list, or 0 for other types.
+func mapiFixedValueSize(propertyType uint16) int {
+	switch propertyType {
+	case mapiTypeNull, mapiTypeShort, mapiTypeLong, mapiTypeFloat,
+		mapiTypeError, mapiTypeBoolean:
+		return 4
+	case mapiTypeDouble, mapiTypeCurrency, mapiTypeAppTime,
+		mapiTypeLongLong, mapiTypeSystemTime:
+		return 8
+	case mapiTypeCLSID:
+		return mapiGUIDLength
+	default:
+		return 0
+	}
+}
+
+func isMAPIVariableType(propertyType uint16) bool {
+	switch propertyType {
+	case mapiTypeString8, mapiTypeUnicode, mapiTypeBinary, mapiTypeObject:
+		return true
+	default:
+		return false
+	}
+}
+
+// littleEndianReader reads little-endian values from a byte slice. After
+// the first read past the end, all reads return zero values and ok reports
+// false.
+type littleEndianReader struct {
+	data []byte
+	ok   bool
+}
+
+func newLittleEndianReader(data []byte) *littleEndianReader {
+	return &littleEndianReader{data: data, ok: true}
+}
+
+func (r *littleEndianReader) bytes(n int) []byte {
+	if !r.ok || n < 0 || n > len(r.data) {
+		r.ok = false
+
+		return nil
+	}
+
+	value := r.data[:n]
+	r.data = r.data[n:]
+
+	return value
+}
+
+func (r *littleEndianReader) uint16() uint16 {
+	value := r.bytes(2)
+	if value == nil {
+		return 0
+	}
+
+	return binary.LittleEndian.Uint16(value)
+}
+
+func (r *littleEndianReader) uint32() uint32 {
+	value := r.bytes(4)
+	if value == nil {
+		return 0
+	}
+
+	return binary.LittleEndian.Uint32(value)
+}
+
+// align skips the padding after a value of n bytes.
+func (r *littleEndianReader) align(n int) {
+	if padding := (mapiValueAlignment - n%4) % 4; padding > 0 {
+		r.bytes(min(padding, len(r.data)))
+	}
+}
+
+// parseMAPIProperties parses a TNEF property list: a count followed by the
+// tag, optional name and values of every property.
+func parseMAPIProperties(data []byte, charset string) ([]MAPIProperty, bool) {
+	r := newLittleEndianReader(data)
+
+	count := int(r.uint32())
+	if count > len(data)/4 {
+		return nil, false
+	}
+
+	properties := make([]MAPIProperty, 0, count)
+
+	for range count {
+		property := MAPIProperty{
+			Type:    r.uint16(),
+			ID:      r.uint16(),
+			Name:    nil,
+			Values:  nil,
+			charset: charset,
+		}
+
+		if property.ID >= mapiNamedPropertyID {
+			property.Name = parseMAPIPropertyName(r)
+		}
+
+		baseType := property.Type &^ mapiMultipleValues
+
+		valueCount := 1
+		if property.Type&mapiMultipleValues != 0 ||
+			isMAPIVariableType(baseType) {
+			valueCount = int(r.uint32())
+		}
+
+		if valueCount > mapiMaxValues {
+			return properties, false
+		}
+
+		for range valueCount {
+			size := mapiFixedValueSize(baseType)
+			if isMAPIVariableType(baseType) {
+				size = int(r.uint32())
+			} else if size == 0 {
+				return properties, false
+			}
+
+			property.Values = append(property.Values, r.bytes(size))
+			r.align(size)
+		}
+
+		if !r.ok {
+			return properties, false
+		}
+
+		properties = append(properties, property)
+	}
+
+	return properties, true
+}
+
+func parseMAPIPropertyName(r *littleEndianReader) *MAPIPropertyName {
+	name := &MAPIPropertyName{GUID: [16]byte{}, ID: 0, Name: ""}
+
+	copy(name.GUID[:], r.bytes(mapiGUIDLength))
+
+	if r.uint32() != mapiNamedPropertyKindString {
+		name.ID = r.uint32()
+
+		return name
+	}
+
+	size := int(r.uint32())
+	name.Name = decodeUTF16LE(r.bytes(size))
+	r.align(size)
+
+	return name
+}
+
+// compressedRTFDictionary is the initial content of the dictionary of
+// compressed RTF, see [MS-OXRTFCP] section 3.1.3.1.
+const compressedRTFDictionary = `{\rtf1\ansi\mac\deff0\deftab720{\fonttbl;}` +
+	`{\f0\fnil \froman \fswiss \fmodern \fscript \fdecor MS Sans Serif` +
+	`SymbolArialTimes New RomanCourier{\colortbl\red0\green0\blue0` +
+	"\r\n" + `\par \pard\plain\f0\fs20\b\i\u\tab\tx`
+
+const (
+	// Compression types of compressed RTF.
+	compressedRTFTypeLZFu = 0x75465a4c
+	compressedRTFTypeMELA = 0x414c454d
+
+	compressedRTFHeaderSize     = 16
+	compressedRTFDictionarySize = 4096
+	compressedRTFMinLength      = 2
+)
+
+// decompressRTF decompresses an RTF body in the compressed RTF format of
+// [MS-OXRTFCP]. The CRC is not verified.
+func decompressRTF(data []byte) ([]byte, bool) {
+	r := newLittleEndianReader(data)
+	compressedSize := int(r.uint32())
+	rawSize := int(r.uint32())
+	compressionType := r.uint32()
+	r.uint32()
+
+	if !r.ok {
+		return nil, false
+	}
+
+	// The compressed size counts the header after its own field.
+	input := data[compressedRTFHeaderSize:]
+	if end := compressedSize + 4 - compressedRTFHeaderSize; end >= 0 &&
+		end < len(input) {
+		input = input[:end]
+	}
+
+	switch compressionType {
+	case compressedRTFTypeMELA:
+		return input[:min(rawSize, len(input))], true
+	case compressedRTFTypeLZFu:
+	default:
+		return nil, false
+	}
+
+	var dictionary [compressedRTFDictionarySize]byte
+
+	copy(dictionary[:], compressedRTFDictionary)
+	position := len(compressedRTFDictionary)
+
+	output := make([]byte, 0, min(rawSize, len(input)*8))
+	emit := func(c byte) {
+		output = append(output, c)
+		dictionary[position] = c
+		position = (position + 1) % compressedRTFDictionarySize
+	}
+
+	for i := 0; i < len(input); {
+		control := input[i]
+		i++
+
+		for bit := range 8 {
+			if control&(1<<bit) == 0 {
+				if i >= len(input) {
+					return output, true
+				}
+
+				emit(input[i])
+				i++
+
+				continue
+			}
+
+			if i+1 >= len(input) {
+				return output, true
+			}
+
+			// A reference is a 12-bit dictionary offset and a 4-bit
+			// length. A reference to the write position ends the data.
+			reference := int(binary.BigEndian.Uint16(input[i:]))
+			i += 2
+
+			offset := reference >> 4
+			if offset == position {
+				return output, true
+			}
+
+			length := reference&0xf + compressedRTFMinLength
+			for k := range length {
+				emit(dictionary[(offset+k)%compressedRTFDictionarySize])
+			}
+		}
+	}
+
+	return output, true
+}
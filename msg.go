@@ -0,0 +1,872 @@
+package letters
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Names of the streams and storages of an Outlook .msg file, see
+// [MS-OXMSG] section 2.2.
+const (
+	msgPropertiesStream    = "__properties_version1.0"
+	msgNameIDStorage       = "__nameid_version1.0"
+	msgRecipientPrefix     = "__recip_version1.0_"
+	msgAttachmentPrefix    = "__attach_version1.0_"
+	msgSubstoragePrefix    = "__substg1.0_"
+	msgNameIDGUIDStream    = "__substg1.0_00020102"
+	msgNameIDEntryStream   = "__substg1.0_00030102"
+	msgNameIDStringStream  = "__substg1.0_00040102"
+	msgEmbeddedMessageName = "__substg1.0_3701000D"
+)
+
+const (
+	// Sizes of the header of the property stream of a top-level message,
+	// an embedded message, and a recipient or attachment.
+	msgTopLevelHeaderSize = 32
+	msgEmbeddedHeaderSize = 24
+	msgObjectHeaderSize   = 8
+
+	msgPropertyEntrySize  = 16
+	msgNameIDEntrySize    = 8
+	msgFirstCustomGUID    = 3
+	msgMaxEmbeddingDepth  = 8
+	msgBase64LineLength   = 76
+	msgRecipientTypeTo    = 1
+	msgRecipientTypeCc    = 2
+	msgRecipientTypeBcc   = 3
+	msgAttachMethodEmbed  = 5
+	msgPropertyValueBytes = 8
+)
+
+// MAPI property IDs of recipients and attachments.
+const (
+	mapiTransportMessageHeaders = 0x007d
+	mapiRecipientType           = 0x0c15
+	mapiInternetReferences      = 0x1039
+	mapiInReplyToID             = 0x1042
+	mapiEmailAddress            = 0x3003
+	mapiCreationTime            = 0x3007
+	mapiAttachMethod            = 0x3705
+	mapiAttachContentID         = 0x3712
+	mapiSMTPAddress             = 0x39fe
+	mapiAttachmentHidden        = 0x7ffe
+)
+
+// msgGUIDs returns the GUIDs of named properties with the predefined GUID
+// indexes 1 and 2, PS_MAPI and PS_PUBLIC_STRINGS, in their on-disk byte
+// order.
+func msgGUIDs() [][16]byte {
+	return [][16]byte{
+		{0x28, 0x03, 0x02, 0, 0, 0, 0, 0, 0xc0, 0, 0, 0, 0, 0, 0, 0x46},
+		{0x29, 0x03, 0x02, 0, 0, 0, 0, 0, 0xc0, 0, 0, 0, 0, 0, 0, 0x46},
+	}
+}
+
+type msgMessage struct {
+	properties  mapiProperties
+	recipients  []mapiProperties
+	attachments []msgAttachment
+}
+
+type msgAttachment struct {
+	properties mapiProperties
+	embedded   *msgMessage
+}
+
+type msgReader struct {
+	file  *cfbFile
+	names map[uint16]*MAPIPropertyName
+}
+
+// ParseMSG reads and parses an Outlook .msg file using a parser with the
+// default options.
+func ParseMSG(r io.Reader) (Email, error) {
+	return NewEmailParser().ParseMSG(r)
+}
+
+// ParseMSG reads and parses an Outlook .msg file, a compound file of MAPI
+// properties, into the same Email that Parse returns for the message.
+//
+// The headers are parsed from the transport headers that Outlook keeps for
+// received messages, or built from the subject, sender, recipients and
+// dates of messages that were never sent. The plain-text and HTML bodies
+// fill Email.Text and Email.HTML and the compressed RTF body is
+// decompressed into Email.RTF. Attachments whose Content-ID is referenced
+// by the HTML body become inline files, other attachments attached files,
+// and embedded messages message/rfc822 attached files. The body and file
+// filters of the parser apply as in Parse.
+//
+// It returns an error wrapping ErrInvalidMSG when r is not a valid .msg
+// file. Parse reads .msg files as well.
+func (ep *EmailParser) ParseMSG(r io.Reader) (Email, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Email{}, fmt.Errorf(
+			"letters.msg.ParseMSG: cannot read message: %w",
+			err,
+		)
+	}
+
+	file, err := openCFB(data)
+	if err != nil {
+		return Email{}, fmt.Errorf(
+			"letters.msg.ParseMSG: cannot open compound file: %w",
+			err,
+		)
+	}
+
+	reader := msgReader{file: file, names: nil}
+	reader.names = reader.readNames()
+
+	message, err := reader.readMessage(0, msgTopLevelHeaderSize, 0)
+	if err != nil {
+		return Email{}, fmt.Errorf(
+			"letters.msg.ParseMSG: cannot read message: %w",
+			err,
+		)
+	}
+
+	email, err := ep.msgEmail(message)
+	if err != nil {
+		return email, fmt.Errorf("letters.msg.ParseMSG: %w", err)
+	}
+
+	return email, nil
+}
+
+// readNames reads the mapping of named property IDs to their names.
+func (m *msgReader) readNames() map[uint16]*MAPIPropertyName {
+	names := make(map[uint16]*MAPIPropertyName)
+
+	storage, ok := m.file.children(0)[msgNameIDStorage]
+	if !ok {
+		return names
+	}
+
+	streams := m.file.children(storage)
+	guids := m.readOptionalStream(streams, msgNameIDGUIDStream)
+	entries := m.readOptionalStream(streams, msgNameIDEntryStream)
+	strs := m.readOptionalStream(streams, msgNameIDStringStream)
+
+	for len(entries) >= msgNameIDEntrySize {
+		r := newLittleEndianReader(entries)
+		entries = entries[msgNameIDEntrySize:]
+
+		nameOrID := r.uint32()
+		indexAndKind := r.uint16()
+		propertyIndex := r.uint16()
+
+		name := &MAPIPropertyName{GUID: [16]byte{}, ID: 0, Name: ""}
+
+		guidIndex := int(indexAndKind >> 1)
+		switch {
+		case guidIndex > 0 && guidIndex < msgFirstCustomGUID:
+			name.GUID = msgGUIDs()[guidIndex-1]
+		case guidIndex >= msgFirstCustomGUID:
+			start := (guidIndex - msgFirstCustomGUID) * mapiGUIDLength
+			if start+mapiGUIDLength <= len(guids) {
+				copy(name.GUID[:], guids[start:])
+			}
+		default:
+		}
+
+		if indexAndKind&1 == 0 {
+			name.ID = nameOrID
+		} else if int(nameOrID) < len(strs) {
+			r := newLittleEndianReader(strs[nameOrID:])
+			name.Name = decodeUTF16LE(r.bytes(int(r.uint32())))
+		}
+
+		names[mapiNamedPropertyID+propertyIndex] = name
+	}
+
+	return names
+}
+
+func (m *msgReader) readOptionalStream(
+	streams map[string]int,
+	name string,
+) []byte {
+	id, ok := streams[name]
+	if !ok {
+		return nil
+	}
+
+	data, err := m.file.readStream(id)
+	if err != nil {
+		return nil
+	}
+
+	return data
+}
+
+// readMessage reads the properties, recipients and attachments of the
+// message in a storage.
+func (m *msgReader) readMessage(
+	storage int,
+	headerSize int,
+	depth int,
+) (*msgMessage, error) {
+	if depth > msgMaxEmbeddingDepth {
+		return nil, fmt.Errorf("%w: too deeply embedded", ErrInvalidMSG)
+	}
+
+	properties, err := m.readProperties(storage, headerSize)
+	if err != nil {
+		return nil, err
+	}
+
+	message := &msgMessage{
+		properties:  properties,
+		recipients:  nil,
+		attachments: nil,
+	}
+
+	children := m.file.children(storage)
+
+	for _, name := range sortedMSGNames(children, msgRecipientPrefix) {
+		recipient, err := m.readProperties(children[name], msgObjectHeaderSize)
+		if err != nil {
+			return nil, err
+		}
+
+		message.recipients = append(message.recipients, recipient)
+	}
+
+	for _, name := range sortedMSGNames(children, msgAttachmentPrefix) {
+		attachment, err := m.readAttachment(children[name], depth)
+		if err != nil {
+			return nil, err
+		}
+
+		message.attachments = append(message.attachments, attachment)
+	}
+
+	return message, nil
+}
+
+func (m *msgReader) readAttachment(
+	storage int,
+	depth int,
+) (msgAttachment, error) {
+	properties, err := m.readProperties(storage, msgObjectHeaderSize)
+	if err != nil {
+		return msgAttachment{}, err
+	}
+
+	attachment := msgAttachment{properties: properties, embedded: nil}
+
+	if properties.integer(mapiAttachMethod) != msgAttachMethodEmbed {
+		return attachment, nil
+	}
+
+	embedded, ok := m.file.children(storage)[msgEmbeddedMessageName]
+	if !ok {
+		return attachment, nil
+	}
+
+	attachment.embedded, err = m.readMessage(
+		embedded,
+		msgEmbeddedHeaderSize,
+		depth+1,
+	)
+
+	return attachment, err
+}
+
+func sortedMSGNames(children map[string]int, prefix string) []string {
+	var names []string
+
+	for name := range children {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// readProperties reads the property stream of a storage and the streams
+// of its variable-length and multi-valued properties.
+func (m *msgReader) readProperties(
+	storage int,
+	headerSize int,
+) (mapiProperties, error) {
+	streams := m.file.children(storage)
+
+	id, ok := streams[msgPropertiesStream]
+	if !ok {
+		return nil, fmt.Errorf("%w: no property stream", ErrInvalidMSG)
+	}
+
+	data, err := m.file.readStream(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var properties mapiProperties
+
+	if len(data) < headerSize {
+		return nil, fmt.Errorf("%w: truncated property stream", ErrInvalidMSG)
+	}
+
+	for entries := data[headerSize:]; len(entries) >= msgPropertyEntrySize; {
+		r := newLittleEndianReader(entries)
+		entries = entries[msgPropertyEntrySize:]
+
+		property := MAPIProperty{
+			Type:    r.uint16(),
+			ID:      r.uint16(),
+			Name:    nil,
+			Values:  nil,
+			charset: "",
+		}
+		r.uint32()
+		value := r.bytes(msgPropertyValueBytes)
+
+		if property.ID >= mapiNamedPropertyID {
+			property.Name = m.names[property.ID]
+		}
+
+		property.Values = m.readPropertyValues(streams, property, value)
+		properties = append(properties, property)
+	}
+
+	if charset := codePageCharset(
+		max(
+			properties.integer(mapiInternetCodePage),
+			properties.integer(mapiMessageCodePage),
+		),
+	); charset != "" {
+		setMAPICharset(properties, charset)
+	}
+
+	return properties, nil
+}
+
+func (m *msgReader) readPropertyValues(
+	streams map[string]int,
+	property MAPIProperty,
+	value []byte,
+) [][]byte {
+	baseType := property.Type &^ mapiMultipleValues
+	streamName := fmt.Sprintf(
+		"%s%04X%04X",
+		msgSubstoragePrefix,
+		property.ID,
+		property.Type,
+	)
+	size := mapiFixedValueSize(baseType)
+
+	switch {
+	case property.Type&mapiMultipleValues == 0 && size > 0 &&
+		size <= msgPropertyValueBytes:
+		return [][]byte{value[:size]}
+	case property.Type&mapiMultipleValues == 0 ||
+		!isMAPIVariableType(baseType):
+		data := m.readOptionalStream(streams, streamName)
+		if data == nil {
+			return nil
+		}
+
+		if property.Type&mapiMultipleValues == 0 || size == 0 {
+			return [][]byte{data}
+		}
+
+		var values [][]byte
+		for offset := 0; offset+size <= len(data); offset += size {
+			values = append(values, data[offset:offset+size])
+		}
+
+		return values
+	default:
+		var values [][]byte
+
+		for i := range mapiMaxValues {
+			data := m.readOptionalStream(
+				streams,
+				fmt.Sprintf("%s-%08X", streamName, i),
+			)
+			if data == nil {
+				break
+			}
+
+			values = append(values, data)
+		}
+
+		return values
+	}
+}
+
+// msgEmail builds an Email from a message read from a .msg file.
+func (ep *EmailParser) msgEmail(message *msgMessage) (Email, error) {
+	var email Email
+
+	header := message.header()
+
+	headers, err := ep.ParseHeaders(header)
+	if err != nil {
+		return email, fmt.Errorf("cannot parse headers: %w", err)
+	}
+
+	email.Headers = headers
+
+	properties := message.properties
+	textType := ContentTypeHeader{
+		ContentType: contentTypeTextPlain,
+		Params:      map[string]string{},
+	}
+	htmlType := ContentTypeHeader{
+		ContentType: contentTypeTextHTML,
+		Params:      map[string]string{},
+	}
+
+	if ep.bodyFilter(textType) {
+		email.Text = properties.text(mapiBody)
+		email.RTF = message.rtf()
+	}
+
+	if ep.bodyFilter(htmlType) {
+		email.HTML = message.html()
+	}
+
+	for _, attachment := range message.attachments {
+		err = ep.addMSGAttachment(&email, attachment)
+		if err != nil {
+			return email, err
+		}
+	}
+
+	if ep.decodeTNEF {
+		decodeTNEFFiles(&email)
+	}
+
+	if ep.decodeLegacy {
+		ep.extractLegacyFiles(&email)
+	}
+
+	if ep.parseCalendars {
+		ep.parseCalendarFiles(&email)
+	}
+
+	if ep.parseVCards {
+		ep.parseVCardFiles(&email)
+	}
+
+	if ep.htmlToText && email.Text == "" && email.HTML != "" {
+		email.Text, err = HTMLToText(email.HTML, ep.htmlLinkStyle)
+		if err != nil {
+			return email, fmt.Errorf("cannot render html text: %w", err)
+		}
+	}
+
+	email.Text = normalizeMultilineString(email.Text)
+	email.HTML = normalizeMultilineString(email.HTML)
+
+	if ep.extractSignatureContacts {
+		ep.extractSignatureContact(&email)
+	}
+
+	return email, nil
+}
+
+func (ep *EmailParser) addMSGAttachment(
+	email *Email,
+	attachment msgAttachment,
+) error {
+	properties := attachment.properties
+
+	if attachment.embedded != nil {
+		file, err := ep.msgEmbeddedFile(attachment)
+		if err != nil {
+			return err
+		}
+
+		if ep.fileFilter(file.ContentType, file.ContentDisposition) {
+			email.AttachedFiles = append(email.AttachedFiles, file)
+		}
+
+		return nil
+	}
+
+	property, ok := properties.find(mapiAttachDataBinary)
+	if !ok || property.Type != mapiTypeBinary {
+		return nil
+	}
+
+	data := property.Bytes()
+	filename := properties.attachmentFilename("")
+	contentType := ContentTypeHeader{
+		ContentType: properties.attachmentContentType(filename, data),
+		Params:      map[string]string{},
+	}
+
+	contentID := strings.Trim(properties.text(mapiAttachContentID), "<>")
+	if contentID != "" &&
+		(properties.integer(mapiAttachmentHidden) != 0 ||
+			strings.Contains(email.HTML, "cid:"+contentID)) {
+		contentDisposition := fileContentDisposition(
+			ContentDispositionInline,
+			filename,
+		)
+		if ep.fileFilter(contentType, contentDisposition) {
+			email.InlineFiles = append(email.InlineFiles, InlineFile{
+				ContentID:          contentID,
+				ContentType:        contentType,
+				ContentDisposition: contentDisposition,
+				Data:               data,
+			})
+		}
+
+		return nil
+	}
+
+	contentDisposition := fileContentDisposition(
+		ContentDispositionAttachment,
+		filename,
+	)
+	if ep.fileFilter(contentType, contentDisposition) {
+		email.AttachedFiles = append(email.AttachedFiles, AttachedFile{
+			ContentType:        contentType,
+			ContentDisposition: contentDisposition,
+			Data:               data,
+		})
+	}
+
+	return nil
+}
+
+// msgEmbeddedFile returns an embedded message as a message/rfc822 attached
+// file.
+func (ep *EmailParser) msgEmbeddedFile(
+	attachment msgAttachment,
+) (AttachedFile, error) {
+	embedded := attachment.embedded
+
+	email, err := ep.msgEmail(embedded)
+	if err != nil {
+		return AttachedFile{}, fmt.Errorf(
+			"cannot read embedded message: %w",
+			err,
+		)
+	}
+
+	data, err := formatMSGEmail(embedded.header(), email)
+	if err != nil {
+		return AttachedFile{}, fmt.Errorf(
+			"cannot format embedded message: %w",
+			err,
+		)
+	}
+
+	filename := attachment.properties.text(mapiDisplayName)
+	if filename == "" {
+		filename = embedded.properties.text(mapiSubject)
+	}
+
+	return AttachedFile{
+		ContentType: ContentTypeHeader{
+			ContentType: "message/rfc822",
+			Params:      map[string]string{},
+		},
+		ContentDisposition: fileContentDisposition(
+			ContentDispositionAttachment,
+			SanitizeFilename(filename)+".eml",
+		),
+		Data: data,
+	}, nil
+}
+
+// header returns the transport headers of the message or, when it has none
+// or they cannot be read, headers built from its properties.
+func (m *msgMessage) header() mail.Header {
+	transportHeaders := strings.TrimSpace(
+		m.properties.text(mapiTransportMessageHeaders),
+	)
+	if transportHeaders != "" {
+		message, err := mail.ReadMessage(
+			strings.NewReader(transportHeaders + "\r\n\r\n"),
+		)
+		if err == nil {
+			return message.Header
+		}
+	}
+
+	properties := m.properties
+	header := make(mail.Header)
+
+	set := func(name string, value string) {
+		if value != "" {
+			header[textproto.CanonicalMIMEHeaderKey(name)] = []string{value}
+		}
+	}
+
+	from := msgAddress(
+		properties.text(mapiSentRepresentingName),
+		properties.text(mapiSentRepresentingSMTP),
+		properties.text(mapiSentRepresentingEmail),
+	)
+	sender := msgAddress(
+		properties.text(mapiSenderName),
+		properties.text(mapiSenderSMTPAddress),
+		properties.text(mapiSenderEmailAddress),
+	)
+
+	if from == nil {
+		from = sender
+	}
+
+	if from != nil {
+		set("From", from.String())
+	}
+
+	if sender != nil && !strings.EqualFold(sender.Address, from.Address) {
+		set("Sender", sender.String())
+	}
+
+	recipients := map[int64][]string{}
+
+	for _, recipient := range m.recipients {
+		address := msgAddress(
+			recipient.text(mapiDisplayName),
+			recipient.text(mapiSMTPAddress),
+			recipient.text(mapiEmailAddress),
+		)
+		if address != nil {
+			recipientType := recipient.integer(mapiRecipientType)
+			recipients[recipientType] = append(
+				recipients[recipientType],
+				address.String(),
+			)
+		}
+	}
+
+	set("To", strings.Join(recipients[msgRecipientTypeTo], ", "))
+	set("Cc", strings.Join(recipients[msgRecipientTypeCc], ", "))
+	set("Bcc", strings.Join(recipients[msgRecipientTypeBcc], ", "))
+
+	if subject := properties.text(mapiSubject); subject != "" {
+		set("Subject", mime.QEncoding.Encode("utf-8", subject))
+	}
+
+	for _, id := range []uint16{
+		mapiClientSubmitTime,
+		mapiMessageDeliveryTime,
+		mapiCreationTime,
+	} {
+		if date := properties.time(id); !date.IsZero() {
+			set("Date", date.Format(time.RFC1123Z))
+
+			break
+		}
+	}
+
+	set("Message-ID", properties.text(mapiInternetMessageID))
+	set("In-Reply-To", properties.text(mapiInReplyToID))
+	set("References", properties.text(mapiInternetReferences))
+
+	return header
+}
+
+// msgAddress returns the address of a sender or recipient, preferring the
+// SMTP address over the address of its native type, which is an X.500
+// distinguished name for Exchange users. It returns nil when neither is an
+// email address.
+func msgAddress(name string, smtpAddress string, address string) *mail.Address {
+	for _, candidate := range []string{smtpAddress, address} {
+		if strings.Contains(candidate, "@") {
+			return &mail.Address{Name: name, Address: candidate}
+		}
+	}
+
+	return nil
+}
+
+func (m *msgMessage) html() string {
+	property, ok := m.properties.find(mapiBodyHTML)
+	if !ok {
+		return ""
+	}
+
+	if property.Type == mapiTypeBinary {
+		charset := property.charset
+		if charset == "" {
+			charset = mapiDefaultCharset
+		}
+
+		return decodeCharsetBytes(property.Bytes(), charset)
+	}
+
+	return property.Text()
+}
+
+func (m *msgMessage) rtf() string {
+	property, ok := m.properties.find(mapiRTFCompressed)
+	if !ok {
+		return ""
+	}
+
+	rtf, ok := decompressRTF(property.Bytes())
+	if !ok {
+		return ""
+	}
+
+	return string(bytes.TrimRight(rtf, "\x00"))
+}
+
+// formatMSGEmail formats an email read from a .msg file as an RFC 5322
+// message with its original headers, except the MIME headers, which
+// describe the body that is written.
+func formatMSGEmail(header mail.Header, email Email) ([]byte, error) {
+	var b bytes.Buffer
+
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		if name == "Mime-Version" || strings.HasPrefix(name, "Content-") {
+			continue
+		}
+
+		for _, value := range header[name] {
+			b.WriteString(name + ": " + value + "\r\n")
+		}
+	}
+
+	writer := multipart.NewWriter(&b)
+
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: " + mime.FormatMediaType(
+		"multipart/mixed",
+		map[string]string{"boundary": writer.Boundary()},
+	) + "\r\n\r\n")
+
+	err := writeMSGTextPart(writer, contentTypeTextPlain, email.Text)
+	if err == nil {
+		err = writeMSGTextPart(writer, contentTypeTextHTML, email.HTML)
+	}
+
+	for _, file := range email.InlineFiles {
+		if err != nil {
+			break
+		}
+
+		err = writeMSGFilePart(
+			writer,
+			file.ContentType.ContentType,
+			file.ContentDisposition,
+			file.ContentID,
+			file.Data,
+		)
+	}
+
+	for _, file := range email.AttachedFiles {
+		if err != nil {
+			break
+		}
+
+		err = writeMSGFilePart(
+			writer,
+			file.ContentType.ContentType,
+			file.ContentDisposition,
+			"",
+			file.Data,
+		)
+	}
+
+	if err == nil {
+		err = writer.Close()
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot write part: %w", err)
+	}
+
+	return b.Bytes(), nil
+}
+
+func writeMSGTextPart(
+	writer *multipart.Writer,
+	contentType string,
+	text string,
+) error {
+	if text == "" {
+		return nil
+	}
+
+	part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType + "; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return fmt.Errorf("cannot create text part: %w", err)
+	}
+
+	encoder := quotedprintable.NewWriter(part)
+
+	_, err = encoder.Write([]byte(text))
+	if err == nil {
+		err = encoder.Close()
+	}
+
+	if err != nil {
+		return fmt.Errorf("cannot write text part: %w", err)
+	}
+
+	return nil
+}
+
+func writeMSGFilePart(
+	writer *multipart.Writer,
+	contentType string,
+	contentDisposition ContentDispositionHeader,
+	contentID string,
+	data []byte,
+) error {
+	header := textproto.MIMEHeader{
+		"Content-Type": {contentType},
+		"Content-Disposition": {mime.FormatMediaType(
+			string(contentDisposition.ContentDisposition),
+			contentDisposition.Params,
+		)},
+		"Content-Transfer-Encoding": {"base64"},
+	}
+
+	if contentID != "" {
+		header.Set("Content-Id", "<"+contentID+">")
+	}
+
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return fmt.Errorf("cannot create file part: %w", err)
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 0 {
+		line := encoded[:min(msgBase64LineLength, len(encoded))]
+		encoded = encoded[len(line):]
+
+		_, err = io.WriteString(part, line+"\r\n")
+		if err != nil {
+			return fmt.Errorf("cannot write file part: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,592 @@
+package letters_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/mnako/letters"
+)
+
+type msgTestProperty struct {
+	id           uint16
+	propertyType uint16
+	value        []byte
+}
+
+func msgString(id uint16, s string) msgTestProperty {
+	var value []byte
+	for _, unit := range utf16.Encode([]rune(s)) {
+		value = binary.LittleEndian.AppendUint16(value, unit)
+	}
+
+	return msgTestProperty{id: id, propertyType: 0x001f, value: value}
+}
+
+func msgBinary(id uint16, value []byte) msgTestProperty {
+	return msgTestProperty{id: id, propertyType: 0x0102, value: value}
+}
+
+func msgLong(id uint16, value uint32) msgTestProperty {
+	return msgTestProperty{
+		id:           id,
+		propertyType: 0x0003,
+		value:        binary.LittleEndian.AppendUint32(nil, value),
+	}
+}
+
+func msgTime(id uint16, t time.Time) msgTestProperty {
+	filetime := uint64(t.Unix()+11644473600) * 10000000
+
+	return msgTestProperty{
+		id:           id,
+		propertyType: 0x0040,
+		value:        binary.LittleEndian.AppendUint64(nil, filetime),
+	}
+}
+
+// msgStorage returns a storage with a property stream and the streams of its
+// variable-length properties. Streams are []byte values and storages
+// map[string]any values.
+func msgStorage(
+	headerSize int,
+	properties ...msgTestProperty,
+) map[string]any {
+	storage := map[string]any{}
+	stream := make([]byte, headerSize)
+
+	for _, property := range properties {
+		stream = binary.LittleEndian.AppendUint16(stream, property.propertyType)
+		stream = binary.LittleEndian.AppendUint16(stream, property.id)
+		stream = binary.LittleEndian.AppendUint32(stream, 0x6)
+
+		value := make([]byte, 8)
+		if property.propertyType == 0x001f || property.propertyType == 0x0102 {
+			binary.LittleEndian.PutUint32(value, uint32(len(property.value)))
+
+			name := fmt.Sprintf(
+				"__substg1.0_%04X%04X",
+				property.id,
+				property.propertyType,
+			)
+			storage[name] = property.value
+		} else {
+			copy(value, property.value)
+		}
+
+		stream = append(stream, value...)
+	}
+
+	storage["__properties_version1.0"] = stream
+
+	return storage
+}
+
+type cfbTestEntry struct {
+	name        string
+	entryType   byte
+	right       uint32
+	child       uint32
+	startSector uint32
+	size        uint32
+}
+
+// cfbTestFile writes a version 3 compound file with 512-byte sectors that
+// keeps every stream in the mini stream.
+func cfbTestFile(t *testing.T, root map[string]any) []byte {
+	t.Helper()
+
+	const (
+		sectorSize     = 512
+		miniSectorSize = 64
+		endOfChain     = 0xfffffffe
+		noStream       = 0xffffffff
+	)
+
+	entries := []cfbTestEntry{{
+		name:        "Root Entry",
+		entryType:   5,
+		right:       noStream,
+		child:       noStream,
+		startSector: endOfChain,
+		size:        0,
+	}}
+
+	var miniStream []byte
+
+	var miniFAT []uint32
+
+	var addStorage func(parent int, storage map[string]any)
+	addStorage = func(parent int, storage map[string]any) {
+		names := make([]string, 0, len(storage))
+		for name := range storage {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		previous := -1
+
+		for _, name := range names {
+			id := len(entries)
+			entries = append(entries, cfbTestEntry{
+				name:        name,
+				entryType:   2,
+				right:       noStream,
+				child:       noStream,
+				startSector: endOfChain,
+				size:        0,
+			})
+
+			if previous < 0 {
+				entries[parent].child = uint32(id)
+			} else {
+				entries[previous].right = uint32(id)
+			}
+
+			previous = id
+
+			switch value := storage[name].(type) {
+			case []byte:
+				if len(value) >= 4096 {
+					t.Fatalf("stream %q is too large", name)
+				}
+
+				entries[id].size = uint32(len(value))
+				if len(value) == 0 {
+					continue
+				}
+
+				entries[id].startSector = uint32(len(miniFAT))
+
+				sectors := (len(value) + miniSectorSize - 1) / miniSectorSize
+				for i := range sectors {
+					next := uint32(len(miniFAT) + 1)
+					if i == sectors-1 {
+						next = endOfChain
+					}
+
+					miniFAT = append(miniFAT, next)
+				}
+
+				padded := make([]byte, sectors*miniSectorSize)
+				copy(padded, value)
+				miniStream = append(miniStream, padded...)
+			case map[string]any:
+				entries[id].entryType = 1
+				addStorage(id, value)
+			default:
+				t.Fatalf("unexpected entry %q: %T", name, value)
+			}
+		}
+	}
+
+	addStorage(0, root)
+
+	var fat []uint32
+
+	chain := func(size int) uint32 {
+		if size == 0 {
+			return endOfChain
+		}
+
+		start := uint32(len(fat))
+		sectors := (size + sectorSize - 1) / sectorSize
+
+		for i := range sectors {
+			next := uint32(len(fat) + 1)
+			if i == sectors-1 {
+				next = endOfChain
+			}
+
+			fat = append(fat, next)
+		}
+
+		return start
+	}
+
+	// Sector 0 holds the FAT, which is marked as a FAT sector.
+	fat = append(fat, 0xfffffffd)
+	directoryStart := chain(len(entries) * 128)
+	miniFATStart := chain(len(miniFAT) * 4)
+	miniStreamStart := chain(len(miniStream))
+
+	if len(fat) > sectorSize/4 {
+		t.Fatalf("compound file is too large")
+	}
+
+	if len(miniStream) > 0 {
+		entries[0].startSector = miniStreamStart
+		entries[0].size = uint32(len(miniStream))
+	}
+
+	header := make([]byte, sectorSize)
+	copy(header, "\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1")
+	binary.LittleEndian.PutUint16(header[0x18:], 0x3e)
+	binary.LittleEndian.PutUint16(header[0x1a:], 3)
+	binary.LittleEndian.PutUint16(header[0x1c:], 0xfffe)
+	binary.LittleEndian.PutUint16(header[0x1e:], 9)
+	binary.LittleEndian.PutUint16(header[0x20:], 6)
+	binary.LittleEndian.PutUint32(header[0x2c:], 1)
+	binary.LittleEndian.PutUint32(header[0x30:], directoryStart)
+	binary.LittleEndian.PutUint32(header[0x38:], 4096)
+	binary.LittleEndian.PutUint32(header[0x3c:], miniFATStart)
+	binary.LittleEndian.PutUint32(header[0x40:], uint32(len(miniFAT)))
+	binary.LittleEndian.PutUint32(header[0x44:], endOfChain)
+	binary.LittleEndian.PutUint32(header[0x4c:], 0)
+
+	for offset := 0x50; offset < sectorSize; offset += 4 {
+		binary.LittleEndian.PutUint32(header[offset:], noStream)
+	}
+
+	sectorAlign := func(data []byte) []byte {
+		for len(data)%sectorSize != 0 {
+			data = append(data, 0)
+		}
+
+		return data
+	}
+
+	fatSector := make([]byte, 0, sectorSize)
+	for i := range sectorSize / 4 {
+		entry := uint32(noStream)
+		if i < len(fat) {
+			entry = fat[i]
+		}
+
+		fatSector = binary.LittleEndian.AppendUint32(fatSector, entry)
+	}
+
+	var directory []byte
+
+	for _, entry := range entries {
+		data := make([]byte, 128)
+
+		name := utf16.Encode([]rune(entry.name + "\x00"))
+		for i, unit := range name {
+			binary.LittleEndian.PutUint16(data[2*i:], unit)
+		}
+
+		binary.LittleEndian.PutUint16(data[0x40:], uint16(2*len(name)))
+		data[0x42] = entry.entryType
+		data[0x43] = 1
+		binary.LittleEndian.PutUint32(data[0x44:], noStream)
+		binary.LittleEndian.PutUint32(data[0x48:], entry.right)
+		binary.LittleEndian.PutUint32(data[0x4c:], entry.child)
+		binary.LittleEndian.PutUint32(data[0x74:], entry.startSector)
+		binary.LittleEndian.PutUint32(data[0x78:], entry.size)
+
+		directory = append(directory, data...)
+	}
+
+	var miniFATData []byte
+	for _, entry := range miniFAT {
+		miniFATData = binary.LittleEndian.AppendUint32(miniFATData, entry)
+	}
+
+	data := append(header, fatSector...)
+	data = append(data, sectorAlign(directory)...)
+	data = append(data, sectorAlign(miniFATData)...)
+
+	return append(data, sectorAlign(miniStream)...)
+}
+
+func msgTestData(t *testing.T, transportHeaders string) []byte {
+	t.Helper()
+
+	// The compressed RTF example of [MS-OXRTFCP] section 4.1.
+	compressedRTF, err := base64.StdEncoding.DecodeString(
+		"LQAAACsAAABMWkZ18cXHpwMACgByY3BnMTI1QjIK8yBoZWwJACBidwWwbGR9CoAPoA==",
+	)
+	if err != nil {
+		t.Fatalf("cannot decode compressed RTF: %s", err)
+	}
+
+	sent := time.Date(2024, time.March, 5, 9, 30, 0, 0, time.UTC)
+
+	properties := []msgTestProperty{
+		msgString(0x001a, "IPM.Note"),
+		msgString(0x0037, "Quarterly café report"),
+		msgString(0x0042, "Alice Example"),
+		msgString(0x5d02, "alice@example.com"),
+		msgString(0x0c1a, "Alice Example"),
+		msgString(0x5d01, "alice@example.com"),
+		msgTime(0x0039, sent),
+		msgString(0x1035, "<report@example.com>"),
+		msgString(0x1000, "See the report.\r\n"),
+		msgBinary(
+			0x1013,
+			[]byte("<p>See the r\xe9port.</p><img src=\"cid:chart@example\">"),
+		),
+		msgLong(0x3fde, 1252),
+		msgBinary(0x1009, compressedRTF),
+	}
+	if transportHeaders != "" {
+		properties = append(properties, msgString(0x007d, transportHeaders))
+	}
+
+	embedded := msgStorage(
+		24,
+		msgString(0x0037, "Earlier message"),
+		msgString(0x0c1a, "Carol Example"),
+		msgString(0x5d01, "carol@example.com"),
+		msgString(0x1000, "Earlier text"),
+	)
+
+	root := msgStorage(32, properties...)
+	root["__recip_version1.0_#00000000"] = msgStorage(
+		8,
+		msgLong(0x0c15, 1),
+		msgString(0x3001, "Bob Example"),
+		msgString(0x3003, "/O=EXAMPLE/CN=BOB"),
+		msgString(0x39fe, "bob@example.com"),
+	)
+	root["__recip_version1.0_#00000001"] = msgStorage(
+		8,
+		msgLong(0x0c15, 2),
+		msgString(0x3001, "Carol Example"),
+		msgString(0x3003, "carol@example.com"),
+	)
+	root["__attach_version1.0_#00000000"] = msgStorage(
+		8,
+		msgLong(0x3705, 1),
+		msgString(0x3707, "Quarterly report.pdf"),
+		msgBinary(0x3701, []byte("%PDF-1.7\n")),
+	)
+	root["__attach_version1.0_#00000001"] = msgStorage(
+		8,
+		msgLong(0x3705, 1),
+		msgString(0x3707, "chart.png"),
+		msgString(0x3712, "chart@example"),
+		msgBinary(0x3701, []byte("\x89PNG\r\n\x1a\n")),
+	)
+
+	embeddedAttachment := msgStorage(
+		8,
+		msgLong(0x3705, 5),
+		msgString(0x3001, "Earlier message"),
+	)
+	embeddedAttachment["__substg1.0_3701000D"] = embedded
+	root["__attach_version1.0_#00000002"] = embeddedAttachment
+
+	return cfbTestFile(t, root)
+}
+
+func TestParseMSG(t *testing.T) {
+	t.Parallel()
+
+	email, err := letters.ParseMSG(bytes.NewReader(msgTestData(t, "")))
+	if err != nil {
+		t.Fatalf("cannot parse message: %s", err)
+	}
+
+	headers := email.Headers
+	expectedDate := time.Date(2024, time.March, 5, 9, 30, 0, 0, time.UTC)
+
+	if headers.Subject != "Quarterly café report" ||
+		len(headers.From) != 1 ||
+		headers.From[0].Address != "alice@example.com" ||
+		headers.Sender != nil ||
+		len(headers.To) != 1 ||
+		headers.To[0].Address != "bob@example.com" ||
+		headers.To[0].Name != "Bob Example" ||
+		len(headers.Cc) != 1 ||
+		headers.Cc[0].Address != "carol@example.com" ||
+		headers.MessageID != "report@example.com" ||
+		!headers.Date.Equal(expectedDate) {
+		t.Errorf("unexpected headers: %#v", headers)
+	}
+
+	expectedHTML := "<p>See the réport.</p><img src=\"cid:chart@example\">"
+
+	if email.Text != "See the report." ||
+		email.HTML != expectedHTML ||
+		email.RTF != "{\\rtf1\\ansi\\ansicpg1252\\pard hello world}\r\n" {
+		t.Errorf(
+			"unexpected bodies: %q, %q, %q",
+			email.Text,
+			email.HTML,
+			email.RTF,
+		)
+	}
+
+	if len(email.InlineFiles) != 1 ||
+		email.InlineFiles[0].ContentID != "chart@example" ||
+		email.InlineFiles[0].ContentType.ContentType != "image/png" {
+		t.Errorf("unexpected inline files: %#v", email.InlineFiles)
+	}
+
+	if len(email.AttachedFiles) != 2 {
+		t.Fatalf("unexpected attached files: %#v", email.AttachedFiles)
+	}
+
+	report := email.AttachedFiles[0]
+	if report.Filename().Name != "Quarterly report.pdf" ||
+		report.ContentType.ContentType != "application/pdf" ||
+		string(report.Data) != "%PDF-1.7\n" {
+		t.Errorf("unexpected attached file: %#v", report)
+	}
+
+	message := email.AttachedFiles[1]
+	if message.ContentType.ContentType != "message/rfc822" ||
+		message.Filename().Name != "Earlier message.eml" {
+		t.Errorf("unexpected embedded message: %#v", message)
+	}
+
+	embedded, err := letters.ParseEmail(bytes.NewReader(message.Data))
+	if err != nil {
+		t.Fatalf("cannot parse embedded message: %s", err)
+	}
+
+	if embedded.Headers.Subject != "Earlier message" ||
+		len(embedded.Headers.From) != 1 ||
+		embedded.Headers.From[0].Address != "carol@example.com" ||
+		embedded.Text != "Earlier text" {
+		t.Errorf("unexpected embedded message: %#v", embedded)
+	}
+}
+
+func TestParseMSGTransportHeaders(t *testing.T) {
+	t.Parallel()
+
+	data := msgTestData(t, "From: Dave <dave@example.com>\r\n"+
+		"To: Erin <erin@example.com>\r\n"+
+		"Subject: Relayed\r\n"+
+		"Date: Tue, 05 Mar 2024 10:00:00 +0000\r\n"+
+		"Message-ID: <relayed@example.com>\r\n"+
+		"Content-Type: multipart/mixed; boundary=b\r\n")
+
+	// Parse reads .msg files as well.
+	email, err := letters.ParseEmail(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("cannot parse message: %s", err)
+	}
+
+	if email.Headers.Subject != "Relayed" ||
+		len(email.Headers.From) != 1 ||
+		email.Headers.From[0].Address != "dave@example.com" ||
+		email.Headers.MessageID != "relayed@example.com" ||
+		email.Text != "See the report." {
+		t.Errorf("unexpected email: %#v", email)
+	}
+}
+
+func TestParseMSGFilters(t *testing.T) {
+	t.Parallel()
+
+	email, err := letters.NewEmailParser(
+		letters.WithBodyFilter(letters.NoBodies),
+		letters.WithFileFilter(letters.NoFiles),
+	).ParseMSG(bytes.NewReader(msgTestData(t, "")))
+	if err != nil {
+		t.Fatalf("cannot parse message: %s", err)
+	}
+
+	if len(email.AttachedFiles) != 0 || len(email.InlineFiles) != 0 ||
+		email.Text != "" || email.HTML != "" || email.RTF != "" ||
+		email.Headers.Subject != "Quarterly café report" {
+		t.Errorf("unexpected email: %#v", email)
+	}
+}
+
+// cfbLoopingTestData returns a compound file with a valid root entry, whose
+// header lists FAT sector 0 four times and whose FAT chains the directory
+// sector to itself.
+func cfbLoopingTestData() []byte {
+	const sectorSize = 512
+
+	data := make([]byte, 3*sectorSize)
+	copy(data, "\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1")
+	binary.LittleEndian.PutUint16(data[0x1a:], 3)
+	binary.LittleEndian.PutUint16(data[0x1c:], 0xfffe)
+	binary.LittleEndian.PutUint16(data[0x1e:], 9)
+	binary.LittleEndian.PutUint16(data[0x20:], 6)
+	binary.LittleEndian.PutUint32(data[0x30:], 1)
+	binary.LittleEndian.PutUint32(data[0x38:], 4096)
+	binary.LittleEndian.PutUint32(data[0x3c:], 0xfffffffe)
+	binary.LittleEndian.PutUint32(data[0x44:], 0xfffffffe)
+
+	for i := range 109 {
+		entry := uint32(0xffffffff)
+		if i < 4 {
+			entry = 0
+		}
+
+		binary.LittleEndian.PutUint32(data[0x4c+4*i:], entry)
+	}
+
+	fat := data[sectorSize : 2*sectorSize]
+	for i := range sectorSize / 4 {
+		binary.LittleEndian.PutUint32(fat[4*i:], 0xffffffff)
+	}
+
+	binary.LittleEndian.PutUint32(fat[0:], 0xfffffffd)
+	binary.LittleEndian.PutUint32(fat[4:], 1)
+
+	root := data[2*sectorSize:]
+	for i, r := range utf16.Encode([]rune("Root Entry")) {
+		binary.LittleEndian.PutUint16(root[2*i:], r)
+	}
+
+	binary.LittleEndian.PutUint16(root[0x40:], 22)
+	root[0x42] = 5
+	binary.LittleEndian.PutUint32(root[0x44:], 0xffffffff)
+	binary.LittleEndian.PutUint32(root[0x48:], 0xffffffff)
+	binary.LittleEndian.PutUint32(root[0x4c:], 0xffffffff)
+	binary.LittleEndian.PutUint32(root[0x74:], 0xfffffffe)
+
+	return data
+}
+
+func TestParseMSGErrors(t *testing.T) {
+	t.Parallel()
+
+	valid := msgTestData(t, "")
+
+	testCases := []struct {
+		name          string
+		data          []byte
+		expectedError string
+	}{
+		{
+			name:          "no signature",
+			data:          []byte(strings.Repeat("message.msg ", 100)),
+			expectedError: "no compound file signature",
+		},
+		{
+			name:          "truncated",
+			data:          valid[:1024],
+			expectedError: "",
+		},
+		{
+			name:          "looping FAT",
+			data:          cfbLoopingTestData(),
+			expectedError: "sector chain loops",
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := letters.ParseMSG(bytes.NewReader(testCase.data))
+			if !errors.Is(err, letters.ErrInvalidMSG) ||
+				!strings.Contains(err.Error(), testCase.expectedError) {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			_, err = letters.ParseEmail(bytes.NewReader(testCase.data))
+			if err == nil {
+				t.Errorf("expected ParseEmail to fail")
+			}
+		})
+	}
+}
@@ -27,6 +27,20 @@ func normalizeParametrizedAttributeValue(s string) string {
 	return s
 }
 
+// indexFold returns the index of the first instance of substr in s, with
+// letters matched case-insensitively, or -1. Unlike an index into
+// strings.ToLower(s), the index is valid for s: lowercasing changes the
+// length of some non-ASCII characters.
+func indexFold(s string, substr string) int {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if strings.EqualFold(s[i:i+len(substr)], substr) {
+			return i
+		}
+	}
+
+	return -1
+}
+
 func getTimeLocationFromObsoleteDateFormat(dateHeader string) *time.Location {
 	// From RFC5322 Section 4.3.  Obsolete Date and Time:
 	// The remaining three character zones are the US time zones. The first
@@ -440,7 +454,7 @@ func ParseContentDisposition(
 ) (ContentDispositionHeader, error) {
 	var cdh ContentDispositionHeader
 
-	label, params, err := mime.ParseMediaType(contentDispositionValue)
+	label, params, err := parseMediaType(contentDispositionValue)
 	if label == "" {
 		return cdh, nil
 	}
@@ -468,7 +482,8 @@ func ParseContentDisposition(
 	}, nil
 }
 
-// ParseContentTransferEncoding parses a Content-Transfer-Encoding header.
+// ParseContentTransferEncoding parses a Content-Transfer-Encoding header,
+// accepting the encodings of DefaultContentTransferDecoders.
 func ParseContentTransferEncoding(s string) (ContentTransferEncoding, error) {
 	label := normalizeParametrizedAttributeValue(s)
 	if label == "" {
@@ -477,9 +492,7 @@ func ParseContentTransferEncoding(s string) (ContentTransferEncoding, error) {
 
 	cte := ContentTransferEncoding(label)
 
-	switch cte {
-	case cte7bit, cte8bit, cteBinary, cteQuotedPrintable, cteBase64:
-	default:
+	if _, ok := DefaultContentTransferDecoders()[cte]; !ok {
 		return cte, fmt.Errorf(
 			"%w %q",
 			ErrUnknownContentTransferEncoding,
@@ -490,6 +503,35 @@ func ParseContentTransferEncoding(s string) (ContentTransferEncoding, error) {
 	return cte, nil
 }
 
+// parseMediaType parses a Content-Type or Content-Disposition value like
+// mime.ParseMediaType, but also decodes RFC 2231 parameters in charsets
+// other than UTF-8 and accepts parameter values with raw 8-bit bytes.
+func parseMediaType(value string) (string, map[string]string, error) {
+	mediaType, params, err := mime.ParseMediaType(value)
+
+	switch {
+	case errors.Is(err, mime.ErrInvalidMediaParameter):
+		return mediaType, decodeMediaTypeParams(value), nil
+	case err != nil:
+		return mediaType, params, fmt.Errorf(
+			"letters.parsers.parseMediaType: %w",
+			err,
+		)
+	default:
+	}
+
+	lowerValue := strings.ToLower(value)
+	if strings.Contains(lowerValue, "*") {
+		for attribute, decoded := range decodeMediaTypeParams(value) {
+			if strings.Contains(lowerValue, attribute+"*") {
+				params[attribute] = decoded
+			}
+		}
+	}
+
+	return mediaType, params, nil
+}
+
 // ParseDefaultMediaType parses a media type, defaulting an empty value to text/plain.
 func ParseDefaultMediaType(
 	contentTypeValue string,
@@ -498,7 +540,7 @@ func ParseDefaultMediaType(
 		contentTypeValue = "text/plain"
 	}
 
-	mediatype, params, err := mime.ParseMediaType(contentTypeValue)
+	mediatype, params, err := parseMediaType(contentTypeValue)
 	if err != nil {
 		return mediatype, params, fmt.Errorf(
 			"letters.parsers.parseDefaultMediaType: "+
@@ -527,7 +569,13 @@ func ParseContentTypeHeader(
 		)
 	}
 
-	for _, param := range []string{"charset", "micalg", "protocol"} {
+	for _, param := range []string{
+		"charset",
+		"micalg",
+		"protocol",
+		"format",
+		"delsp",
+	} {
 		if mediaTypeParams[param] != "" {
 			mediaTypeParams[param] = normalizeParametrizedAttributeValue(
 				mediaTypeParams[param],
@@ -758,14 +806,14 @@ func (ep *EmailParser) ParseHeaders(header mail.Header) (Headers, error) {
 func parseText(
 	content io.Reader,
 	charsetLabel string,
-	cte ContentTransferEncoding,
+	decodeTransfer ContentTransferDecoder,
 ) (string, error) {
 	textEncoding, _ := charset.Lookup(charsetLabel)
 	if textEncoding == nil && charsetLabel != "" {
 		return "", fmt.Errorf("%w %s", ErrUnknownCharset, charsetLabel)
 	}
 
-	reader, err := decodeContent(content, textEncoding, cte)
+	reader, err := decodeContent(content, textEncoding, decodeTransfer)
 	if err != nil {
 		return "", fmt.Errorf(
 			"letters.parsers.parseText: "+
@@ -861,8 +909,9 @@ func (ep *EmailParser) parsePart(
 			charsetLabel = parentContentType.Params["charset"]
 		}
 
-		cte, err := ParseContentTransferEncoding(
+		decodeTransfer, err := ep.contentTransferDecoder(
 			part.Header.Get("Content-Transfer-Encoding"),
+			&emailBodies.warnings,
 		)
 		if err != nil {
 			return emailBodies, fmt.Errorf(
@@ -883,12 +932,35 @@ func (ep *EmailParser) parsePart(
 			)
 		}
 
+		handled, err := ep.handlePart(
+			part,
+			HandledPart{
+				Header:             part.Header,
+				ContentType:        partContentType,
+				ContentDisposition: cdh,
+				ParentContentType:  parentContentType,
+				Data:               nil,
+			},
+			decodeTransfer,
+			&emailBodies.handledParts,
+		)
+		if err != nil {
+			return emailBodies, fmt.Errorf("letters.parsers.parsePart: %w", err)
+		}
+
+		if handled {
+			continue
+		}
+
 		if cdh.ContentDisposition == ContentDispositionAttachment {
 			if !ep.fileFilter(partContentType, cdh) {
 				continue
 			}
 
-			attachedFile, err := decodeAttachedFileFromPart(part, cte)
+			attachedFile, err := decodeAttachedFileFromPart(
+				part,
+				decodeTransfer,
+			)
 			if err != nil {
 				return emailBodies, fmt.Errorf(
 					"letters.parsers.parsePart: "+
@@ -910,7 +982,7 @@ func (ep *EmailParser) parsePart(
 				continue
 			}
 
-			partTextBody, err := parseText(part, charsetLabel, cte)
+			partTextBody, err := parseText(part, charsetLabel, decodeTransfer)
 			if err != nil {
 				return emailBodies, fmt.Errorf(
 					"letters.parsers.parsePart: "+
@@ -919,7 +991,7 @@ func (ep *EmailParser) parsePart(
 				)
 			}
 
-			emailBodies.text += partTextBody
+			emailBodies.text += decodeTextFormat(partTextBody, partContentType)
 			emailBodies.text += "\n\n"
 
 			continue
@@ -930,7 +1002,11 @@ func (ep *EmailParser) parsePart(
 				continue
 			}
 
-			partEnrichedText, err := parseText(part, charsetLabel, cte)
+			partEnrichedText, err := parseText(
+				part,
+				charsetLabel,
+				decodeTransfer,
+			)
 			if err != nil {
 				return emailBodies, fmt.Errorf(
 					"letters.parsers.parsePart: "+
@@ -949,7 +1025,7 @@ func (ep *EmailParser) parsePart(
 				continue
 			}
 
-			partHTMLBody, err := parseText(part, charsetLabel, cte)
+			partHTMLBody, err := parseText(part, charsetLabel, decodeTransfer)
 			if err != nil {
 				return emailBodies, fmt.Errorf(
 					"letters.parsers.parsePart: "+
@@ -990,7 +1066,7 @@ func (ep *EmailParser) parsePart(
 				continue
 			}
 
-			inlineFile, err := decodeInlineFile(part, cte)
+			inlineFile, err := decodeInlineFile(part, decodeTransfer)
 			if err != nil {
 				return emailBodies, fmt.Errorf(
 					"letters.parsers.parsePart: "+
@@ -1012,7 +1088,10 @@ func (ep *EmailParser) parsePart(
 				continue
 			}
 
-			attachedFile, err := decodeAttachedFileFromPart(part, cte)
+			attachedFile, err := decodeAttachedFileFromPart(
+				part,
+				decodeTransfer,
+			)
 			if err != nil {
 				return emailBodies, fmt.Errorf(
 					"letters.parsers.parsePart: "+
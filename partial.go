@@ -0,0 +1,506 @@
+package letters
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const contentTypeMessagePartial = "message/partial"
+
+// MessageFragment is a fragment of a message split into message/partial
+// messages, see RFC 2046 section 5.2.2.
+type MessageFragment struct {
+	// ID identifies the message that the fragment belongs to.
+	ID string
+
+	// Number is the position of the fragment in the message, starting at 1.
+	Number int
+
+	// Total is the number of fragments of the message. It is required in
+	// the last fragment only and zero in fragments without it.
+	Total int
+
+	// Data is the raw fragment, with its header and body.
+	Data []byte
+}
+
+// PartialMessage describes a message/partial fragment stored until the
+// other fragments of its message arrive.
+type PartialMessage struct {
+	ID     string
+	Number int
+
+	// Total is the number of fragments of the message, or zero until the
+	// fragment that declares it arrives.
+	Total int
+
+	// Received is the number of fragments of the message received so far.
+	Received int
+}
+
+// PartialStore keeps the fragments of message/partial messages across calls
+// to Parse until all fragments of a message arrive. Implementations must be
+// safe for concurrent use when the parser is.
+type PartialStore interface {
+	// AddFragment stores a fragment, replacing any stored fragment with the
+	// same ID and number, and returns all stored fragments of its message.
+	AddFragment(fragment MessageFragment) ([]MessageFragment, error)
+
+	// DeleteFragments deletes the stored fragments of a message.
+	DeleteFragments(id string) error
+}
+
+// Defaults of MemoryPartialStoreOptions.
+const (
+	DefaultPartialMaxSize      = 64 << 20
+	DefaultPartialMaxMessages  = 1000
+	DefaultPartialMaxFragments = 1000
+	DefaultPartialTTL          = 7 * 24 * time.Hour
+)
+
+// MemoryPartialStoreOptions limits the fragments that a MemoryPartialStore
+// keeps. Zero values select the defaults.
+type MemoryPartialStoreOptions struct {
+	// MaxSize is the total size in bytes of the stored fragments. When a
+	// fragment exceeds it, the messages with the oldest first fragments are
+	// deleted. A message that exceeds it alone is rejected. It defaults to
+	// DefaultPartialMaxSize.
+	MaxSize int
+
+	// MaxMessages is the number of messages with stored fragments. When a
+	// fragment of another message arrives, the message with the oldest
+	// first fragment is deleted. It defaults to DefaultPartialMaxMessages.
+	MaxMessages int
+
+	// MaxFragments is the highest fragment number and total accepted. It
+	// defaults to DefaultPartialMaxFragments.
+	MaxFragments int
+
+	// TTL is the time after the first fragment of a message arrives when
+	// its fragments are deleted. It defaults to DefaultPartialTTL.
+	TTL time.Duration
+}
+
+// MemoryPartialStore is a PartialStore that keeps fragments in memory
+// within the limits of its MemoryPartialStoreOptions. It is safe for
+// concurrent use.
+type MemoryPartialStore struct {
+	options MemoryPartialStoreOptions
+
+	mu       sync.Mutex
+	size     int
+	messages map[string]*memoryPartialMessage
+}
+
+type memoryPartialMessage struct {
+	created   time.Time
+	size      int
+	fragments map[int]MessageFragment
+}
+
+// NewMemoryPartialStore returns an empty MemoryPartialStore.
+func NewMemoryPartialStore(
+	options MemoryPartialStoreOptions,
+) *MemoryPartialStore {
+	if options.MaxSize <= 0 {
+		options.MaxSize = DefaultPartialMaxSize
+	}
+
+	if options.MaxMessages <= 0 {
+		options.MaxMessages = DefaultPartialMaxMessages
+	}
+
+	if options.MaxFragments <= 0 {
+		options.MaxFragments = DefaultPartialMaxFragments
+	}
+
+	if options.TTL <= 0 {
+		options.TTL = DefaultPartialTTL
+	}
+
+	return &MemoryPartialStore{
+		options:  options,
+		mu:       sync.Mutex{},
+		size:     0,
+		messages: make(map[string]*memoryPartialMessage),
+	}
+}
+
+// AddFragment stores a fragment and returns the stored fragments of its
+// message in the order of their numbers. It deletes expired messages and,
+// to stay within the limits, the messages with the oldest first fragments.
+// It returns an error wrapping ErrPartialTooLarge and deletes the fragments
+// of the message when the message exceeds the limits alone.
+func (s *MemoryPartialStore) AddFragment(
+	fragment MessageFragment,
+) ([]MessageFragment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	for id, message := range s.messages {
+		if now.Sub(message.created) >= s.options.TTL {
+			s.deleteMessage(id)
+		}
+	}
+
+	if max(fragment.Number, fragment.Total) > s.options.MaxFragments {
+		s.deleteMessage(fragment.ID)
+
+		return nil, fmt.Errorf(
+			"letters.partial.AddFragment: %w: %q has more than %d fragments",
+			ErrPartialTooLarge,
+			fragment.ID,
+			s.options.MaxFragments,
+		)
+	}
+
+	message, ok := s.messages[fragment.ID]
+	if !ok {
+		if len(s.messages) >= s.options.MaxMessages {
+			s.deleteOldestMessage(fragment.ID)
+		}
+
+		message = &memoryPartialMessage{
+			created:   now,
+			size:      0,
+			fragments: make(map[int]MessageFragment),
+		}
+		s.messages[fragment.ID] = message
+	}
+
+	if replaced, ok := message.fragments[fragment.Number]; ok {
+		message.size -= len(replaced.Data)
+		s.size -= len(replaced.Data)
+	}
+
+	message.fragments[fragment.Number] = fragment
+	message.size += len(fragment.Data)
+	s.size += len(fragment.Data)
+
+	if message.size > s.options.MaxSize {
+		s.deleteMessage(fragment.ID)
+
+		return nil, fmt.Errorf(
+			"letters.partial.AddFragment: %w: %q exceeds %d bytes",
+			ErrPartialTooLarge,
+			fragment.ID,
+			s.options.MaxSize,
+		)
+	}
+
+	for s.size > s.options.MaxSize {
+		s.deleteOldestMessage(fragment.ID)
+	}
+
+	stored := make([]MessageFragment, 0, len(message.fragments))
+	for _, f := range message.fragments {
+		stored = append(stored, f)
+	}
+
+	sortFragments(stored)
+
+	return stored, nil
+}
+
+// DeleteFragments deletes the stored fragments of a message.
+func (s *MemoryPartialStore) DeleteFragments(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteMessage(id)
+
+	return nil
+}
+
+func (s *MemoryPartialStore) deleteMessage(id string) {
+	message, ok := s.messages[id]
+	if !ok {
+		return
+	}
+
+	s.size -= message.size
+	delete(s.messages, id)
+}
+
+// deleteOldestMessage deletes the message with the oldest first fragment
+// other than the message with the given id.
+func (s *MemoryPartialStore) deleteOldestMessage(except string) {
+	oldest := ""
+
+	var oldestCreated time.Time
+
+	for id, message := range s.messages {
+		if id != except &&
+			(oldest == "" || message.created.Before(oldestCreated)) {
+			oldest = id
+			oldestCreated = message.created
+		}
+	}
+
+	s.deleteMessage(oldest)
+}
+
+// WithPartialStore makes the parser reassemble message/partial messages.
+// Parse stores each fragment in the store and, once all fragments of a
+// message have arrived, parses the reassembled message with the same
+// parser and deletes its fragments from the store. Until then, Parse
+// returns the headers of the fragment with Email.Partial set.
+func WithPartialStore(store PartialStore) EmailParserOption {
+	return func(ep *EmailParser) {
+		ep.partialStore = store
+	}
+}
+
+// NewMessageFragment returns the fragment of a raw message/partial message
+// with the id, number and total parameters of its Content-Type. It returns
+// an error wrapping ErrInvalidPartial when the parameters are missing or
+// invalid.
+func NewMessageFragment(
+	contentType ContentTypeHeader,
+	data []byte,
+) (MessageFragment, error) {
+	fragment := MessageFragment{
+		ID:     contentType.Params["id"],
+		Number: 0,
+		Total:  0,
+		Data:   data,
+	}
+
+	if !strings.EqualFold(contentType.ContentType, contentTypeMessagePartial) {
+		return fragment, fmt.Errorf(
+			"letters.partial.NewMessageFragment: %w: content type %s",
+			ErrInvalidPartial,
+			contentType.ContentType,
+		)
+	}
+
+	if fragment.ID == "" {
+		return fragment, fmt.Errorf(
+			"letters.partial.NewMessageFragment: %w: no id",
+			ErrInvalidPartial,
+		)
+	}
+
+	number, err := strconv.Atoi(contentType.Params["number"])
+	if err != nil || number < 1 {
+		return fragment, fmt.Errorf(
+			"letters.partial.NewMessageFragment: %w: invalid number %q",
+			ErrInvalidPartial,
+			contentType.Params["number"],
+		)
+	}
+
+	fragment.Number = number
+
+	if total, ok := contentType.Params["total"]; ok {
+		fragment.Total, err = strconv.Atoi(total)
+		if err != nil || fragment.Total < number {
+			return fragment, fmt.Errorf(
+				"letters.partial.NewMessageFragment: %w: invalid total %q",
+				ErrInvalidPartial,
+				total,
+			)
+		}
+	}
+
+	return fragment, nil
+}
+
+// ReassembleFragments reassembles the raw message split into fragments.
+// The header of the message is the header of the first fragment, with its
+// Content-* fields and its Subject, Message-ID, Encrypted and MIME-Version
+// fields replaced by those of the message enclosed in the first fragment.
+// The body is the body of the enclosed message followed by the bodies of
+// the other fragments. It returns an error wrapping ErrInvalidPartial when
+// fragments are missing or inconsistent.
+func ReassembleFragments(fragments []MessageFragment) ([]byte, error) {
+	fragments = slices.Clone(fragments)
+	sortFragments(fragments)
+
+	complete, err := fragmentsComplete(fragments)
+	if err != nil {
+		return nil, fmt.Errorf("letters.partial.ReassembleFragments: %w", err)
+	}
+
+	if !complete {
+		return nil, fmt.Errorf(
+			"letters.partial.ReassembleFragments: %w: missing fragments",
+			ErrInvalidPartial,
+		)
+	}
+
+	outerFields, outerBody, err := splitRawMessage(fragments[0].Data)
+	if err != nil {
+		return nil, fmt.Errorf("letters.partial.ReassembleFragments: %w", err)
+	}
+
+	enclosedFields, enclosedBody, err := splitRawMessage(outerBody)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"letters.partial.ReassembleFragments: "+
+				"cannot read enclosed message: %w",
+			err,
+		)
+	}
+
+	var message bytes.Buffer
+
+	for _, field := range outerFields {
+		if !isEnclosedHeaderField(field) {
+			message.WriteString(field.raw)
+		}
+	}
+
+	for _, field := range enclosedFields {
+		if isEnclosedHeaderField(field) {
+			message.WriteString(field.raw)
+		}
+	}
+
+	message.WriteString("\r\n")
+	message.Write(enclosedBody)
+
+	for _, fragment := range fragments[1:] {
+		_, body, err := splitRawMessage(fragment.Data)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"letters.partial.ReassembleFragments: "+
+					"cannot read fragment %d: %w",
+				fragment.Number,
+				err,
+			)
+		}
+
+		message.Write(body)
+	}
+
+	return message.Bytes(), nil
+}
+
+// parsePartial stores a message/partial fragment and parses its message
+// once all fragments have arrived.
+func (ep *EmailParser) parsePartial(email Email, data []byte) (Email, error) {
+	fragment, err := NewMessageFragment(email.Headers.ContentType, data)
+	if err != nil {
+		return email, err
+	}
+
+	fragments, err := ep.partialStore.AddFragment(fragment)
+	if err != nil {
+		return email, fmt.Errorf("cannot store fragment: %w", err)
+	}
+
+	sortFragments(fragments)
+
+	// Inconsistent fragments would block their ID until they expire, so
+	// they are deleted together with the fragments stored before them.
+	complete, err := fragmentsComplete(fragments)
+	if err != nil {
+		return email, ep.deletePartial(fragment.ID, err)
+	}
+
+	if !complete {
+		email.Partial = &PartialMessage{
+			ID:       fragment.ID,
+			Number:   fragment.Number,
+			Total:    fragmentsTotal(fragments),
+			Received: len(fragments),
+		}
+
+		return email, nil
+	}
+
+	message, err := ReassembleFragments(fragments)
+
+	err = ep.deletePartial(fragment.ID, err)
+	if err != nil {
+		return email, err
+	}
+
+	return ep.Parse(bytes.NewReader(message))
+}
+
+// deletePartial deletes the stored fragments of a message and returns err,
+// or the error of the deletion when err is nil.
+func (ep *EmailParser) deletePartial(id string, err error) error {
+	deleteErr := ep.partialStore.DeleteFragments(id)
+	if err != nil {
+		return err
+	}
+
+	if deleteErr != nil {
+		return fmt.Errorf("cannot delete fragments: %w", deleteErr)
+	}
+
+	return nil
+}
+
+func sortFragments(fragments []MessageFragment) {
+	slices.SortFunc(fragments, func(a, b MessageFragment) int {
+		return a.Number - b.Number
+	})
+}
+
+func fragmentsTotal(fragments []MessageFragment) int {
+	total := 0
+
+	for _, fragment := range fragments {
+		total = max(total, fragment.Total)
+	}
+
+	return total
+}
+
+// fragmentsComplete reports whether sorted fragments are fragments 1 to
+// total of a message. It returns an error wrapping ErrInvalidPartial when
+// the fragments disagree on their total or exceed it.
+func fragmentsComplete(fragments []MessageFragment) (bool, error) {
+	total := fragmentsTotal(fragments)
+
+	for i, fragment := range fragments {
+		if fragment.Total != 0 && fragment.Total != total {
+			return false, fmt.Errorf(
+				"%w: fragments of %q declare totals %d and %d",
+				ErrInvalidPartial,
+				fragment.ID,
+				fragment.Total,
+				total,
+			)
+		}
+
+		if total != 0 && fragment.Number > total {
+			return false, fmt.Errorf(
+				"%w: fragment %d of %q exceeds total %d",
+				ErrInvalidPartial,
+				fragment.Number,
+				fragment.ID,
+				total,
+			)
+		}
+
+		if fragment.Number != i+1 {
+			return false, nil
+		}
+	}
+
+	return total != 0 && len(fragments) == total, nil
+}
+
+// isEnclosedHeaderField reports whether a header field is taken from the
+// message enclosed in the first fragment rather than from the fragment.
+func isEnclosedHeaderField(field rawHeaderField) bool {
+	name := strings.ToLower(field.name)
+
+	return strings.HasPrefix(name, "content-") ||
+		slices.Contains(
+			[]string{"subject", "message-id", "encrypted", "mime-version"},
+			name,
+		)
+}
@@ -0,0 +1,428 @@
+package letters_test
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mnako/letters"
+)
+
+func partialTestFragment(number int, total string, body string) string {
+	n := strconv.Itoa(number)
+
+	params := "id=\"report@example.com\"; number=" + n
+	if total != "" {
+		params += "; total=" + total
+	}
+
+	return "From: Alice <alice@example.com>\r\n" +
+		"To: Bob <bob@example.com>\r\n" +
+		"Subject: Report (part " + n + ")\r\n" +
+		"Message-ID: <part" + n + "@example.com>\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: message/partial; " + params + "\r\n" +
+		"\r\n" +
+		body
+}
+
+func partialTestFragments() []string {
+	return []string{
+		partialTestFragment(
+			1,
+			"",
+			"Subject: Quarterly report\r\n"+
+				"Message-ID: <report@example.com>\r\n"+
+				"X-Dropped: enclosed\r\n"+
+				"MIME-Version: 1.0\r\n"+
+				"Content-Type: text/plain;\r\n"+
+				" charset=utf-8\r\n"+
+				"\r\n"+
+				"Line one\r\n",
+		),
+		partialTestFragment(2, "", "Line two\r\n"),
+		partialTestFragment(3, "3", "Line three\r\n"),
+	}
+}
+
+func TestReassembleFragments(t *testing.T) {
+	t.Parallel()
+
+	var fragments []letters.MessageFragment
+
+	for _, data := range partialTestFragments() {
+		email, err := letters.ParseEmail(strings.NewReader(data))
+		if err != nil {
+			t.Fatalf("cannot parse fragment: %s", err)
+		}
+
+		fragment, err := letters.NewMessageFragment(
+			email.Headers.ContentType,
+			[]byte(data),
+		)
+		if err != nil {
+			t.Fatalf("cannot read fragment: %s", err)
+		}
+
+		fragments = append([]letters.MessageFragment{fragment}, fragments...)
+	}
+
+	message, err := letters.ReassembleFragments(fragments)
+	if err != nil {
+		t.Fatalf("cannot reassemble fragments: %s", err)
+	}
+
+	expected := "From: Alice <alice@example.com>\r\n" +
+		"To: Bob <bob@example.com>\r\n" +
+		"Subject: Quarterly report\r\n" +
+		"Message-ID: <report@example.com>\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain;\r\n" +
+		" charset=utf-8\r\n" +
+		"\r\n" +
+		"Line one\r\n" +
+		"Line two\r\n" +
+		"Line three\r\n"
+
+	if string(message) != expected {
+		t.Errorf("expected message:\n%q\ngot:\n%q", expected, message)
+	}
+}
+
+func TestParseWithPartialStore(t *testing.T) {
+	t.Parallel()
+
+	store := letters.NewMemoryPartialStore(letters.MemoryPartialStoreOptions{})
+	parser := letters.NewEmailParser(letters.WithPartialStore(store))
+	fragments := partialTestFragments()
+
+	expectedPartials := []letters.PartialMessage{
+		{ID: "report@example.com", Number: 3, Total: 3, Received: 1},
+		{ID: "report@example.com", Number: 1, Total: 3, Received: 2},
+	}
+
+	for i, data := range []string{fragments[2], fragments[0]} {
+		email, err := parser.Parse(strings.NewReader(data))
+		if err != nil {
+			t.Fatalf("cannot parse fragment: %s", err)
+		}
+
+		if email.Partial == nil || *email.Partial != expectedPartials[i] {
+			t.Errorf("unexpected partial message: %#v", email.Partial)
+		}
+
+		if email.Text != "" {
+			t.Errorf("expected no text in fragment, got %q", email.Text)
+		}
+	}
+
+	email, err := parser.Parse(strings.NewReader(fragments[1]))
+	if err != nil {
+		t.Fatalf("cannot parse fragment: %s", err)
+	}
+
+	if email.Partial != nil ||
+		email.Headers.Subject != "Quarterly report" ||
+		email.Headers.MessageID != "report@example.com" ||
+		email.Headers.ContentType.ContentType != "text/plain" ||
+		strings.TrimSpace(email.Text) != "Line one\nLine two\nLine three" {
+		t.Errorf("unexpected reassembled email: %#v", email)
+	}
+
+	stored, err := store.AddFragment(letters.MessageFragment{
+		ID:     "report@example.com",
+		Number: 2,
+		Total:  0,
+		Data:   nil,
+	})
+	if err != nil || len(stored) != 1 {
+		t.Errorf("expected fragments to be deleted, got %d", len(stored))
+	}
+}
+
+func TestParseWithPartialStoreErrors(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name      string
+		fragments []string
+	}{
+		{
+			name: "no id",
+			fragments: []string{
+				"Content-Type: message/partial; number=1; total=1\r\n" +
+					"\r\n" +
+					"Subject: Report\r\n\r\nText\r\n",
+			},
+		},
+		{
+			name: "invalid number",
+			fragments: []string{
+				"Content-Type: message/partial; id=a; number=0\r\n" +
+					"\r\n" +
+					"Text\r\n",
+			},
+		},
+		{
+			name: "total below number",
+			fragments: []string{
+				"Content-Type: message/partial; id=a; number=3; total=2\r\n" +
+					"\r\n" +
+					"Text\r\n",
+			},
+		},
+		{
+			name: "conflicting totals",
+			fragments: []string{
+				"Content-Type: message/partial; id=a; number=1; total=3\r\n" +
+					"\r\n" +
+					"Subject: Report\r\n\r\nText\r\n",
+				"Content-Type: message/partial; id=a; number=2; total=2\r\n" +
+					"\r\n" +
+					"Text\r\n",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := letters.NewMemoryPartialStore(
+				letters.MemoryPartialStoreOptions{},
+			)
+			parser := letters.NewEmailParser(letters.WithPartialStore(store))
+
+			var err error
+
+			for _, fragment := range testCase.fragments {
+				_, err = parser.Parse(strings.NewReader(fragment))
+			}
+
+			if !errors.Is(err, letters.ErrInvalidPartial) {
+				t.Errorf("expected ErrInvalidPartial, got %v", err)
+			}
+
+			stored, err := store.AddFragment(letters.MessageFragment{
+				ID:     "a",
+				Number: 1,
+				Total:  0,
+				Data:   nil,
+			})
+			if err != nil || len(stored) != 1 {
+				t.Errorf("expected deleted fragments, got %d", len(stored))
+			}
+		})
+	}
+}
+
+func TestParseWithPartialStoreInconsistentFragments(t *testing.T) {
+	t.Parallel()
+
+	store := letters.NewMemoryPartialStore(letters.MemoryPartialStoreOptions{})
+	parser := letters.NewEmailParser(letters.WithPartialStore(store))
+	fragments := []string{
+		partialTestFragment(
+			1,
+			"",
+			"Subject: Report\r\n\r\nLine one\r\n",
+		),
+		partialTestFragment(2, "2", "Line two\r\n"),
+	}
+
+	// A bogus fragment makes the real fragments inconsistent. They are
+	// deleted, so that the message can be sent again.
+	for _, fragment := range []string{
+		partialTestFragment(5, "5", "Bogus\r\n"),
+		fragments[0],
+	} {
+		_, err := parser.Parse(strings.NewReader(fragment))
+		if err != nil {
+			t.Fatalf("cannot parse fragment: %s", err)
+		}
+	}
+
+	_, err := parser.Parse(strings.NewReader(fragments[1]))
+	if !errors.Is(err, letters.ErrInvalidPartial) {
+		t.Errorf("expected ErrInvalidPartial, got %v", err)
+	}
+
+	var email letters.Email
+
+	for _, fragment := range fragments {
+		email, err = parser.Parse(strings.NewReader(fragment))
+		if err != nil {
+			t.Fatalf("cannot parse fragment: %s", err)
+		}
+	}
+
+	if email.Partial != nil ||
+		strings.TrimSpace(email.Text) != "Line one\nLine two" {
+		t.Errorf("unexpected reassembled email: %#v", email)
+	}
+}
+
+func TestMemoryPartialStoreLimits(t *testing.T) {
+	t.Parallel()
+
+	fragment := func(id string, n int, data string) letters.MessageFragment {
+		return letters.MessageFragment{
+			ID:     id,
+			Number: n,
+			Total:  0,
+			Data:   []byte(data),
+		}
+	}
+
+	testCases := []struct {
+		name           string
+		options        letters.MemoryPartialStoreOptions
+		fragments      []letters.MessageFragment
+		wait           time.Duration
+		expectedError  error
+		expectedStored int
+	}{
+		{
+			name: "too many fragments",
+			options: letters.MemoryPartialStoreOptions{
+				MaxSize:      0,
+				MaxMessages:  0,
+				MaxFragments: 2,
+				TTL:          0,
+			},
+			fragments: []letters.MessageFragment{
+				fragment("a", 1, "x"),
+				fragment("a", 3, "x"),
+				fragment("a", 2, "x"),
+			},
+			wait:           0,
+			expectedError:  letters.ErrPartialTooLarge,
+			expectedStored: 1,
+		},
+		{
+			name: "message too large",
+			options: letters.MemoryPartialStoreOptions{
+				MaxSize:      4,
+				MaxMessages:  0,
+				MaxFragments: 0,
+				TTL:          0,
+			},
+			fragments: []letters.MessageFragment{
+				fragment("a", 1, "xxx"),
+				fragment("a", 2, "xx"),
+				fragment("a", 3, "x"),
+			},
+			wait:           0,
+			expectedError:  letters.ErrPartialTooLarge,
+			expectedStored: 1,
+		},
+		{
+			name: "store full",
+			options: letters.MemoryPartialStoreOptions{
+				MaxSize:      4,
+				MaxMessages:  0,
+				MaxFragments: 0,
+				TTL:          0,
+			},
+			fragments: []letters.MessageFragment{
+				fragment("a", 1, "xxx"),
+				fragment("b", 1, "xx"),
+				fragment("a", 2, "x"),
+			},
+			wait:           0,
+			expectedError:  nil,
+			expectedStored: 1,
+		},
+		{
+			name: "too many messages",
+			options: letters.MemoryPartialStoreOptions{
+				MaxSize:      0,
+				MaxMessages:  1,
+				MaxFragments: 0,
+				TTL:          0,
+			},
+			fragments: []letters.MessageFragment{
+				fragment("a", 1, "x"),
+				fragment("b", 1, "x"),
+				fragment("a", 2, "x"),
+			},
+			wait:           0,
+			expectedError:  nil,
+			expectedStored: 1,
+		},
+		{
+			name: "expired",
+			options: letters.MemoryPartialStoreOptions{
+				MaxSize:      0,
+				MaxMessages:  0,
+				MaxFragments: 0,
+				TTL:          time.Millisecond,
+			},
+			fragments: []letters.MessageFragment{
+				fragment("a", 1, "x"),
+				fragment("b", 1, "x"),
+				fragment("a", 2, "x"),
+			},
+			wait:           2 * time.Millisecond,
+			expectedError:  nil,
+			expectedStored: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := letters.NewMemoryPartialStore(testCase.options)
+
+			var err error
+
+			last := len(testCase.fragments) - 1
+
+			for _, f := range testCase.fragments[:last-1] {
+				_, err = store.AddFragment(f)
+				if err != nil {
+					t.Fatalf("cannot store fragment: %s", err)
+				}
+			}
+
+			time.Sleep(testCase.wait)
+
+			_, err = store.AddFragment(testCase.fragments[last-1])
+			if !errors.Is(err, testCase.expectedError) {
+				t.Errorf("expected %v, got %v", testCase.expectedError, err)
+			}
+
+			stored, err := store.AddFragment(testCase.fragments[last])
+			if err != nil || len(stored) != testCase.expectedStored {
+				t.Errorf("unexpected fragments: %#v, %v", stored, err)
+			}
+		})
+	}
+}
+
+func TestReassembleFragmentsIncomplete(t *testing.T) {
+	t.Parallel()
+
+	_, err := letters.ReassembleFragments([]letters.MessageFragment{
+		{
+			ID:     "a",
+			Number: 1,
+			Total:  0,
+			Data:   []byte("Subject: Report\r\n\r\nText\r\n"),
+		},
+		{
+			ID:     "a",
+			Number: 3,
+			Total:  3,
+			Data:   []byte("Text\r\n"),
+		},
+	})
+	if !errors.Is(err, letters.ErrInvalidPartial) {
+		t.Errorf("expected ErrInvalidPartial, got %v", err)
+	}
+}
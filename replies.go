@@ -0,0 +1,431 @@
+package letters
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const replyOutlookSeparatorLength = 20
+
+// ReplyBody is a reply split into the text its author wrote and the
+// history it carries.
+type ReplyBody struct {
+	// NewContent is what the author of the reply wrote.
+	NewContent string
+
+	// QuotedHistory is the quoted or forwarded earlier message, including
+	// its attribution line.
+	QuotedHistory string
+
+	// Signature is the signature of the author of the reply, without the
+	// separator.
+	Signature string
+}
+
+// EmailReply contains the plain-text and HTML bodies of an email split into
+// new content, quoted history and signature.
+type EmailReply struct {
+	Text ReplyBody
+	HTML ReplyBody
+}
+
+// SplitReply splits the plain-text and HTML bodies of the email with
+// SplitReplyText and SplitReplyHTML.
+func (e Email) SplitReply() (EmailReply, error) {
+	htmlReply, err := SplitReplyHTML(e.HTML)
+	if err != nil {
+		return EmailReply{}, fmt.Errorf(
+			"letters.replies.SplitReply: cannot split html body: %w",
+			err,
+		)
+	}
+
+	return EmailReply{
+		Text: SplitReplyText(e.Text),
+		HTML: htmlReply,
+	}, nil
+}
+
+// SplitReplyText splits a plain-text reply into new content, quoted history
+// and signature.
+//
+// The quoted history starts at the first attribution line such as "On ...
+// wrote:" (in English and several other languages), at an Outlook
+// "-----Original Message-----" or "From:"/"Sent:" header block, or at the
+// trailing block of lines quoted with ">". The signature starts at the last
+// "-- " separator before the quoted history.
+func SplitReplyText(s string) ReplyBody {
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+
+	quoteStart := findTextQuoteStart(lines)
+	content := lines[:quoteStart]
+
+	signatureStart := len(content)
+
+	for i := len(content) - 1; i >= 0; i-- {
+		if isSignatureSeparator(content[i]) {
+			signatureStart = i
+
+			break
+		}
+	}
+
+	reply := ReplyBody{
+		NewContent:    joinReplyLines(content[:signatureStart]),
+		QuotedHistory: joinReplyLines(lines[quoteStart:]),
+		Signature:     "",
+	}
+
+	if signatureStart < len(content) {
+		reply.Signature = joinReplyLines(content[signatureStart+1:])
+	}
+
+	return reply
+}
+
+func findTextQuoteStart(lines []string) int {
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+
+		if isAttributionLine(trimmed) || isOriginalMessageLine(trimmed) {
+			return i
+		}
+
+		// Attribution lines are often wrapped onto a second line.
+		if i+1 < len(lines) && !strings.HasPrefix(trimmed, ">") &&
+			isAttributionLine(trimmed+" "+strings.TrimSpace(lines[i+1])) {
+			return i
+		}
+
+		if isOutlookHeaderBlock(lines[i:]) {
+			return i
+		}
+
+		if isOutlookSeparator(trimmed) && i+1 < len(lines) &&
+			isOutlookHeaderBlock(lines[i+1:]) {
+			return i
+		}
+	}
+
+	// Otherwise the history is the trailing block of quoted lines.
+	quoteStart := len(lines)
+
+	for i := len(lines) - 1; i >= 0; i-- {
+		trimmed := strings.TrimSpace(lines[i])
+
+		switch {
+		case strings.HasPrefix(trimmed, ">"):
+			quoteStart = i
+		case trimmed == "":
+		default:
+			return quoteStart
+		}
+	}
+
+	return quoteStart
+}
+
+func joinReplyLines(lines []string) string {
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func isSignatureSeparator(line string) bool {
+	return line == "-- " || line == "--"
+}
+
+// attributionPatterns returns the opening words and verbs of "On <date>,
+// <name> wrote:" lines in common languages. An empty prefix matches lines
+// in languages where the attribution does not start with a fixed word.
+func attributionPatterns() [][2]string {
+	return [][2]string{
+		{"on ", "wrote"},
+		{"am ", "schrieb"},
+		{"le ", "a écrit"},
+		{"el ", "escribió"},
+		{"il ", "ha scritto"},
+		{"op ", "schreef"},
+		{"em ", "escreveu"},
+		{"den ", "skrev"},
+		{"w dniu ", "napisał"},
+		{"", "kirjoitti"},
+		{"", "написал"},
+		{"", "書きました"},
+		{"", "写道"},
+		{"", "작성"},
+	}
+}
+
+func isAttributionLine(line string) bool {
+	if !strings.HasSuffix(line, ":") && !strings.HasSuffix(line, "：") {
+		return false
+	}
+
+	lower := strings.ToLower(line)
+
+	for _, pattern := range attributionPatterns() {
+		if strings.HasPrefix(lower, pattern[0]) &&
+			strings.Contains(lower, pattern[1]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isOriginalMessageLine(line string) bool {
+	if !strings.HasPrefix(line, "---") {
+		return false
+	}
+
+	return slices.Contains([]string{
+		"original message",
+		"forwarded message",
+		"ursprüngliche nachricht",
+		"message d'origine",
+		"mensaje original",
+		"messaggio originale",
+		"oorspronkelijk bericht",
+		"mensagem original",
+	}, strings.ToLower(strings.Trim(line, "- ")))
+}
+
+func isOutlookSeparator(line string) bool {
+	return len(line) >= replyOutlookSeparatorLength &&
+		strings.Trim(line, "_") == ""
+}
+
+func isOutlookHeaderBlock(lines []string) bool {
+	if len(lines) < 2 || !strings.HasPrefix(lines[0], "From: ") {
+		return false
+	}
+
+	return strings.HasPrefix(lines[1], "Sent: ") ||
+		strings.HasPrefix(lines[1], "Date: ")
+}
+
+// SplitReplyHTML splits an HTML reply into new content, quoted history and
+// signature, each an HTML fragment.
+//
+// The quoted history starts at Gmail gmail_quote, Apple and Thunderbird
+// blockquote type=cite, Outlook divRplyFwdMsg and Yahoo yahoo_quoted markup,
+// or at a block whose text is an attribution or original message line as
+// recognized by SplitReplyText. The signature starts at Gmail, Thunderbird
+// or Outlook signature markup or at a "-- " separator.
+func SplitReplyHTML(s string) (ReplyBody, error) {
+	if s == "" {
+		return ReplyBody{}, nil
+	}
+
+	document, err := html.Parse(strings.NewReader(s))
+	if err != nil {
+		return ReplyBody{}, fmt.Errorf(
+			"letters.replies.SplitReplyHTML: cannot parse HTML: %w",
+			err,
+		)
+	}
+
+	body := findHTMLElement(document, atom.Body)
+	if body == nil {
+		body = document
+	}
+
+	var reply ReplyBody
+
+	quoteStart := findHTMLNode(body, isHTMLQuoteStart)
+	if quoteStart != nil {
+		reply.QuotedHistory, err = renderHTMLNodes(
+			extractHTMLNodesFrom(body, quoteStart),
+		)
+		if err != nil {
+			return ReplyBody{}, err
+		}
+	}
+
+	signatureStart := findHTMLNode(body, isHTMLSignatureStart)
+	if signatureStart != nil {
+		signature := extractHTMLNodesFrom(body, signatureStart)
+		// Leave out the separator itself.
+		if signatureStart.Type == html.TextNode ||
+			hasHTMLClass(signatureStart, "gmail_signature_prefix") {
+			signature = signature[1:]
+		}
+
+		reply.Signature, err = renderHTMLNodes(signature)
+		if err != nil {
+			return ReplyBody{}, err
+		}
+	}
+
+	var content []*html.Node
+	for child := body.FirstChild; child != nil; child = child.NextSibling {
+		content = append(content, child)
+	}
+
+	reply.NewContent, err = renderHTMLNodes(content)
+	if err != nil {
+		return ReplyBody{}, err
+	}
+
+	return reply, nil
+}
+
+func isHTMLQuoteStart(node *html.Node) bool {
+	if node.Type != html.ElementNode {
+		return false
+	}
+
+	if hasHTMLClass(
+		node,
+		"gmail_quote",
+		"gmail_quote_container",
+		"yahoo_quoted",
+		"moz-cite-prefix",
+	) {
+		return true
+	}
+
+	switch htmlAttribute(node, "id") {
+	case "appendonsend", "divRplyFwdMsg":
+		return true
+	}
+
+	if node.DataAtom == atom.Blockquote &&
+		strings.EqualFold(htmlAttribute(node, "type"), "cite") {
+		return true
+	}
+
+	switch node.DataAtom {
+	case atom.Div, atom.P:
+		text := strings.Join(strings.Fields(htmlNodeText(node)), " ")
+
+		return isAttributionLine(text) || isOriginalMessageLine(text)
+	default:
+		return false
+	}
+}
+
+func isHTMLSignatureStart(node *html.Node) bool {
+	if node.Type == html.TextNode {
+		return isSignatureSeparator(strings.TrimSpace(node.Data))
+	}
+
+	if node.Type != html.ElementNode {
+		return false
+	}
+
+	return hasHTMLClass(
+		node,
+		"gmail_signature_prefix",
+		"gmail_signature",
+		"moz-signature",
+	) ||
+		htmlAttribute(node, "data-smartmail") == "gmail_signature" ||
+		htmlAttribute(node, "id") == "Signature"
+}
+
+func hasHTMLClass(node *html.Node, classes ...string) bool {
+	for _, class := range strings.Fields(htmlAttribute(node, "class")) {
+		if slices.Contains(classes, class) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func htmlNodeText(node *html.Node) string {
+	if node.Type == html.TextNode {
+		return node.Data
+	}
+
+	var b strings.Builder
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		b.WriteString(htmlNodeText(child))
+		b.WriteByte(' ')
+	}
+
+	return b.String()
+}
+
+func findHTMLElement(node *html.Node, a atom.Atom) *html.Node {
+	return findHTMLNode(node, func(n *html.Node) bool {
+		return n.Type == html.ElementNode && n.DataAtom == a
+	})
+}
+
+// findHTMLNode returns the first node below root in document order for
+// which match returns true.
+func findHTMLNode(root *html.Node, match func(*html.Node) bool) *html.Node {
+	for child := root.FirstChild; child != nil; child = child.NextSibling {
+		if match(child) {
+			return child
+		}
+
+		if found := findHTMLNode(child, match); found != nil {
+			return found
+		}
+	}
+
+	return nil
+}
+
+// extractHTMLNodesFrom removes node and everything that follows it in
+// document order below root, and returns the removed nodes in order.
+func extractHTMLNodesFrom(root *html.Node, node *html.Node) []*html.Node {
+	var extracted []*html.Node
+
+	for current := node; current != nil; {
+		parent := current.Parent
+
+		for sibling := current; sibling != nil; {
+			next := sibling.NextSibling
+
+			parent.RemoveChild(sibling)
+			extracted = append(extracted, sibling)
+
+			sibling = next
+		}
+
+		// Continue with the content that follows the closest ancestor
+		// that has any.
+		current = nil
+
+		for ancestor := parent; ancestor != root; ancestor = ancestor.Parent {
+			if ancestor.NextSibling != nil {
+				current = ancestor.NextSibling
+
+				break
+			}
+		}
+	}
+
+	return extracted
+}
+
+func renderHTMLNodes(nodes []*html.Node) (string, error) {
+	var b strings.Builder
+
+	for _, node := range nodes {
+		err := html.Render(&b, node)
+		if err != nil {
+			return "", fmt.Errorf(
+				"letters.replies.renderHTMLNodes: cannot render HTML: %w",
+				err,
+			)
+		}
+	}
+
+	return strings.TrimSpace(b.String()), nil
+}
@@ -0,0 +1,207 @@
+package letters_test
+
+import (
+	"testing"
+
+	"github.com/mnako/letters"
+)
+
+func TestSplitReplyText(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		text     string
+		expected letters.ReplyBody
+	}{
+		{
+			name: "attribution and quoted lines",
+			text: "Sounds good.\n" +
+				"\n" +
+				"-- \n" +
+				"Bob\n" +
+				"\n" +
+				"On Mon, 1 Apr 2019 at 07:55, " +
+				"Alice <alice@example.com> wrote:\n" +
+				"> Shall we meet?\n" +
+				">\n" +
+				"> -- \n" +
+				"> Alice\n",
+			expected: letters.ReplyBody{
+				NewContent: "Sounds good.",
+				QuotedHistory: "On Mon, 1 Apr 2019 at 07:55, " +
+					"Alice <alice@example.com> wrote:\n" +
+					"> Shall we meet?\n" +
+					">\n" +
+					"> -- \n" +
+					"> Alice",
+				Signature: "Bob",
+			},
+		},
+		{
+			name: "wrapped attribution",
+			text: "Yes.\n\nOn Mon, 1 Apr 2019 at 07:55, Alice Sender\n" +
+				"<alice@example.com> wrote:\n> Shall we meet?",
+			expected: letters.ReplyBody{
+				NewContent: "Yes.",
+				QuotedHistory: "On Mon, 1 Apr 2019 at 07:55, Alice Sender\n" +
+					"<alice@example.com> wrote:\n> Shall we meet?",
+				Signature: "",
+			},
+		},
+		{
+			name: "german attribution",
+			text: "Ja.\n\nAm 01.04.2019 um 07:55 schrieb Alice " +
+				"<alice@example.com>:\n> Treffen wir uns?",
+			expected: letters.ReplyBody{
+				NewContent: "Ja.",
+				QuotedHistory: "Am 01.04.2019 um 07:55 schrieb Alice " +
+					"<alice@example.com>:\n> Treffen wir uns?",
+				Signature: "",
+			},
+		},
+		{
+			name: "outlook original message",
+			text: "Done.\n\n-----Original Message-----\n" +
+				"From: Alice\nSent: Monday\n\nPlease do it.",
+			expected: letters.ReplyBody{
+				NewContent: "Done.",
+				QuotedHistory: "-----Original Message-----\n" +
+					"From: Alice\nSent: Monday\n\nPlease do it.",
+				Signature: "",
+			},
+		},
+		{
+			name: "outlook header block",
+			text: "Done.\n\n________________________________\n" +
+				"From: Alice\nSent: Monday\n\nPlease do it.",
+			expected: letters.ReplyBody{
+				NewContent: "Done.",
+				QuotedHistory: "________________________________\n" +
+					"From: Alice\nSent: Monday\n\nPlease do it.",
+				Signature: "",
+			},
+		},
+		{
+			name: "interleaved quotes stay in the new content",
+			text: "> Question one?\nAnswer one.\n> Question two?\n",
+			expected: letters.ReplyBody{
+				NewContent:    "> Question one?\nAnswer one.",
+				QuotedHistory: "> Question two?",
+				Signature:     "",
+			},
+		},
+		{
+			name: "no history",
+			text: "Just a message.\n--\nBob",
+			expected: letters.ReplyBody{
+				NewContent:    "Just a message.",
+				QuotedHistory: "",
+				Signature:     "Bob",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			reply := letters.SplitReplyText(testCase.text)
+			if reply != testCase.expected {
+				t.Errorf(
+					"unexpected reply:\ngot:      %#v\nexpected: %#v",
+					reply,
+					testCase.expected,
+				)
+			}
+		})
+	}
+}
+
+func TestSplitReplyHTML(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		html     string
+		expected letters.ReplyBody
+	}{
+		{
+			name: "gmail",
+			html: "<div dir=\"ltr\">Sounds good.<br clear=\"all\"><br>" +
+				"<span class=\"gmail_signature_prefix\">-- </span><br>" +
+				"<div class=\"gmail_signature\">Bob</div></div>" +
+				"<br><div class=\"gmail_quote\">" +
+				"<div class=\"gmail_attr\">On Mon, Alice wrote:<br></div>" +
+				"<blockquote class=\"gmail_quote\">Shall we meet?" +
+				"</blockquote></div>",
+			expected: letters.ReplyBody{
+				NewContent: "<div dir=\"ltr\">Sounds good." +
+					"<br clear=\"all\"/><br/></div>",
+				QuotedHistory: "<div class=\"gmail_quote\">" +
+					"<div class=\"gmail_attr\">" +
+					"On Mon, Alice wrote:<br/></div>" +
+					"<blockquote class=\"gmail_quote\">Shall we meet?" +
+					"</blockquote></div>",
+				Signature: "<br/><div class=\"gmail_signature\">Bob</div><br/>",
+			},
+		},
+		{
+			name: "apple",
+			html: "<div>Yes.</div><div><br><blockquote type=\"cite\">" +
+				"<div>On 1 Apr 2019, at 07:55, Alice wrote:</div><br>" +
+				"<div>Shall we meet?</div></blockquote></div>",
+			expected: letters.ReplyBody{
+				NewContent: "<div>Yes.</div><div><br/></div>",
+				QuotedHistory: "<blockquote type=\"cite\">" +
+					"<div>On 1 Apr 2019, at 07:55, Alice wrote:</div><br/>" +
+					"<div>Shall we meet?</div></blockquote>",
+				Signature: "",
+			},
+		},
+		{
+			name: "outlook",
+			html: "<div>Done.</div><div id=\"Signature\">Bob</div>" +
+				"<hr><div id=\"divRplyFwdMsg\"><b>From:</b> Alice</div>" +
+				"<div>Please do it.</div>",
+			expected: letters.ReplyBody{
+				NewContent: "<div>Done.</div>",
+				QuotedHistory: "<div id=\"divRplyFwdMsg\"><b>From:</b> Alice" +
+					"</div><div>Please do it.</div>",
+				Signature: "<div id=\"Signature\">Bob</div><hr/>",
+			},
+		},
+		{
+			name: "attribution paragraph",
+			html: "<p>Fine.</p><p>On Monday, Alice wrote:</p>" +
+				"<blockquote>Shall we meet?</blockquote>",
+			expected: letters.ReplyBody{
+				NewContent: "<p>Fine.</p>",
+				QuotedHistory: "<p>On Monday, Alice wrote:</p>" +
+					"<blockquote>Shall we meet?</blockquote>",
+				Signature: "",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			reply, err := letters.SplitReplyHTML(testCase.html)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if reply != testCase.expected {
+				t.Errorf(
+					"unexpected reply:\ngot:      %#v\nexpected: %#v",
+					reply,
+					testCase.expected,
+				)
+			}
+		})
+	}
+}
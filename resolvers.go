@@ -0,0 +1,33 @@
+package letters
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// TXTResolver looks up DNS TXT records.
+//
+// *net.Resolver satisfies TXTResolver. Tests and offline callers can supply
+// their own implementation backed by static data.
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// DNSResolver looks up the DNS records needed to evaluate SPF and DMARC.
+//
+// *net.Resolver satisfies DNSResolver. Implementations should return a
+// *net.DNSError with IsNotFound set when a name does not exist, so that
+// lookups of missing names are not reported as temporary errors.
+type DNSResolver interface {
+	TXTResolver
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+}
+
+func isDNSNotFound(err error) bool {
+	var dnsErr *net.DNSError
+
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
@@ -0,0 +1,587 @@
+package letters
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"io"
+	"path"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// AttachmentRiskKind is the kind of a finding of AnalyzeAttachmentRisk.
+type AttachmentRiskKind string
+
+// Kinds of findings reported by AnalyzeAttachmentRisk.
+const (
+	AttachmentRiskRightToLeft AttachmentRiskKind = "right-to-left override"
+
+	AttachmentRiskDoubleExtension    AttachmentRiskKind = "double extension"
+	AttachmentRiskDangerousExtension AttachmentRiskKind = "dangerous extension"
+	AttachmentRiskOOXMLMacros        AttachmentRiskKind = "OOXML macros"
+	AttachmentRiskOLEMacros          AttachmentRiskKind = "OLE macros"
+	AttachmentRiskPDFJavaScript      AttachmentRiskKind = "PDF JavaScript"
+	AttachmentRiskPDFLaunch          AttachmentRiskKind = "PDF launch action"
+	AttachmentRiskPDFUninspected     AttachmentRiskKind = "PDF uninspected"
+	AttachmentRiskHTMLForm           AttachmentRiskKind = "HTML form"
+	AttachmentRiskHTMLScript         AttachmentRiskKind = "HTML script"
+)
+
+// RiskSeverity ranks findings of AnalyzeAttachmentRisk.
+type RiskSeverity int
+
+// Severities of findings, from the lowest.
+const (
+	RiskSeverityNone RiskSeverity = iota
+	RiskSeverityLow
+	RiskSeverityMedium
+	RiskSeverityHigh
+)
+
+// String returns the lower-case name of the severity.
+func (s RiskSeverity) String() string {
+	switch s {
+	case RiskSeverityNone:
+		return "none"
+	case RiskSeverityLow:
+		return "low"
+	case RiskSeverityMedium:
+		return "medium"
+	case RiskSeverityHigh:
+		return "high"
+	default:
+		return "unknown"
+	}
+}
+
+// AttachmentRisk is a finding of AnalyzeAttachmentRisk.
+type AttachmentRisk struct {
+	Kind     AttachmentRiskKind
+	Severity RiskSeverity
+
+	// Detail is what triggered the finding, for example the extension, the
+	// name of the macro stream, the PDF name or the HTML element.
+	Detail string
+}
+
+// AttachmentRiskAnalysis is the result of AnalyzeAttachmentRisk.
+type AttachmentRiskAnalysis struct {
+	// Filename is the decoded file name. See AttachedFile.Filename.
+	Filename string
+
+	// ContentType is the media type detected from the content. See
+	// DetectContentType.
+	ContentType string
+
+	// Findings lists the findings in a fixed order: file name findings
+	// first, then content findings.
+	Findings []AttachmentRisk
+}
+
+// Severity returns the highest severity of the findings, or
+// RiskSeverityNone when there are none.
+func (a AttachmentRiskAnalysis) Severity() RiskSeverity {
+	severity := RiskSeverityNone
+
+	for _, finding := range a.Findings {
+		severity = max(severity, finding.Severity)
+	}
+
+	return severity
+}
+
+// AnalyzeFileRisks analyzes the inline and attached files of the email
+// with AnalyzeAttachmentRisk, inline files first.
+func (e Email) AnalyzeFileRisks() []AttachmentRiskAnalysis {
+	analyses := make(
+		[]AttachmentRiskAnalysis,
+		0,
+		len(e.InlineFiles)+len(e.AttachedFiles),
+	)
+
+	for _, file := range e.InlineFiles {
+		analyses = append(analyses, file.AnalyzeRisk())
+	}
+
+	for _, file := range e.AttachedFiles {
+		analyses = append(analyses, file.AnalyzeRisk())
+	}
+
+	return analyses
+}
+
+// AnalyzeRisk analyzes the inline file with AnalyzeAttachmentRisk.
+func (f InlineFile) AnalyzeRisk() AttachmentRiskAnalysis {
+	return AnalyzeAttachmentRisk(
+		f.Filename().Name,
+		f.ContentType.ContentType,
+		f.Data,
+	)
+}
+
+// AnalyzeRisk analyzes the attached file with AnalyzeAttachmentRisk.
+func (f AttachedFile) AnalyzeRisk() AttachmentRiskAnalysis {
+	return AnalyzeAttachmentRisk(
+		f.Filename().Name,
+		f.ContentType.ContentType,
+		f.Data,
+	)
+}
+
+// AnalyzeAttachmentRisk statically analyzes a file for common signs of
+// malware and phishing, without running or fully parsing it:
+//
+//   - right-to-left override characters in the file name, which disguise
+//     the real extension (high)
+//   - extensions that Windows runs or mounts, such as .exe, .js, .lnk, .iso
+//     and .one (high)
+//   - a dangerous extension after a document extension, such as
+//     "invoice.pdf.exe" (high)
+//   - OOXML documents with a vbaProject.bin macro project (medium)
+//   - OLE compound documents, such as .doc and .xls files, with a VBA
+//     project (medium)
+//   - PDF files with JavaScript (medium) or launch actions (high), also
+//     when their names are hex-escaped or in FlateDecode object streams;
+//     object streams that cannot be inflated are reported as uninspected
+//     (low)
+//   - HTML files with forms (medium) or scripts and event handlers (low)
+//
+// The checks of the content use the detected media type, so they also apply
+// to files with a misleading name or declared media type.
+func AnalyzeAttachmentRisk(
+	filename string,
+	declaredContentType string,
+	data []byte,
+) AttachmentRiskAnalysis {
+	analysis := AttachmentRiskAnalysis{
+		Filename:    filename,
+		ContentType: DetectContentType(data),
+		Findings:    nil,
+	}
+
+	analysis.Findings = append(
+		analysis.Findings,
+		filenameRisks(filename)...,
+	)
+
+	switch {
+	case isZipBasedContentType(analysis.ContentType) ||
+		analysis.ContentType == "application/zip":
+		analysis.Findings = append(analysis.Findings, ooxmlRisks(data)...)
+	case analysis.ContentType == "application/x-ole-storage":
+		analysis.Findings = append(analysis.Findings, oleRisks(data)...)
+	case analysis.ContentType == "application/pdf":
+		analysis.Findings = append(analysis.Findings, pdfRisks(data)...)
+	case analysis.ContentType == "text/html" ||
+		canonicalContentType(declaredContentType) == "text/html" ||
+		extensionContentType(filename) == "text/html":
+		analysis.Findings = append(analysis.Findings, htmlRisks(data)...)
+	default:
+	}
+
+	return analysis
+}
+
+// filenameRisks checks a file name for right-to-left overrides, dangerous
+// extensions and double extensions.
+func filenameRisks(filename string) []AttachmentRisk {
+	var risks []AttachmentRisk
+
+	for _, r := range filename {
+		if isBidiOverride(r) {
+			risks = append(risks, AttachmentRisk{
+				Kind:     AttachmentRiskRightToLeft,
+				Severity: RiskSeverityHigh,
+				Detail:   filename,
+			})
+
+			break
+		}
+	}
+
+	// The sanitized name has the override characters removed, so the
+	// extension is the one that Windows sees.
+	name := SanitizeFilename(filename)
+
+	extension := strings.ToLower(path.Ext(name))
+	if !isDangerousExtension(extension) {
+		return risks
+	}
+
+	risks = append(risks, AttachmentRisk{
+		Kind:     AttachmentRiskDangerousExtension,
+		Severity: RiskSeverityHigh,
+		Detail:   extension,
+	})
+
+	stem := strings.TrimRight(strings.TrimSuffix(name, path.Ext(name)), " ")
+	decoy := strings.ToLower(path.Ext(stem))
+
+	if extensionContentType(stem) != "" && !isDangerousExtension(decoy) {
+		risks = append(risks, AttachmentRisk{
+			Kind:     AttachmentRiskDoubleExtension,
+			Severity: RiskSeverityHigh,
+			Detail:   decoy + extension,
+		})
+	}
+
+	return risks
+}
+
+// isBidiOverride reports whether a character changes the direction of the
+// text that follows it.
+func isBidiOverride(r rune) bool {
+	switch r {
+	case '\u202a', '\u202b', '\u202d', '\u202e',
+		'\u2066', '\u2067', '\u2068':
+		return true
+	default:
+		return false
+	}
+}
+
+// isDangerousExtension reports whether Windows runs, installs or mounts
+// files with a lower-case extension, or opens them in an application that
+// runs embedded code.
+func isDangerousExtension(extension string) bool {
+	switch extension {
+	case ".exe", ".com", ".scr", ".pif", ".cpl", ".dll", ".msi", ".msp",
+		".bat", ".cmd", ".ps1", ".psm1", ".vbs", ".vbe", ".js", ".jse",
+		".wsf", ".wsh", ".hta", ".jar", ".reg", ".lnk", ".url", ".scf",
+		".chm", ".iso", ".img", ".vhd", ".vhdx", ".one", ".appx",
+		".msix", ".application", ".gadget", ".xll":
+		return true
+	default:
+		return false
+	}
+}
+
+// ooxmlRisks checks an OOXML document for a VBA project.
+func ooxmlRisks(data []byte) []AttachmentRisk {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil
+	}
+
+	var risks []AttachmentRisk
+
+	for _, file := range reader.File {
+		if strings.EqualFold(path.Base(file.Name), "vbaProject.bin") {
+			risks = append(risks, AttachmentRisk{
+				Kind:     AttachmentRiskOOXMLMacros,
+				Severity: RiskSeverityMedium,
+				Detail:   file.Name,
+			})
+		}
+	}
+
+	return risks
+}
+
+// oleRisks checks an OLE compound document for a VBA project by searching
+// the UTF-16 names of its directory entries.
+func oleRisks(data []byte) []AttachmentRisk {
+	// Directory entry names are null-terminated.
+	pattern := append(utf16LEString("_VBA_PROJECT"), 0, 0)
+	if !bytes.Contains(data, pattern) {
+		return nil
+	}
+
+	return []AttachmentRisk{{
+		Kind:     AttachmentRiskOLEMacros,
+		Severity: RiskSeverityMedium,
+		Detail:   "_VBA_PROJECT",
+	}}
+}
+
+func utf16LEString(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	encoded := make([]byte, 0, 2*len(units))
+
+	for _, unit := range units {
+		encoded = append(encoded, byte(unit), byte(unit>>8))
+	}
+
+	return encoded
+}
+
+// pdfMaxInflatedSize limits the total size of the object streams that are
+// inflated for one PDF file.
+const pdfMaxInflatedSize = 32 << 20
+
+// pdfRisks checks a PDF file for JavaScript and launch actions.
+func pdfRisks(data []byte) []AttachmentRisk {
+	names, inspected := pdfNames(data)
+
+	var risks []AttachmentRisk
+
+	for _, name := range []string{"JavaScript", "JS"} {
+		if names[name] {
+			risks = append(risks, AttachmentRisk{
+				Kind:     AttachmentRiskPDFJavaScript,
+				Severity: RiskSeverityMedium,
+				Detail:   "/" + name,
+			})
+
+			break
+		}
+	}
+
+	if names["Launch"] {
+		risks = append(risks, AttachmentRisk{
+			Kind:     AttachmentRiskPDFLaunch,
+			Severity: RiskSeverityHigh,
+			Detail:   "/Launch",
+		})
+	}
+
+	if !inspected {
+		risks = append(risks, AttachmentRisk{
+			Kind:     AttachmentRiskPDFUninspected,
+			Severity: RiskSeverityLow,
+			Detail:   "/ObjStm",
+		})
+	}
+
+	return risks
+}
+
+// pdfNames returns the name objects of a PDF file, with #xx escapes
+// decoded, in its uncompressed parts and in its FlateDecode object streams.
+// It reports false when an object stream uses another filter, does not
+// inflate, or exceeds pdfMaxInflatedSize, so that names in it may be
+// missing.
+func pdfNames(data []byte) (map[string]bool, bool) {
+	names := make(map[string]bool)
+	addPDFNames(names, data)
+
+	inspected := true
+	limit := pdfMaxInflatedSize
+
+	for _, stream := range pdfStreams(data) {
+		dictionary := make(map[string]bool)
+		addPDFNames(dictionary, stream.dictionary)
+
+		if !dictionary["ObjStm"] {
+			continue
+		}
+
+		inflated, ok := inflatePDFStream(dictionary, stream.data, limit)
+		limit -= len(inflated)
+
+		addPDFNames(names, inflated)
+
+		inspected = inspected && ok
+	}
+
+	return names, inspected
+}
+
+func addPDFNames(names map[string]bool, data []byte) {
+	for i := 0; i < len(data); i++ {
+		if data[i] != '/' {
+			continue
+		}
+
+		end := i + 1
+		for end < len(data) && !isPDFDelimiter(data[end]) {
+			end++
+		}
+
+		names[decodePDFName(data[i+1:end])] = true
+		i = end - 1
+	}
+}
+
+// pdfStream is a stream object of a PDF file.
+type pdfStream struct {
+	dictionary []byte
+	data       []byte
+}
+
+// pdfStreams returns the stream objects of a PDF file. The data of a stream
+// ends at the next endstream keyword, as /Length may be an indirect object.
+func pdfStreams(data []byte) []pdfStream {
+	var (
+		streams       []pdfStream
+		starts        []int
+		dictionary    []byte
+		dictionaryEnd = -1
+	)
+
+	for i := 0; i < len(data); i++ {
+		switch {
+		case bytes.HasPrefix(data[i:], []byte("<<")):
+			starts = append(starts, i)
+			dictionaryEnd = -1
+			i++
+		case bytes.HasPrefix(data[i:], []byte(">>")):
+			if len(starts) > 0 {
+				dictionary = data[starts[len(starts)-1] : i+2]
+				starts = starts[:len(starts)-1]
+				dictionaryEnd = i + 2
+			}
+
+			i++
+		case dictionaryEnd >= 0 && bytes.HasPrefix(data[i:], []byte("stream")):
+			start := i + len("stream")
+			if bytes.HasPrefix(data[start:], []byte("\r\n")) {
+				start += 2
+			} else if start < len(data) && data[start] == '\n' {
+				start++
+			}
+
+			end := bytes.Index(data[start:], []byte("endstream"))
+			if end < 0 {
+				end = len(data) - start
+			}
+
+			streams = append(streams, pdfStream{
+				dictionary: dictionary,
+				data:       data[start : start+end],
+			})
+
+			starts = starts[:0]
+			dictionaryEnd = -1
+			i = start + end + len("endstream") - 1
+		case dictionaryEnd >= 0 && !isPDFWhitespace(data[i]):
+			dictionaryEnd = -1
+		default:
+		}
+	}
+
+	return streams
+}
+
+// inflatePDFStream decodes a stream whose only filter is FlateDecode
+// without a predictor. It returns at most limit bytes, and false when the
+// stream cannot be decoded completely.
+func inflatePDFStream(
+	dictionary map[string]bool,
+	data []byte,
+	limit int,
+) ([]byte, bool) {
+	filters := 0
+
+	for _, filter := range []string{
+		"FlateDecode", "Fl",
+		"ASCIIHexDecode", "AHx",
+		"ASCII85Decode", "A85",
+		"LZWDecode", "LZW",
+		"RunLengthDecode", "RL",
+		"CCITTFaxDecode", "CCF",
+		"DCTDecode", "DCT",
+		"JBIG2Decode", "JPXDecode", "Crypt",
+	} {
+		if dictionary[filter] {
+			filters++
+		}
+	}
+
+	if filters != 1 || !(dictionary["FlateDecode"] || dictionary["Fl"]) ||
+		dictionary["Predictor"] || limit <= 0 {
+		return nil, false
+	}
+
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, false
+	}
+
+	inflated, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil || len(inflated) > limit {
+		return inflated[:min(len(inflated), limit)], false
+	}
+
+	return inflated, true
+}
+
+func isPDFWhitespace(c byte) bool {
+	return strings.IndexByte("\x00\t\n\f\r ", c) >= 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("\x00\t\n\f\r ()<>[]{}/%", c) >= 0
+}
+
+func decodePDFName(name []byte) string {
+	var b strings.Builder
+
+	for i := 0; i < len(name); i++ {
+		if name[i] == '#' && i+2 < len(name) {
+			decoded, err := hex.DecodeString(string(name[i+1 : i+3]))
+			if err == nil {
+				b.Write(decoded)
+
+				i += 2
+
+				continue
+			}
+		}
+
+		b.WriteByte(name[i])
+	}
+
+	return b.String()
+}
+
+// htmlRisks checks an HTML file for forms, scripts and event handlers.
+func htmlRisks(data []byte) []AttachmentRisk {
+	document, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+
+	var risks []AttachmentRisk
+
+	if forms := findHTMLElements(document, atom.Form); len(forms) > 0 {
+		risks = append(risks, AttachmentRisk{
+			Kind:     AttachmentRiskHTMLForm,
+			Severity: RiskSeverityMedium,
+			Detail:   htmlAttribute(forms[0], "action"),
+		})
+	}
+
+	if len(findHTMLElements(document, atom.Script)) > 0 {
+		return append(risks, AttachmentRisk{
+			Kind:     AttachmentRiskHTMLScript,
+			Severity: RiskSeverityLow,
+			Detail:   "script",
+		})
+	}
+
+	if handler := findHTMLEventHandler(document); handler != "" {
+		risks = append(risks, AttachmentRisk{
+			Kind:     AttachmentRiskHTMLScript,
+			Severity: RiskSeverityLow,
+			Detail:   handler,
+		})
+	}
+
+	return risks
+}
+
+// findHTMLEventHandler returns the name of the first event handler
+// attribute in the tree, or an empty string.
+func findHTMLEventHandler(root *html.Node) string {
+	for child := root.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode {
+			for _, attribute := range child.Attr {
+				if strings.HasPrefix(strings.ToLower(attribute.Key), "on") {
+					return attribute.Key
+				}
+			}
+		}
+
+		if handler := findHTMLEventHandler(child); handler != "" {
+			return handler
+		}
+	}
+
+	return ""
+}
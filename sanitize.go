@@ -0,0 +1,820 @@
+package letters
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// HTMLRemovalReason describes why SanitizeHTML removed something.
+type HTMLRemovalReason string
+
+// Reasons for removals reported by SanitizeHTML.
+const (
+	HTMLRemovalElement     HTMLRemovalReason = "disallowed element"
+	HTMLRemovalAttribute   HTMLRemovalReason = "disallowed attribute"
+	HTMLRemovalURL         HTMLRemovalReason = "unsafe URL"
+	HTMLRemovalRemoteImage HTMLRemovalReason = "remote image"
+	HTMLRemovalCSS         HTMLRemovalReason = "unsafe CSS"
+)
+
+// HTMLRemoval records an element, attribute or CSS declaration that
+// SanitizeHTML removed.
+type HTMLRemoval struct {
+	Reason HTMLRemovalReason
+
+	// Element is the name of the element the removal happened in.
+	Element string
+
+	// Attribute is the name of the removed attribute, or "style" for CSS
+	// removed from a style attribute. It is empty when the whole element
+	// was removed.
+	Attribute string
+
+	// Value is the removed attribute value, URL or CSS declaration.
+	Value string
+}
+
+// HTMLSanitizeOptions configures SanitizeHTML.
+type HTMLSanitizeOptions struct {
+	// BlockRemoteImages removes images and CSS backgrounds loaded from
+	// http and https URLs, which are commonly used to track when a
+	// message is opened.
+	BlockRemoteImages bool
+
+	// StyleScope is the CSS selector of the element the caller renders the
+	// sanitized HTML in, for example "#message". When it is set, the rules
+	// of style elements are sanitized, scoped to that selector and kept in
+	// a single style element at the start of the result. When it is empty,
+	// style elements are removed; style attributes are sanitized either
+	// way.
+	StyleScope string
+
+	// InlineFiles and ContentIDRewriter rewrite cid: URLs that refer to
+	// one of the inline files, for example with InlineFileDataURI. Other
+	// cid: URLs are kept.
+	InlineFiles       []InlineFile
+	ContentIDRewriter ContentIDRewriter
+}
+
+// SanitizedHTML is the result of SanitizeHTML.
+type SanitizedHTML struct {
+	// HTML is the sanitized content of the body, without html, head and
+	// body elements.
+	HTML string
+
+	// Removed lists everything the sanitizer removed, in document order.
+	Removed []HTMLRemoval
+}
+
+type htmlSanitizer struct {
+	options HTMLSanitizeOptions
+	removed []HTMLRemoval
+	styles  []string
+}
+
+// SanitizeHTML sanitizes the HTML body of the email with SanitizeHTML. Its
+// inline files are used for cid: URLs when options.InlineFiles is nil.
+func (e Email) SanitizeHTML(
+	options HTMLSanitizeOptions,
+) (SanitizedHTML, error) {
+	if options.InlineFiles == nil {
+		options.InlineFiles = e.InlineFiles
+	}
+
+	return SanitizeHTML(e.HTML, options)
+}
+
+// SanitizeHTML makes an untrusted HTML email body safe to render in a web
+// page.
+//
+// Only email-safe elements and attributes are kept. Scripts, forms, frames,
+// objects and their content are removed, event handler attributes are
+// removed, and links and images are limited to http, https, mailto, tel,
+// cid and data:image URLs. CSS in style attributes is limited to
+// presentational properties, without url() values that load scripts or,
+// optionally, remote images, and without fixed or absolute positioning that
+// could cover the host page. Elements that are not allowed but usually
+// contain readable text, such as form or font elements from other
+// namespaces, are replaced by their content.
+func SanitizeHTML(
+	htmlBody string,
+	options HTMLSanitizeOptions,
+) (SanitizedHTML, error) {
+	document, err := html.Parse(strings.NewReader(htmlBody))
+	if err != nil {
+		return SanitizedHTML{}, fmt.Errorf(
+			"letters.sanitize.SanitizeHTML: cannot parse HTML: %w",
+			err,
+		)
+	}
+
+	sanitizer := htmlSanitizer{options: options, removed: nil, styles: nil}
+
+	// Style elements in the head apply to the body as well.
+	if head := findHTMLElement(document, atom.Head); head != nil {
+		for _, style := range findHTMLElements(head, atom.Style) {
+			sanitizer.sanitizeStyleElement(style)
+		}
+	}
+
+	body := findHTMLElement(document, atom.Body)
+	if body == nil {
+		return SanitizedHTML{HTML: "", Removed: sanitizer.removed}, nil
+	}
+
+	sanitizer.sanitizeChildren(body)
+
+	var b strings.Builder
+
+	if len(sanitizer.styles) > 0 {
+		b.WriteString("<style>")
+		b.WriteString(strings.Join(sanitizer.styles, "\n"))
+		b.WriteString("</style>")
+	}
+
+	for child := body.FirstChild; child != nil; child = child.NextSibling {
+		err = html.Render(&b, child)
+		if err != nil {
+			return SanitizedHTML{}, fmt.Errorf(
+				"letters.sanitize.SanitizeHTML: cannot render HTML: %w",
+				err,
+			)
+		}
+	}
+
+	return SanitizedHTML{HTML: b.String(), Removed: sanitizer.removed}, nil
+}
+
+func (s *htmlSanitizer) record(
+	reason HTMLRemovalReason,
+	element string,
+	attribute string,
+	value string,
+) {
+	s.removed = append(s.removed, HTMLRemoval{
+		Reason:    reason,
+		Element:   element,
+		Attribute: attribute,
+		Value:     value,
+	})
+}
+
+func (s *htmlSanitizer) sanitizeChildren(parent *html.Node) {
+	for child := parent.FirstChild; child != nil; {
+		next := child.NextSibling
+
+		switch child.Type {
+		case html.ElementNode:
+			next = s.sanitizeElement(child)
+		case html.TextNode:
+		case html.ErrorNode,
+			html.DocumentNode,
+			html.CommentNode,
+			html.DoctypeNode,
+			html.RawNode:
+			parent.RemoveChild(child)
+		}
+
+		child = next
+	}
+}
+
+// sanitizeElement sanitizes node and returns the node to continue with.
+func (s *htmlSanitizer) sanitizeElement(node *html.Node) *html.Node {
+	next := node.NextSibling
+
+	switch {
+	case node.DataAtom == atom.Style:
+		s.sanitizeStyleElement(node)
+		node.Parent.RemoveChild(node)
+
+		return next
+	case node.Namespace != "" || isRemovedHTMLElement(node.DataAtom):
+		s.record(HTMLRemovalElement, node.Data, "", "")
+		node.Parent.RemoveChild(node)
+
+		return next
+	case !isAllowedHTMLElement(node.DataAtom):
+		// Replace the element by its content, and sanitize the content
+		// next.
+		s.record(HTMLRemovalElement, node.Data, "", "")
+
+		first := node.FirstChild
+		for child := node.FirstChild; child != nil; {
+			nextChild := child.NextSibling
+
+			node.RemoveChild(child)
+			node.Parent.InsertBefore(child, node)
+
+			child = nextChild
+		}
+
+		node.Parent.RemoveChild(node)
+
+		if first != nil {
+			return first
+		}
+
+		return next
+	}
+
+	s.sanitizeAttributes(node)
+
+	if node.DataAtom == atom.A && htmlAttribute(node, "href") != "" {
+		node.Attr = append(
+			node.Attr,
+			html.Attribute{Namespace: "", Key: "target", Val: "_blank"},
+			html.Attribute{
+				Namespace: "",
+				Key:       "rel",
+				Val:       "noopener noreferrer nofollow",
+			},
+		)
+	}
+
+	if node.DataAtom == atom.Img && htmlAttribute(node, "src") == "" {
+		node.Parent.RemoveChild(node)
+
+		return next
+	}
+
+	s.sanitizeChildren(node)
+
+	return next
+}
+
+func (s *htmlSanitizer) sanitizeAttributes(node *html.Node) {
+	attributes := node.Attr[:0]
+
+	for _, attribute := range node.Attr {
+		key := attribute.Key
+
+		switch {
+		case attribute.Namespace != "" || !isAllowedHTMLAttribute(key):
+			s.record(HTMLRemovalAttribute, node.Data, key, attribute.Val)
+
+			continue
+		case key == "style":
+			attribute.Val = s.sanitizeDeclarations(node.Data, attribute.Val)
+			if attribute.Val == "" {
+				continue
+			}
+		case isHTMLURLAttribute(key):
+			value, ok := s.sanitizeURL(
+				node.Data,
+				key,
+				attribute.Val,
+				key != "href" && key != "cite",
+			)
+			if !ok {
+				continue
+			}
+
+			attribute.Val = value
+		}
+
+		attributes = append(attributes, attribute)
+	}
+
+	node.Attr = attributes
+}
+
+// sanitizeURL returns the URL to keep in place of value, or false when the
+// attribute must be removed. Images are loaded automatically, so they are
+// subject to BlockRemoteImages and may be data:image URLs.
+func (s *htmlSanitizer) sanitizeURL(
+	element string,
+	attribute string,
+	value string,
+	image bool,
+) (string, bool) {
+	value = strings.TrimSpace(value)
+	scheme, _, hasScheme := strings.Cut(value, ":")
+	scheme = strings.ToLower(scheme)
+
+	switch {
+	case strings.HasPrefix(value, "#") && !image:
+		return value, true
+	case !hasScheme || strings.ContainsAny(scheme, "/?#"):
+		// Relative URLs have no meaning in an email.
+		s.record(HTMLRemovalURL, element, attribute, value)
+
+		return "", false
+	case scheme == "http" || scheme == "https":
+		if image && s.options.BlockRemoteImages {
+			s.record(HTMLRemovalRemoteImage, element, attribute, value)
+
+			return "", false
+		}
+
+		return value, true
+	case scheme == "cid":
+		return s.rewriteContentID(value), true
+	case (scheme == "mailto" || scheme == "tel") && !image:
+		return value, true
+	case scheme == "data" && image && isSafeDataImage(value):
+		return value, true
+	default:
+		s.record(HTMLRemovalURL, element, attribute, value)
+
+		return "", false
+	}
+}
+
+func (s *htmlSanitizer) rewriteContentID(cidURL string) string {
+	if s.options.ContentIDRewriter == nil {
+		return cidURL
+	}
+
+	index := findInlineFile(s.options.InlineFiles, parseContentIDURL(cidURL))
+	if index < 0 {
+		return cidURL
+	}
+
+	return s.options.ContentIDRewriter(s.options.InlineFiles[index])
+}
+
+func isSafeDataImage(value string) bool {
+	mediaType, _, _ := strings.Cut(strings.ToLower(value[len("data:"):]), ",")
+	mediaType, _, _ = strings.Cut(mediaType, ";")
+
+	return slices.Contains([]string{
+		"image/png",
+		"image/gif",
+		"image/jpeg",
+		"image/jpg",
+		"image/webp",
+		"image/bmp",
+	}, strings.TrimSpace(mediaType))
+}
+
+// sanitizeDeclarations returns the safe declarations of a CSS declaration
+// list, as found in a style attribute or a style rule.
+func (s *htmlSanitizer) sanitizeDeclarations(
+	element string,
+	css string,
+) string {
+	var declarations []string
+
+	for _, declaration := range strings.Split(stripCSSComments(css), ";") {
+		declaration = strings.TrimSpace(declaration)
+		if declaration == "" {
+			continue
+		}
+
+		property, value, found := strings.Cut(declaration, ":")
+		property = strings.ToLower(strings.TrimSpace(property))
+		value = strings.TrimSpace(value)
+
+		if !found || !isSafeCSSDeclaration(property, value) {
+			s.record(HTMLRemovalCSS, element, "style", declaration)
+
+			continue
+		}
+
+		value, ok := s.sanitizeCSSURLs(element, value)
+		if !ok {
+			continue
+		}
+
+		declarations = append(declarations, property+":"+value)
+	}
+
+	return strings.Join(declarations, ";")
+}
+
+// sanitizeCSSURLs checks and rewrites the url() values of a CSS value, and
+// returns false when the declaration must be removed. A value with an
+// unterminated url() is removed, as browsers may still load its URL.
+func (s *htmlSanitizer) sanitizeCSSURLs(
+	element string,
+	value string,
+) (string, bool) {
+	ok := true
+
+	sanitized, terminated := scanCSSURLs(value, func(cssURL string) string {
+		safeURL, safe := s.sanitizeURL(element, "style", cssURL, true)
+		if !safe {
+			ok = false
+		}
+
+		return safeURL
+	})
+	if !terminated {
+		s.record(HTMLRemovalCSS, element, "style", value)
+
+		return "", false
+	}
+
+	return sanitized, ok
+}
+
+func isSafeCSSDeclaration(property string, value string) bool {
+	lower := strings.ToLower(value)
+
+	for _, unsafe := range []string{
+		"expression(",
+		// image-set(), image() and cross-fade() load images from plain
+		// strings rather than url() values.
+		"image-set(",
+		"image(",
+		"cross-fade(",
+		"javascript:",
+		"vbscript:",
+		"behavior",
+		"-moz-binding",
+		"@import",
+		"\\",
+		"<",
+	} {
+		if strings.Contains(lower, unsafe) {
+			return false
+		}
+	}
+
+	if property == "position" {
+		return lower == "static" || lower == "relative"
+	}
+
+	for _, allowed := range []string{
+		"background",
+		"border",
+		"color",
+		"direction",
+		"display",
+		"float",
+		"clear",
+		"font",
+		"height",
+		"letter-spacing",
+		"line-height",
+		"list-style",
+		"margin",
+		"max-height",
+		"max-width",
+		"min-height",
+		"min-width",
+		"opacity",
+		"overflow",
+		"padding",
+		"table-layout",
+		"text-",
+		"vertical-align",
+		"visibility",
+		"white-space",
+		"width",
+		"word-",
+		"overflow-wrap",
+	} {
+		if strings.HasPrefix(property, allowed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *htmlSanitizer) sanitizeStyleElement(node *html.Node) {
+	css := htmlNodeText(node)
+
+	if s.options.StyleScope == "" {
+		s.record(HTMLRemovalElement, node.Data, "", css)
+
+		return
+	}
+
+	scoped := s.scopeStyleSheet(stripCSSComments(css))
+	if scoped != "" {
+		s.styles = append(s.styles, scoped)
+	}
+}
+
+// scopeStyleSheet returns the rules of a style sheet with their selectors
+// prefixed by StyleScope and their declarations sanitized. Rules in @media
+// blocks are scoped as well; other at-rules are removed.
+func (s *htmlSanitizer) scopeStyleSheet(css string) string {
+	var rules []string
+
+	for {
+		css = strings.TrimSpace(css)
+
+		open := strings.IndexByte(css, '{')
+		if open < 0 {
+			return strings.Join(rules, "\n")
+		}
+
+		prelude := strings.TrimSpace(css[:open])
+
+		end := matchingCSSBrace(css, open)
+		block := css[open+1 : end]
+
+		if end < len(css) {
+			css = css[end+1:]
+		} else {
+			css = ""
+		}
+
+		// Statements such as @import end with a semicolon before the
+		// next rule.
+		if i := strings.LastIndexByte(prelude, ';'); i >= 0 {
+			s.record(HTMLRemovalCSS, "style", "", prelude[:i+1])
+			prelude = strings.TrimSpace(prelude[i+1:])
+		}
+
+		switch {
+		case strings.HasPrefix(strings.ToLower(prelude), "@media"):
+			nested := s.scopeStyleSheet(block)
+			if nested != "" {
+				rules = append(rules, prelude+"{"+nested+"}")
+			}
+		case strings.HasPrefix(prelude, "@"):
+			s.record(HTMLRemovalCSS, "style", "", prelude)
+		default:
+			declarations := s.sanitizeDeclarations("style", block)
+			if declarations == "" {
+				continue
+			}
+
+			selectors := s.scopeSelectors(prelude)
+			if selectors != "" {
+				rules = append(rules, selectors+"{"+declarations+"}")
+			}
+		}
+	}
+}
+
+// scopeSelectors prefixes each selector of a selector list with StyleScope.
+// A leading html, body or :root descendant is removed first. Selectors that
+// would still match outside the scope, because they start with a combinator
+// or select the root elements themselves, are removed.
+func (s *htmlSanitizer) scopeSelectors(selectors string) string {
+	scope := s.options.StyleScope
+
+	var scoped []string
+
+	for _, selector := range strings.Split(selectors, ",") {
+		selector = strings.TrimSpace(selector)
+
+		for _, root := range cssRootSelectors() {
+			if strings.HasPrefix(strings.ToLower(selector), root+" ") {
+				selector = strings.TrimSpace(selector[len(root):])
+			}
+		}
+
+		if selector == "" ||
+			strings.ContainsAny(selector[:1], "~+>") ||
+			isCSSRootSelector(selector) {
+			s.record(HTMLRemovalCSS, "style", "", selector)
+
+			continue
+		}
+
+		scoped = append(scoped, scope+" "+selector)
+	}
+
+	return strings.Join(scoped, ",")
+}
+
+func cssRootSelectors() []string {
+	return []string{"html", "body", ":root"}
+}
+
+// isCSSRootSelector reports whether a selector starts with a compound
+// selector for the html or body element or the :root pseudo-class.
+func isCSSRootSelector(selector string) bool {
+	lower := strings.ToLower(selector)
+
+	for _, root := range cssRootSelectors() {
+		rest, found := strings.CutPrefix(lower, root)
+		if found && (rest == "" || strings.ContainsAny(rest[:1], ".#[:")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchingCSSBrace(css string, open int) int {
+	depth := 0
+
+	for i := open; i < len(css); i++ {
+		switch css[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return len(css)
+}
+
+func stripCSSComments(css string) string {
+	var b strings.Builder
+
+	for {
+		start := strings.Index(css, "/*")
+		if start < 0 {
+			b.WriteString(css)
+
+			return b.String()
+		}
+
+		b.WriteString(css[:start])
+
+		end := strings.Index(css[start+2:], "*/")
+		if end < 0 {
+			return b.String()
+		}
+
+		css = css[start+2+end+2:]
+	}
+}
+
+func findHTMLElements(root *html.Node, a atom.Atom) []*html.Node {
+	var elements []*html.Node
+
+	for child := root.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && child.DataAtom == a {
+			elements = append(elements, child)
+		}
+
+		elements = append(elements, findHTMLElements(child, a)...)
+	}
+
+	return elements
+}
+
+// isRemovedHTMLElement reports whether the element is removed together with
+// its content.
+func isRemovedHTMLElement(a atom.Atom) bool {
+	switch a {
+	case atom.Script,
+		atom.Noscript,
+		atom.Template,
+		atom.Iframe,
+		atom.Frame,
+		atom.Frameset,
+		atom.Object,
+		atom.Embed,
+		atom.Applet,
+		atom.Param,
+		atom.Input,
+		atom.Button,
+		atom.Select,
+		atom.Textarea,
+		atom.Option,
+		atom.Optgroup,
+		atom.Link,
+		atom.Meta,
+		atom.Base,
+		atom.Title,
+		atom.Head,
+		atom.Audio,
+		atom.Video,
+		atom.Source,
+		atom.Track,
+		atom.Canvas,
+		atom.Dialog:
+		return true
+	default:
+		return false
+	}
+}
+
+func isAllowedHTMLElement(a atom.Atom) bool {
+	switch a {
+	case atom.A,
+		atom.Abbr,
+		atom.Address,
+		atom.Article,
+		atom.Aside,
+		atom.B,
+		atom.Bdi,
+		atom.Bdo,
+		atom.Big,
+		atom.Blockquote,
+		atom.Br,
+		atom.Caption,
+		atom.Center,
+		atom.Cite,
+		atom.Code,
+		atom.Col,
+		atom.Colgroup,
+		atom.Dd,
+		atom.Del,
+		atom.Details,
+		atom.Dfn,
+		atom.Div,
+		atom.Dl,
+		atom.Dt,
+		atom.Em,
+		atom.Figcaption,
+		atom.Figure,
+		atom.Font,
+		atom.Footer,
+		atom.H1,
+		atom.H2,
+		atom.H3,
+		atom.H4,
+		atom.H5,
+		atom.H6,
+		atom.Header,
+		atom.Hr,
+		atom.I,
+		atom.Img,
+		atom.Ins,
+		atom.Kbd,
+		atom.Li,
+		atom.Main,
+		atom.Mark,
+		atom.Nav,
+		atom.Ol,
+		atom.P,
+		atom.Pre,
+		atom.Q,
+		atom.S,
+		atom.Samp,
+		atom.Section,
+		atom.Small,
+		atom.Span,
+		atom.Strike,
+		atom.Strong,
+		atom.Sub,
+		atom.Summary,
+		atom.Sup,
+		atom.Table,
+		atom.Tbody,
+		atom.Td,
+		atom.Tfoot,
+		atom.Th,
+		atom.Thead,
+		atom.Time,
+		atom.Tr,
+		atom.Tt,
+		atom.U,
+		atom.Ul,
+		atom.Var,
+		atom.Wbr:
+		return true
+	default:
+		return false
+	}
+}
+
+func isAllowedHTMLAttribute(key string) bool {
+	switch key {
+	case "align",
+		"alt",
+		"background",
+		"bgcolor",
+		"border",
+		"cellpadding",
+		"cellspacing",
+		"cite",
+		"class",
+		"color",
+		"colspan",
+		"datetime",
+		"dir",
+		"face",
+		"headers",
+		"height",
+		"href",
+		"hspace",
+		"lang",
+		"nowrap",
+		"rowspan",
+		"scope",
+		"size",
+		"span",
+		"src",
+		"start",
+		"style",
+		"summary",
+		"title",
+		"type",
+		"valign",
+		"vspace",
+		"width":
+		return true
+	default:
+		return false
+	}
+}
+
+func isHTMLURLAttribute(key string) bool {
+	switch key {
+	case "href", "src", "background", "cite":
+		return true
+	default:
+		return false
+	}
+}
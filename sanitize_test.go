@@ -0,0 +1,238 @@
+package letters_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mnako/letters"
+)
+
+func TestSanitizeHTML(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name            string
+		html            string
+		options         letters.HTMLSanitizeOptions
+		expected        string
+		expectedRemoved []letters.HTMLRemovalReason
+	}{
+		{
+			name: "scripts and event handlers",
+			html: "<p onclick=\"steal()\" id=\"x\" class=\"intro\">Hi" +
+				"<script>steal()</script></p>",
+			expected: "<p class=\"intro\">Hi</p>",
+			expectedRemoved: []letters.HTMLRemovalReason{
+				letters.HTMLRemovalAttribute,
+				letters.HTMLRemovalAttribute,
+				letters.HTMLRemovalElement,
+			},
+		},
+		{
+			name: "forms and frames",
+			html: "<form action=\"https://evil.example/\">" +
+				"Password: <input type=\"password\"><button>Go</button>" +
+				"</form><iframe src=\"https://evil.example/\"></iframe>",
+			expected: "Password: ",
+			expectedRemoved: []letters.HTMLRemovalReason{
+				letters.HTMLRemovalElement,
+				letters.HTMLRemovalElement,
+				letters.HTMLRemovalElement,
+				letters.HTMLRemovalElement,
+			},
+		},
+		{
+			name: "links",
+			html: "<a href=\"javascript:alert(1)\">a</a>" +
+				"<a href=\"java&#x09;script:alert(1)\">b</a>" +
+				"<a href=\"https://example.com/\">c</a>" +
+				"<a href=\"mailto:alice@example.com\">d</a>",
+			expected: "<a>a</a><a>b</a>" +
+				"<a href=\"https://example.com/\" target=\"_blank\" " +
+				"rel=\"noopener noreferrer nofollow\">c</a>" +
+				"<a href=\"mailto:alice@example.com\" target=\"_blank\" " +
+				"rel=\"noopener noreferrer nofollow\">d</a>",
+			expectedRemoved: []letters.HTMLRemovalReason{
+				letters.HTMLRemovalURL,
+				letters.HTMLRemovalURL,
+			},
+		},
+		{
+			name: "images",
+			html: "<img src=\"https://tracker.example/p.gif\">" +
+				"<img src=\"data:image/svg+xml;base64,PHN2Zz4=\">" +
+				"<img src=\"data:image/png;base64,cG5n\" alt=\"dot\">" +
+				"<img src=\"cid:logo@example.com\">",
+			expected: "<img src=\"https://tracker.example/p.gif\"/>" +
+				"<img src=\"data:image/png;base64,cG5n\" alt=\"dot\"/>" +
+				"<img src=\"/files/logo@example.com\"/>",
+			options: letters.HTMLSanitizeOptions{
+				InlineFiles: []letters.InlineFile{
+					{ContentID: "logo@example.com"},
+				},
+				ContentIDRewriter: func(file letters.InlineFile) string {
+					return "/files/" + file.ContentID
+				},
+			},
+			expectedRemoved: []letters.HTMLRemovalReason{
+				letters.HTMLRemovalURL,
+			},
+		},
+		{
+			name: "blocked remote images",
+			html: "<img src=\"https://tracker.example/p.gif\">" +
+				"<div style=\"background:url(https://tracker.example/b.png);" +
+				"color:red\">x</div>",
+			options: letters.HTMLSanitizeOptions{
+				BlockRemoteImages: true,
+			},
+			expected: "<div style=\"color:red\">x</div>",
+			expectedRemoved: []letters.HTMLRemovalReason{
+				letters.HTMLRemovalRemoteImage,
+				letters.HTMLRemovalRemoteImage,
+			},
+		},
+		{
+			name: "inline CSS",
+			html: "<div style=\"position:fixed;top:0;color:red;" +
+				"width:expression(alert(1));font-size:12px\">x</div>",
+			expected: "<div style=\"color:red;font-size:12px\">x</div>",
+			expectedRemoved: []letters.HTMLRemovalReason{
+				letters.HTMLRemovalCSS,
+				letters.HTMLRemovalCSS,
+				letters.HTMLRemovalCSS,
+			},
+		},
+		{
+			name: "style elements are removed without a scope",
+			html: "<html><head><style>body { color: red }</style></head>" +
+				"<body><p>x</p></body></html>",
+			expected: "<p>x</p>",
+			expectedRemoved: []letters.HTMLRemovalReason{
+				letters.HTMLRemovalElement,
+			},
+		},
+		{
+			name: "scoped style elements",
+			html: "<html><head><style>" +
+				"@import url(https://evil.example/x.css);" +
+				"body p { color: red } .a, p b { position: fixed; top: 0 }" +
+				"@media (max-width: 600px) { .a { width: 100% } }" +
+				"@font-face { font-family: x }" +
+				"</style></head><body><p>x</p></body></html>",
+			options: letters.HTMLSanitizeOptions{
+				StyleScope: "#message",
+			},
+			expected: "<style>#message p{color:red}\n" +
+				"@media (max-width: 600px){#message .a{width:100%}}</style>" +
+				"<p>x</p>",
+			expectedRemoved: []letters.HTMLRemovalReason{
+				letters.HTMLRemovalCSS,
+				letters.HTMLRemovalCSS,
+				letters.HTMLRemovalCSS,
+				letters.HTMLRemovalCSS,
+			},
+		},
+		{
+			name: "style selectors outside the scope",
+			html: "<style>" +
+				"~ * { display: none } + p, > p { color: red }" +
+				"body { color: red } html.dark p, :root { color: blue }" +
+				"html > body p { color: green } p ~ a { color: black }" +
+				"</style><p>x</p>",
+			options: letters.HTMLSanitizeOptions{
+				StyleScope: "#message",
+			},
+			expected: "<style>#message p ~ a{color:black}</style><p>x</p>",
+			expectedRemoved: []letters.HTMLRemovalReason{
+				letters.HTMLRemovalCSS,
+				letters.HTMLRemovalCSS,
+				letters.HTMLRemovalCSS,
+				letters.HTMLRemovalCSS,
+				letters.HTMLRemovalCSS,
+				letters.HTMLRemovalCSS,
+				letters.HTMLRemovalCSS,
+			},
+		},
+		{
+			name: "unterminated and image-set CSS URLs",
+			html: "<div style=\"background:url('https://t.example/p.png\">" +
+				"a</div>" +
+				"<div style=\"color:red;" +
+				"background:url(https://t.example/p.png\">b</div>" +
+				"<div style=\"background-image:" +
+				"image-set('https://t.example/p.png' 1x);color:red\">c</div>" +
+				"<div style=\"background-image:-webkit-image-set(" +
+				"'https://t.example/p.png' 1x)\">d</div>",
+			options: letters.HTMLSanitizeOptions{
+				BlockRemoteImages: true,
+			},
+			expected: "<div>a</div><div style=\"color:red\">b</div>" +
+				"<div style=\"color:red\">c</div><div>d</div>",
+			expectedRemoved: []letters.HTMLRemovalReason{
+				letters.HTMLRemovalCSS,
+				letters.HTMLRemovalCSS,
+				letters.HTMLRemovalCSS,
+				letters.HTMLRemovalCSS,
+			},
+		},
+		{
+			name: "non-ASCII CSS before url()",
+			html: "<div style=\"color:ȺȺȺȺȺȺȺȺȺȺȺȺ url(x)\">x</div>" +
+				"<div style=\"font-family:İİİİ;" +
+				"background:url(https://t.example/p.png)\">y</div>",
+			options: letters.HTMLSanitizeOptions{
+				BlockRemoteImages: true,
+			},
+			expected: "<div>x</div>" +
+				"<div style=\"font-family:İİİİ\">y</div>",
+			expectedRemoved: []letters.HTMLRemovalReason{
+				letters.HTMLRemovalURL,
+				letters.HTMLRemovalRemoteImage,
+			},
+		},
+		{
+			name: "unknown elements keep their content",
+			html: "<p>Hello<o:p></o:p> <blink>world</blink>" +
+				"<svg><text>x</text></svg></p>",
+			expected: "<p>Hello world</p>",
+			expectedRemoved: []letters.HTMLRemovalReason{
+				letters.HTMLRemovalElement,
+				letters.HTMLRemovalElement,
+				letters.HTMLRemovalElement,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			sanitized, err := letters.SanitizeHTML(
+				testCase.html,
+				testCase.options,
+			)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if sanitized.HTML != testCase.expected {
+				t.Errorf(
+					"unexpected HTML:\ngot:      %q\nexpected: %q",
+					sanitized.HTML,
+					testCase.expected,
+				)
+			}
+
+			var reasons []letters.HTMLRemovalReason
+			for _, removal := range sanitized.Removed {
+				reasons = append(reasons, removal.Reason)
+			}
+
+			if !reflect.DeepEqual(reasons, testCase.expectedRemoved) {
+				t.Errorf("unexpected removals: %#v", sanitized.Removed)
+			}
+		})
+	}
+}
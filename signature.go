@@ -0,0 +1,350 @@
+package letters
+
+import (
+	"net/mail"
+	"strings"
+)
+
+const (
+	signatureMaxLines       = 10
+	signatureMaxFieldLength = 60
+	phoneNumberMinDigits    = 7
+	phoneNumberMaxDigits    = 15
+)
+
+// WithSignatureContactExtraction makes the parser extract the contact
+// details in the signature block of the plain-text body, or of the HTML
+// body rendered as text, into Email.SignatureContact. The contact is keyed
+// to the first address of Headers.From.
+func WithSignatureContactExtraction() EmailParserOption {
+	return func(ep *EmailParser) {
+		ep.extractSignatureContacts = true
+	}
+}
+
+func (ep *EmailParser) extractSignatureContact(email *Email) {
+	if len(email.Headers.From) == 0 {
+		return
+	}
+
+	text := email.Text
+	if text == "" && email.HTML != "" {
+		text, _ = HTMLToText(email.HTML, ep.htmlLinkStyle)
+	}
+
+	contact, ok := ExtractSignatureContact(text, email.Headers.From[0])
+	if ok {
+		email.SignatureContact = &contact
+	}
+}
+
+// ExtractSignatureContact extracts the phone numbers, title, company, email
+// addresses and URLs in the signature block of a plain-text body written by
+// the sender at from. The signature is the block after the "-- " separator
+// found by SplitReplyText or, when there is none, the last paragraph of the
+// new content when it contains a phone number. The sender's name and
+// address become the name and first email address of the contact. It
+// reports whether the signature contained any contact details.
+func ExtractSignatureContact(
+	text string,
+	from *mail.Address,
+) (Contact, bool) {
+	contact := Contact{
+		Version:       "",
+		UID:           "",
+		FormattedName: "",
+		Name: ContactName{
+			FamilyName:      "",
+			GivenName:       "",
+			AdditionalNames: "",
+			Prefixes:        "",
+			Suffixes:        "",
+		},
+		Nickname:     "",
+		Organization: "",
+		Department:   "",
+		Title:        "",
+		Role:         "",
+		Emails:       nil,
+		Phones:       nil,
+		Addresses:    nil,
+		URLs:         nil,
+		Birthday:     "",
+		Note:         "",
+	}
+
+	if from != nil {
+		contact.FormattedName = from.Name
+		contact.Emails = append(contact.Emails, ContactValue{
+			Value:     from.Address,
+			Types:     nil,
+			Preferred: false,
+		})
+	}
+
+	lines := signatureLines(text)
+	if len(lines) > signatureMaxLines {
+		lines = lines[:signatureMaxLines]
+	}
+
+	var texts []string
+
+	for _, line := range lines {
+		// Skip valedictions such as "Best regards,".
+		if strings.HasSuffix(line, ",") {
+			continue
+		}
+
+		for _, segment := range splitSignatureLine(line) {
+			segment = trimSignatureName(segment, contact.FormattedName)
+
+			if segment != "" &&
+				!addSignatureDetail(&contact, segment) &&
+				len(segment) <= signatureMaxFieldLength {
+				texts = append(texts, segment)
+			}
+		}
+	}
+
+	// Without a name in From, the signature starts with the name.
+	if contact.FormattedName == "" && len(texts) > 2 {
+		contact.FormattedName, texts = texts[0], texts[1:]
+	}
+
+	switch {
+	case len(texts) == 1:
+		contact.Title, contact.Organization = splitSignatureTitle(texts[0])
+	case len(texts) > 1:
+		contact.Title, contact.Organization = texts[0], texts[1]
+	default:
+	}
+
+	found := len(contact.Phones) > 0 || len(contact.URLs) > 0 ||
+		contact.Title != "" || contact.Organization != "" ||
+		len(contact.Emails) > 1
+
+	return contact, found
+}
+
+// signatureLines returns the non-empty lines of the signature of a body.
+func signatureLines(text string) []string {
+	reply := SplitReplyText(text)
+
+	signature := reply.Signature
+	if signature == "" {
+		paragraphs := strings.Split(reply.NewContent, "\n\n")
+		last := paragraphs[len(paragraphs)-1]
+
+		if len(paragraphs) > 1 &&
+			strings.ContainsFunc(last, func(r rune) bool {
+				return r >= '0' && r <= '9'
+			}) {
+			signature = last
+		}
+	}
+
+	var lines []string
+
+	for _, line := range strings.Split(signature, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	// Without a separator, only a paragraph with a phone number is taken
+	// for a signature.
+	if reply.Signature == "" && !signatureHasPhoneNumber(lines) {
+		return nil
+	}
+
+	return lines
+}
+
+func signatureHasPhoneNumber(lines []string) bool {
+	for _, line := range lines {
+		for _, segment := range splitSignatureLine(line) {
+			_, number, _ := cutSignatureLabel(segment)
+			if isPhoneNumber(number) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// trimSignatureName trims the name of the sender from the start of a segment
+// of a signature, as in "Alice Smith, Head of Sales".
+func trimSignatureName(segment string, name string) string {
+	if name == "" || len(segment) < len(name) ||
+		!strings.EqualFold(segment[:len(name)], name) {
+		return segment
+	}
+
+	return strings.TrimLeft(segment[len(name):], " ,-–")
+}
+
+// splitSignatureLine splits a line such as "Sales | Example Corp" into its
+// segments.
+func splitSignatureLine(line string) []string {
+	for _, separator := range []string{" · ", " • ", " / "} {
+		line = strings.ReplaceAll(line, separator, " | ")
+	}
+
+	var segments []string
+
+	for _, segment := range strings.Split(line, " | ") {
+		segment = strings.Trim(segment, " |")
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+
+	return segments
+}
+
+// addSignatureDetail adds a segment of a signature to the contact when it
+// is a phone number, an email address or a URL.
+func addSignatureDetail(contact *Contact, segment string) bool {
+	phoneType, number, labeled := cutSignatureLabel(segment)
+	if isPhoneNumber(number) {
+		var types []string
+		if phoneType != "" {
+			types = []string{phoneType}
+		}
+
+		contact.Phones = append(contact.Phones, ContactValue{
+			Value:     number,
+			Types:     types,
+			Preferred: false,
+		})
+
+		return true
+	}
+
+	value := segment
+	if labeled {
+		value = number
+	}
+
+	lower := strings.ToLower(value)
+
+	switch {
+	case strings.HasPrefix(lower, "http://"),
+		strings.HasPrefix(lower, "https://"),
+		strings.HasPrefix(lower, "www."):
+		contact.URLs = append(contact.URLs, ContactValue{
+			Value:     value,
+			Types:     nil,
+			Preferred: false,
+		})
+
+		return true
+	case strings.Contains(value, "@") && !strings.ContainsAny(value, " \t"):
+		address := trimMailto(value)
+
+		for _, email := range contact.Emails {
+			if strings.EqualFold(email.Value, address) {
+				return true
+			}
+		}
+
+		contact.Emails = append(contact.Emails, ContactValue{
+			Value:     address,
+			Types:     nil,
+			Preferred: false,
+		})
+
+		return true
+	default:
+		return labeled
+	}
+}
+
+// signatureLabels returns the labels that signatures put before contact
+// details, such as "Mobile:", "T:" or "E:", with the vCard types of the
+// phone numbers they label.
+func signatureLabels() map[string]string {
+	return map[string]string{
+		"tel":       "voice",
+		"tel.":      "voice",
+		"telephone": "voice",
+		"t":         "voice",
+		"phone":     "voice",
+		"p":         "voice",
+		"office":    "work",
+		"o":         "work",
+		"direct":    "work",
+		"d":         "work",
+		"work":      "work",
+		"mobile":    "cell",
+		"mob":       "cell",
+		"m":         "cell",
+		"cell":      "cell",
+		"c":         "cell",
+		"fax":       "fax",
+		"f":         "fax",
+		"e":         "",
+		"email":     "",
+		"e-mail":    "",
+		"mail":      "",
+		"w":         "",
+		"web":       "",
+		"website":   "",
+	}
+}
+
+// cutSignatureLabel cuts a label such as "Mobile:" from a segment of a
+// signature and returns the vCard type of the label, the rest of the
+// segment and whether the segment had a known label.
+func cutSignatureLabel(segment string) (string, string, bool) {
+	label, rest, found := strings.Cut(segment, ":")
+	if !found {
+		return "", segment, false
+	}
+
+	phoneType, ok := signatureLabels()[strings.ToLower(
+		strings.TrimSpace(label),
+	)]
+	if !ok {
+		return "", segment, false
+	}
+
+	return phoneType, strings.TrimSpace(rest), true
+}
+
+// isPhoneNumber reports whether s looks like a phone number such as
+// +1 (555) 010-0100.
+func isPhoneNumber(s string) bool {
+	if s == "" || !strings.ContainsAny(s[:1], "+(0123456789") {
+		return false
+	}
+
+	digits := 0
+
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case strings.ContainsRune(" +-().", r):
+		default:
+			return false
+		}
+	}
+
+	return digits >= phoneNumberMinDigits && digits <= phoneNumberMaxDigits
+}
+
+// splitSignatureTitle splits a line such as "Head of Sales, Example Corp" or
+// "CTO at Example" into a title and an organization.
+func splitSignatureTitle(line string) (string, string) {
+	for _, separator := range []string{", ", " at ", " @ ", " - ", " – "} {
+		title, organization, found := strings.Cut(line, separator)
+		if found {
+			return strings.TrimSpace(title), strings.TrimSpace(organization)
+		}
+	}
+
+	return line, ""
+}
@@ -0,0 +1,207 @@
+package letters_test
+
+import (
+	"net/mail"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mnako/letters"
+)
+
+func TestExtractSignatureContact(t *testing.T) {
+	t.Parallel()
+
+	from := &mail.Address{Name: "Alice Smith", Address: "alice@example.com"}
+
+	testCases := []struct {
+		name           string
+		text           string
+		from           *mail.Address
+		expectedOK     bool
+		expectedName   string
+		expectedTitle  string
+		expectedOrg    string
+		expectedPhones []letters.ContactValue
+		expectedEmails []string
+		expectedURLs   []string
+	}{
+		{
+			name: "separator",
+			text: "Thanks for the update.\n" +
+				"\n" +
+				"-- \n" +
+				"Alice Smith\n" +
+				"Head of Sales\n" +
+				"Example Corp\n" +
+				"Tel: +1 (555) 010-0100 | Mobile: +1 555 010 0199\n" +
+				"Fax: +1 555 010 0111\n" +
+				"E: alice.smith@example.com\n" +
+				"www.example.com\n",
+			from:          from,
+			expectedOK:    true,
+			expectedName:  "Alice Smith",
+			expectedTitle: "Head of Sales",
+			expectedOrg:   "Example Corp",
+			expectedPhones: []letters.ContactValue{
+				{
+					Value:     "+1 (555) 010-0100",
+					Types:     []string{"voice"},
+					Preferred: false,
+				},
+				{
+					Value:     "+1 555 010 0199",
+					Types:     []string{"cell"},
+					Preferred: false,
+				},
+				{
+					Value:     "+1 555 010 0111",
+					Types:     []string{"fax"},
+					Preferred: false,
+				},
+			},
+			expectedEmails: []string{
+				"alice@example.com",
+				"alice.smith@example.com",
+			},
+			expectedURLs: []string{"www.example.com"},
+		},
+		{
+			name: "last paragraph",
+			text: "See you on Monday.\n" +
+				"\n" +
+				"Best regards,\n" +
+				"Alice Smith | CTO at Example Corp\n" +
+				"+44 20 7946 0958\n",
+			from:          from,
+			expectedOK:    true,
+			expectedName:  "Alice Smith",
+			expectedTitle: "CTO",
+			expectedOrg:   "Example Corp",
+			expectedPhones: []letters.ContactValue{
+				{
+					Value:     "+44 20 7946 0958",
+					Types:     nil,
+					Preferred: false,
+				},
+			},
+			expectedEmails: []string{"alice@example.com"},
+			expectedURLs:   nil,
+		},
+		{
+			name: "name in signature",
+			text: "Done.\n" +
+				"-- \n" +
+				"Bob Jones\n" +
+				"Engineer\n" +
+				"Example Corp\n",
+			from:           &mail.Address{Name: "", Address: "bob@example.com"},
+			expectedOK:     true,
+			expectedName:   "Bob Jones",
+			expectedTitle:  "Engineer",
+			expectedOrg:    "Example Corp",
+			expectedPhones: nil,
+			expectedEmails: []string{"bob@example.com"},
+			expectedURLs:   nil,
+		},
+		{
+			name: "no signature",
+			text: "Meet me at 10.\n" +
+				"\n" +
+				"The code is 1234.\n",
+			from:           from,
+			expectedOK:     false,
+			expectedName:   "Alice Smith",
+			expectedTitle:  "",
+			expectedOrg:    "",
+			expectedPhones: nil,
+			expectedEmails: []string{"alice@example.com"},
+			expectedURLs:   nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			contact, ok := letters.ExtractSignatureContact(
+				testCase.text,
+				testCase.from,
+			)
+			if ok != testCase.expectedOK {
+				t.Errorf("expected ok %t, got %t", testCase.expectedOK, ok)
+			}
+
+			if contact.FormattedName != testCase.expectedName ||
+				contact.Title != testCase.expectedTitle ||
+				contact.Organization != testCase.expectedOrg {
+				t.Errorf("unexpected contact: %#v", contact)
+			}
+
+			if !reflect.DeepEqual(contact.Phones, testCase.expectedPhones) {
+				t.Errorf("unexpected phones: %#v", contact.Phones)
+			}
+
+			var emails []string
+			for _, email := range contact.Emails {
+				emails = append(emails, email.Value)
+			}
+
+			if !reflect.DeepEqual(emails, testCase.expectedEmails) {
+				t.Errorf("unexpected emails: %q", emails)
+			}
+
+			var urls []string
+			for _, url := range contact.URLs {
+				urls = append(urls, url.Value)
+			}
+
+			if !reflect.DeepEqual(urls, testCase.expectedURLs) {
+				t.Errorf("unexpected URLs: %q", urls)
+			}
+		})
+	}
+}
+
+func TestParseWithSignatureContactExtraction(t *testing.T) {
+	t.Parallel()
+
+	message := "From: Alice Smith <alice@example.com>\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"Hello.\r\n" +
+		"\r\n" +
+		"-- \r\n" +
+		"Alice Smith, Head of Sales, Example Corp\r\n" +
+		"M: +1 555 010 0199\r\n"
+
+	email, err := letters.NewEmailParser(
+		letters.WithSignatureContactExtraction(),
+	).Parse(strings.NewReader(message))
+	if err != nil {
+		t.Fatalf("cannot parse email: %s", err)
+	}
+
+	contact := email.SignatureContact
+	if contact == nil ||
+		contact.Title != "Head of Sales" ||
+		contact.Organization != "Example Corp" ||
+		contact.Emails[0].Value != "alice@example.com" ||
+		len(contact.Phones) != 1 ||
+		contact.Phones[0].Value != "+1 555 010 0199" {
+		t.Errorf("unexpected signature contact: %#v", contact)
+	}
+
+	email, err = letters.ParseEmail(strings.NewReader(message))
+	if err != nil {
+		t.Fatalf("cannot parse email: %s", err)
+	}
+
+	if email.SignatureContact != nil {
+		t.Errorf(
+			"expected no signature contact by default: %#v",
+			email.SignatureContact,
+		)
+	}
+}
@@ -0,0 +1,535 @@
+package letters
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// Media types returned by DetectContentType for content it cannot identify.
+const (
+	ContentTypeOctetStream = "application/octet-stream"
+	ContentTypeTextPlain   = "text/plain"
+)
+
+// sniffLength is the number of leading bytes DetectContentType inspects,
+// apart from zip archives, which are read as a whole.
+const sniffLength = 1024
+
+// ContentTypeDetection compares the declared media type of a file with the
+// type detected from its content.
+type ContentTypeDetection struct {
+	// Declared is the media type of the Content-Type header.
+	Declared string
+
+	// Detected is the media type detected from the content. See
+	// DetectContentType.
+	Detected string
+
+	// Filename is the decoded file name, see AttachedFile.Filename, and
+	// ExtensionType is the media type its extension implies, or an empty
+	// string for unknown extensions.
+	Filename      string
+	ExtensionType string
+
+	// Mismatch reports whether the detected type contradicts the declared
+	// type or the file name extension, for example an "invoice.pdf" that is
+	// a Windows executable. Generic declared types such as
+	// application/octet-stream and undetected content are never reported
+	// as mismatches.
+	Mismatch bool
+}
+
+type contentSignature struct {
+	offset    int
+	magic     string
+	mediaType string
+}
+
+// DetectContentType detects the media type of the content of an attached
+// file.
+func (f AttachedFile) DetectContentType() ContentTypeDetection {
+	return detectFileContentType(
+		f.ContentType,
+		f.ContentDisposition,
+		f.Data,
+	)
+}
+
+// DetectContentType detects the media type of the content of an inline
+// file.
+func (f InlineFile) DetectContentType() ContentTypeDetection {
+	return detectFileContentType(
+		f.ContentType,
+		f.ContentDisposition,
+		f.Data,
+	)
+}
+
+func detectFileContentType(
+	contentType ContentTypeHeader,
+	contentDisposition ContentDispositionHeader,
+	data []byte,
+) ContentTypeDetection {
+	filename := fileFilename(contentType, contentDisposition).Name
+
+	detection := ContentTypeDetection{
+		Declared:      strings.ToLower(contentType.ContentType),
+		Detected:      DetectContentType(data),
+		Filename:      filename,
+		ExtensionType: extensionContentType(filename),
+		Mismatch:      false,
+	}
+
+	if detection.Detected == ContentTypeOctetStream ||
+		detection.Detected == ContentTypeTextPlain {
+		return detection
+	}
+
+	if !isGenericContentType(detection.Declared) &&
+		!isCompatibleContentType(detection.Detected, detection.Declared) {
+		detection.Mismatch = true
+	}
+
+	if detection.ExtensionType != "" &&
+		!isCompatibleContentType(
+			detection.Detected,
+			detection.ExtensionType,
+		) {
+		detection.Mismatch = true
+	}
+
+	return detection
+}
+
+// DetectContentType returns the media type of data detected from the
+// magic numbers of common archive, office document, PDF, image and
+// executable formats. Zip archives are inspected to tell Office Open XML,
+// OpenDocument, EPUB, Java and Android packages apart.
+//
+// Data that is not recognised is reported as "text/plain" when it is valid
+// UTF-8 without control characters, and as "application/octet-stream"
+// otherwise.
+func DetectContentType(data []byte) string {
+	for _, signature := range contentSignatures() {
+		end := signature.offset + len(signature.magic)
+		if len(data) >= end &&
+			string(data[signature.offset:end]) == signature.magic {
+			return refineContentType(signature.mediaType, data)
+		}
+	}
+
+	head := data
+	if len(head) > sniffLength {
+		head = head[:sniffLength]
+	}
+
+	if bytes.Contains(head, []byte("%PDF-")) {
+		return "application/pdf"
+	}
+
+	if mediaType := detectMarkupContentType(head); mediaType != "" {
+		return mediaType
+	}
+
+	if isPlainText(head) {
+		return ContentTypeTextPlain
+	}
+
+	return ContentTypeOctetStream
+}
+
+// contentSignatures lists the magic numbers of the formats that
+// DetectContentType recognises.
+func contentSignatures() []contentSignature {
+	return []contentSignature{
+		{0, "%PDF-", "application/pdf"},
+		{0, "PK\x03\x04", "application/zip"},
+		{0, "PK\x05\x06", "application/zip"},
+		{0, "PK\x07\x08", "application/zip"},
+		{0, "Rar!\x1a\x07", "application/vnd.rar"},
+		{0, "7z\xbc\xaf\x27\x1c", "application/x-7z-compressed"},
+		{0, "\x1f\x8b", "application/gzip"},
+		{0, "BZh", "application/x-bzip2"},
+		{0, "\xfd7zXZ\x00", "application/x-xz"},
+		{257, "ustar", "application/x-tar"},
+		{0, "MSCF\x00\x00\x00\x00", "application/vnd.ms-cab-compressed"},
+		{0, "\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1", "application/x-ole-storage"},
+		{0, "{\\rtf", "application/rtf"},
+		{0, "\x78\x9f\x3e\x22", "application/vnd.ms-tnef"},
+		{0, "\x89PNG\r\n\x1a\n", "image/png"},
+		{0, "\xff\xd8\xff", "image/jpeg"},
+		{0, "GIF87a", "image/gif"},
+		{0, "GIF89a", "image/gif"},
+		{8, "WEBP", "image/webp"},
+		{0, "II*\x00", "image/tiff"},
+		{0, "MM\x00*", "image/tiff"},
+		{0, "\x00\x00\x01\x00", "image/vnd.microsoft.icon"},
+		{4, "ftypheic", "image/heic"},
+		{4, "ftypheix", "image/heic"},
+		{4, "ftypmif1", "image/heif"},
+		{0, "BM", "image/bmp"},
+		{0, "MZ", "application/vnd.microsoft.portable-executable"},
+		{0, "\x7fELF", "application/x-executable"},
+		{0, "\xfe\xed\xfa\xce", "application/x-mach-binary"},
+		{0, "\xfe\xed\xfa\xcf", "application/x-mach-binary"},
+		{0, "\xce\xfa\xed\xfe", "application/x-mach-binary"},
+		{0, "\xcf\xfa\xed\xfe", "application/x-mach-binary"},
+		{0, "L\x00\x00\x00\x01\x14\x02\x00", "application/x-ms-shortcut"},
+		{0, "#!", "text/x-shellscript"},
+		{0, "%!PS", "application/postscript"},
+	}
+}
+
+// refineContentType narrows down the media type of container formats.
+func refineContentType(mediaType string, data []byte) string {
+	switch mediaType {
+	case "application/zip":
+		return detectZipContentType(data)
+	case "image/webp":
+		if !bytes.HasPrefix(data, []byte("RIFF")) {
+			return ContentTypeOctetStream
+		}
+	case "image/bmp":
+		// "BM" is short enough to start unrelated data, so the file size
+		// in the header must match.
+		const bmpHeaderLength = 14
+		if len(data) < bmpHeaderLength ||
+			int(binary.LittleEndian.Uint32(data[2:6])) != len(data) {
+			return detectTextContentType(data)
+		}
+	case "text/x-shellscript":
+		return detectTextContentType(data)
+	default:
+	}
+
+	return mediaType
+}
+
+func detectTextContentType(data []byte) string {
+	if len(data) > sniffLength {
+		data = data[:sniffLength]
+	}
+
+	if isPlainText(data) {
+		if bytes.HasPrefix(data, []byte("#!")) {
+			return "text/x-shellscript"
+		}
+
+		return ContentTypeTextPlain
+	}
+
+	return ContentTypeOctetStream
+}
+
+// detectZipContentType tells apart the formats that are zip archives from
+// the files they contain.
+func detectZipContentType(data []byte) string {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "application/zip"
+	}
+
+	for _, file := range reader.File {
+		switch file.Name {
+		case "mimetype":
+			mediaType := readZipMimetype(file)
+			if mediaType != "" {
+				return mediaType
+			}
+		case "word/document.xml":
+			return "application/" +
+				"vnd.openxmlformats-officedocument.wordprocessingml.document"
+		case "xl/workbook.xml":
+			return "application/" +
+				"vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+		case "ppt/presentation.xml":
+			return "application/" +
+				"vnd.openxmlformats-officedocument.presentationml.presentation"
+		case "AndroidManifest.xml":
+			return "application/vnd.android.package-archive"
+		case "META-INF/MANIFEST.MF":
+			return "application/java-archive"
+		default:
+		}
+	}
+
+	return "application/zip"
+}
+
+// readZipMimetype returns the content of the mimetype file of OpenDocument
+// and EPUB files.
+func readZipMimetype(file *zip.File) string {
+	const maxMimetypeLength = 100
+
+	if file.UncompressedSize64 > maxMimetypeLength {
+		return ""
+	}
+
+	reader, err := file.Open()
+	if err != nil {
+		return ""
+	}
+
+	content, err := io.ReadAll(io.LimitReader(reader, maxMimetypeLength))
+	if closeErr := reader.Close(); err != nil || closeErr != nil {
+		return ""
+	}
+
+	mediaType := strings.TrimSpace(string(content))
+
+	if !strings.HasPrefix(mediaType, "application/") {
+		return ""
+	}
+
+	return mediaType
+}
+
+// detectMarkupContentType detects HTML and SVG documents.
+func detectMarkupContentType(head []byte) string {
+	text := strings.ToLower(strings.TrimLeft(
+		strings.TrimPrefix(string(head), "\ufeff"),
+		" \t\r\n",
+	))
+
+	for _, prefix := range []string{
+		"<!doctype html",
+		"<html",
+		"<head",
+		"<body",
+		"<script",
+	} {
+		if strings.HasPrefix(text, prefix) {
+			return "text/html"
+		}
+	}
+
+	if strings.HasPrefix(text, "<svg") ||
+		(strings.HasPrefix(text, "<?xml") && strings.Contains(text, "<svg")) {
+		return "image/svg+xml"
+	}
+
+	return ""
+}
+
+func isPlainText(data []byte) bool {
+	// The data may end in the middle of a character when it was cut to
+	// sniffLength.
+	for i := 0; i < utf8.UTFMax-1 && !utf8.Valid(data); i++ {
+		data = data[:len(data)-1]
+	}
+
+	if !utf8.Valid(data) {
+		return false
+	}
+
+	for _, c := range data {
+		if c < ' ' && c != '\t' && c != '\n' && c != '\r' && c != '\f' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// extensionContentType returns the media type implied by the extension of a
+// file name, or an empty string for unknown extensions.
+func extensionContentType(filename string) string {
+	extension := strings.ToLower(path.Ext(filename))
+
+	switch extension {
+	case ".pdf":
+		return "application/pdf"
+	case ".zip":
+		return "application/zip"
+	case ".docx":
+		return "application/" +
+			"vnd.openxmlformats-officedocument.wordprocessingml.document"
+	case ".xlsx":
+		return "application/" +
+			"vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case ".pptx":
+		return "application/" +
+			"vnd.openxmlformats-officedocument.presentationml.presentation"
+	case ".odt":
+		return "application/vnd.oasis.opendocument.text"
+	case ".ods":
+		return "application/vnd.oasis.opendocument.spreadsheet"
+	case ".odp":
+		return "application/vnd.oasis.opendocument.presentation"
+	case ".epub":
+		return "application/epub+zip"
+	case ".jar":
+		return "application/java-archive"
+	case ".apk":
+		return "application/vnd.android.package-archive"
+	case ".doc":
+		return "application/msword"
+	case ".xls":
+		return "application/vnd.ms-excel"
+	case ".ppt":
+		return "application/vnd.ms-powerpoint"
+	case ".msg":
+		return "application/vnd.ms-outlook"
+	case ".msi":
+		return "application/x-msi"
+	case ".rtf":
+		return "application/rtf"
+	case ".rar":
+		return "application/vnd.rar"
+	case ".7z":
+		return "application/x-7z-compressed"
+	case ".gz", ".tgz":
+		return "application/gzip"
+	case ".bz2":
+		return "application/x-bzip2"
+	case ".xz":
+		return "application/x-xz"
+	case ".tar":
+		return "application/x-tar"
+	case ".cab":
+		return "application/vnd.ms-cab-compressed"
+	case ".png":
+		return "image/png"
+	case ".jpg", ".jpeg", ".jpe":
+		return "image/jpeg"
+	case ".gif":
+		return "image/gif"
+	case ".webp":
+		return "image/webp"
+	case ".tif", ".tiff":
+		return "image/tiff"
+	case ".ico":
+		return "image/vnd.microsoft.icon"
+	case ".heic":
+		return "image/heic"
+	case ".bmp":
+		return "image/bmp"
+	case ".svg":
+		return "image/svg+xml"
+	case ".exe", ".dll", ".scr", ".sys", ".cpl":
+		return "application/vnd.microsoft.portable-executable"
+	case ".lnk":
+		return "application/x-ms-shortcut"
+	case ".html", ".htm":
+		return "text/html"
+	case ".txt", ".csv":
+		return ContentTypeTextPlain
+	default:
+		return ""
+	}
+}
+
+// fileContentType returns the media type detected from the content of a
+// file, or implied by its name when the content is not recognized.
+func fileContentType(filename string, data []byte) string {
+	contentType := DetectContentType(data)
+
+	byExtension := extensionContentType(filename)
+	if isGenericContentType(contentType) && byExtension != "" {
+		return byExtension
+	}
+
+	return contentType
+}
+
+func isGenericContentType(mediaType string) bool {
+	switch mediaType {
+	case "",
+		ContentTypeOctetStream,
+		"application/unknown",
+		"application/binary",
+		"application/download",
+		"application/x-download",
+		"application/force-download":
+		return true
+	default:
+		return false
+	}
+}
+
+// isCompatibleContentType reports whether content of the detected media
+// type can be a file of the expected media type.
+func isCompatibleContentType(detected string, expected string) bool {
+	detected = canonicalContentType(detected)
+	expected = canonicalContentType(expected)
+
+	if detected == expected {
+		return true
+	}
+
+	switch detected {
+	case "application/zip":
+		// A damaged document may not be recognised beyond being a zip
+		// archive.
+		return isZipBasedContentType(expected)
+	case "application/x-ole-storage":
+		switch expected {
+		case "application/msword",
+			"application/vnd.ms-excel",
+			"application/vnd.ms-powerpoint",
+			"application/vnd.ms-outlook",
+			"application/x-msi":
+			return true
+		default:
+			return false
+		}
+	case "application/gzip":
+		return expected == "application/x-tar"
+	case "image/heif":
+		return expected == "image/heic"
+	case "text/html", "image/svg+xml", "text/x-shellscript":
+		return strings.HasPrefix(expected, "text/")
+	default:
+		return false
+	}
+}
+
+func isZipBasedContentType(mediaType string) bool {
+	return strings.HasPrefix(
+		mediaType,
+		"application/vnd.openxmlformats-officedocument.",
+	) ||
+		strings.HasPrefix(mediaType, "application/vnd.oasis.opendocument.") ||
+		strings.HasSuffix(mediaType, "+zip") ||
+		mediaType == "application/java-archive" ||
+		mediaType == "application/vnd.android.package-archive"
+}
+
+// canonicalContentType maps aliases of media types to the names that
+// DetectContentType returns.
+func canonicalContentType(mediaType string) string {
+	switch mediaType {
+	case "application/x-zip-compressed", "application/x-zip":
+		return "application/zip"
+	case "application/x-pdf":
+		return "application/pdf"
+	case "application/x-gzip", "application/x-compressed":
+		return "application/gzip"
+	case "application/x-rar-compressed", "application/x-rar":
+		return "application/vnd.rar"
+	case "image/jpg", "image/pjpeg":
+		return "image/jpeg"
+	case "image/x-png":
+		return "image/png"
+	case "image/x-icon":
+		return "image/vnd.microsoft.icon"
+	case "image/x-ms-bmp", "image/x-bmp":
+		return "image/bmp"
+	case "text/rtf":
+		return "application/rtf"
+	case "application/x-msdownload",
+		"application/x-msdos-program",
+		"application/x-dosexec",
+		"application/exe":
+		return "application/vnd.microsoft.portable-executable"
+	case "application/x-tnef":
+		return "application/vnd.ms-tnef"
+	default:
+		return mediaType
+	}
+}
@@ -0,0 +1,222 @@
+package letters_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/mnako/letters"
+)
+
+func zipTestData(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var b bytes.Buffer
+
+	writer := zip.NewWriter(&b)
+
+	for name, content := range files {
+		file, err := writer.Create(name)
+		if err != nil {
+			t.Fatalf("cannot create zip entry: %s", err)
+		}
+
+		_, err = file.Write([]byte(content))
+		if err != nil {
+			t.Fatalf("cannot write zip entry: %s", err)
+		}
+	}
+
+	err := writer.Close()
+	if err != nil {
+		t.Fatalf("cannot close zip: %s", err)
+	}
+
+	return b.Bytes()
+}
+
+func TestDetectContentType(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{
+			name:     "PDF",
+			data:     []byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n"),
+			expected: "application/pdf",
+		},
+		{
+			name:     "PE executable",
+			data:     append([]byte("MZ\x90\x00\x03"), make([]byte, 64)...),
+			expected: "application/vnd.microsoft.portable-executable",
+		},
+		{
+			name:     "ELF executable",
+			data:     []byte("\x7fELF\x02\x01\x01\x00"),
+			expected: "application/x-executable",
+		},
+		{
+			name:     "PNG",
+			data:     []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"),
+			expected: "image/png",
+		},
+		{
+			name:     "JPEG",
+			data:     []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00"),
+			expected: "image/jpeg",
+		},
+		{
+			name:     "WebP",
+			data:     []byte("RIFF\x24\x00\x00\x00WEBPVP8 "),
+			expected: "image/webp",
+		},
+		{
+			name:     "OLE compound file",
+			data:     []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1\x00\x00"),
+			expected: "application/x-ole-storage",
+		},
+		{
+			name: "docx",
+			data: zipTestData(t, map[string]string{
+				"[Content_Types].xml": "<Types/>",
+				"word/document.xml":   "<w:document/>",
+			}),
+			expected: "application/" +
+				"vnd.openxmlformats-officedocument.wordprocessingml.document",
+		},
+		{
+			name: "OpenDocument",
+			data: zipTestData(t, map[string]string{
+				"mimetype": "application/vnd.oasis.opendocument.text",
+			}),
+			expected: "application/vnd.oasis.opendocument.text",
+		},
+		{
+			name: "zip",
+			data: zipTestData(t, map[string]string{
+				"invoice.exe": "MZ",
+			}),
+			expected: "application/zip",
+		},
+		{
+			name:     "HTML",
+			data:     []byte("\xef\xbb\xbf\n<!DOCTYPE html><html><body>"),
+			expected: "text/html",
+		},
+		{
+			name:     "text that starts with BM",
+			data:     []byte("BM: the quarterly numbers are attached"),
+			expected: "text/plain",
+		},
+		{
+			name:     "unknown binary",
+			data:     []byte{0x00, 0x01, 0x02, 0x03},
+			expected: "application/octet-stream",
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			detected := letters.DetectContentType(testCase.data)
+			if detected != testCase.expected {
+				t.Errorf(
+					"unexpected content type: got %q, expected %q",
+					detected,
+					testCase.expected,
+				)
+			}
+		})
+	}
+}
+
+func TestAttachedFileDetectContentType(t *testing.T) {
+	t.Parallel()
+
+	executable := append([]byte("MZ\x90\x00"), make([]byte, 64)...)
+
+	testCases := []struct {
+		name             string
+		contentType      string
+		filename         string
+		data             []byte
+		expectedMismatch bool
+	}{
+		{
+			name:             "executable declared as PDF",
+			contentType:      "application/pdf",
+			filename:         "invoice.pdf",
+			data:             executable,
+			expectedMismatch: true,
+		},
+		{
+			name:             "executable with generic type and PDF name",
+			contentType:      "application/octet-stream",
+			filename:         "invoice.pdf",
+			data:             executable,
+			expectedMismatch: true,
+		},
+		{
+			name:             "PDF with generic type",
+			contentType:      "application/octet-stream",
+			filename:         "invoice.pdf",
+			data:             []byte("%PDF-1.4\n"),
+			expectedMismatch: false,
+		},
+		{
+			name:             "JPEG declared with an alias",
+			contentType:      "image/jpg",
+			filename:         "photo.JPG",
+			data:             []byte("\xff\xd8\xff\xe1\x00\x10Exif"),
+			expectedMismatch: false,
+		},
+		{
+			name:             "Word document in a compound file",
+			contentType:      "application/msword",
+			filename:         "report.doc",
+			data:             []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1\x00"),
+			expectedMismatch: false,
+		},
+		{
+			name:             "unrecognised content",
+			contentType:      "application/pdf",
+			filename:         "invoice.pdf",
+			data:             []byte{0x00, 0x01},
+			expectedMismatch: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			file := letters.AttachedFile{
+				ContentType: letters.ContentTypeHeader{
+					ContentType: testCase.contentType,
+					Params:      map[string]string{},
+				},
+				ContentDisposition: letters.ContentDispositionHeader{
+					ContentDisposition: letters.ContentDispositionAttachment,
+					Params: map[string]string{
+						"filename": testCase.filename,
+					},
+				},
+				Data: testCase.data,
+			}
+
+			detection := file.DetectContentType()
+
+			if detection.Declared != testCase.contentType ||
+				detection.Filename != testCase.filename ||
+				detection.Mismatch != testCase.expectedMismatch {
+				t.Errorf("unexpected detection: %#v", detection)
+			}
+		})
+	}
+}
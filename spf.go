@@ -0,0 +1,1192 @@
+package letters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SPFResult is the result of an SPF evaluation as defined in RFC 7208
+// Section 2.6.
+type SPFResult string
+
+// SPF results defined in RFC 7208 Section 2.6.
+const (
+	SPFResultNone      SPFResult = "none"
+	SPFResultNeutral   SPFResult = "neutral"
+	SPFResultPass      SPFResult = "pass"
+	SPFResultFail      SPFResult = "fail"
+	SPFResultSoftFail  SPFResult = "softfail"
+	SPFResultTempError SPFResult = "temperror"
+	SPFResultPermError SPFResult = "permerror"
+)
+
+const (
+	spfMaxDNSLookups  = 10
+	spfMaxVoidLookups = 2
+	spfMaxNames       = 10
+	spfMaxDomainSize  = 253
+	spfMaxLabelSize   = 63
+	spfIPv4Bits       = 32
+	spfIPv6Bits       = 128
+)
+
+// SPFQuery contains the identities that CheckSPF evaluates.
+//
+// IP is the address of the SMTP client, HELO is the domain given in the
+// HELO or EHLO command, and MailFrom is the reverse-path given in the MAIL
+// FROM command. An empty MailFrom means a null reverse-path, in which case
+// CheckSPF evaluates the HELO identity as RFC 7208 Section 2.4 requires.
+type SPFQuery struct {
+	IP       net.IP
+	HELO     string
+	MailFrom string
+}
+
+// SPFCheckResult contains the outcome of an SPF evaluation.
+type SPFCheckResult struct {
+	Result SPFResult
+
+	// Domain is the domain whose SPF policy was evaluated first, i.e. the
+	// domain of the sender identity.
+	Domain string
+
+	// Sender is the sender identity, e.g. "postmaster@mail.example.com"
+	// when MAIL FROM was empty.
+	Sender string
+
+	// Mechanism is the directive that matched, if any.
+	Mechanism string
+
+	// Explanation is the expanded "exp=" explanation string returned with
+	// a fail result, if the domain publishes one.
+	Explanation string
+}
+
+type spfScope struct {
+	domain       string
+	sender       string
+	localPart    string
+	senderDomain string
+}
+
+type spfDirective struct {
+	raw        string
+	qualifier  byte
+	mechanism  string
+	domainSpec string
+	network    *net.IPNet
+	cidr4      int
+	cidr6      int
+}
+
+type spfRecord struct {
+	directives []spfDirective
+	redirect   string
+	exp        string
+}
+
+type spfEvaluation struct {
+	result      SPFResult
+	mechanism   string
+	explanation string
+}
+
+type spfChecker struct {
+	resolver    DNSResolver
+	ip          net.IP
+	helo        string
+	now         time.Time
+	lookups     int
+	voidLookups int
+}
+
+// CheckSPF evaluates the SPF policy of the sender identity in query
+// according to the check_host() function of RFC 7208.
+//
+// A temperror or permerror result is returned together with an error
+// wrapping ErrSPFTempError or ErrSPFPermError that describes the cause.
+func CheckSPF(
+	ctx context.Context,
+	resolver DNSResolver,
+	query SPFQuery,
+) (SPFCheckResult, error) {
+	if query.IP == nil {
+		return SPFCheckResult{Result: SPFResultNone}, fmt.Errorf(
+			"%w: missing client IP address",
+			ErrInvalidSPFQuery,
+		)
+	}
+
+	helo := strings.TrimSuffix(strings.TrimSpace(query.HELO), ".")
+
+	sender := strings.Trim(strings.TrimSpace(query.MailFrom), "<>")
+	if sender == "" {
+		sender = "postmaster@" + helo
+	}
+
+	localPart, senderDomain, ok := strings.Cut(sender, "@")
+	if !ok {
+		localPart, senderDomain = "", sender
+	}
+
+	if localPart == "" {
+		localPart = "postmaster"
+	}
+
+	senderDomain = strings.TrimSuffix(senderDomain, ".")
+	sender = localPart + "@" + senderDomain
+
+	checker := &spfChecker{
+		resolver: resolver,
+		ip:       query.IP,
+		helo:     helo,
+		now:      time.Now(),
+	}
+
+	evaluation, err := checker.checkHost(
+		ctx,
+		spfScope{
+			domain:       senderDomain,
+			sender:       sender,
+			localPart:    localPart,
+			senderDomain: senderDomain,
+		},
+	)
+
+	result := SPFCheckResult{
+		Result:      evaluation.result,
+		Domain:      senderDomain,
+		Sender:      sender,
+		Mechanism:   evaluation.mechanism,
+		Explanation: evaluation.explanation,
+	}
+	if err != nil {
+		return result, fmt.Errorf(
+			"letters.spf.CheckSPF: cannot evaluate SPF for %q: %w",
+			sender,
+			err,
+		)
+	}
+
+	return result, nil
+}
+
+// SPFQueryFromHeaders builds an SPFQuery from the headers added by the
+// receiving MTA.
+//
+// The client IP address and the HELO domain are taken from the "from"
+// clause of the topmost Received header, e.g.
+// "from mail.example.com (mail.example.com [192.0.2.1]) by ...". MailFrom
+// is taken from the topmost Return-Path header.
+func SPFQueryFromHeaders(headers Headers) (SPFQuery, error) {
+	var query SPFQuery
+
+	receivedHeaders := headers.ExtraHeaders["Received"]
+	if len(receivedHeaders) == 0 {
+		return query, fmt.Errorf(
+			"letters.spf.SPFQueryFromHeaders: %w",
+			ErrNoReceivedHeader,
+		)
+	}
+
+	helo, ip := parseReceivedFromClause(receivedHeaders[0])
+	if ip == nil {
+		return query, fmt.Errorf(
+			"letters.spf.SPFQueryFromHeaders: %w in %q",
+			ErrNoConnectingIP,
+			receivedHeaders[0],
+		)
+	}
+
+	query.IP = ip
+	query.HELO = helo
+
+	returnPaths := headers.ExtraHeaders["Return-Path"]
+	if len(returnPaths) > 0 {
+		query.MailFrom = strings.Trim(strings.TrimSpace(returnPaths[0]), "<>")
+	}
+
+	return query, nil
+}
+
+func parseReceivedFromClause(received string) (string, net.IP) {
+	fields := strings.Fields(received)
+	if len(fields) < 2 || !strings.EqualFold(fields[0], "from") {
+		return "", nil
+	}
+
+	helo := strings.Trim(fields[1], "[]")
+
+	// The from clause ends where the "by" clause starts.
+	clause := received
+
+	index := indexFold(received, " by ")
+	if index >= 0 {
+		clause = received[:index]
+	}
+
+	for {
+		start := strings.IndexByte(clause, '[')
+		if start < 0 {
+			return helo, nil
+		}
+
+		end := strings.IndexByte(clause[start:], ']')
+		if end < 0 {
+			return helo, nil
+		}
+
+		literal := clause[start+1 : start+end]
+		if len(literal) > 5 && strings.EqualFold(literal[:5], "ipv6:") {
+			literal = literal[5:]
+		}
+
+		if ip := net.ParseIP(literal); ip != nil {
+			return helo, ip
+		}
+
+		clause = clause[start+end+1:]
+	}
+}
+
+func isValidSPFDomain(domain string) bool {
+	domain = strings.TrimSuffix(domain, ".")
+	if domain == "" || len(domain) > spfMaxDomainSize {
+		return false
+	}
+
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return false
+	}
+
+	for _, label := range labels {
+		if label == "" || len(label) > spfMaxLabelSize {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c *spfChecker) checkHost(
+	ctx context.Context,
+	scope spfScope,
+) (spfEvaluation, error) {
+	if !isValidSPFDomain(scope.domain) {
+		return spfEvaluation{result: SPFResultNone}, nil
+	}
+
+	rawRecord, err := c.lookupRecord(ctx, scope.domain)
+	if err != nil {
+		return spfEvaluation{result: spfResultForError(err)}, err
+	}
+
+	if rawRecord == "" {
+		return spfEvaluation{result: SPFResultNone}, nil
+	}
+
+	record, err := parseSPFRecord(rawRecord)
+	if err != nil {
+		return spfEvaluation{result: SPFResultPermError}, err
+	}
+
+	for _, directive := range record.directives {
+		matched, err := c.matches(ctx, scope, directive)
+		if err != nil {
+			return spfEvaluation{result: spfResultForError(err)}, err
+		}
+
+		if !matched {
+			continue
+		}
+
+		evaluation := spfEvaluation{
+			result:    spfQualifierResult(directive.qualifier),
+			mechanism: directive.raw,
+		}
+
+		if evaluation.result == SPFResultFail && record.exp != "" {
+			evaluation.explanation = c.explain(ctx, scope, record.exp)
+		}
+
+		return evaluation, nil
+	}
+
+	if record.redirect == "" {
+		return spfEvaluation{result: SPFResultNeutral}, nil
+	}
+
+	err = c.countLookup()
+	if err != nil {
+		return spfEvaluation{result: SPFResultPermError}, err
+	}
+
+	target, err := c.expand(scope, record.redirect, false)
+	if err != nil {
+		return spfEvaluation{result: SPFResultPermError}, err
+	}
+
+	redirectScope := scope
+	redirectScope.domain = target
+
+	evaluation, err := c.checkHost(ctx, redirectScope)
+	if err != nil {
+		return evaluation, err
+	}
+
+	if evaluation.result == SPFResultNone {
+		return spfEvaluation{result: SPFResultPermError}, fmt.Errorf(
+			"%w: redirect target %q has no SPF record",
+			ErrSPFPermError,
+			target,
+		)
+	}
+
+	return evaluation, nil
+}
+
+func (c *spfChecker) lookupRecord(
+	ctx context.Context,
+	domain string,
+) (string, error) {
+	txts, err := c.resolver.LookupTXT(ctx, domain)
+	if err != nil {
+		if isDNSNotFound(err) {
+			return "", nil
+		}
+
+		return "", fmt.Errorf(
+			"%w: cannot look up TXT records of %q: %w",
+			ErrSPFTempError,
+			domain,
+			err,
+		)
+	}
+
+	var records []string
+
+	for _, txt := range txts {
+		lowerTxt := strings.ToLower(txt)
+		if lowerTxt == "v=spf1" || strings.HasPrefix(lowerTxt, "v=spf1 ") {
+			records = append(records, txt)
+		}
+	}
+
+	switch len(records) {
+	case 0:
+		return "", nil
+	case 1:
+		return records[0], nil
+	default:
+		return "", fmt.Errorf(
+			"%w: %q publishes %d SPF records",
+			ErrSPFPermError,
+			domain,
+			len(records),
+		)
+	}
+}
+
+func isSPFModifierName(name string) bool {
+	if name == "" || !isASCIILetter(name[0]) {
+		return false
+	}
+
+	for i := 1; i < len(name); i++ {
+		b := name[i]
+		if !isASCIILetter(b) && !isASCIIDigit(b) &&
+			b != '-' && b != '_' && b != '.' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isASCIILetter(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+func isASCIIDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+func parseSPFRecord(record string) (spfRecord, error) {
+	var parsed spfRecord
+
+	fields := strings.Fields(record)
+
+	for _, term := range fields[1:] {
+		name, value, isModifier := strings.Cut(term, "=")
+		if isModifier && isSPFModifierName(name) {
+			switch strings.ToLower(name) {
+			case "redirect":
+				if parsed.redirect != "" {
+					return parsed, fmt.Errorf(
+						"%w: duplicate redirect modifier",
+						ErrSPFPermError,
+					)
+				}
+
+				parsed.redirect = value
+			case "exp":
+				if parsed.exp != "" {
+					return parsed, fmt.Errorf(
+						"%w: duplicate exp modifier",
+						ErrSPFPermError,
+					)
+				}
+
+				parsed.exp = value
+			}
+
+			continue
+		}
+
+		directive, err := parseSPFDirective(term)
+		if err != nil {
+			return parsed, err
+		}
+
+		parsed.directives = append(parsed.directives, directive)
+	}
+
+	return parsed, nil
+}
+
+func parseSPFDirective(term string) (spfDirective, error) {
+	directive := spfDirective{
+		raw:       term,
+		qualifier: '+',
+		cidr4:     spfIPv4Bits,
+		cidr6:     spfIPv6Bits,
+	}
+
+	if strings.ContainsRune("+-~?", rune(term[0])) {
+		directive.qualifier = term[0]
+		term = term[1:]
+	}
+
+	name, rest := term, ""
+	if index := strings.IndexAny(term, ":/"); index >= 0 {
+		name, rest = term[:index], term[index:]
+	}
+
+	directive.mechanism = strings.ToLower(name)
+
+	switch directive.mechanism {
+	case "all":
+		if rest != "" {
+			return directive, spfSyntaxError(directive.raw)
+		}
+	case "include", "exists":
+		if !strings.HasPrefix(rest, ":") || len(rest) == 1 {
+			return directive, spfSyntaxError(directive.raw)
+		}
+
+		directive.domainSpec = rest[1:]
+	case "ptr":
+		if rest != "" {
+			if !strings.HasPrefix(rest, ":") || len(rest) == 1 {
+				return directive, spfSyntaxError(directive.raw)
+			}
+
+			directive.domainSpec = rest[1:]
+		}
+	case "a", "mx":
+		return parseSPFDualCIDRDirective(directive, rest)
+	case "ip4", "ip6":
+		return parseSPFIPDirective(directive, rest)
+	default:
+		return directive, fmt.Errorf(
+			"%w: unknown mechanism %q",
+			ErrSPFPermError,
+			directive.raw,
+		)
+	}
+
+	return directive, nil
+}
+
+func parseSPFDualCIDRDirective(
+	directive spfDirective,
+	rest string,
+) (spfDirective, error) {
+	if strings.HasPrefix(rest, ":") {
+		domainSpec, cidr, hasCIDR := strings.Cut(rest[1:], "/")
+		if domainSpec == "" {
+			return directive, spfSyntaxError(directive.raw)
+		}
+
+		directive.domainSpec = domainSpec
+
+		rest = ""
+		if hasCIDR {
+			rest = "/" + cidr
+		}
+	}
+
+	if rest == "" {
+		return directive, nil
+	}
+
+	cidr4, cidr6, hasCIDR6 := strings.Cut(rest[1:], "//")
+	if strings.HasPrefix(rest, "//") {
+		cidr4, cidr6, hasCIDR6 = "", rest[2:], true
+	}
+
+	if !hasCIDR6 && cidr4 == "" {
+		return directive, spfSyntaxError(directive.raw)
+	}
+
+	var err error
+
+	if cidr4 != "" {
+		directive.cidr4, err = parseSPFCIDR(cidr4, spfIPv4Bits)
+		if err != nil {
+			return directive, spfSyntaxError(directive.raw)
+		}
+	}
+
+	if hasCIDR6 {
+		directive.cidr6, err = parseSPFCIDR(cidr6, spfIPv6Bits)
+		if err != nil {
+			return directive, spfSyntaxError(directive.raw)
+		}
+	}
+
+	return directive, nil
+}
+
+func parseSPFIPDirective(
+	directive spfDirective,
+	rest string,
+) (spfDirective, error) {
+	if !strings.HasPrefix(rest, ":") {
+		return directive, spfSyntaxError(directive.raw)
+	}
+
+	bits := spfIPv4Bits
+	if directive.mechanism == "ip6" {
+		bits = spfIPv6Bits
+	}
+
+	address, cidr, hasCIDR := strings.Cut(rest[1:], "/")
+
+	ip := net.ParseIP(address)
+	if ip == nil || (bits == spfIPv4Bits) != (ip.To4() != nil) {
+		return directive, spfSyntaxError(directive.raw)
+	}
+
+	ones := bits
+	if hasCIDR {
+		var err error
+
+		ones, err = parseSPFCIDR(cidr, bits)
+		if err != nil {
+			return directive, spfSyntaxError(directive.raw)
+		}
+	}
+
+	if bits == spfIPv4Bits {
+		ip = ip.To4()
+	}
+
+	directive.network = &net.IPNet{
+		IP:   ip.Mask(net.CIDRMask(ones, bits)),
+		Mask: net.CIDRMask(ones, bits),
+	}
+
+	return directive, nil
+}
+
+func parseSPFCIDR(s string, bits int) (int, error) {
+	ones, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf(
+			"letters.spf.parseSPFCIDR: cannot parse CIDR length %q: %w",
+			s,
+			err,
+		)
+	}
+
+	if ones < 0 || ones > bits || (len(s) > 1 && s[0] == '0') {
+		return 0, fmt.Errorf(
+			"%w: invalid CIDR length %q",
+			ErrSPFPermError,
+			s,
+		)
+	}
+
+	return ones, nil
+}
+
+func spfSyntaxError(term string) error {
+	return fmt.Errorf("%w: invalid term %q", ErrSPFPermError, term)
+}
+
+func spfQualifierResult(qualifier byte) SPFResult {
+	switch qualifier {
+	case '-':
+		return SPFResultFail
+	case '~':
+		return SPFResultSoftFail
+	case '?':
+		return SPFResultNeutral
+	default:
+		return SPFResultPass
+	}
+}
+
+func spfResultForError(err error) SPFResult {
+	if errors.Is(err, ErrSPFTempError) {
+		return SPFResultTempError
+	}
+
+	return SPFResultPermError
+}
+
+func (c *spfChecker) countLookup() error {
+	c.lookups++
+	if c.lookups > spfMaxDNSLookups {
+		return fmt.Errorf(
+			"%w: more than %d DNS lookups",
+			ErrSPFPermError,
+			spfMaxDNSLookups,
+		)
+	}
+
+	return nil
+}
+
+func (c *spfChecker) countVoidLookup() error {
+	c.voidLookups++
+	if c.voidLookups > spfMaxVoidLookups {
+		return fmt.Errorf(
+			"%w: more than %d void DNS lookups",
+			ErrSPFPermError,
+			spfMaxVoidLookups,
+		)
+	}
+
+	return nil
+}
+
+func (c *spfChecker) targetDomain(
+	scope spfScope,
+	directive spfDirective,
+) (string, error) {
+	if directive.domainSpec == "" {
+		return scope.domain, nil
+	}
+
+	return c.expand(scope, directive.domainSpec, false)
+}
+
+func (c *spfChecker) matches(
+	ctx context.Context,
+	scope spfScope,
+	directive spfDirective,
+) (bool, error) {
+	switch directive.mechanism {
+	case "all":
+		return true, nil
+	case "ip4", "ip6":
+		return directive.network.Contains(c.ip), nil
+	case "include":
+		return c.matchesInclude(ctx, scope, directive)
+	case "exists":
+		return c.matchesExists(ctx, scope, directive)
+	case "a":
+		return c.matchesA(ctx, scope, directive)
+	case "mx":
+		return c.matchesMX(ctx, scope, directive)
+	case "ptr":
+		return c.matchesPTR(ctx, scope, directive)
+	default:
+		return false, nil
+	}
+}
+
+func (c *spfChecker) matchesInclude(
+	ctx context.Context,
+	scope spfScope,
+	directive spfDirective,
+) (bool, error) {
+	err := c.countLookup()
+	if err != nil {
+		return false, err
+	}
+
+	target, err := c.targetDomain(scope, directive)
+	if err != nil {
+		return false, err
+	}
+
+	includeScope := scope
+	includeScope.domain = target
+
+	evaluation, err := c.checkHost(ctx, includeScope)
+	if err != nil {
+		return false, err
+	}
+
+	switch evaluation.result {
+	case SPFResultPass:
+		return true, nil
+	case SPFResultNone:
+		return false, fmt.Errorf(
+			"%w: included domain %q has no SPF record",
+			ErrSPFPermError,
+			target,
+		)
+	case SPFResultFail,
+		SPFResultSoftFail,
+		SPFResultNeutral,
+		SPFResultTempError,
+		SPFResultPermError:
+		return false, nil
+	default:
+		return false, nil
+	}
+}
+
+func (c *spfChecker) matchesExists(
+	ctx context.Context,
+	scope spfScope,
+	directive spfDirective,
+) (bool, error) {
+	err := c.countLookup()
+	if err != nil {
+		return false, err
+	}
+
+	target, err := c.targetDomain(scope, directive)
+	if err != nil {
+		return false, err
+	}
+
+	ips, err := c.lookupIPs(ctx, target, true)
+	if err != nil {
+		return false, err
+	}
+
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (c *spfChecker) matchesA(
+	ctx context.Context,
+	scope spfScope,
+	directive spfDirective,
+) (bool, error) {
+	err := c.countLookup()
+	if err != nil {
+		return false, err
+	}
+
+	target, err := c.targetDomain(scope, directive)
+	if err != nil {
+		return false, err
+	}
+
+	ips, err := c.lookupIPs(ctx, target, true)
+	if err != nil {
+		return false, err
+	}
+
+	return c.containsIP(ips, directive), nil
+}
+
+func (c *spfChecker) matchesMX(
+	ctx context.Context,
+	scope spfScope,
+	directive spfDirective,
+) (bool, error) {
+	err := c.countLookup()
+	if err != nil {
+		return false, err
+	}
+
+	target, err := c.targetDomain(scope, directive)
+	if err != nil {
+		return false, err
+	}
+
+	mxs, err := c.resolver.LookupMX(ctx, target)
+	if err != nil && !isDNSNotFound(err) {
+		return false, fmt.Errorf(
+			"%w: cannot look up MX records of %q: %w",
+			ErrSPFTempError,
+			target,
+			err,
+		)
+	}
+
+	if len(mxs) == 0 {
+		return false, c.countVoidLookup()
+	}
+
+	if len(mxs) > spfMaxNames {
+		return false, fmt.Errorf(
+			"%w: %q has more than %d MX records",
+			ErrSPFPermError,
+			target,
+			spfMaxNames,
+		)
+	}
+
+	for _, mx := range mxs {
+		ips, err := c.lookupIPs(ctx, strings.TrimSuffix(mx.Host, "."), false)
+		if err != nil {
+			return false, err
+		}
+
+		if c.containsIP(ips, directive) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (c *spfChecker) matchesPTR(
+	ctx context.Context,
+	scope spfScope,
+	directive spfDirective,
+) (bool, error) {
+	err := c.countLookup()
+	if err != nil {
+		return false, err
+	}
+
+	target, err := c.targetDomain(scope, directive)
+	if err != nil {
+		return false, err
+	}
+
+	target = strings.ToLower(strings.TrimSuffix(target, "."))
+
+	// RFC 7208 Section 5.5: errors while looking up or validating PTR
+	// names are not fatal; the mechanism simply does not match.
+	names, err := c.resolver.LookupAddr(ctx, c.ip.String())
+	if err != nil {
+		return false, nil //nolint:nilerr // PTR failures mean "no match".
+	}
+
+	if len(names) > spfMaxNames {
+		names = names[:spfMaxNames]
+	}
+
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSuffix(name, "."))
+		if name != target && !strings.HasSuffix(name, "."+target) {
+			continue
+		}
+
+		addrs, err := c.resolver.LookupIPAddr(ctx, name)
+		if err != nil {
+			continue
+		}
+
+		for _, addr := range addrs {
+			if addr.IP.Equal(c.ip) {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+func (c *spfChecker) lookupIPs(
+	ctx context.Context,
+	host string,
+	countVoid bool,
+) ([]net.IP, error) {
+	addrs, err := c.resolver.LookupIPAddr(ctx, host)
+	if err != nil && !isDNSNotFound(err) {
+		return nil, fmt.Errorf(
+			"%w: cannot look up addresses of %q: %w",
+			ErrSPFTempError,
+			host,
+			err,
+		)
+	}
+
+	if len(addrs) == 0 && countVoid {
+		return nil, c.countVoidLookup()
+	}
+
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		ips = append(ips, addr.IP)
+	}
+
+	return ips, nil
+}
+
+func (c *spfChecker) containsIP(ips []net.IP, directive spfDirective) bool {
+	isIPv4 := c.ip.To4() != nil
+
+	for _, ip := range ips {
+		if (ip.To4() != nil) != isIPv4 {
+			continue
+		}
+
+		ones, bits := directive.cidr6, spfIPv6Bits
+		if isIPv4 {
+			ip = ip.To4()
+			ones, bits = directive.cidr4, spfIPv4Bits
+		}
+
+		network := net.IPNet{
+			IP:   ip.Mask(net.CIDRMask(ones, bits)),
+			Mask: net.CIDRMask(ones, bits),
+		}
+		if network.Contains(c.ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *spfChecker) explain(
+	ctx context.Context,
+	scope spfScope,
+	exp string,
+) string {
+	// RFC 7208 Section 6.2: any error while computing the explanation
+	// leaves the explanation empty without changing the result.
+	target, err := c.expand(scope, exp, false)
+	if err != nil {
+		return ""
+	}
+
+	txts, err := c.resolver.LookupTXT(ctx, target)
+	if err != nil || len(txts) != 1 {
+		return ""
+	}
+
+	explanation, err := c.expand(scope, txts[0], true)
+	if err != nil {
+		return ""
+	}
+
+	return explanation
+}
+
+func (c *spfChecker) expand(
+	scope spfScope,
+	spec string,
+	isExplanation bool,
+) (string, error) {
+	var expanded strings.Builder
+
+	for i := 0; i < len(spec); i++ {
+		if spec[i] != '%' {
+			expanded.WriteByte(spec[i])
+
+			continue
+		}
+
+		if i+1 >= len(spec) {
+			return "", spfMacroError(spec)
+		}
+
+		i++
+
+		switch spec[i] {
+		case '%':
+			expanded.WriteByte('%')
+		case '_':
+			expanded.WriteByte(' ')
+		case '-':
+			expanded.WriteString("%20")
+		case '{':
+			end := strings.IndexByte(spec[i:], '}')
+			if end < 0 {
+				return "", spfMacroError(spec)
+			}
+
+			value, err := c.expandMacro(scope, spec[i+1:i+end], isExplanation)
+			if err != nil {
+				return "", err
+			}
+
+			expanded.WriteString(value)
+
+			i += end
+		default:
+			return "", spfMacroError(spec)
+		}
+	}
+
+	result := expanded.String()
+	if isExplanation {
+		return result, nil
+	}
+
+	// RFC 7208 Section 7.3: long expansions are truncated by removing
+	// labels from the left until the domain fits.
+	for len(result) > spfMaxDomainSize {
+		_, right, ok := strings.Cut(result, ".")
+		if !ok {
+			break
+		}
+
+		result = right
+	}
+
+	return result, nil
+}
+
+func (c *spfChecker) expandMacro(
+	scope spfScope,
+	macro string,
+	isExplanation bool,
+) (string, error) {
+	if macro == "" {
+		return "", spfMacroError(macro)
+	}
+
+	letter := macro[0]
+
+	value, ok := c.macroValue(scope, letter|0x20, isExplanation)
+	if !ok {
+		return "", spfMacroError(macro)
+	}
+
+	transformers := macro[1:]
+
+	digitsEnd := 0
+	for digitsEnd < len(transformers) &&
+		isASCIIDigit(transformers[digitsEnd]) {
+		digitsEnd++
+	}
+
+	keep := 0
+	if digitsEnd > 0 {
+		var err error
+
+		keep, err = strconv.Atoi(transformers[:digitsEnd])
+		if err != nil || keep == 0 {
+			return "", spfMacroError(macro)
+		}
+	}
+
+	transformers = transformers[digitsEnd:]
+
+	reverse := false
+	if transformers != "" && transformers[0]|0x20 == 'r' {
+		reverse = true
+		transformers = transformers[1:]
+	}
+
+	delimiters := "."
+	if transformers != "" {
+		if strings.Trim(transformers, ".-+,/_=") != "" {
+			return "", spfMacroError(macro)
+		}
+
+		delimiters = transformers
+	}
+
+	parts := strings.FieldsFunc(value, func(r rune) bool {
+		return strings.ContainsRune(delimiters, r)
+	})
+
+	if reverse {
+		slices.Reverse(parts)
+	}
+
+	if keep > 0 && keep < len(parts) {
+		parts = parts[len(parts)-keep:]
+	}
+
+	value = strings.Join(parts, ".")
+
+	if isASCIILetter(letter) && letter < 'a' {
+		value = url.PathEscape(value)
+	}
+
+	return value, nil
+}
+
+func (c *spfChecker) macroValue(
+	scope spfScope,
+	letter byte,
+	isExplanation bool,
+) (string, bool) {
+	switch letter {
+	case 's':
+		return scope.sender, true
+	case 'l':
+		return scope.localPart, true
+	case 'o':
+		return scope.senderDomain, true
+	case 'd':
+		return scope.domain, true
+	case 'i':
+		return spfMacroIP(c.ip), true
+	case 'p':
+		// Validating the domain name of the client is discouraged by
+		// RFC 7208 Section 7.3; "unknown" is the documented fallback.
+		return "unknown", true
+	case 'v':
+		if c.ip.To4() != nil {
+			return "in-addr", true
+		}
+
+		return "ip6", true
+	case 'h':
+		return c.helo, true
+	case 'c':
+		return c.ip.String(), isExplanation
+	case 'r':
+		return "unknown", isExplanation
+	case 't':
+		return strconv.FormatInt(c.now.Unix(), 10), isExplanation
+	default:
+		return "", false
+	}
+}
+
+func spfMacroIP(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.String()
+	}
+
+	const hexDigits = "0123456789abcdef"
+
+	ip16 := ip.To16()
+	nibbles := make([]string, 0, len(ip16)*2)
+
+	for _, b := range ip16 {
+		nibbles = append(
+			nibbles,
+			string(hexDigits[b>>4]),
+			string(hexDigits[b&0x0f]),
+		)
+	}
+
+	return strings.Join(nibbles, ".")
+}
+
+func spfMacroError(spec string) error {
+	return fmt.Errorf("%w: invalid macro in %q", ErrSPFPermError, spec)
+}
@@ -0,0 +1,442 @@
+package letters_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/mnako/letters"
+)
+
+type fakeDNSResolver struct {
+	txt  map[string][]string
+	ip   map[string][]string
+	mx   map[string][]string
+	ptr  map[string][]string
+	fail map[string]bool
+}
+
+func (r fakeDNSResolver) lookup(
+	records map[string][]string,
+	name string,
+) ([]string, error) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if r.fail[name] {
+		return nil, &net.DNSError{
+			Err:         "server failure",
+			Name:        name,
+			IsTemporary: true,
+		}
+	}
+
+	values, ok := records[name]
+	if !ok {
+		return nil, &net.DNSError{
+			Err:        "no such host",
+			Name:       name,
+			IsNotFound: true,
+		}
+	}
+
+	return values, nil
+}
+
+func (r fakeDNSResolver) LookupTXT(
+	_ context.Context,
+	name string,
+) ([]string, error) {
+	return r.lookup(r.txt, name)
+}
+
+func (r fakeDNSResolver) LookupIPAddr(
+	_ context.Context,
+	host string,
+) ([]net.IPAddr, error) {
+	values, err := r.lookup(r.ip, host)
+
+	addrs := make([]net.IPAddr, 0, len(values))
+	for _, value := range values {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(value)})
+	}
+
+	return addrs, err
+}
+
+func (r fakeDNSResolver) LookupMX(
+	_ context.Context,
+	name string,
+) ([]*net.MX, error) {
+	values, err := r.lookup(r.mx, name)
+
+	mxs := make([]*net.MX, 0, len(values))
+	for _, value := range values {
+		mxs = append(mxs, &net.MX{Host: value + ".", Pref: 10})
+	}
+
+	return mxs, err
+}
+
+func (r fakeDNSResolver) LookupAddr(
+	_ context.Context,
+	addr string,
+) ([]string, error) {
+	return r.lookup(r.ptr, addr)
+}
+
+func newFakeSPFResolver() fakeDNSResolver {
+	return fakeDNSResolver{
+		txt: map[string][]string{
+			"example.com": {
+				"v=spf1 ip4:192.0.2.0/24 a:mail.example.com mx " +
+					"include:_spf.example.net -all",
+				"google-site-verification=abc",
+			},
+			"_spf.example.net":     {"v=spf1 ip6:2001:db8::/32 ~all"},
+			"soft.example.org":     {"v=spf1 ?ip4:198.51.100.1 ~all"},
+			"redirect.example.org": {"v=spf1 redirect=example.com"},
+			"exists.example.org": {
+				"v=spf1 exists:%{ir}.%{l1r+-}._spf.%{d} " +
+					"-all exp=explain.%{d}",
+			},
+			"explain.exists.example.org": {
+				"%{i} is not one of %{d}'s designated mail servers.",
+			},
+			"1.100.51.198.alice._spf.exists.example.org": {"ok"},
+			"double.example.org":                         {"v=spf1 -all", "v=spf1 +all"},
+			"broken.example.org":                         {"v=spf1 ip4:192.0.2.300 -all"},
+			"unknown.example.org":                        {"v=spf1 foo:bar -all"},
+			"loop.example.org":                           {"v=spf1 include:loop.example.org -all"},
+			"void.example.org": {
+				"v=spf1 a:a.void.example.org a:b.void.example.org " +
+					"a:c.void.example.org -all",
+			},
+			"dns.example.org":  {"v=spf1 a:fail.example.org -all"},
+			"helo.example.org": {"v=spf1 a -all"},
+		},
+		ip: map[string][]string{
+			"mail.example.com":                           {"203.0.113.5"},
+			"mx1.example.com":                            {"203.0.113.10", "2001:db8:1::10"},
+			"helo.example.org":                           {"203.0.113.77"},
+			"1.100.51.198.alice._spf.exists.example.org": {"127.0.0.2"},
+		},
+		mx: map[string][]string{
+			"example.com": {"mx1.example.com"},
+		},
+		fail: map[string]bool{
+			"fail.example.org": true,
+		},
+	}
+}
+
+func TestCheckSPF(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name              string
+		query             letters.SPFQuery
+		expectedResult    letters.SPFResult
+		expectedMechanism string
+		expectedErr       error
+	}{
+		{
+			name: "ip4 match",
+			query: letters.SPFQuery{
+				IP:       net.ParseIP("192.0.2.44"),
+				MailFrom: "alice@example.com",
+			},
+			expectedResult:    letters.SPFResultPass,
+			expectedMechanism: "ip4:192.0.2.0/24",
+		},
+		{
+			name: "a match",
+			query: letters.SPFQuery{
+				IP:       net.ParseIP("203.0.113.5"),
+				MailFrom: "alice@example.com",
+			},
+			expectedResult:    letters.SPFResultPass,
+			expectedMechanism: "a:mail.example.com",
+		},
+		{
+			name: "mx match",
+			query: letters.SPFQuery{
+				IP:       net.ParseIP("2001:db8:1::10"),
+				MailFrom: "<alice@example.com>",
+			},
+			expectedResult:    letters.SPFResultPass,
+			expectedMechanism: "mx",
+		},
+		{
+			name: "include match",
+			query: letters.SPFQuery{
+				IP:       net.ParseIP("2001:db8:ffff::1"),
+				MailFrom: "alice@example.com",
+			},
+			expectedResult:    letters.SPFResultPass,
+			expectedMechanism: "include:_spf.example.net",
+		},
+		{
+			name: "no match",
+			query: letters.SPFQuery{
+				IP:       net.ParseIP("198.51.100.99"),
+				MailFrom: "alice@example.com",
+			},
+			expectedResult:    letters.SPFResultFail,
+			expectedMechanism: "-all",
+		},
+		{
+			name: "neutral qualifier",
+			query: letters.SPFQuery{
+				IP:       net.ParseIP("198.51.100.1"),
+				MailFrom: "alice@soft.example.org",
+			},
+			expectedResult:    letters.SPFResultNeutral,
+			expectedMechanism: "?ip4:198.51.100.1",
+		},
+		{
+			name: "softfail",
+			query: letters.SPFQuery{
+				IP:       net.ParseIP("198.51.100.2"),
+				MailFrom: "alice@soft.example.org",
+			},
+			expectedResult:    letters.SPFResultSoftFail,
+			expectedMechanism: "~all",
+		},
+		{
+			name: "redirect",
+			query: letters.SPFQuery{
+				IP:       net.ParseIP("192.0.2.1"),
+				MailFrom: "alice@redirect.example.org",
+			},
+			expectedResult:    letters.SPFResultPass,
+			expectedMechanism: "ip4:192.0.2.0/24",
+		},
+		{
+			name: "exists with macros",
+			query: letters.SPFQuery{
+				IP:       net.ParseIP("198.51.100.1"),
+				MailFrom: "alice@exists.example.org",
+			},
+			expectedResult:    letters.SPFResultPass,
+			expectedMechanism: "exists:%{ir}.%{l1r+-}._spf.%{d}",
+		},
+		{
+			name: "null sender uses HELO",
+			query: letters.SPFQuery{
+				IP:   net.ParseIP("203.0.113.77"),
+				HELO: "helo.example.org",
+			},
+			expectedResult:    letters.SPFResultPass,
+			expectedMechanism: "a",
+		},
+		{
+			name: "no record",
+			query: letters.SPFQuery{
+				IP:       net.ParseIP("192.0.2.1"),
+				MailFrom: "alice@none.example.org",
+			},
+			expectedResult: letters.SPFResultNone,
+		},
+		{
+			name: "single-label domain",
+			query: letters.SPFQuery{
+				IP:       net.ParseIP("192.0.2.1"),
+				MailFrom: "alice@localhost",
+			},
+			expectedResult: letters.SPFResultNone,
+		},
+		{
+			name: "multiple records",
+			query: letters.SPFQuery{
+				IP:       net.ParseIP("192.0.2.1"),
+				MailFrom: "alice@double.example.org",
+			},
+			expectedResult: letters.SPFResultPermError,
+			expectedErr:    letters.ErrSPFPermError,
+		},
+		{
+			name: "invalid ip4",
+			query: letters.SPFQuery{
+				IP:       net.ParseIP("192.0.2.1"),
+				MailFrom: "alice@broken.example.org",
+			},
+			expectedResult: letters.SPFResultPermError,
+			expectedErr:    letters.ErrSPFPermError,
+		},
+		{
+			name: "unknown mechanism",
+			query: letters.SPFQuery{
+				IP:       net.ParseIP("192.0.2.1"),
+				MailFrom: "alice@unknown.example.org",
+			},
+			expectedResult: letters.SPFResultPermError,
+			expectedErr:    letters.ErrSPFPermError,
+		},
+		{
+			name: "include loop exceeds lookup limit",
+			query: letters.SPFQuery{
+				IP:       net.ParseIP("192.0.2.1"),
+				MailFrom: "alice@loop.example.org",
+			},
+			expectedResult: letters.SPFResultPermError,
+			expectedErr:    letters.ErrSPFPermError,
+		},
+		{
+			name: "void lookup limit",
+			query: letters.SPFQuery{
+				IP:       net.ParseIP("192.0.2.1"),
+				MailFrom: "alice@void.example.org",
+			},
+			expectedResult: letters.SPFResultPermError,
+			expectedErr:    letters.ErrSPFPermError,
+		},
+		{
+			name: "dns failure",
+			query: letters.SPFQuery{
+				IP:       net.ParseIP("192.0.2.1"),
+				MailFrom: "alice@dns.example.org",
+			},
+			expectedResult: letters.SPFResultTempError,
+			expectedErr:    letters.ErrSPFTempError,
+		},
+	}
+
+	resolver := newFakeSPFResolver()
+
+	for _, tc := range testCases {
+		testCase := tc
+
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			result, err := letters.CheckSPF(
+				context.Background(),
+				resolver,
+				testCase.query,
+			)
+
+			if testCase.expectedErr == nil && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if testCase.expectedErr != nil &&
+				!errors.Is(err, testCase.expectedErr) {
+				t.Fatalf("expected %v, got %v", testCase.expectedErr, err)
+			}
+
+			if result.Result != testCase.expectedResult {
+				t.Errorf(
+					"unexpected result: got %q, want %q",
+					result.Result,
+					testCase.expectedResult,
+				)
+			}
+
+			if result.Mechanism != testCase.expectedMechanism {
+				t.Errorf(
+					"unexpected mechanism: got %q, want %q",
+					result.Mechanism,
+					testCase.expectedMechanism,
+				)
+			}
+		})
+	}
+}
+
+func TestCheckSPFExplanation(t *testing.T) {
+	t.Parallel()
+
+	result, err := letters.CheckSPF(
+		context.Background(),
+		newFakeSPFResolver(),
+		letters.SPFQuery{
+			IP:       net.ParseIP("198.51.100.2"),
+			MailFrom: "alice@exists.example.org",
+		},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	const expectedExplanation = "198.51.100.2 is not one of " +
+		"exists.example.org's designated mail servers."
+
+	if result.Result != letters.SPFResultFail {
+		t.Errorf("unexpected result: got %q", result.Result)
+	}
+
+	if result.Explanation != expectedExplanation {
+		t.Errorf(
+			"unexpected explanation: got %q, want %q",
+			result.Explanation,
+			expectedExplanation,
+		)
+	}
+}
+
+func TestSPFQueryFromHeaders(t *testing.T) {
+	t.Parallel()
+
+	headers := letters.Headers{
+		From: []*mail.Address{{Address: "alice@example.com"}},
+		ExtraHeaders: map[string][]string{
+			"Received": {
+				"from mail.example.com (mail.example.com [192.0.2.1]) " +
+					"by mx.example.net (Postfix) with ESMTPS id 4F3; " +
+					"Mon, 1 Apr 2019 07:55:00 +0100",
+				"from [10.0.0.1] by mail.example.com; " +
+					"Mon, 1 Apr 2019 07:54:00 +0100",
+			},
+			"Return-Path": {"<bounces@example.com>"},
+		},
+	}
+
+	query, err := letters.SPFQueryFromHeaders(headers)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !query.IP.Equal(net.ParseIP("192.0.2.1")) {
+		t.Errorf("unexpected IP: got %s", query.IP)
+	}
+
+	if query.HELO != "mail.example.com" {
+		t.Errorf("unexpected HELO: got %q", query.HELO)
+	}
+
+	if query.MailFrom != "bounces@example.com" {
+		t.Errorf("unexpected MAIL FROM: got %q", query.MailFrom)
+	}
+
+	_, err = letters.SPFQueryFromHeaders(letters.Headers{})
+	if !errors.Is(err, letters.ErrNoReceivedHeader) {
+		t.Errorf("expected ErrNoReceivedHeader, got %v", err)
+	}
+
+	// Lowercasing changes the length of Ⱥ and İ in bytes.
+	for _, testCase := range []struct {
+		received   string
+		expectedIP net.IP
+	}{
+		{"from ȺȺȺȺȺȺȺȺȺȺȺȺ by x", nil},
+		{
+			"from İİİİİİİİ ([192.0.2.7]) BY mx.example.net ([198.51.100.1])",
+			net.ParseIP("192.0.2.7"),
+		},
+	} {
+		received, expectedIP := testCase.received, testCase.expectedIP
+
+		query, err = letters.SPFQueryFromHeaders(letters.Headers{
+			ExtraHeaders: map[string][]string{"Received": {received}},
+		})
+		if expectedIP == nil && !errors.Is(err, letters.ErrNoConnectingIP) {
+			t.Errorf("%q: expected ErrNoConnectingIP, got %v", received, err)
+		}
+
+		if expectedIP != nil && (err != nil || !query.IP.Equal(expectedIP)) {
+			t.Errorf("%q: unexpected IP: got %s, %v", received, query.IP, err)
+		}
+	}
+}
@@ -47,6 +47,15 @@ const (
 	cteBase64          ContentTransferEncoding = "base64"
 )
 
+// Legacy content-transfer encodings of files, see legacy.go.
+const (
+	cteXUUEncode ContentTransferEncoding = "x-uuencode"
+	cteXUUE      ContentTransferEncoding = "x-uue"
+	cteUUEncode  ContentTransferEncoding = "uuencode"
+	cteXYEnc     ContentTransferEncoding = "x-yenc"
+	cteXBinHex   ContentTransferEncoding = "x-binhex40"
+)
+
 // UnknownContentTypeError reports an unsupported MIME content type.
 type UnknownContentTypeError struct {
 	contentType string
@@ -508,6 +517,9 @@ type emailBodies struct {
 
 	InlineFiles   []InlineFile
 	AttachedFiles []AttachedFile
+
+	warnings     []error
+	handledParts map[string][]any
 }
 
 func (eb *emailBodies) extend(b emailBodies) {
@@ -516,6 +528,15 @@ func (eb *emailBodies) extend(b emailBodies) {
 	eb.html += b.html
 	eb.InlineFiles = append(eb.InlineFiles, b.InlineFiles...)
 	eb.AttachedFiles = append(eb.AttachedFiles, b.AttachedFiles...)
+	eb.warnings = append(eb.warnings, b.warnings...)
+
+	for pattern, results := range b.handledParts {
+		if eb.handledParts == nil {
+			eb.handledParts = make(map[string][]any)
+		}
+
+		eb.handledParts[pattern] = append(eb.handledParts[pattern], results...)
+	}
 }
 
 // Email contains the parsed headers, bodies, and files of an email message.
@@ -526,8 +547,41 @@ type Email struct {
 	EnrichedText string // See RFC 1523, RFC 1563, and RFC 1896
 	HTML         string
 
+	// RTF is the decompressed RTF body of an Outlook .msg file. See
+	// ParseMSG.
+	RTF string
+
 	InlineFiles   []InlineFile
 	AttachedFiles []AttachedFile
+
+	// TNEF lists the messages decoded from TNEF files. See
+	// WithTNEFDecoding.
+	TNEF []TNEFMessage
+
+	// Calendars lists the calendars parsed from iCalendar files. See
+	// WithCalendarParsing.
+	Calendars []Calendar
+
+	// Contacts lists the contacts parsed from vCard files. See
+	// WithVCardParsing.
+	Contacts []Contact
+
+	// SignatureContact is the contact extracted from the signature of the
+	// sender. See WithSignatureContactExtraction.
+	SignatureContact *Contact
+
+	// Partial is set when the message is a message/partial fragment that
+	// is stored until the other fragments arrive. See WithPartialStore.
+	Partial *PartialMessage
+
+	// Warnings lists the problems that the parser worked around instead of
+	// failing. See WithUnknownEncodingPolicy.
+	Warnings []error
+
+	// HandledParts lists the results of content type handlers by the
+	// pattern they were registered for, in the order of the parts. See
+	// WithContentTypeHandler.
+	HandledParts map[string][]any
 }
 
 // InlineFile contains a MIME file intended for inline presentation.
@@ -0,0 +1,457 @@
+package letters
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// tnefSignature starts every TNEF stream.
+const tnefSignature = 0x223e9f78
+
+// TNEF attribute levels.
+const (
+	tnefLevelMessage    = 0x01
+	tnefLevelAttachment = 0x02
+)
+
+// TNEF attributes, with their type in the high 16 bits.
+const (
+	tnefAttributeFrom           = 0x00008000
+	tnefAttributeSubject        = 0x00018004
+	tnefAttributeDateSent       = 0x00038005
+	tnefAttributeDateReceived   = 0x00038006
+	tnefAttributeMessageClass   = 0x00078008
+	tnefAttributeMessageID      = 0x00018009
+	tnefAttributeBody           = 0x0001800c
+	tnefAttributeAttachData     = 0x0006800f
+	tnefAttributeAttachTitle    = 0x00018010
+	tnefAttributeAttachRendData = 0x00069002
+	tnefAttributeMAPIProperties = 0x00069003
+	tnefAttributeAttachment     = 0x00069005
+	tnefAttributeOEMCodePage    = 0x00069007
+)
+
+const (
+	// tnefDateLength is the length of a TNEF date: seven 16-bit values,
+	// the last being the day of the week.
+	tnefDateLength = 14
+
+	// tnefTripleHeaderLength is the length of the header of the
+	// address triple of the From attribute.
+	tnefTripleHeaderLength = 8
+)
+
+// TNEFMessage is a message decoded from a TNEF stream, which Outlook sends
+// as an application/ms-tnef part usually named winmail.dat.
+type TNEFMessage struct {
+	// MessageClass is the MAPI message class, for example "IPM.Note".
+	MessageClass string
+
+	Subject   string
+	MessageID string
+
+	// Sent and Received are the submit and delivery times, or zero when
+	// the stream does not record them.
+	Sent     time.Time
+	Received time.Time
+
+	SenderName    string
+	SenderAddress string
+
+	// Body is the plain-text body, HTML the HTML body and RTF the
+	// decompressed RTF body. Outlook usually sends only the RTF body.
+	Body string
+	HTML string
+	RTF  []byte
+
+	// Attachments lists the attached files with their real names and media
+	// types. Files without a MIME tag get the media type detected from
+	// their content.
+	Attachments []AttachedFile
+
+	// Properties lists the MAPI properties of the message.
+	Properties []MAPIProperty
+}
+
+type tnefAttachment struct {
+	title      string
+	data       []byte
+	properties mapiProperties
+}
+
+type tnefDecoder struct {
+	message     TNEFMessage
+	properties  mapiProperties
+	attachments []tnefAttachment
+	charset     string
+}
+
+// WithTNEFDecoding makes the parser decode attached TNEF files, replacing
+// each one in Email.AttachedFiles with the files it contains and adding the
+// decoded message to Email.TNEF. Files that cannot be decoded are kept as
+// they are.
+func WithTNEFDecoding() EmailParserOption {
+	return func(ep *EmailParser) {
+		ep.decodeTNEF = true
+	}
+}
+
+// IsTNEF reports whether the attached file is a TNEF stream: an
+// application/ms-tnef file or a file named winmail.dat that starts with the
+// TNEF signature.
+func (f AttachedFile) IsTNEF() bool {
+	contentType := strings.ToLower(f.ContentType.ContentType)
+	if contentType != "application/ms-tnef" &&
+		contentType != "application/vnd.ms-tnef" &&
+		!strings.EqualFold(f.Filename().Sanitized, "winmail.dat") {
+		return false
+	}
+
+	return len(f.Data) >= 4 &&
+		binary.LittleEndian.Uint32(f.Data) == tnefSignature
+}
+
+// DecodeTNEF decodes the attached file with DecodeTNEF.
+func (f AttachedFile) DecodeTNEF() (TNEFMessage, error) {
+	return DecodeTNEF(f.Data)
+}
+
+// decodeTNEFFiles replaces the TNEF files among the attached files with
+// their content.
+func decodeTNEFFiles(email *Email) {
+	files := make([]AttachedFile, 0, len(email.AttachedFiles))
+
+	for _, file := range email.AttachedFiles {
+		if !file.IsTNEF() {
+			files = append(files, file)
+
+			continue
+		}
+
+		message, err := file.DecodeTNEF()
+		if err != nil {
+			files = append(files, file)
+
+			continue
+		}
+
+		files = append(files, message.Attachments...)
+		email.TNEF = append(email.TNEF, message)
+	}
+
+	email.AttachedFiles = files
+}
+
+// DecodeTNEF decodes a TNEF stream, as described in [MS-OXTNEF].
+//
+// Attribute checksums are not verified, because some clients write them
+// incorrectly. It returns an error wrapping ErrInvalidTNEF when data is not
+// a TNEF stream or is truncated.
+func DecodeTNEF(data []byte) (TNEFMessage, error) {
+	r := newLittleEndianReader(data)
+
+	if r.uint32() != tnefSignature {
+		return TNEFMessage{}, fmt.Errorf(
+			"letters.tnef.DecodeTNEF: %w: no TNEF signature",
+			ErrInvalidTNEF,
+		)
+	}
+
+	// The legacy key is not used.
+	r.uint16()
+
+	decoder := tnefDecoder{
+		message: TNEFMessage{
+			MessageClass:  "",
+			Subject:       "",
+			MessageID:     "",
+			Sent:          time.Time{},
+			Received:      time.Time{},
+			SenderName:    "",
+			SenderAddress: "",
+			Body:          "",
+			HTML:          "",
+			RTF:           nil,
+			Attachments:   nil,
+			Properties:    nil,
+		},
+		properties:  nil,
+		attachments: nil,
+		charset:     mapiDefaultCharset,
+	}
+
+	for r.ok && len(r.data) > 0 {
+		level := r.bytes(1)
+		attribute := r.uint32()
+		value := r.bytes(int(r.uint32()))
+
+		// The checksum is not verified.
+		r.uint16()
+
+		if !r.ok {
+			return decoder.message, fmt.Errorf(
+				"letters.tnef.DecodeTNEF: %w: truncated attribute %#08x",
+				ErrInvalidTNEF,
+				attribute,
+			)
+		}
+
+		err := decoder.decodeAttribute(level[0], attribute, value)
+		if err != nil {
+			return decoder.message, fmt.Errorf(
+				"letters.tnef.DecodeTNEF: %w",
+				err,
+			)
+		}
+	}
+
+	decoder.finish()
+
+	return decoder.message, nil
+}
+
+func (d *tnefDecoder) decodeAttribute(
+	level byte,
+	attribute uint32,
+	value []byte,
+) error {
+	if level == tnefLevelAttachment {
+		return d.decodeAttachmentAttribute(attribute, value)
+	}
+
+	if level != tnefLevelMessage {
+		return fmt.Errorf("%w: unknown level %d", ErrInvalidTNEF, level)
+	}
+
+	switch attribute {
+	case tnefAttributeOEMCodePage:
+		if len(value) >= 4 {
+			charset := codePageCharset(
+				int64(binary.LittleEndian.Uint32(value)),
+			)
+			if charset != "" {
+				d.charset = charset
+			}
+		}
+	case tnefAttributeSubject:
+		d.message.Subject = d.decodeString(value)
+	case tnefAttributeMessageID:
+		d.message.MessageID = d.decodeString(value)
+	case tnefAttributeMessageClass:
+		d.message.MessageClass = d.decodeString(value)
+	case tnefAttributeBody:
+		d.message.Body = d.decodeString(value)
+	case tnefAttributeDateSent:
+		d.message.Sent = decodeTNEFDate(value)
+	case tnefAttributeDateReceived:
+		d.message.Received = decodeTNEFDate(value)
+	case tnefAttributeFrom:
+		d.message.SenderName, d.message.SenderAddress = d.decodeTriple(value)
+	case tnefAttributeMAPIProperties:
+		properties, ok := parseMAPIProperties(value, d.charset)
+		if !ok {
+			return fmt.Errorf(
+				"%w: invalid message properties",
+				ErrInvalidTNEF,
+			)
+		}
+
+		d.properties = append(d.properties, properties...)
+	default:
+	}
+
+	return nil
+}
+
+func (d *tnefDecoder) decodeAttachmentAttribute(
+	attribute uint32,
+	value []byte,
+) error {
+	if attribute == tnefAttributeAttachRendData || len(d.attachments) == 0 {
+		d.attachments = append(d.attachments, tnefAttachment{
+			title:      "",
+			data:       nil,
+			properties: nil,
+		})
+	}
+
+	attachment := &d.attachments[len(d.attachments)-1]
+
+	switch attribute {
+	case tnefAttributeAttachTitle:
+		attachment.title = d.decodeString(value)
+	case tnefAttributeAttachData:
+		attachment.data = value
+	case tnefAttributeAttachment:
+		properties, ok := parseMAPIProperties(value, d.charset)
+		if !ok {
+			return fmt.Errorf(
+				"%w: invalid attachment properties",
+				ErrInvalidTNEF,
+			)
+		}
+
+		attachment.properties = append(attachment.properties, properties...)
+	default:
+	}
+
+	return nil
+}
+
+func (d *tnefDecoder) decodeString(value []byte) string {
+	return decodeCharsetBytes(bytes.TrimRight(value, "\x00"), d.charset)
+}
+
+// decodeTriple decodes the display name and address of the address triple
+// of the From attribute. Addresses are prefixed with their type, for
+// example "SMTP:".
+func (d *tnefDecoder) decodeTriple(value []byte) (string, string) {
+	r := newLittleEndianReader(value)
+	r.uint16()
+	r.uint16()
+	nameLength := int(r.uint16())
+	addressLength := int(r.uint16())
+	name := r.bytes(nameLength)
+	address := r.bytes(addressLength)
+
+	if !r.ok || len(value) < tnefTripleHeaderLength {
+		return "", ""
+	}
+
+	addressText := d.decodeString(address)
+	if addressType, rest, found := strings.Cut(addressText, ":"); found &&
+		strings.EqualFold(addressType, "SMTP") {
+		addressText = rest
+	}
+
+	return d.decodeString(name), addressText
+}
+
+func decodeTNEFDate(value []byte) time.Time {
+	if len(value) < tnefDateLength {
+		return time.Time{}
+	}
+
+	field := func(i int) int {
+		return int(binary.LittleEndian.Uint16(value[2*i:]))
+	}
+
+	return time.Date(
+		field(0),
+		time.Month(field(1)),
+		field(2),
+		field(3),
+		field(4),
+		field(5),
+		0,
+		time.UTC,
+	)
+}
+
+// finish fills the message from its MAPI properties, which take precedence
+// over the TNEF attributes, and builds the attachments.
+func (d *tnefDecoder) finish() {
+	message := &d.message
+	properties := d.properties
+
+	// The code page properties apply to the 8-bit strings of the whole
+	// message, including the properties that precede them.
+	if charset := codePageCharset(
+		max(
+			properties.integer(mapiInternetCodePage),
+			properties.integer(mapiMessageCodePage),
+		),
+	); charset != "" {
+		d.charset = charset
+		setMAPICharset(properties, charset)
+
+		for _, attachment := range d.attachments {
+			setMAPICharset(attachment.properties, charset)
+		}
+	}
+
+	message.Properties = properties
+
+	setNonEmpty(&message.MessageClass, properties.text(mapiMessageClass))
+	setNonEmpty(&message.Subject, properties.text(mapiSubject))
+	setNonEmpty(&message.MessageID, properties.text(mapiInternetMessageID))
+	setNonEmpty(&message.Body, properties.text(mapiBody))
+
+	// The sent representing properties hold the author of messages sent
+	// on behalf of someone else.
+	for _, id := range []uint16{mapiSenderName, mapiSentRepresentingName} {
+		setNonEmpty(&message.SenderName, properties.text(id))
+	}
+
+	for _, id := range []uint16{
+		mapiSenderEmailAddress,
+		mapiSentRepresentingEmail,
+		mapiSenderSMTPAddress,
+		mapiSentRepresentingSMTP,
+	} {
+		if address := properties.text(id); strings.Contains(address, "@") {
+			message.SenderAddress = address
+		}
+	}
+
+	if sent := properties.time(mapiClientSubmitTime); !sent.IsZero() {
+		message.Sent = sent
+	}
+
+	received := properties.time(mapiMessageDeliveryTime)
+	if !received.IsZero() {
+		message.Received = received
+	}
+
+	if property, ok := properties.find(mapiBodyHTML); ok {
+		message.HTML = property.Text()
+		if property.Type == mapiTypeBinary {
+			message.HTML = decodeCharsetBytes(property.Bytes(), d.charset)
+		}
+	}
+
+	if property, ok := properties.find(mapiRTFCompressed); ok {
+		if rtf, ok := decompressRTF(property.Bytes()); ok {
+			message.RTF = rtf
+		}
+	}
+
+	for _, attachment := range d.attachments {
+		message.Attachments = append(
+			message.Attachments,
+			attachment.attachedFile(),
+		)
+	}
+}
+
+// attachedFile returns the attachment as an attached file named after its
+// long file name, file name, display name or title.
+func (a tnefAttachment) attachedFile() AttachedFile {
+	data := a.data
+	if property, ok := a.properties.find(mapiAttachDataBinary); ok {
+		data = property.Bytes()
+	}
+
+	filename := a.properties.attachmentFilename(a.title)
+
+	return AttachedFile{
+		ContentType: ContentTypeHeader{
+			ContentType: a.properties.attachmentContentType(filename, data),
+			Params:      map[string]string{},
+		},
+		ContentDisposition: fileContentDisposition(
+			ContentDispositionAttachment,
+			filename,
+		),
+		Data: data,
+	}
+}
+
+func setNonEmpty(target *string, value string) {
+	if value != "" {
+		*target = value
+	}
+}
@@ -0,0 +1,293 @@
+package letters_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/mnako/letters"
+)
+
+func tnefAttribute(level byte, attribute uint32, value []byte) []byte {
+	data := []byte{level}
+	data = binary.LittleEndian.AppendUint32(data, attribute)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(value)))
+	data = append(data, value...)
+
+	var checksum uint16
+	for _, b := range value {
+		checksum += uint16(b)
+	}
+
+	return binary.LittleEndian.AppendUint16(data, checksum)
+}
+
+func mapiPropertyList(properties ...[]byte) []byte {
+	data := binary.LittleEndian.AppendUint32(nil, uint32(len(properties)))
+
+	for _, property := range properties {
+		data = append(data, property...)
+	}
+
+	return data
+}
+
+func mapiVariableProperty(propertyType, id uint16, value []byte) []byte {
+	data := binary.LittleEndian.AppendUint16(nil, propertyType)
+	data = binary.LittleEndian.AppendUint16(data, id)
+	data = binary.LittleEndian.AppendUint32(data, 1)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(value)))
+	data = append(data, value...)
+
+	for len(data)%4 != 0 {
+		data = append(data, 0)
+	}
+
+	return data
+}
+
+func mapiUnicodeProperty(id uint16, s string) []byte {
+	var value []byte
+	for _, unit := range utf16.Encode([]rune(s + "\x00")) {
+		value = binary.LittleEndian.AppendUint16(value, unit)
+	}
+
+	return mapiVariableProperty(0x001f, id, value)
+}
+
+func mapiTimeProperty(id uint16, t time.Time) []byte {
+	data := binary.LittleEndian.AppendUint16(nil, 0x0040)
+	data = binary.LittleEndian.AppendUint16(data, id)
+
+	filetime := uint64(t.Unix()+11644473600) * 10000000
+
+	return binary.LittleEndian.AppendUint64(data, filetime)
+}
+
+func tnefTestData(t *testing.T) []byte {
+	t.Helper()
+
+	// The compressed RTF example of [MS-OXRTFCP] section 4.1.
+	compressedRTF, err := base64.StdEncoding.DecodeString(
+		"LQAAACsAAABMWkZ18cXHpwMACgByY3BnMTI1QjIK8yBoZWwJACBidwWwbGR9CoAPoA==",
+	)
+	if err != nil {
+		t.Fatalf("cannot decode compressed RTF: %s", err)
+	}
+
+	sent := time.Date(2024, time.March, 5, 9, 30, 0, 0, time.UTC)
+
+	data := binary.LittleEndian.AppendUint32(nil, 0x223e9f78)
+	data = binary.LittleEndian.AppendUint16(data, 0x0001)
+
+	add := func(level byte, attribute uint32, value []byte) {
+		data = append(data, tnefAttribute(level, attribute, value)...)
+	}
+
+	add(0x01, 0x00089006, []byte{0, 0, 1, 0})
+	add(0x01, 0x00069007, []byte{0xe4, 0x04, 0, 0, 0, 0, 0, 0})
+	add(0x01, 0x00078008, []byte("IPM.Note\x00"))
+	add(0x01, 0x00018004, []byte("Caf\xe9\x00"))
+	add(0x01, 0x00069003, mapiPropertyList(
+		mapiUnicodeProperty(0x0037, "Quarterly café report"),
+		mapiUnicodeProperty(0x0c1a, "Alice Example"),
+		mapiUnicodeProperty(0x5d01, "alice@example.com"),
+		mapiTimeProperty(0x0039, sent),
+		mapiVariableProperty(0x0102, 0x1009, compressedRTF),
+	))
+	add(0x02, 0x00069002, make([]byte, 14))
+	add(0x02, 0x00018010, []byte("REPORT~1.PDF\x00"))
+	add(0x02, 0x0006800f, []byte("%PDF-1.7\n"))
+	add(0x02, 0x00069005, mapiPropertyList(
+		mapiUnicodeProperty(0x3707, "Quarterly report.pdf"),
+	))
+	add(0x02, 0x00069002, make([]byte, 14))
+	add(0x02, 0x00018010, []byte("notes.txt\x00"))
+	add(0x02, 0x0006800f, []byte("Notes"))
+
+	return data
+}
+
+func TestDecodeTNEF(t *testing.T) {
+	t.Parallel()
+
+	message, err := letters.DecodeTNEF(tnefTestData(t))
+	if err != nil {
+		t.Fatalf("cannot decode TNEF: %s", err)
+	}
+
+	expectedRTF := "{\\rtf1\\ansi\\ansicpg1252\\pard hello world}\r\n"
+	expectedSent := time.Date(2024, time.March, 5, 9, 30, 0, 0, time.UTC)
+
+	if message.MessageClass != "IPM.Note" ||
+		message.Subject != "Quarterly café report" ||
+		message.SenderName != "Alice Example" ||
+		message.SenderAddress != "alice@example.com" ||
+		!message.Sent.Equal(expectedSent) ||
+		string(message.RTF) != expectedRTF {
+		t.Errorf("unexpected message: %#v, RTF %q", message, message.RTF)
+	}
+
+	if len(message.Attachments) != 2 {
+		t.Fatalf("unexpected attachments: %#v", message.Attachments)
+	}
+
+	expected := []struct {
+		filename    string
+		contentType string
+		data        string
+	}{
+		{"Quarterly report.pdf", "application/pdf", "%PDF-1.7\n"},
+		{"notes.txt", "text/plain", "Notes"},
+	}
+
+	for i, attachment := range message.Attachments {
+		if attachment.Filename().Name != expected[i].filename ||
+			attachment.ContentType.ContentType != expected[i].contentType ||
+			string(attachment.Data) != expected[i].data {
+			t.Errorf("unexpected attachment %d: %#v", i, attachment)
+		}
+	}
+}
+
+func TestDecodeTNEFCompressedRTF(t *testing.T) {
+	t.Parallel()
+
+	// The compressed RTF examples of [MS-OXRTFCP] sections 4.1 and 4.2.
+	testCases := []struct {
+		name     string
+		filepath string
+		expected string
+	}{
+		{
+			name:     "simple",
+			filepath: "tests/test_compressed_rtf_simple.bin",
+			expected: "{\\rtf1\\ansi\\ansicpg1252\\pard hello world}\r\n",
+		},
+		{
+			name:     "reference overlapping its output",
+			filepath: "tests/test_compressed_rtf_repeated.bin",
+			expected: "{\\rtf1 WXYZWXYZWXYZWXYZWXYZ}",
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			compressedRTF, err := os.ReadFile(testCase.filepath)
+			if err != nil {
+				t.Fatalf("cannot read %s: %s", testCase.filepath, err)
+			}
+
+			data := binary.LittleEndian.AppendUint32(nil, 0x223e9f78)
+			data = binary.LittleEndian.AppendUint16(data, 0x0001)
+			data = append(data, tnefAttribute(
+				0x01,
+				0x00069003,
+				mapiPropertyList(
+					mapiVariableProperty(0x0102, 0x1009, compressedRTF),
+				),
+			)...)
+
+			message, err := letters.DecodeTNEF(data)
+			if err != nil {
+				t.Fatalf("cannot decode TNEF: %s", err)
+			}
+
+			if string(message.RTF) != testCase.expected {
+				t.Errorf(
+					"unexpected RTF:\ngot:      %q\nexpected: %q",
+					message.RTF,
+					testCase.expected,
+				)
+			}
+		})
+	}
+}
+
+func TestDecodeTNEFErrors(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		data []byte
+	}{
+		{
+			name: "no signature",
+			data: []byte("winmail.dat"),
+		},
+		{
+			name: "truncated attribute",
+			data: tnefTestData(t)[:45],
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := letters.DecodeTNEF(testCase.data)
+			if !errors.Is(err, letters.ErrInvalidTNEF) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseWithTNEFDecoding(t *testing.T) {
+	t.Parallel()
+
+	var b bytes.Buffer
+
+	b.WriteString("From: Alice <alice@example.com>\r\n" +
+		"Subject: Report\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		"See attached.\r\n" +
+		"--b\r\n" +
+		"Content-Type: application/ms-tnef; name=\"winmail.dat\"\r\n" +
+		"Content-Disposition: attachment; filename=\"winmail.dat\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n")
+	b.WriteString(base64.StdEncoding.EncodeToString(tnefTestData(t)))
+	b.WriteString("\r\n--b--\r\n")
+
+	message := b.String()
+
+	email, err := letters.ParseEmail(strings.NewReader(message))
+	if err != nil {
+		t.Fatalf("cannot parse email: %s", err)
+	}
+
+	if len(email.AttachedFiles) != 1 || !email.AttachedFiles[0].IsTNEF() ||
+		email.TNEF != nil {
+		t.Errorf("expected TNEF file without the option: %#v", email)
+	}
+
+	email, err = letters.NewEmailParser(
+		letters.WithTNEFDecoding(),
+	).Parse(strings.NewReader(message))
+	if err != nil {
+		t.Fatalf("cannot parse email: %s", err)
+	}
+
+	if len(email.AttachedFiles) != 2 ||
+		email.AttachedFiles[0].Filename().Name != "Quarterly report.pdf" ||
+		len(email.TNEF) != 1 ||
+		email.TNEF[0].Subject != "Quarterly café report" {
+		t.Errorf("unexpected email: %#v", email)
+	}
+}
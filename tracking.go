@@ -0,0 +1,515 @@
+package letters
+
+import (
+	"fmt"
+	"net/textproto"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// TrackingPixelReason describes why FindTrackingPixels considers an image a
+// tracking pixel.
+type TrackingPixelReason string
+
+// Reasons reported by FindTrackingPixels.
+const (
+	TrackingPixelTiny         TrackingPixelReason = "tiny image"
+	TrackingPixelHidden       TrackingPixelReason = "hidden image"
+	TrackingPixelKnownTracker TrackingPixelReason = "known tracker URL"
+)
+
+// TrackingPixel is a remote image in an HTML body that is likely used to
+// track when and where the message is opened.
+type TrackingPixel struct {
+	// URL is the src of the image.
+	URL string
+
+	// Domain is the lower-case ASCII domain the image is loaded from.
+	Domain string
+
+	// Tracker is the name of the tracking service the URL belongs to, or an
+	// empty string when it does not match a known tracker.
+	Tracker string
+
+	Reasons []TrackingPixelReason
+}
+
+// ServiceProviderEvidence is a header that identifies an email service
+// provider.
+type ServiceProviderEvidence struct {
+	Header string
+	Value  string
+}
+
+// ServiceProvider is an email service provider that sent, or relayed, a
+// message.
+type ServiceProvider struct {
+	// Name is the name of the provider, for example "SendGrid".
+	Name string
+
+	// Evidence lists the headers that identify the provider.
+	Evidence []ServiceProviderEvidence
+}
+
+// TrackingAnalysis is the result of Email.AnalyzeTracking.
+type TrackingAnalysis struct {
+	// Pixels lists the tracking pixels in the HTML body in document order.
+	Pixels []TrackingPixel
+
+	// ServiceProviders lists the email service providers identified from
+	// the headers, the best supported first.
+	ServiceProviders []ServiceProvider
+}
+
+type trackerPattern struct {
+	name   string
+	domain string
+	path   string
+}
+
+type serviceProviderSignature struct {
+	name string
+
+	// headers are headers that only the provider adds.
+	headers []string
+
+	// mailers are lower-case substrings of the X-Mailer header.
+	mailers []string
+
+	// feedbackIDs are lower-case sender IDs, the last field of the
+	// Feedback-ID header.
+	feedbackIDs []string
+
+	// domains are the domains of the provider that appear in the
+	// Return-Path, List-Unsubscribe and Message-ID headers.
+	domains []string
+}
+
+// AnalyzeTracking finds the tracking pixels in the HTML body of the email
+// with FindTrackingPixels and identifies its email service providers with
+// DetectServiceProviders.
+func (e Email) AnalyzeTracking() (TrackingAnalysis, error) {
+	pixels, err := FindTrackingPixels(e.HTML)
+	if err != nil {
+		return TrackingAnalysis{}, fmt.Errorf(
+			"letters.tracking.AnalyzeTracking: cannot find tracking pixels: %w",
+			err,
+		)
+	}
+
+	return TrackingAnalysis{
+		Pixels:           pixels,
+		ServiceProviders: DetectServiceProviders(e.Headers),
+	}, nil
+}
+
+// FindTrackingPixels returns the remote images in an HTML body that are at
+// most 1x1 pixels in size, hidden with the hidden attribute, display:none,
+// visibility:hidden or opacity:0 on the image or one of its ancestors, or
+// loaded from a URL of a known tracking service.
+func FindTrackingPixels(htmlBody string) ([]TrackingPixel, error) {
+	document, err := html.Parse(strings.NewReader(htmlBody))
+	if err != nil {
+		return nil, fmt.Errorf(
+			"letters.tracking.FindTrackingPixels: cannot parse HTML: %w",
+			err,
+		)
+	}
+
+	var pixels []TrackingPixel
+
+	for _, image := range findHTMLElements(document, atom.Img) {
+		src := strings.TrimSpace(htmlAttribute(image, "src"))
+		if !isAbsoluteWebURL(src) {
+			continue
+		}
+
+		parsed, err := url.Parse(src)
+		if err != nil {
+			continue
+		}
+
+		pixel := TrackingPixel{
+			URL:     src,
+			Domain:  normalizeLinkDomain(parsed.Hostname()),
+			Tracker: "",
+			Reasons: nil,
+		}
+
+		if isTinyHTMLImage(image) {
+			pixel.Reasons = append(pixel.Reasons, TrackingPixelTiny)
+		}
+
+		if isHiddenHTMLImage(image) {
+			pixel.Reasons = append(pixel.Reasons, TrackingPixelHidden)
+		}
+
+		pixel.Tracker = matchTrackerPattern(pixel.Domain, parsed.Path)
+		if pixel.Tracker != "" {
+			pixel.Reasons = append(pixel.Reasons, TrackingPixelKnownTracker)
+		}
+
+		if len(pixel.Reasons) > 0 {
+			pixels = append(pixels, pixel)
+		}
+	}
+
+	return pixels, nil
+}
+
+// isTinyHTMLImage reports whether both dimensions of an image are at most
+// one pixel, or either is below one pixel, according to its width and
+// height attributes or its style.
+func isTinyHTMLImage(image *html.Node) bool {
+	width := htmlImageDimension(image, "width")
+	height := htmlImageDimension(image, "height")
+
+	return (width >= 0 && width < 1) ||
+		(height >= 0 && height < 1) ||
+		(width >= 0 && width <= 1 && height >= 0 && height <= 1)
+}
+
+// htmlImageDimension returns the size in pixels of an image dimension set
+// in its style or attributes, or -1 when it is not set or not in pixels.
+func htmlImageDimension(image *html.Node, name string) float64 {
+	value := htmlAttribute(image, name)
+
+	for declaration := range strings.SplitSeq(
+		htmlAttribute(image, "style"),
+		";",
+	) {
+		property, propertyValue, found := strings.Cut(declaration, ":")
+		if found && strings.EqualFold(strings.TrimSpace(property), name) {
+			value = propertyValue
+		}
+	}
+
+	value = strings.TrimSpace(strings.TrimSuffix(
+		strings.ToLower(strings.TrimSpace(value)),
+		"px",
+	))
+
+	size, err := strconv.ParseFloat(value, 64)
+	if err != nil || size < 0 {
+		return -1
+	}
+
+	return size
+}
+
+// isHiddenHTMLImage reports whether an image or one of its ancestors is
+// hidden.
+func isHiddenHTMLImage(image *html.Node) bool {
+	for node := image; node != nil; node = node.Parent {
+		if node.Type != html.ElementNode {
+			continue
+		}
+
+		if isHiddenHTMLElement(node) {
+			return true
+		}
+
+		for declaration := range strings.SplitSeq(
+			htmlAttribute(node, "style"),
+			";",
+		) {
+			property, value, found := strings.Cut(declaration, ":")
+			if !found ||
+				!strings.EqualFold(strings.TrimSpace(property), "opacity") {
+				continue
+			}
+
+			opacity, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err == nil && opacity == 0 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// trackerPatterns lists the URLs of open-tracking images of common email
+// service providers and sales tools.
+func trackerPatterns() []trackerPattern {
+	return []trackerPattern{
+		{"Mailchimp", "list-manage.com", "/track/open.php"},
+		{"SendGrid", "sendgrid.net", "/wf/open"},
+		{"Amazon SES", "awstrack.me", "/I0/"},
+		{"Salesforce Marketing Cloud", "exct.net", "/open.aspx"},
+		{"Constant Contact", "rs6.net", "/on.jsp"},
+		{"Campaign Monitor", "createsend1.com", "/t/"},
+		{"HubSpot", "hubspotlinks.com", ""},
+		{"HubSpot", "sidekickopen.com", ""},
+		{"HubSpot", "t.hubspotemail.net", ""},
+		{"Klaviyo", "trk.klaviyomail.com", ""},
+		{"Brevo", "sendibt3.com", ""},
+		{"Mailtrack", "mailtrack.io", ""},
+		{"Yesware", "t.yesware.com", ""},
+		{"Streak", "mailfoogae.appspot.com", ""},
+		{"Mixmax", "track.mixmax.com", ""},
+		{"Superhuman", "r.superhuman.com", ""},
+		{"Google Analytics", "google-analytics.com", "/collect"},
+	}
+}
+
+func matchTrackerPattern(domain string, path string) string {
+	for _, pattern := range trackerPatterns() {
+		if isDomainOrSubdomain(domain, pattern.domain) &&
+			strings.Contains(path, pattern.path) {
+			return pattern.name
+		}
+	}
+
+	return ""
+}
+
+func isDomainOrSubdomain(domain string, parent string) bool {
+	return domain == parent || strings.HasSuffix(domain, "."+parent)
+}
+
+// serviceProviderSignatures lists the headers by which common email service
+// providers can be identified.
+func serviceProviderSignatures() []serviceProviderSignature {
+	return []serviceProviderSignature{
+		{
+			name:    "SendGrid",
+			headers: []string{"X-SG-EID", "X-SG-ID"},
+			domains: []string{"sendgrid.net", "sendgrid.com"},
+		},
+		{
+			name:        "Mailchimp",
+			headers:     []string{"X-MC-User"},
+			mailers:     []string{"mailchimp"},
+			feedbackIDs: []string{"mc"},
+			domains: []string{
+				"list-manage.com",
+				"mcsv.net",
+				"mcdlv.net",
+				"rsgsv.net",
+			},
+		},
+		{
+			name:    "Mandrill",
+			headers: []string{"X-Mandrill-User"},
+			mailers: []string{"mandrill"},
+			domains: []string{"mandrillapp.com"},
+		},
+		{
+			name:        "Amazon SES",
+			headers:     []string{"X-SES-Outgoing"},
+			feedbackIDs: []string{"amazonses"},
+			domains:     []string{"amazonses.com"},
+		},
+		{
+			name:    "Mailgun",
+			headers: []string{"X-Mailgun-Sid", "X-Mailgun-Variables"},
+			mailers: []string{"mailgun"},
+			domains: []string{"mailgun.org", "mailgun.net"},
+		},
+		{
+			name:    "Postmark",
+			headers: []string{"X-PM-Message-Id", "X-PM-Tag"},
+			domains: []string{"mtasv.net", "postmarkapp.com"},
+		},
+		{
+			name:    "SparkPost",
+			headers: []string{"X-MSFBL"},
+			domains: []string{"sparkpostmail.com", "sparkpost.com"},
+		},
+		{
+			name:    "Brevo",
+			headers: []string{"X-Mailin-EID", "X-Mailin-Campaign"},
+			mailers: []string{"sendinblue", "brevo"},
+			domains: []string{"sendinblue.com", "brevo.com", "sendibt3.com"},
+		},
+		{
+			name:    "Salesforce Marketing Cloud",
+			headers: []string{"X-SFMC-Stack"},
+			domains: []string{"exacttarget.com", "exct.net"},
+		},
+		{
+			name:    "HubSpot",
+			mailers: []string{"hubspot"},
+			domains: []string{"hubspotemail.net", "hubspot.com"},
+		},
+		{
+			name:    "Klaviyo",
+			headers: []string{"X-Kmail-Relay-Info"},
+			domains: []string{"klaviyomail.com", "klaviyo.com"},
+		},
+		{
+			name:    "Campaign Monitor",
+			mailers: []string{"campaign monitor", "createsend"},
+			domains: []string{"createsend.com", "cmail19.com", "cmail20.com"},
+		},
+		{
+			name:    "Constant Contact",
+			mailers: []string{"constant contact"},
+			domains: []string{"constantcontact.com", "ccsend.com"},
+		},
+	}
+}
+
+// DetectServiceProviders identifies the email service providers that sent
+// a message from provider-specific headers such as X-SG-EID, from the
+// X-Mailer and Feedback-ID headers, and from the domains in the
+// Return-Path, List-Unsubscribe and Message-ID headers.
+//
+// Providers are returned with the most evidence first. A message relayed
+// through several providers, for example Mandrill and Mailchimp, can
+// match more than one.
+func DetectServiceProviders(headers Headers) []ServiceProvider {
+	var providers []ServiceProvider
+
+	mailers := serviceProviderHeaderValues(headers, "X-Mailer")
+	feedbackIDs := serviceProviderHeaderValues(headers, "Feedback-ID")
+	domainHeaders := serviceProviderDomainHeaders(headers)
+
+	for _, signature := range serviceProviderSignatures() {
+		provider := ServiceProvider{
+			Name:     signature.name,
+			Evidence: nil,
+		}
+
+		addEvidence := func(header string, value string) {
+			provider.Evidence = append(
+				provider.Evidence,
+				ServiceProviderEvidence{
+					Header: header,
+					Value:  value,
+				},
+			)
+		}
+
+		for _, header := range signature.headers {
+			for _, value := range serviceProviderHeaderValues(headers, header) {
+				addEvidence(header, value)
+			}
+		}
+
+		for _, mailer := range mailers {
+			if slices.ContainsFunc(signature.mailers, func(s string) bool {
+				return strings.Contains(strings.ToLower(mailer), s)
+			}) {
+				addEvidence("X-Mailer", mailer)
+			}
+		}
+
+		for _, feedbackID := range feedbackIDs {
+			fields := strings.Split(strings.TrimSpace(feedbackID), ":")
+			senderID := strings.ToLower(fields[len(fields)-1])
+
+			if slices.Contains(signature.feedbackIDs, senderID) {
+				addEvidence("Feedback-ID", feedbackID)
+			}
+		}
+
+		for _, domainHeader := range domainHeaders {
+			if slices.ContainsFunc(signature.domains, func(s string) bool {
+				return isDomainOrSubdomain(domainHeader.domain, s)
+			}) {
+				addEvidence(domainHeader.name, domainHeader.value)
+			}
+		}
+
+		if len(provider.Evidence) > 0 {
+			providers = append(providers, provider)
+		}
+	}
+
+	slices.SortStableFunc(providers, func(a, b ServiceProvider) int {
+		return len(b.Evidence) - len(a.Evidence)
+	})
+
+	return providers
+}
+
+func serviceProviderHeaderValues(headers Headers, name string) []string {
+	return headers.ExtraHeaders[textproto.CanonicalMIMEHeaderKey(name)]
+}
+
+type serviceProviderDomainHeader struct {
+	name   string
+	value  string
+	domain string
+}
+
+// serviceProviderDomainHeaders returns the domains of the Return-Path
+// addresses, List-Unsubscribe URIs and Message-ID.
+func serviceProviderDomainHeaders(
+	headers Headers,
+) []serviceProviderDomainHeader {
+	var domainHeaders []serviceProviderDomainHeader
+
+	for _, returnPath := range serviceProviderHeaderValues(
+		headers,
+		"Return-Path",
+	) {
+		address := strings.Trim(strings.TrimSpace(returnPath), "<>")
+		if index := strings.LastIndexByte(address, '@'); index >= 0 {
+			domainHeaders = append(domainHeaders, serviceProviderDomainHeader{
+				name:   "Return-Path",
+				value:  returnPath,
+				domain: normalizeLinkDomain(address[index+1:]),
+			})
+		}
+	}
+
+	for _, listUnsubscribe := range serviceProviderHeaderValues(
+		headers,
+		"List-Unsubscribe",
+	) {
+		for uri := range strings.SplitSeq(listUnsubscribe, ",") {
+			domain := listUnsubscribeDomain(uri)
+			if domain != "" {
+				domainHeaders = append(
+					domainHeaders,
+					serviceProviderDomainHeader{
+						name:   "List-Unsubscribe",
+						value:  listUnsubscribe,
+						domain: domain,
+					},
+				)
+			}
+		}
+	}
+
+	messageID := strings.Trim(string(headers.MessageID), "<> ")
+	if index := strings.LastIndexByte(messageID, '@'); index >= 0 {
+		domainHeaders = append(domainHeaders, serviceProviderDomainHeader{
+			name:   "Message-ID",
+			value:  string(headers.MessageID),
+			domain: normalizeLinkDomain(messageID[index+1:]),
+		})
+	}
+
+	return domainHeaders
+}
+
+// listUnsubscribeDomain returns the domain of a mailto: or http URI from a
+// List-Unsubscribe header.
+func listUnsubscribeDomain(uri string) string {
+	parsed, err := url.Parse(strings.Trim(strings.TrimSpace(uri), "<>"))
+	if err != nil {
+		return ""
+	}
+
+	if strings.EqualFold(parsed.Scheme, "mailto") {
+		address, _, _ := strings.Cut(parsed.Opaque, "?")
+
+		index := strings.LastIndexByte(address, '@')
+		if index < 0 {
+			return ""
+		}
+
+		return normalizeLinkDomain(address[index+1:])
+	}
+
+	return normalizeLinkDomain(parsed.Hostname())
+}
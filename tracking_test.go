@@ -0,0 +1,153 @@
+package letters_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mnako/letters"
+)
+
+func TestFindTrackingPixels(t *testing.T) {
+	t.Parallel()
+
+	body := "<p>Hi<img src=\"https://example.com/logo.png\" width=\"120\" " +
+		"height=\"40\"></p>" +
+		"<img src=\"https://t.example.com/o.gif\" width=\"1\" height=\"1\">" +
+		"<img src=\"https://t.example.com/z.gif\" style=\"width:0px\">" +
+		"<div style=\"display: none\">" +
+		"<img src=\"https://t.example.com/h.gif\"></div>" +
+		"<img src=\"https://t.example.com/s.gif\" style=\"opacity: 0.0\">" +
+		"<img src=\"https://us1.list-manage.com/track/open.php?u=1&id=2\">" +
+		"<img src=\"cid:logo@example.com\" width=\"1\" height=\"1\">"
+
+	pixels, err := letters.FindTrackingPixels(body)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []letters.TrackingPixel{
+		{
+			URL:     "https://t.example.com/o.gif",
+			Domain:  "t.example.com",
+			Tracker: "",
+			Reasons: []letters.TrackingPixelReason{
+				letters.TrackingPixelTiny,
+			},
+		},
+		{
+			URL:     "https://t.example.com/z.gif",
+			Domain:  "t.example.com",
+			Tracker: "",
+			Reasons: []letters.TrackingPixelReason{
+				letters.TrackingPixelTiny,
+			},
+		},
+		{
+			URL:     "https://t.example.com/h.gif",
+			Domain:  "t.example.com",
+			Tracker: "",
+			Reasons: []letters.TrackingPixelReason{
+				letters.TrackingPixelHidden,
+			},
+		},
+		{
+			URL:     "https://t.example.com/s.gif",
+			Domain:  "t.example.com",
+			Tracker: "",
+			Reasons: []letters.TrackingPixelReason{
+				letters.TrackingPixelHidden,
+			},
+		},
+		{
+			URL:     "https://us1.list-manage.com/track/open.php?u=1&id=2",
+			Domain:  "us1.list-manage.com",
+			Tracker: "Mailchimp",
+			Reasons: []letters.TrackingPixelReason{
+				letters.TrackingPixelKnownTracker,
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(pixels, expected) {
+		t.Errorf("unexpected tracking pixels:\n%#v", pixels)
+	}
+}
+
+func TestDetectServiceProviders(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		headers  string
+		expected []string
+	}{
+		{
+			name: "SendGrid",
+			headers: "Return-Path: <bounces+123-abc=example.com@" +
+				"em1234.example.org>\r\n" +
+				"X-SG-EID: abcdef\r\n",
+			expected: []string{"SendGrid"},
+		},
+		{
+			name: "Mailchimp through Mandrill",
+			headers: "Return-Path: <bounce-mc.us1_1.2-alice=example.com@" +
+				"mail123.atl11.mcdlv.net>\r\n" +
+				"X-Mailer: MailChimp Mailer - **CID1234**\r\n" +
+				"X-Mandrill-User: md_1234\r\n" +
+				"Feedback-ID: 1234:1234.5678:us1:mc\r\n" +
+				"List-Unsubscribe: <https://example.us1.list-manage.com/" +
+				"unsubscribe?u=1&id=2>, <mailto:unsubscribe-mc.us1_1@" +
+				"unsubscribe.mailchimpapp.net>\r\n",
+			expected: []string{"Mailchimp", "Mandrill"},
+		},
+		{
+			name: "Amazon SES",
+			headers: "Message-ID: <0100018c-abcd@email.amazonses.com>\r\n" +
+				"Feedback-ID: 1.us-east-1.abcdef=:AmazonSES\r\n" +
+				"X-SES-Outgoing: 2024.01.01-54.240.8.1\r\n",
+			expected: []string{"Amazon SES"},
+		},
+		{
+			name: "no provider",
+			headers: "Message-ID: <1234@mail.example.com>\r\n" +
+				"X-Mailer: Apple Mail (2.3696.120.41.1.1)\r\n",
+			expected: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			email, err := letters.ParseEmail(strings.NewReader(
+				"From: Alice <alice@example.com>\r\n" +
+					testCase.headers +
+					"Content-Type: text/plain\r\n" +
+					"\r\n" +
+					"Hello\r\n",
+			))
+			if err != nil {
+				t.Fatalf("cannot parse email: %s", err)
+			}
+
+			analysis, err := email.AnalyzeTracking()
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			var names []string
+			for _, provider := range analysis.ServiceProviders {
+				names = append(names, provider.Name)
+			}
+
+			if !reflect.DeepEqual(names, testCase.expected) {
+				t.Errorf(
+					"unexpected providers: %#v",
+					analysis.ServiceProviders,
+				)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package letters
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime/quotedprintable"
+)
+
+// ContentTransferDecoder decodes content encoded with a
+// Content-Transfer-Encoding.
+type ContentTransferDecoder func(data []byte) ([]byte, error)
+
+// ContentTransferDecoders maps Content-Transfer-Encodings to their decoders.
+type ContentTransferDecoders map[ContentTransferEncoding]ContentTransferDecoder
+
+// UnknownEncodingPolicy decides how the parser handles a part with a
+// Content-Transfer-Encoding that it has no decoder for.
+type UnknownEncodingPolicy string
+
+// Policies for unknown Content-Transfer-Encodings.
+const (
+	// UnknownEncodingError fails the parse with an error wrapping
+	// ErrUnknownContentTransferEncoding. It is the default policy.
+	UnknownEncodingError UnknownEncodingPolicy = "error"
+
+	// UnknownEncodingBinary reads the content as binary, without decoding.
+	UnknownEncodingBinary UnknownEncodingPolicy = "binary"
+
+	// UnknownEncodingWarn reads the content as binary and adds an error
+	// wrapping ErrUnknownContentTransferEncoding to Email.Warnings.
+	UnknownEncodingWarn UnknownEncodingPolicy = "warn"
+)
+
+// DefaultContentTransferDecoders returns the decoders of the encodings
+// that the parser supports by default: 7bit, 8bit, binary,
+// quoted-printable and base64, and the legacy x-uuencode, x-uue, uuencode,
+// x-yenc and x-binhex40 encodings.
+func DefaultContentTransferDecoders() ContentTransferDecoders {
+	decodeLegacy := func(cte ContentTransferEncoding) ContentTransferDecoder {
+		return func(data []byte) ([]byte, error) {
+			return decodeLegacyContent(data, cte)
+		}
+	}
+
+	return ContentTransferDecoders{
+		cte7bit:            decodeIdentity,
+		cte8bit:            decodeIdentity,
+		cteBinary:          decodeIdentity,
+		cteQuotedPrintable: decodeQuotedPrintable,
+		cteBase64:          decodeBase64,
+		cteXUUEncode:       decodeLegacy(cteXUUEncode),
+		cteXUUE:            decodeLegacy(cteXUUE),
+		cteUUEncode:        decodeLegacy(cteUUEncode),
+		cteXYEnc:           decodeLegacy(cteXYEnc),
+		cteXBinHex:         decodeLegacy(cteXBinHex),
+	}
+}
+
+// WithContentTransferDecoder registers a decoder for a
+// Content-Transfer-Encoding label, such as x-gzip64 or a vendor-specific
+// one. Labels are case-insensitive and the decoder replaces any default
+// decoder of the label.
+func WithContentTransferDecoder(
+	label string,
+	decoder ContentTransferDecoder,
+) EmailParserOption {
+	return func(ep *EmailParser) {
+		encoding := ContentTransferEncoding(
+			normalizeParametrizedAttributeValue(label),
+		)
+		ep.transferDecoders[encoding] = decoder
+	}
+}
+
+// WithUnknownEncodingPolicy configures how the parser handles parts with a
+// Content-Transfer-Encoding that has no decoder.
+func WithUnknownEncodingPolicy(policy UnknownEncodingPolicy) EmailParserOption {
+	return func(ep *EmailParser) {
+		ep.unknownEncodingPolicy = policy
+	}
+}
+
+// contentTransferDecoder returns the decoder of a Content-Transfer-Encoding
+// header, applying the unknown encoding policy to labels that have none.
+func (ep *EmailParser) contentTransferDecoder(
+	header string,
+	warnings *[]error,
+) (ContentTransferDecoder, error) {
+	label := normalizeParametrizedAttributeValue(header)
+	if label == "" {
+		label = string(cte7bit)
+	}
+
+	decoder, ok := ep.transferDecoders[ContentTransferEncoding(label)]
+	if ok {
+		return decoder, nil
+	}
+
+	err := fmt.Errorf("%w %q", ErrUnknownContentTransferEncoding, label)
+
+	switch ep.unknownEncodingPolicy {
+	case UnknownEncodingBinary:
+		return decodeIdentity, nil
+	case UnknownEncodingWarn:
+		*warnings = append(*warnings, err)
+
+		return decodeIdentity, nil
+	case UnknownEncodingError:
+		return nil, err
+	default:
+		return nil, err
+	}
+}
+
+func decodeIdentity(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+func decodeBase64(data []byte) ([]byte, error) {
+	decoded, err := io.ReadAll(
+		base64.NewDecoder(base64.StdEncoding, bytes.NewReader(data)),
+	)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		decoded, err = io.ReadAll(
+			base64.NewDecoder(base64.RawStdEncoding, bytes.NewReader(data)),
+		)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"letters.transferencoding.decodeBase64: "+
+					"cannot decode raw-std-base64-encoded content: %w",
+				err,
+			)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf(
+			"letters.transferencoding.decodeBase64: "+
+				"cannot decode std-base64-encoded content: %w",
+			err,
+		)
+	}
+
+	return decoded, nil
+}
+
+func decodeQuotedPrintable(data []byte) ([]byte, error) {
+	decoded, err := io.ReadAll(
+		quotedprintable.NewReader(bytes.NewReader(data)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"letters.transferencoding.decodeQuotedPrintable: "+
+				"cannot decode quoted-printable-encoded content: %w",
+			err,
+		)
+	}
+
+	return decoded, nil
+}
@@ -0,0 +1,174 @@
+package letters_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/mnako/letters"
+)
+
+func decodeGzip64(data []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(
+		base64.NewDecoder(base64.StdEncoding, bytes.NewReader(data)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read gzip64: %w", err)
+	}
+
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read gzip64: %w", err)
+	}
+
+	return decoded, nil
+}
+
+func transferEncodingTestEmail(t *testing.T, encoding string) string {
+	t.Helper()
+
+	var compressed bytes.Buffer
+
+	writer := gzip.NewWriter(&compressed)
+
+	_, err := writer.Write([]byte("Compressed report"))
+	if err != nil {
+		t.Fatalf("cannot compress: %s", err)
+	}
+
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("cannot compress: %s", err)
+	}
+
+	return "From: Alice <alice@example.com>\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"See the report.\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"Content-Disposition: attachment; filename=report.txt\r\n" +
+		"Content-Transfer-Encoding: " + encoding + "\r\n" +
+		"\r\n" +
+		base64.StdEncoding.EncodeToString(compressed.Bytes()) + "\r\n" +
+		"--b--\r\n"
+}
+
+func TestParseWithContentTransferDecoder(t *testing.T) {
+	t.Parallel()
+
+	email, err := letters.NewEmailParser(
+		letters.WithContentTransferDecoder("X-GZIP64", decodeGzip64),
+	).Parse(strings.NewReader(transferEncodingTestEmail(t, "x-gzip64")))
+	if err != nil {
+		t.Fatalf("cannot parse email: %s", err)
+	}
+
+	if len(email.AttachedFiles) != 1 ||
+		string(email.AttachedFiles[0].Data) != "Compressed report" ||
+		len(email.Warnings) != 0 {
+		t.Errorf("unexpected email: %#v", email)
+	}
+}
+
+func TestParseWithUnknownEncodingPolicy(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name             string
+		options          []letters.EmailParserOption
+		expectedErr      error
+		expectedWarnings int
+	}{
+		{
+			name:             "default",
+			options:          nil,
+			expectedErr:      letters.ErrUnknownContentTransferEncoding,
+			expectedWarnings: 0,
+		},
+		{
+			name: "error",
+			options: []letters.EmailParserOption{
+				letters.WithUnknownEncodingPolicy(
+					letters.UnknownEncodingError,
+				),
+			},
+			expectedErr:      letters.ErrUnknownContentTransferEncoding,
+			expectedWarnings: 0,
+		},
+		{
+			name: "binary",
+			options: []letters.EmailParserOption{
+				letters.WithUnknownEncodingPolicy(
+					letters.UnknownEncodingBinary,
+				),
+			},
+			expectedErr:      nil,
+			expectedWarnings: 0,
+		},
+		{
+			name: "warn",
+			options: []letters.EmailParserOption{
+				letters.WithUnknownEncodingPolicy(
+					letters.UnknownEncodingWarn,
+				),
+			},
+			expectedErr:      nil,
+			expectedWarnings: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			message := transferEncodingTestEmail(t, "x-gzip64")
+
+			email, err := letters.NewEmailParser(
+				testCase.options...,
+			).Parse(strings.NewReader(message))
+			if !errors.Is(err, testCase.expectedErr) {
+				t.Fatalf(
+					"expected error %v, got %v",
+					testCase.expectedErr,
+					err,
+				)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if len(email.AttachedFiles) != 1 ||
+				!strings.HasPrefix(
+					string(email.AttachedFiles[0].Data),
+					"H4sI",
+				) {
+				t.Errorf("expected undecoded file: %#v", email.AttachedFiles)
+			}
+
+			if len(email.Warnings) != testCase.expectedWarnings {
+				t.Fatalf("unexpected warnings: %v", email.Warnings)
+			}
+
+			for _, warning := range email.Warnings {
+				if !errors.Is(
+					warning,
+					letters.ErrUnknownContentTransferEncoding,
+				) {
+					t.Errorf("unexpected warning: %v", warning)
+				}
+			}
+		})
+	}
+}
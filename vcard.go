@@ -0,0 +1,377 @@
+package letters
+
+import (
+	"fmt"
+	"io"
+	"mime/quotedprintable"
+	"path"
+	"slices"
+	"strings"
+)
+
+const (
+	vCardTypeParam       = "TYPE"
+	vCardPreferredType   = "pref"
+	vCardQuotedPrintable = "QUOTED-PRINTABLE"
+	vCardTelPrefix       = "tel:"
+	vCardNameFields      = 5
+	vCardAddressFields   = 7
+	vCardOrgFields       = 2
+)
+
+// Contact is a contact parsed from a vCard, see RFC 6350, or extracted from
+// the signature block of an email.
+type Contact struct {
+	// Version is the vCard version, 2.1, 3.0 or 4.0. It is empty for
+	// contacts extracted from signatures.
+	Version string
+
+	UID           string
+	FormattedName string
+	Name          ContactName
+	Nickname      string
+
+	// Organization and Department are the first two components of the ORG
+	// property.
+	Organization string
+	Department   string
+
+	Title string
+	Role  string
+
+	Emails    []ContactValue
+	Phones    []ContactValue
+	Addresses []ContactAddress
+	URLs      []ContactValue
+
+	// Birthday is the BDAY property as written in the vCard, such as
+	// 1985-04-12 or 19850412.
+	Birthday string
+
+	Note string
+}
+
+// ContactName is the structured name of a contact.
+type ContactName struct {
+	FamilyName      string
+	GivenName       string
+	AdditionalNames string
+	Prefixes        string
+	Suffixes        string
+}
+
+// ContactValue is an email address, phone number or URL of a contact.
+type ContactValue struct {
+	Value string
+
+	// Types are the lowercase types of the value, such as work, home, cell,
+	// voice or fax.
+	Types []string
+
+	// Preferred reports whether the contact prefers the value over others
+	// of the same kind.
+	Preferred bool
+}
+
+// ContactAddress is a postal address of a contact.
+type ContactAddress struct {
+	Types     []string
+	Preferred bool
+
+	POBox      string
+	Extended   string
+	Street     string
+	Locality   string
+	Region     string
+	PostalCode string
+	Country    string
+}
+
+// WithVCardParsing makes the parser parse the vCard files among the
+// attached and inline files into Email.Contacts. The files are kept, and
+// files that cannot be parsed are reported in Email.Warnings.
+func WithVCardParsing() EmailParserOption {
+	return func(ep *EmailParser) {
+		ep.parseVCards = true
+	}
+}
+
+// IsVCard reports whether the attached file is a vCard file: a text/vcard
+// or text/x-vcard file or a file with a .vcf or .vcard extension.
+func (f AttachedFile) IsVCard() bool {
+	return isVCardFile(f.ContentType, f.Filename())
+}
+
+// IsVCard reports whether the inline file is a vCard file.
+func (f InlineFile) IsVCard() bool {
+	return isVCardFile(f.ContentType, f.Filename())
+}
+
+// ParseVCards parses the attached file with ParseVCards, decoding it from
+// the charset of its Content-Type.
+func (f AttachedFile) ParseVCards() ([]Contact, error) {
+	return ParseVCards(
+		decodeCharsetBytes(f.Data, f.ContentType.Params["charset"]),
+	)
+}
+
+// ParseVCards parses the inline file with ParseVCards.
+func (f InlineFile) ParseVCards() ([]Contact, error) {
+	return ParseVCards(
+		decodeCharsetBytes(f.Data, f.ContentType.Params["charset"]),
+	)
+}
+
+func isVCardFile(contentType ContentTypeHeader, filename Filename) bool {
+	switch strings.ToLower(contentType.ContentType) {
+	case "text/vcard", "text/x-vcard":
+		return true
+	default:
+		extension := strings.ToLower(path.Ext(filename.Sanitized))
+
+		return extension == ".vcf" || extension == ".vcard"
+	}
+}
+
+func (ep *EmailParser) parseVCardFiles(email *Email) {
+	add := func(contacts []Contact, err error) {
+		if err != nil {
+			email.Warnings = append(email.Warnings, err)
+
+			return
+		}
+
+		email.Contacts = append(email.Contacts, contacts...)
+	}
+
+	for _, file := range email.InlineFiles {
+		if file.IsVCard() {
+			add(file.ParseVCards())
+		}
+	}
+
+	for _, file := range email.AttachedFiles {
+		if file.IsVCard() {
+			add(file.ParseVCards())
+		}
+	}
+}
+
+// ParseVCards parses the contacts of vCard data, in versions 2.1, 3.0 and
+// 4.0, including quoted-printable values and the charsets of vCard 2.1. It
+// returns an error wrapping ErrInvalidVCard when the text is not a list of
+// vCards.
+func ParseVCards(text string) ([]Contact, error) {
+	components, err := parseContentComponents(text, ErrInvalidVCard)
+	if err != nil {
+		return nil, fmt.Errorf("letters.vcard.ParseVCards: %w", err)
+	}
+
+	if len(components) == 0 {
+		return nil, fmt.Errorf(
+			"letters.vcard.ParseVCards: %w: no VCARD",
+			ErrInvalidVCard,
+		)
+	}
+
+	contacts := make([]Contact, 0, len(components))
+
+	for _, component := range components {
+		if component.name != "VCARD" {
+			return contacts, fmt.Errorf(
+				"letters.vcard.ParseVCards: %w: unexpected %s component",
+				ErrInvalidVCard,
+				component.name,
+			)
+		}
+
+		contacts = append(contacts, parseVCard(component))
+	}
+
+	return contacts, nil
+}
+
+func parseVCard(component *calendarComponent) Contact {
+	var contact Contact
+
+	for _, property := range component.properties {
+		// Properties may be grouped, as in item1.EMAIL.
+		name := property.name
+		if dot := strings.LastIndexByte(name, '.'); dot >= 0 {
+			name = name[dot+1:]
+		}
+
+		value := vCardValue(property)
+
+		switch name {
+		case "VERSION":
+			contact.Version = value
+		case "UID":
+			contact.UID = value
+		case "FN":
+			contact.FormattedName = unescapeCalendarText(value)
+		case "N":
+			fields := vCardFields(value, vCardNameFields)
+			contact.Name = ContactName{
+				FamilyName:      fields[0],
+				GivenName:       fields[1],
+				AdditionalNames: fields[2],
+				Prefixes:        fields[3],
+				Suffixes:        fields[4],
+			}
+		case "NICKNAME":
+			contact.Nickname = unescapeCalendarText(value)
+		case "ORG":
+			fields := vCardFields(value, vCardOrgFields)
+			contact.Organization = fields[0]
+			contact.Department = fields[1]
+		case "TITLE":
+			contact.Title = unescapeCalendarText(value)
+		case "ROLE":
+			contact.Role = unescapeCalendarText(value)
+		case "EMAIL":
+			contact.Emails = append(
+				contact.Emails,
+				newContactValue(property, trimMailto(value)),
+			)
+		case "TEL":
+			if strings.HasPrefix(strings.ToLower(value), vCardTelPrefix) {
+				value = value[len(vCardTelPrefix):]
+			}
+
+			contact.Phones = append(
+				contact.Phones,
+				newContactValue(property, value),
+			)
+		case "ADR":
+			types, preferred := vCardTypes(property)
+			fields := vCardFields(value, vCardAddressFields)
+
+			contact.Addresses = append(contact.Addresses, ContactAddress{
+				Types:      types,
+				Preferred:  preferred,
+				POBox:      fields[0],
+				Extended:   fields[1],
+				Street:     fields[2],
+				Locality:   fields[3],
+				Region:     fields[4],
+				PostalCode: fields[5],
+				Country:    fields[6],
+			})
+		case "URL":
+			contact.URLs = append(
+				contact.URLs,
+				newContactValue(property, value),
+			)
+		case "BDAY":
+			contact.Birthday = value
+		case "NOTE":
+			contact.Note = unescapeCalendarText(value)
+		default:
+		}
+	}
+
+	return contact
+}
+
+// vCardValue returns the value of a property, decoded from quoted-printable
+// and from its charset.
+func vCardValue(property calendarProperty) string {
+	isQuotedPrintable := func(encoding string) bool {
+		return strings.EqualFold(encoding, vCardQuotedPrintable)
+	}
+
+	// vCard 2.1 allows the encoding without a parameter name.
+	if !isQuotedPrintable(property.param("ENCODING")) &&
+		!slices.ContainsFunc(
+			property.params[vCardTypeParam],
+			isQuotedPrintable,
+		) {
+		return property.value
+	}
+
+	decoded, err := io.ReadAll(
+		quotedprintable.NewReader(strings.NewReader(property.value)),
+	)
+	if err != nil {
+		return property.value
+	}
+
+	return decodeCharsetBytes(decoded, property.param("CHARSET"))
+}
+
+// vCardTypes returns the lowercase types of a property and whether it is
+// preferred, either by the pref type or by a PREF parameter.
+func vCardTypes(property calendarProperty) ([]string, bool) {
+	var types []string
+
+	preferred := property.param("PREF") != ""
+
+	for _, param := range property.params[vCardTypeParam] {
+		for _, t := range strings.Split(strings.ToLower(param), ",") {
+			t = strings.TrimSpace(t)
+
+			switch t {
+			case "":
+			case vCardPreferredType:
+				preferred = true
+			case "quoted-printable", "base64", "b", "8bit", "7bit":
+			default:
+				if !slices.Contains(types, t) {
+					types = append(types, t)
+				}
+			}
+		}
+	}
+
+	return types, preferred
+}
+
+func newContactValue(property calendarProperty, value string) ContactValue {
+	types, preferred := vCardTypes(property)
+
+	return ContactValue{
+		Value:     strings.TrimSpace(unescapeCalendarText(value)),
+		Types:     types,
+		Preferred: preferred,
+	}
+}
+
+func trimMailto(value string) string {
+	if strings.HasPrefix(strings.ToLower(value), calendarMailtoPrefix) {
+		return value[len(calendarMailtoPrefix):]
+	}
+
+	return value
+}
+
+// vCardFields splits a structured value, such as N, ORG or ADR, at its
+// unescaped semicolons into count unescaped fields.
+func vCardFields(value string, count int) []string {
+	fields := make([]string, 0, count)
+
+	start := 0
+
+	for i := 0; i < len(value) && len(fields) < count-1; i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case ';':
+			fields = append(fields, value[start:i])
+			start = i + 1
+		default:
+		}
+	}
+
+	fields = append(fields, value[start:])
+
+	for i, field := range fields {
+		fields[i] = strings.TrimSpace(unescapeCalendarText(field))
+	}
+
+	for len(fields) < count {
+		fields = append(fields, "")
+	}
+
+	return fields
+}
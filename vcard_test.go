@@ -0,0 +1,303 @@
+package letters_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mnako/letters"
+)
+
+func TestParseVCards(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		text     string
+		expected letters.Contact
+	}{
+		{
+			name: "vCard 2.1",
+			text: "BEGIN:VCARD\r\n" +
+				"VERSION:2.1\r\n" +
+				"N;CHARSET=ISO-8859-1;ENCODING=QUOTED-PRINTABLE:" +
+				"M=FCller;J=FCrgen\r\n" +
+				"FN;CHARSET=ISO-8859-1;QUOTED-PRINTABLE:J=FCrgen M=FCller\r\n" +
+				"ORG:Example GmbH;Sales\r\n" +
+				"TITLE:Head of Sales\r\n" +
+				"TEL;WORK;VOICE:+49 30 1234567\r\n" +
+				"TEL;CELL:+49 170 1234567\r\n" +
+				"EMAIL;PREF;INTERNET:juergen@example.com\r\n" +
+				"ADR;WORK;CHARSET=ISO-8859-1;ENCODING=QUOTED-PRINTABLE:" +
+				";;Hauptstra=DFe 1;Berlin;;10115;Germany\r\n" +
+				"NOTE;ENCODING=QUOTED-PRINTABLE:First line=0D=0A=\r\n" +
+				"second line\r\n" +
+				"END:VCARD\r\n",
+			expected: letters.Contact{
+				Version:       "2.1",
+				UID:           "",
+				FormattedName: "Jürgen Müller",
+				Name: letters.ContactName{
+					FamilyName:      "Müller",
+					GivenName:       "Jürgen",
+					AdditionalNames: "",
+					Prefixes:        "",
+					Suffixes:        "",
+				},
+				Nickname:     "",
+				Organization: "Example GmbH",
+				Department:   "Sales",
+				Title:        "Head of Sales",
+				Role:         "",
+				Emails: []letters.ContactValue{
+					{
+						Value:     "juergen@example.com",
+						Types:     []string{"internet"},
+						Preferred: true,
+					},
+				},
+				Phones: []letters.ContactValue{
+					{
+						Value:     "+49 30 1234567",
+						Types:     []string{"work", "voice"},
+						Preferred: false,
+					},
+					{
+						Value:     "+49 170 1234567",
+						Types:     []string{"cell"},
+						Preferred: false,
+					},
+				},
+				Addresses: []letters.ContactAddress{
+					{
+						Types:      []string{"work"},
+						Preferred:  false,
+						POBox:      "",
+						Extended:   "",
+						Street:     "Hauptstraße 1",
+						Locality:   "Berlin",
+						Region:     "",
+						PostalCode: "10115",
+						Country:    "Germany",
+					},
+				},
+				URLs:     nil,
+				Birthday: "",
+				Note:     "First line\r\nsecond line",
+			},
+		},
+		{
+			name: "vCard 3.0",
+			text: "BEGIN:VCARD\r\n" +
+				"VERSION:3.0\r\n" +
+				"UID:urn:uuid:4fbe8971-0bc3-424c-9c26-36c3e1eff6b1\r\n" +
+				"FN:Alice Example\r\n" +
+				"N:Example;Alice;;Dr.;\r\n" +
+				"NICKNAME:Al\r\n" +
+				"item1.EMAIL;TYPE=INTERNET,WORK,pref:alice@example.com\r\n" +
+				"TEL;TYPE=cell:+1 555 0100\r\n" +
+				"URL:https://example.com\r\n" +
+				"NOTE:Likes\\, commas\\nand\r\n" +
+				"  folded lines\r\n" +
+				"BDAY:1985-04-12\r\n" +
+				"END:VCARD\r\n",
+			expected: letters.Contact{
+				Version:       "3.0",
+				UID:           "urn:uuid:4fbe8971-0bc3-424c-9c26-36c3e1eff6b1",
+				FormattedName: "Alice Example",
+				Name: letters.ContactName{
+					FamilyName:      "Example",
+					GivenName:       "Alice",
+					AdditionalNames: "",
+					Prefixes:        "Dr.",
+					Suffixes:        "",
+				},
+				Nickname:     "Al",
+				Organization: "",
+				Department:   "",
+				Title:        "",
+				Role:         "",
+				Emails: []letters.ContactValue{
+					{
+						Value:     "alice@example.com",
+						Types:     []string{"internet", "work"},
+						Preferred: true,
+					},
+				},
+				Phones: []letters.ContactValue{
+					{
+						Value:     "+1 555 0100",
+						Types:     []string{"cell"},
+						Preferred: false,
+					},
+				},
+				Addresses: nil,
+				URLs: []letters.ContactValue{
+					{
+						Value:     "https://example.com",
+						Types:     nil,
+						Preferred: false,
+					},
+				},
+				Birthday: "1985-04-12",
+				Note:     "Likes, commas\nand folded lines",
+			},
+		},
+		{
+			name: "vCard 4.0",
+			text: "BEGIN:VCARD\n" +
+				"VERSION:4.0\n" +
+				"FN:Bob\n" +
+				"TEL;VALUE=uri;TYPE=\"voice,home\";PREF=1:tel:+1-555-0101\n" +
+				"EMAIL:mailto:bob@example.com\n" +
+				"ORG:Bob\\; Co\n" +
+				"ROLE:Owner\n" +
+				"END:VCARD\n",
+			expected: letters.Contact{
+				Version:       "4.0",
+				UID:           "",
+				FormattedName: "Bob",
+				Name: letters.ContactName{
+					FamilyName:      "",
+					GivenName:       "",
+					AdditionalNames: "",
+					Prefixes:        "",
+					Suffixes:        "",
+				},
+				Nickname:     "",
+				Organization: "Bob; Co",
+				Department:   "",
+				Title:        "",
+				Role:         "Owner",
+				Emails: []letters.ContactValue{
+					{
+						Value:     "bob@example.com",
+						Types:     nil,
+						Preferred: false,
+					},
+				},
+				Phones: []letters.ContactValue{
+					{
+						Value:     "+1-555-0101",
+						Types:     []string{"voice", "home"},
+						Preferred: true,
+					},
+				},
+				Addresses: nil,
+				URLs:      nil,
+				Birthday:  "",
+				Note:      "",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			contacts, err := letters.ParseVCards(testCase.text)
+			if err != nil {
+				t.Fatalf("cannot parse vCard: %s", err)
+			}
+
+			if len(contacts) != 1 {
+				t.Fatalf("expected one contact, got %#v", contacts)
+			}
+
+			if !reflect.DeepEqual(contacts[0], testCase.expected) {
+				t.Errorf(
+					"expected contact:\n%#v\ngot:\n%#v",
+					testCase.expected,
+					contacts[0],
+				)
+			}
+		})
+	}
+}
+
+func TestParseVCardsErrors(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		text string
+	}{
+		{
+			name: "empty",
+			text: "",
+		},
+		{
+			name: "calendar",
+			text: "BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n",
+		},
+		{
+			name: "unterminated",
+			text: "BEGIN:VCARD\r\nFN:Alice\r\n",
+		},
+		{
+			name: "invalid content line",
+			text: "BEGIN:VCARD\r\nFN\r\nEND:VCARD\r\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		testCase := tc
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := letters.ParseVCards(testCase.text)
+			if !errors.Is(err, letters.ErrInvalidVCard) {
+				t.Errorf("expected ErrInvalidVCard, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseWithVCardParsing(t *testing.T) {
+	t.Parallel()
+
+	message := "From: Alice <alice@example.com>\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"My contacts.\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/x-vcard; charset=utf-8\r\n" +
+		"Content-Disposition: attachment; filename=contacts.vcf\r\n" +
+		"\r\n" +
+		"BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Alice\r\nEND:VCARD\r\n" +
+		"BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Bob\r\nEND:VCARD\r\n" +
+		"--b\r\n" +
+		"Content-Type: application/octet-stream\r\n" +
+		"Content-Disposition: attachment; filename=broken.vcf\r\n" +
+		"\r\n" +
+		"BEGIN:VCARD\r\n" +
+		"--b--\r\n"
+
+	email, err := letters.NewEmailParser(
+		letters.WithVCardParsing(),
+	).Parse(strings.NewReader(message))
+	if err != nil {
+		t.Fatalf("cannot parse email: %s", err)
+	}
+
+	if len(email.Contacts) != 2 ||
+		email.Contacts[0].FormattedName != "Alice" ||
+		email.Contacts[1].FormattedName != "Bob" {
+		t.Errorf("unexpected contacts: %#v", email.Contacts)
+	}
+
+	if len(email.AttachedFiles) != 2 {
+		t.Errorf("expected vCard files to be kept: %#v", email.AttachedFiles)
+	}
+
+	if len(email.Warnings) != 1 ||
+		!errors.Is(email.Warnings[0], letters.ErrInvalidVCard) {
+		t.Errorf("unexpected warnings: %v", email.Warnings)
+	}
+}